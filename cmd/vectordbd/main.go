@@ -30,12 +30,104 @@ func main() {
 
 	logger.Info("Starting VectraDB", "version", version)
 
+	routeLogLevels, err := middleware.ParseRouteLogLevels(cfg.Logging.RouteLevels)
+	if err != nil {
+		logger.WithError(err).Warn("Ignoring invalid route log levels")
+	}
+
 	// Initialize store
 	storeConfig := store.Config{
 		DBPath:    cfg.Database.Path,
 		Timeout:   cfg.Database.Timeout,
-		MaxConns:  100,
 		BatchSize: 1000,
+
+		CursorSecret: cfg.Database.CursorSecret,
+		CursorTTL:    cfg.Database.CursorTTL,
+
+		SoftDelete:          cfg.Database.SoftDelete,
+		CompactionThreshold: cfg.Database.CompactionThreshold,
+		StrictLoad:          cfg.Database.StrictLoad,
+		ManualMigration:     !cfg.Database.AutoMigrate,
+		ReadThrough:         cfg.Database.ReadThrough,
+		Precision:           cfg.Database.Precision,
+		SparseThreshold:     cfg.Database.SparseThreshold,
+
+		Quantization: cfg.Database.Quantization,
+		PQSubspaces:  cfg.Database.PQSubspaces,
+		PQTrainSize:  cfg.Database.PQTrainSize,
+		PQRescore:    cfg.Database.PQRescore,
+		PQCacheSize:  cfg.Database.PQCacheSize,
+
+		IndexType:      cfg.Database.IndexType,
+		IndexThreshold: cfg.Database.IndexThreshold,
+		IndexAlgorithm: cfg.Database.IndexAlgorithm,
+		IndexEfSearch:  cfg.Database.IndexEfSearch,
+		IndexProbes:    cfg.Database.IndexProbes,
+
+		IndexFallback:         cfg.Database.IndexFallback,
+		IndexFallbackMinScore: cfg.Database.IndexFallbackMinScore,
+
+		CollectionKey: cfg.Database.CollectionKey,
+
+		AccessStats:         cfg.Database.AccessStats,
+		AccessFlushInterval: cfg.Database.AccessFlushInterval,
+
+		EventFlushInterval: cfg.Analytics.FlushInterval,
+		EventRetention:     cfg.Analytics.Retention,
+
+		DefragInterval:     cfg.Database.DefragInterval,
+		DefragWindow:       cfg.Database.DefragWindow,
+		DefragMinFreeRatio: cfg.Database.DefragMinFreeRatio,
+
+		KeywordMaxPostings: cfg.Database.KeywordMaxPostings,
+		KeywordCountEmpty:  cfg.Database.KeywordCountEmpty,
+
+		LogRequestIDs: cfg.Logging.RequestIDs,
+
+		BuiltinHooks: cfg.Database.InsertHooks,
+
+		DocumentRetention:     cfg.Database.DocumentRetention,
+		DocumentSweepInterval: cfg.Database.DocumentSweepInterval,
+
+		SkipZeroVectors:  cfg.Search.SkipZeroVectors,
+		MaxCandidates:    cfg.Search.MaxCandidates,
+		MaxRadiusResults: cfg.Search.MaxRadiusResults,
+		MaxSearchGroups:  cfg.Search.MaxGroups,
+		NegativeWeight:   cfg.Search.NegativeWeight,
+		SnapshotMaxAge:   cfg.Search.SnapshotMaxAge,
+		SearchCacheSize:  cfg.Search.CacheSize,
+		SearchCacheTTL:   cfg.Search.CacheTTL,
+		SearchCacheWarm:  cfg.Search.CacheWarm,
+		VectorPooling:    cfg.Search.VectorPooling,
+
+		Calibration:         cfg.Search.Calibration,
+		CalibrationSlope:    cfg.Search.CalibrationSlope,
+		CalibrationMidpoint: cfg.Search.CalibrationMidpoint,
+
+		ClusterCount:    cfg.Search.ClusterCount,
+		ClusterLabelKey: cfg.Search.ClusterLabelKey,
+
+		MaxAdhocVectors: cfg.Search.MaxAdhocVectors,
+
+		OnDimensionMismatch: cfg.Search.OnDimensionMismatch,
+
+		RequireWeights: cfg.Search.RequireWeights,
+
+		MaxQueryTerms: cfg.Search.MaxQueryTerms,
+		OnLongQuery:   cfg.Search.OnLongQuery,
+
+		FuzzyMinSimilarity:  cfg.Search.FuzzyMinSimilarity,
+		FuzzyMaxComparisons: cfg.Search.FuzzyMaxComparisons,
+
+		ValidateIDs: cfg.Database.ValidateIDs,
+		IDPattern:   cfg.Database.IDPattern,
+
+		MaxMetadataEntries:     cfg.Database.MaxMetadataEntries,
+		MaxMetadataKeyLength:   cfg.Database.MaxMetadataKeyLength,
+		MaxMetadataValueLength: cfg.Database.MaxMetadataValueLength,
+
+		NormalizeMetadata:        cfg.Database.NormalizeMetadata,
+		PreserveOriginalMetadata: cfg.Database.PreserveOriginalMetadata,
 	}
 
 	store, err := store.NewBoltStore(storeConfig)
@@ -45,7 +137,7 @@ func main() {
 	defer store.Close()
 
 	// Initialize handler
-	handler := api.NewHandler(store)
+	handler := api.NewHandler(store, cfg)
 
 	// Setup router
 	r := chi.NewRouter()
@@ -53,7 +145,7 @@ func main() {
 	// Add middleware
 	r.Use(middleware.RequestIDMiddleware())
 	r.Use(middleware.RealIPMiddleware())
-	r.Use(middleware.LoggingMiddleware())
+	r.Use(middleware.LoggingMiddleware(routeLogLevels))
 	r.Use(middleware.RecoveryMiddleware())
 	r.Use(middleware.CORSMiddleware())
 	r.Use(middleware.CompressMiddleware())
@@ -69,6 +161,13 @@ func main() {
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
+	if cfg.Search.Stream {
+		// Streamed search results need HTTP/2, accept it without TLS too
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
 
 	// Start server in a goroutine
 	go func() {
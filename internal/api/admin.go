@@ -0,0 +1,566 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/config"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/internal/utils"
+	"vectraDB/pkg/errors"
+	"vectraDB/pkg/response"
+)
+
+type ReloadResult struct {
+	Changed []string `json:"changed"`
+	Ignored []string `json:"ignored"`
+}
+
+// Reload re-reads the configuration and applies the settings that can be
+// changed without a restart. Settings that need a restart are reported as
+// ignored.
+func (h *Handler) Reload(w http.ResponseWriter, r *http.Request) {
+	current := h.config.Load()
+	next := h.loadConfig()
+
+	result := ReloadResult{
+		Changed: []string{},
+		Ignored: []string{},
+	}
+
+	if next.Logging.Level != current.Logging.Level {
+		if err := logger.SetLevel(next.Logging.Level); err != nil {
+			response.Error(w, errors.Wrap(err, http.StatusBadRequest, "invalid log level"))
+			return
+		}
+		result.Changed = append(result.Changed, "log_level")
+	}
+
+	if next.Server.MaxConns != current.Server.MaxConns {
+		h.connLimiter.SetLimit(next.Server.MaxConns)
+		result.Changed = append(result.Changed, "max_conns")
+	}
+
+	if next.Server.RateLimit != current.Server.RateLimit {
+		h.rateLimiter.SetRate(next.Server.RateLimit)
+		result.Changed = append(result.Changed, "rate_limit")
+	}
+
+	if next.Server.StrictJSON != current.Server.StrictJSON {
+		result.Changed = append(result.Changed, "strict_json")
+	}
+
+	if next.Server.MaxDimension != current.Server.MaxDimension {
+		models.SetMaxDimension(next.Server.MaxDimension)
+		result.Changed = append(result.Changed, "max_vector_dimension")
+	}
+
+	if next.Server.MaxBodyBytes != current.Server.MaxBodyBytes {
+		result.Changed = append(result.Changed, "max_body_bytes")
+	}
+
+	if next.Server.AtomicBatchUpdates != current.Server.AtomicBatchUpdates {
+		result.Changed = append(result.Changed, "batch_atomic_updates")
+	}
+
+	if next.Server.UpsertOnPut != current.Server.UpsertOnPut {
+		result.Changed = append(result.Changed, "upsert_on_put")
+	}
+
+	if next.Server.IndexExportLimit != current.Server.IndexExportLimit {
+		result.Changed = append(result.Changed, "index_export_limit")
+	}
+
+	if next.Server.ResponseTimestamps != current.Server.ResponseTimestamps {
+		result.Changed = append(result.Changed, "response_timestamps")
+	}
+
+	if !reflect.DeepEqual(next.Debug, current.Debug) {
+		result.Changed = append(result.Changed, "debug")
+	}
+
+	if next.Analytics.Enabled != current.Analytics.Enabled || next.Analytics.Feedback != current.Analytics.Feedback {
+		result.Changed = append(result.Changed, "analytics")
+	}
+
+	if next.Search.MaxConcurrent != current.Search.MaxConcurrent {
+		h.searchLimiter.SetLimit(next.Search.MaxConcurrent)
+		result.Changed = append(result.Changed, "search_max_concurrent")
+	}
+
+	if next.Search.SlowQueryThreshold != current.Search.SlowQueryThreshold {
+		h.slowQuery.Store(int64(next.Search.SlowQueryThreshold))
+		result.Changed = append(result.Changed, "slow_query_threshold")
+	}
+
+	if next.Search.MaxResponseBytes != current.Search.MaxResponseBytes {
+		result.Changed = append(result.Changed, "search_max_response_bytes")
+	}
+
+	if next.Search.ProfileRate != current.Search.ProfileRate {
+		result.Changed = append(result.Changed, "search_profile_rate")
+	}
+
+	if next.Search.StreamFlushResults != current.Search.StreamFlushResults {
+		result.Changed = append(result.Changed, "search_stream_flush_results")
+	}
+
+	// Every other setting is only read at startup
+	result.Ignored = keepRestartOnly(current, next)
+	h.config.Store(next)
+
+	logger.WithFields(logrus.Fields{
+		"changed": result.Changed,
+		"ignored": result.Ignored,
+	}).Info("Configuration reloaded")
+
+	response.Success(w, result)
+}
+
+// reloadable names the settings, by section or by section and field, that
+// Reload applies.
+var reloadable = map[string]bool{
+	"Server.MaxConns":           true,
+	"Server.RateLimit":          true,
+	"Server.StrictJSON":         true,
+	"Server.MaxDimension":       true,
+	"Server.MaxBodyBytes":       true,
+	"Server.AtomicBatchUpdates": true,
+	"Server.UpsertOnPut":        true,
+	"Server.IndexExportLimit":   true,
+	"Server.ResponseTimestamps": true,
+	"Logging.Level":             true,
+	"Search.MaxConcurrent":      true,
+	"Search.SlowQueryThreshold": true,
+	"Search.MaxResponseBytes":   true,
+	"Search.ProfileRate":        true,
+	"Search.StreamFlushResults": true,
+	"Analytics.Enabled":         true,
+	"Analytics.Feedback":        true,
+	"Debug":                     true,
+}
+
+// settingPrefixes prefixes the names of restart-only settings by section,
+// so they read like their environment variables.
+var settingPrefixes = map[string]string{
+	"Database":  "db_",
+	"Logging":   "log_",
+	"Search":    "search_",
+	"Analytics": "analytics_",
+}
+
+// keepRestartOnly returns the names of the settings that differ between
+// current and next but aren't reloadable, and resets them in next so they
+// are reported again on the next reload until the service is restarted.
+func keepRestartOnly(current, next *config.Config) []string {
+	ignored := []string{}
+	cur := reflect.ValueOf(current).Elem()
+	nxt := reflect.ValueOf(next).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		section := cur.Type().Field(i).Name
+		if reloadable[section] {
+			continue
+		}
+		for j := 0; j < cur.Field(i).NumField(); j++ {
+			field := cur.Field(i).Type().Field(j).Name
+			if reloadable[section+"."+field] {
+				continue
+			}
+			was, now := cur.Field(i).Field(j), nxt.Field(i).Field(j)
+			if reflect.DeepEqual(was.Interface(), now.Interface()) {
+				continue
+			}
+			ignored = append(ignored, settingPrefixes[section]+snakeCase(field))
+			now.Set(was)
+		}
+	}
+	return ignored
+}
+
+// snakeCase converts a Go field name to snake case, keeping initialisms
+// such as ID or PQ together.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			// A lowercase letter after an initialism starts a new word,
+			// unless it pluralizes the initialism, as in IDs
+			startsWord := i+1 < len(runes) && unicode.IsLower(runes[i+1]) &&
+				!(i+2 == len(runes) && runes[i+1] == 's')
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && startsWord) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Compact removes tombstones left behind by soft deletes. With async=true
+// it runs as a background operation instead of within the request.
+func (h *Handler) Compact(w http.ResponseWriter, r *http.Request) {
+	async := false
+	if raw := r.URL.Query().Get("async"); raw != "" {
+		var err error
+		if async, err = strconv.ParseBool(raw); err != nil {
+			response.Error(w, errors.Wrap(err, http.StatusBadRequest, "invalid async"))
+			return
+		}
+	}
+
+	if !async {
+		reclaimed, err := h.store.Compact(r.Context(), nil)
+		if err != nil {
+			response.Error(w, err)
+			return
+		}
+
+		response.Success(w, map[string]int{
+			"reclaimed": reclaimed,
+		})
+		return
+	}
+
+	op := h.operations.Start("compact", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		reclaimed, err := h.store.Compact(ctx, progress)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{"reclaimed": reclaimed}, nil
+	})
+
+	response.Accepted(w, op)
+}
+
+// Defragment rewrites the database into a compact file, giving the space
+// freed by deletes back to the filesystem. It runs as a background
+// operation.
+func (h *Handler) Defragment(w http.ResponseWriter, r *http.Request) {
+	op := h.operations.Start("defragment", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		result, err := h.store.Defragment(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+
+	response.Accepted(w, op)
+}
+
+// FlushCache empties the search response cache.
+func (h *Handler) FlushCache(w http.ResponseWriter, r *http.Request) {
+	evicted, err := h.store.FlushSearchCache(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, map[string]int{
+		"evicted": evicted,
+	})
+}
+
+// FitClusters refits the topic clusters searches report, which otherwise
+// happens in the background once enough vectors have been written. It runs
+// as a background operation.
+func (h *Handler) FitClusters(w http.ResponseWriter, r *http.Request) {
+	op := h.operations.Start("fit_clusters", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		result, err := h.store.FitClusters(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+
+	response.Accepted(w, op)
+}
+
+// BuildIndex builds or rebuilds the search index, which otherwise happens in
+// the background past the index threshold and as vectors are written. It
+// runs as a background operation.
+func (h *Handler) BuildIndex(w http.ResponseWriter, r *http.Request) {
+	op := h.operations.Start("build_index", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		result, err := h.store.BuildIndex(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+
+	response.Accepted(w, op)
+}
+
+func (h *Handler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	op, err := h.operations.Get(urlParam(r, "id"))
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, op)
+}
+
+// CancelOperation cancels a running operation. The returned status may still
+// be running until the operation observes the cancellation.
+func (h *Handler) CancelOperation(w http.ResponseWriter, r *http.Request) {
+	id := urlParam(r, "id")
+	if err := h.operations.Cancel(id); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	op, err := h.operations.Get(id)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, op)
+}
+
+// SetAlias points a collection alias at another collection. Searches
+// started before it keep the collection they resolved.
+func (h *Handler) SetAlias(w http.ResponseWriter, r *http.Request) {
+	var req models.SetAliasRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	alias, err := h.store.SetAlias(r.Context(), urlParam(r, "alias"), req.Collection)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, alias)
+}
+
+// DeleteAlias removes a collection alias. Searches started before it keep
+// the collection they resolved.
+func (h *Handler) DeleteAlias(w http.ResponseWriter, r *http.Request) {
+	alias, err := h.store.DeleteAlias(r.Context(), urlParam(r, "alias"))
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, alias)
+}
+
+// ListAliases lists the collection aliases and the collections they point
+// to.
+func (h *Handler) ListAliases(w http.ResponseWriter, r *http.Request) {
+	aliases, err := h.store.ListAliases(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, aliases)
+}
+
+// SetCollectionConfig replaces the overrides of a collection's metric and
+// dimension.
+func (h *Handler) SetCollectionConfig(w http.ResponseWriter, r *http.Request) {
+	var req models.SetCollectionConfigRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	config, err := h.store.SetCollectionConfig(r.Context(), &models.CollectionConfig{
+		Collection: urlParam(r, "collection"),
+		Metric:     req.Metric,
+		Dimension:  req.Dimension,
+	})
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, config)
+}
+
+// DeleteCollectionConfig removes the overrides of a collection.
+func (h *Handler) DeleteCollectionConfig(w http.ResponseWriter, r *http.Request) {
+	config, err := h.store.DeleteCollectionConfig(r.Context(), urlParam(r, "collection"))
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, config)
+}
+
+// ListCollectionConfigs lists the collections with overrides.
+func (h *Handler) ListCollectionConfigs(w http.ResponseWriter, r *http.Request) {
+	configs, err := h.store.ListCollectionConfigs(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, configs)
+}
+
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.store.Stats(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, stats)
+}
+
+// Quarantine lists vector records that failed to load at startup.
+func (h *Handler) Quarantine(w http.ResponseWriter, r *http.Request) {
+	records, err := h.store.Quarantine(r.Context())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, records)
+}
+
+// IndexPostings lists the vector IDs indexed under a metadata key/value.
+func (h *Handler) IndexPostings(w http.ResponseWriter, r *http.Request) {
+	ids, err := h.store.IndexPostings(r.Context(), urlParam(r, "key"), urlParam(r, "value"))
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, ids)
+}
+
+// VectorPostings lists the index entries that reference a vector.
+func (h *Handler) VectorPostings(w http.ResponseWriter, r *http.Request) {
+	postings, err := h.store.VectorPostings(r.Context(), urlParam(r, "id"))
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, postings)
+}
+
+// exportFlushEntries is the number of index entries written between flushes
+// of an export
+const exportFlushEntries = 1000
+
+// ExportIndex streams a page of the inverted index as NDJSON, one entry per
+// line, for offline analysis of filter cardinality. Pages hold at most
+// INDEX_EXPORT_LIMIT entries and the cursor of the next one is returned in
+// the X-Next-Cursor header.
+func (h *Handler) ExportIndex(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	maxLimit := h.config.Load().Server.IndexExportLimit
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || (maxLimit > 0 && limit > maxLimit) {
+		limit = maxLimit
+	}
+	var withIDs bool
+	if raw := query.Get("ids"); raw != "" {
+		var err error
+		if withIDs, err = strconv.ParseBool(raw); err != nil {
+			response.Error(w, errors.Wrap(err, http.StatusBadRequest, "invalid ids"))
+			return
+		}
+	}
+
+	result, err := h.store.ExportIndex(r.Context(), query.Get("cursor"), limit, withIDs)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	if result.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", result.NextCursor)
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for i := range result.Entries {
+		if err := encoder.Encode(&result.Entries[i]); err != nil {
+			return // The client went away
+		}
+		if flusher != nil && (i+1)%exportFlushEntries == 0 {
+			flusher.Flush()
+		}
+	}
+}
+
+// sampleProfile asks for a profile of a sampled fraction of searches, set
+// by the search profile rate.
+func (h *Handler) sampleProfile(req *models.SearchRequest) {
+	rate := h.config.Load().Search.ProfileRate
+	if rate <= 0 {
+		return
+	}
+
+	h.profileMu.Lock()
+	sampled := h.profileRand.Float64() < rate
+	h.profileMu.Unlock()
+	if sampled {
+		req.Profile = true
+	}
+}
+
+// logSearchProfile logs the profile of a sampled search.
+func (h *Handler) logSearchProfile(kind string, req *models.SearchRequest, result *models.SearchResponse, start time.Time) {
+	if result == nil || result.Profile == nil {
+		return
+	}
+
+	profile := result.Profile
+	logger.WithFields(logrus.Fields{
+		"kind":        kind,
+		"metric":      result.Metric,
+		"filters":     len(req.Filter),
+		"vectors":     profile.Vectors,
+		"candidates":  profile.Candidates,
+		"selectivity": profile.Selectivity(),
+		"filter_ms":   float64(profile.Filter) / float64(time.Millisecond),
+		"score_ms":    float64(profile.Score) / float64(time.Millisecond),
+		"rank_ms":     float64(profile.Rank) / float64(time.Millisecond),
+		"duration":    time.Since(start).String(),
+	}).Info("Search profile")
+}
+
+func (h *Handler) logSlowQuery(kind string, start time.Time) {
+	threshold := time.Duration(h.slowQuery.Load())
+	if threshold <= 0 {
+		return
+	}
+
+	if duration := time.Since(start); duration > threshold {
+		logger.WithFields(logrus.Fields{
+			"kind":      kind,
+			"duration":  duration.String(),
+			"threshold": threshold.String(),
+		}).Warn("Slow query")
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/internal/utils"
+	"vectraDB/pkg/errors"
+	"vectraDB/pkg/response"
+)
+
+// recordSearch stores a search event when analytics are enabled and returns
+// the query ID it issued the search, which clients report feedback on. It
+// returns "" when analytics are disabled. Failures are logged rather than
+// failing the search.
+func (h *Handler) recordSearch(ctx context.Context, event *models.SearchEvent, start time.Time) string {
+	if !h.config.Load().Analytics.Enabled {
+		return ""
+	}
+
+	event.QueryID = newQueryID()
+	event.Time = start
+	event.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+	if err := h.store.RecordSearch(ctx, event); err != nil {
+		logger.WithError(err).Error("Failed to record search event")
+		return ""
+	}
+	return event.QueryID
+}
+
+func newQueryID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SearchAnalytics lists recorded searches between the optional RFC 3339
+// from and to timestamps.
+func (h *Handler) SearchAnalytics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, to, err := parseTimeRange(query)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+
+	events, err := h.store.ListSearchEvents(r.Context(), from, to, limit)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, events)
+}
+
+// SearchFeedback records the results a user clicked after a search, when
+// feedback is enabled.
+func (h *Handler) SearchFeedback(w http.ResponseWriter, r *http.Request) {
+	if !h.config.Load().Analytics.Feedback {
+		response.Error(w, errors.New(http.StatusForbidden, "search feedback is disabled"))
+		return
+	}
+
+	var req models.SearchFeedbackRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	feedback := &models.SearchFeedback{
+		Time:       time.Now(),
+		QueryID:    req.QueryID,
+		ClickedIDs: req.ClickedIDs,
+	}
+	if err := h.store.RecordFeedback(r.Context(), feedback); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Created(w, feedback)
+}
+
+// FeedbackAnalytics returns the click-through rates of the queries searched
+// between the optional RFC 3339 from and to timestamps, or only of the
+// query text given by query.
+func (h *Handler) FeedbackAnalytics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, to, err := parseTimeRange(query)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+
+	queries, err := h.store.QueryFeedback(r.Context(), from, to, query.Get("query"), limit)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, queries)
+}
+
+// parseTimeRange reads the optional RFC 3339 from and to parameters.
+func parseTimeRange(query url.Values) (from, to time.Time, err error) {
+	for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := query.Get(name); raw != "" {
+			if *target, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+				return time.Time{}, time.Time{}, errors.Wrap(err, http.StatusBadRequest, "invalid "+name+" timestamp")
+			}
+		}
+	}
+	return from, to, nil
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/config"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/middleware"
+)
+
+const (
+	// maxLoggedArray is the number of elements of a numeric array, such as
+	// a vector, kept in logged bodies.
+	maxLoggedArray = 4
+	// maxCapturedBody bounds the response bytes buffered for logging, so
+	// large bodies are still parsed and sanitized before being capped.
+	maxCapturedBody = 1 << 20
+)
+
+// logBodies logs request and response bodies when enabled by the debug
+// configuration for the requested route.
+func (h *Handler) logBodies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.config.Load().Debug
+		if !cfg.LogBodies || !logsRoute(cfg, routePath(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Capture the request body as the handler reads it, so it stays
+		// within the handler's own body size limit
+		requestBody := &cappedBuffer{max: maxCapturedBody}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, requestBody), r.Body}
+
+		responseBody := &cappedBuffer{max: maxCapturedBody}
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(responseBody)
+
+		next.ServeHTTP(ww, r)
+
+		logger.WithFields(logrus.Fields{
+			"request_id": middleware.GetRequestID(r.Context()),
+			"method":     r.Method,
+			"url":        r.URL.String(),
+			"status":     ww.Status(),
+			"request":    requestBody.format(cfg),
+			"response":   responseBody.format(cfg),
+		}).Info("HTTP bodies")
+	})
+}
+
+// routePath returns the path of r relative to where the API routes are
+// mounted, such as /vectors/v1 for /api/v1/vectors/v1.
+func routePath(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		return rctx.RoutePath
+	}
+	return r.URL.Path
+}
+
+// logsRoute reports whether bodies are logged for path, relative to where
+// the API routes are mounted.
+func logsRoute(cfg config.DebugConfig, path string) bool {
+	if len(cfg.LogBodyRoutes) == 0 {
+		return true
+	}
+	for _, prefix := range cfg.LogBodyRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBody renders a body for logging. JSON bodies have numeric arrays
+// truncated and redacted fields replaced; the result is capped in size.
+func formatBody(body []byte, cfg config.DebugConfig) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err == nil {
+		if data, err := json.Marshal(sanitizeBody(value, cfg.RedactFields)); err == nil {
+			body = data
+		}
+	}
+
+	if cfg.MaxBodyBytes > 0 && len(body) > cfg.MaxBodyBytes {
+		return fmt.Sprintf("%s... (%d bytes truncated)", body[:cfg.MaxBodyBytes], len(body)-cfg.MaxBodyBytes)
+	}
+	return string(body)
+}
+
+func sanitizeBody(value interface{}, redact []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if containsFold(redact, key) {
+				v[key] = "[REDACTED]"
+				continue
+			}
+			v[key] = sanitizeBody(field, redact)
+		}
+		return v
+	case []interface{}:
+		if len(v) > maxLoggedArray && isNumeric(v) {
+			return append(v[:maxLoggedArray:maxLoggedArray], fmt.Sprintf("... (%d more)", len(v)-maxLoggedArray))
+		}
+		for i, item := range v {
+			v[i] = sanitizeBody(item, redact)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isNumeric(values []interface{}) bool {
+	for _, value := range values {
+		if _, ok := value.(json.Number); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// cappedBuffer keeps the first max bytes written to it and counts the rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		b.dropped += len(p) - max(room, 0)
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// format renders the captured body for logging. A body too large to be
+// captured whole can't be sanitized, so only its size is logged.
+func (b *cappedBuffer) format(cfg config.DebugConfig) string {
+	if b.dropped > 0 {
+		return fmt.Sprintf("(%d bytes, not logged)", b.Len()+b.dropped)
+	}
+	return formatBody(b.Bytes(), cfg)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// decodeJSON decodes the request body into v. Numbers decoded into
+// interface{} values are kept as json.Number so integers aren't turned into
+// floats. In strict mode unknown fields are rejected rather than ignored.
+func (h *Handler) decodeJSON(r *http.Request, v interface{}) error {
+	cfg := h.config.Load().Server
+	body := r.Body
+	if cfg.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(nil, body, cfg.MaxBodyBytes)
+	}
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if cfg.StrictJSON {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(v); err != nil {
+		if tooLarge, ok := err.(*http.MaxBytesError); ok {
+			return errors.Wrap(err, http.StatusRequestEntityTooLarge, "request body too large").
+				WithDetails(fmt.Sprintf("request bodies are limited to %d bytes", tooLarge.Limit))
+		}
+		if tooLong, ok := err.(*models.DimensionError); ok {
+			return errors.Wrap(tooLong, http.StatusBadRequest, "invalid vector dimension").WithDetails(tooLong.Error())
+		}
+		return errors.Wrap(err, http.StatusBadRequest, "invalid JSON").WithDetails(err.Error())
+	}
+	return nil
+}
+
+// urlParam returns a decoded URL parameter. chi routes on the escaped path
+// whenever the request path holds escapes the decoded form can't round-trip,
+// such as %2F, and leaves parameters escaped in that case.
+func urlParam(r *http.Request, key string) string {
+	value := chi.URLParam(r, key)
+	if r.URL.RawPath == "" {
+		return value
+	}
+	if decoded, err := url.PathUnescape(value); err == nil {
+		return decoded
+	}
+	return value
+}
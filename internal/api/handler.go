@@ -1,66 +1,166 @@
 package api
 
 import (
+	"math/rand"
 	"net/http"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"encoding/json"
 	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/config"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/middleware"
 	"vectraDB/internal/models"
+	"vectraDB/internal/operations"
 	"vectraDB/internal/store"
 	"vectraDB/internal/utils"
 	"vectraDB/pkg/errors"
 	"vectraDB/pkg/response"
-	"github.com/sirupsen/logrus"
-	"vectraDB/internal/logger"
 )
 
 type Handler struct {
-	store store.Store
+	store      store.Store
+	operations *operations.Registry
+
+	// loadConfig re-reads the configuration source on reload
+	loadConfig    func() *config.Config
+	config        atomic.Pointer[config.Config]
+	connLimiter   *middleware.ConcurrencyLimiter
+	rateLimiter   *middleware.RateLimiter
+	searchLimiter *middleware.ConcurrencyLimiter
+	slowQuery     atomic.Int64
+
+	// profileRand samples the searches to profile
+	profileMu   sync.Mutex
+	profileRand *rand.Rand
 }
 
-func NewHandler(store store.Store) *Handler {
-	return &Handler{store: store}
+func NewHandler(store store.Store, cfg *config.Config) *Handler {
+	h := &Handler{
+		store:         store,
+		operations:    operations.NewRegistry(),
+		loadConfig:    config.Load,
+		connLimiter:   middleware.NewConcurrencyLimiter(cfg.Server.MaxConns),
+		rateLimiter:   middleware.NewRateLimiter(cfg.Server.RateLimit),
+		searchLimiter: middleware.NewConcurrencyLimiter(cfg.Search.MaxConcurrent),
+	}
+	h.config.Store(cfg)
+	h.slowQuery.Store(int64(cfg.Search.SlowQueryThreshold))
+	models.SetMaxDimension(cfg.Server.MaxDimension)
+
+	seed := int64(cfg.Search.ProfileSeed)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	h.profileRand = rand.New(rand.NewSource(seed))
+	return h
 }
 
 func (h *Handler) Routes() *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(h.stampResponses)
+	r.Use(h.connLimiter.Middleware)
+	r.Use(h.rateLimiter.Middleware)
+	r.Use(h.logBodies)
 
 	// Vector routes
 	r.Route("/vectors", func(r chi.Router) {
 		r.Post("/", h.CreateVector)
+		r.Post("/batch", h.CreateVectors)
+		r.Post("/batch/update", h.UpdateVectors)
+		r.Post("/validate", h.ValidateVector)
+		r.Get("/changes", h.ListChanges)
+		r.Get("/popular", h.PopularVectors)
+		r.Post("/project", h.ProjectVectors)
 		r.Get("/{id}", h.GetVector)
+		r.Head("/{id}", h.HeadVector)
 		r.Put("/{id}", h.UpdateVector)
+		r.Patch("/{id}", h.PatchVector)
 		r.Delete("/{id}", h.DeleteVector)
 		r.Get("/", h.ListVectors)
 	})
 
 	// Search routes
 	r.Route("/search", func(r chi.Router) {
+		r.Use(h.searchLimiter.Middleware)
 		r.Post("/", h.SearchVectors)
+		r.Get("/", h.SearchVectorsQuery)
 		r.Post("/hybrid", h.HybridSearch)
+		r.Post("/unified", h.UnifiedSearch)
+		r.Post("/blended", h.BlendedSearch)
+		r.Post("/adhoc", h.AdhocSearch)
+		r.Post("/feedback", h.SearchFeedback)
 	})
 
+	r.Post("/compare", h.Compare)
+
 	// Document routes
 	r.Route("/documents", func(r chi.Router) {
 		r.Post("/", h.CreateDocument)
+		r.Post("/validate", h.ValidateDocument)
 		r.Get("/{id}", h.GetDocument)
+		r.Head("/{id}", h.HeadDocument)
 		r.Put("/{id}", h.UpdateDocument)
 		r.Delete("/{id}", h.DeleteDocument)
 		r.Get("/", h.ListDocuments)
+		r.Post("/tags", h.BulkTagDocuments)
 		r.Get("/tags/{tag}", h.ListDocumentsByTag)
 	})
 
+	// Admin routes
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(middleware.AdminAuthMiddleware(h.config.Load().Server.AdminToken))
+		r.Post("/reload", h.Reload)
+		r.Post("/compact", h.Compact)
+		r.Post("/defragment", h.Defragment)
+		r.Post("/cache/flush", h.FlushCache)
+		r.Post("/clusters/fit", h.FitClusters)
+		r.Post("/index/build", h.BuildIndex)
+		r.Get("/stats", h.Stats)
+		r.Get("/aliases", h.ListAliases)
+		r.Put("/aliases/{alias}", h.SetAlias)
+		r.Delete("/aliases/{alias}", h.DeleteAlias)
+		r.Get("/collections", h.ListCollectionConfigs)
+		r.Put("/collections/{collection}", h.SetCollectionConfig)
+		r.Delete("/collections/{collection}", h.DeleteCollectionConfig)
+		r.Get("/quarantine", h.Quarantine)
+		r.Get("/analytics/searches", h.SearchAnalytics)
+		r.Get("/analytics/feedback", h.FeedbackAnalytics)
+		r.Get("/index/export", h.ExportIndex)
+		r.Get("/index/{key}/{value}", h.IndexPostings)
+		r.Get("/vectors/{id}/postings", h.VectorPostings)
+		r.Get("/operations/{id}", h.GetOperation)
+		r.Delete("/operations/{id}", h.CancelOperation)
+	})
+
 	// Health check
 	r.Get("/health", h.Health)
 
 	return r
 }
 
+// stampResponses leaves the time out of the responses to a request unless
+// the current configuration asks for response timestamps.
+func (h *Handler) stampResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.config.Load().Server.ResponseTimestamps {
+			w = response.WithoutTimestamps(w)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (h *Handler) CreateVector(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateVectorRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
 	if err := utils.ValidateStruct(&req); err != nil {
-		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "validation failed"))
+		response.Error(w, validationFailed(err))
 		return
 	}
 
@@ -69,6 +169,11 @@ func (h *Handler) CreateVector(w http.ResponseWriter, r *http.Request) {
 		Vector:   req.Vector,
 		Text:     req.Text,
 		Metadata: req.Metadata,
+
+		EmbeddingModel:   req.EmbeddingModel,
+		EmbeddingVersion: req.EmbeddingVersion,
+		Boost:            req.Boost,
+		NamedVectors:     namedVectors(req.NamedVectors),
 	}
 
 	if err := h.store.InsertVector(r.Context(), vector); err != nil {
@@ -79,32 +184,231 @@ func (h *Handler) CreateVector(w http.ResponseWriter, r *http.Request) {
 	response.Created(w, vector)
 }
 
+// ValidateVector runs the validation of CreateVector without storing the
+// vector, reporting every problem found by field.
+func (h *Handler) ValidateVector(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateVectorRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	result := validationResult(&req)
+	vector := &models.Vector{
+		ID:       req.ID,
+		Vector:   req.Vector,
+		Text:     req.Text,
+		Metadata: req.Metadata,
+
+		EmbeddingModel:   req.EmbeddingModel,
+		EmbeddingVersion: req.EmbeddingVersion,
+		Boost:            req.Boost,
+		NamedVectors:     namedVectors(req.NamedVectors),
+	}
+	if err := h.store.ValidateVector(r.Context(), vector); err != nil {
+		field := "metadata"
+		if errors.Is(err, errors.ErrInvalidVectorID) {
+			field = "id"
+		}
+		result.Valid = false
+		result.Errors[field] = errorDetails(err)
+	}
+
+	response.Success(w, result)
+}
+
+// CreateVectors inserts a batch of vectors, each on its own. It responds
+// 201 when every vector was created and 207 with the status of each item
+// when any failed, so clients can retry just the failures.
+func (h *Handler) CreateVectors(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchCreateVectorsRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	result := &models.BatchResponse{Items: make([]models.BatchItemResult, len(req.Vectors))}
+	for i := range req.Vectors {
+		item := &req.Vectors[i]
+		result.Items[i] = models.BatchItemResult{ID: item.ID, Status: http.StatusCreated}
+
+		err := utils.ValidateStruct(item)
+		if err != nil {
+			err = validationFailed(err)
+		} else {
+			err = h.store.InsertVector(r.Context(), &models.Vector{
+				ID:       item.ID,
+				Vector:   item.Vector,
+				Text:     item.Text,
+				Metadata: item.Metadata,
+
+				EmbeddingModel:   item.EmbeddingModel,
+				EmbeddingVersion: item.EmbeddingVersion,
+				Boost:            item.Boost,
+				NamedVectors:     namedVectors(item.NamedVectors),
+			})
+		}
+		if err != nil {
+			result.Failed++
+			batchItemFailed(&result.Items[i], err)
+			continue
+		}
+		result.Succeeded++
+	}
+
+	if result.Failed > 0 {
+		response.MultiStatus(w, result)
+		return
+	}
+	response.Created(w, result)
+}
+
+// UpdateVectors applies a batch of updates. In atomic mode, set by the
+// request or the server default, either all updates apply or none do.
+// It responds 200 when every update applied and 207 with the status of each
+// item otherwise.
+func (h *Handler) UpdateVectors(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchUpdateVectorsRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+	allOrNothing := h.config.Load().Server.AtomicBatchUpdates
+	if req.Atomic != nil {
+		allOrNothing = *req.Atomic
+	}
+
+	result := &models.BatchResponse{Items: make([]models.BatchItemResult, len(req.Vectors))}
+	vectors := make([]*models.Vector, 0, len(req.Vectors))
+	invalid := make(map[int]error)
+	for i := range req.Vectors {
+		item := &req.Vectors[i]
+		result.Items[i] = models.BatchItemResult{ID: item.ID, Status: http.StatusOK}
+		if err := utils.ValidateStruct(item); err != nil {
+			invalid[i] = validationFailed(err)
+			continue
+		}
+		vectors = append(vectors, &models.Vector{
+			ID:       item.ID,
+			Vector:   item.Vector,
+			Text:     item.Text,
+			Metadata: item.Metadata,
+
+			EmbeddingModel:   item.EmbeddingModel,
+			EmbeddingVersion: item.EmbeddingVersion,
+			Boost:            item.Boost,
+			NamedVectors:     namedVectors(item.NamedVectors),
+		})
+	}
+
+	// An invalid item aborts an atomic batch before it reaches the store
+	var errs []error
+	if allOrNothing && len(invalid) > 0 {
+		errs = make([]error, len(vectors))
+		for j := range errs {
+			errs[j] = errors.ErrBatchAborted
+		}
+	} else {
+		var err error
+		if errs, err = h.store.UpdateVectors(r.Context(), vectors, allOrNothing); err != nil {
+			response.Error(w, err)
+			return
+		}
+	}
+
+	j := 0
+	for i := range result.Items {
+		err, ok := invalid[i]
+		if !ok {
+			err = errs[j]
+			j++
+		}
+		if err != nil {
+			result.Failed++
+			batchItemFailed(&result.Items[i], err)
+			continue
+		}
+		result.Succeeded++
+	}
+
+	if result.Failed > 0 {
+		response.MultiStatus(w, result)
+		return
+	}
+	response.Success(w, result)
+}
+
+// batchItemFailed records why a batch item failed.
+func batchItemFailed(item *models.BatchItemResult, err error) {
+	item.Status = http.StatusInternalServerError
+	item.Error = err.Error()
+	if appErr, ok := err.(*errors.AppError); ok {
+		item.Status = appErr.Code
+		item.Error = appErr.Message
+		if appErr.Details != "" {
+			item.Error += ": " + appErr.Details
+		}
+		item.ValidationErrors = appErr.ValidationErrors
+	}
+}
+
 func (h *Handler) GetVector(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := urlParam(r, "id")
 	if id == "" {
 		response.Error(w, errors.ErrInvalidInput.WithDetails("vector ID is required"))
 		return
 	}
 
+	format, err := parseVectorFormat(r.URL.Query())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
 	vector, err := h.store.GetVector(r.Context(), id)
 	if err != nil {
 		response.Error(w, err)
 		return
 	}
 
+	if format != nil {
+		response.Success(w, format.vector(vector))
+		return
+	}
 	response.Success(w, vector)
 }
 
+// HeadVector checks whether a vector exists, responding 200 or 404 without
+// a body.
+func (h *Handler) HeadVector(w http.ResponseWriter, r *http.Request) {
+	exists, err := h.store.VectorExists(r.Context(), urlParam(r, "id"))
+	headStatus(w, exists, err)
+}
+
+// UpdateVector replaces a vector. With UPSERT_ON_PUT a vector that doesn't
+// exist is created instead, responding 201.
 func (h *Handler) UpdateVector(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := urlParam(r, "id")
 	if id == "" {
 		response.Error(w, errors.ErrInvalidInput.WithDetails("vector ID is required"))
 		return
 	}
 
 	var req models.UpdateVectorRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
 	if err := utils.ValidateStruct(&req); err != nil {
-		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "validation failed"))
+		response.Error(w, validationFailed(err))
 		return
 	}
 
@@ -113,9 +417,54 @@ func (h *Handler) UpdateVector(w http.ResponseWriter, r *http.Request) {
 		Vector:   req.Vector,
 		Text:     req.Text,
 		Metadata: req.Metadata,
+
+		EmbeddingModel:   req.EmbeddingModel,
+		EmbeddingVersion: req.EmbeddingVersion,
+		Boost:            req.Boost,
+		NamedVectors:     namedVectors(req.NamedVectors),
 	}
 
-	if err := h.store.UpdateVector(r.Context(), id, vector); err != nil {
+	err := h.store.UpdateVector(r.Context(), id, vector)
+	if err == errors.ErrVectorNotFound && h.config.Load().Server.UpsertOnPut {
+		// Create the vector instead, updating it after all if a concurrent
+		// request created it first
+		if err = h.store.InsertVector(r.Context(), vector); err == nil {
+			response.Created(w, vector)
+			return
+		}
+		if err == errors.ErrVectorExists {
+			err = h.store.UpdateVector(r.Context(), id, vector)
+		}
+	}
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, vector)
+}
+
+// PatchVector updates only the fields given in the request, so a vector's
+// metadata can be changed without resending its embedding.
+func (h *Handler) PatchVector(w http.ResponseWriter, r *http.Request) {
+	id := urlParam(r, "id")
+	if id == "" {
+		response.Error(w, errors.ErrInvalidInput.WithDetails("vector ID is required"))
+		return
+	}
+
+	var req models.PatchVectorRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	vector, err := h.store.PatchVector(r.Context(), id, &req)
+	if err != nil {
 		response.Error(w, err)
 		return
 	}
@@ -124,7 +473,7 @@ func (h *Handler) UpdateVector(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) DeleteVector(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := urlParam(r, "id")
 	if id == "" {
 		response.Error(w, errors.ErrInvalidInput.WithDetails("vector ID is required"))
 		return
@@ -149,56 +498,399 @@ func (h *Handler) ListVectors(w http.ResponseWriter, r *http.Request) {
 		offset = 0
 	}
 
+	format, err := parseVectorFormat(r.URL.Query())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
 	vectors, err := h.store.ListVectors(r.Context(), limit, offset)
 	if err != nil {
 		response.Error(w, err)
 		return
 	}
 
-	response.SuccessWithMeta(w, vectors, &response.Meta{
+	meta := &response.Meta{
 		Limit: limit,
-		Page:  (offset/limit) + 1,
+		Page:  (offset / limit) + 1,
+	}
+	if format != nil {
+		response.SuccessWithMeta(w, format.vectors(vectors), meta)
+		return
+	}
+	response.SuccessWithMeta(w, vectors, meta)
+}
+
+// ListChanges returns vectors changed since the given RFC 3339 timestamp,
+// for incremental sync by downstream consumers.
+func (h *Handler) ListChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var since time.Time
+	if raw := query.Get("since"); raw != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+			response.Error(w, errors.Wrap(err, http.StatusBadRequest, "invalid since timestamp"))
+			return
+		}
+	}
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+
+	result, err := h.store.ListChanges(r.Context(), since, query.Get("cursor"), limit)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, result)
+}
+
+// PopularVectors returns the most retrieved vectors with their retrieval
+// counts.
+func (h *Handler) PopularVectors(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+
+	popular, err := h.store.PopularVectors(r.Context(), limit)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.SuccessWithMeta(w, popular, &response.Meta{
+		Limit: limit,
+		Total: len(popular),
 	})
 }
 
 func (h *Handler) SearchVectors(w http.ResponseWriter, r *http.Request) {
 	var req models.SearchRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
 	if err := utils.ValidateStruct(&req); err != nil {
-		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "validation failed"))
+		response.Error(w, validationFailed(err))
 		return
 	}
 
-	result, err := h.store.SearchVectors(r.Context(), &req)
+	h.search(w, r, &req)
+}
+
+// SearchVectorsQuery is the GET variant of SearchVectors for clients that
+// cannot easily send a request body.
+func (h *Handler) SearchVectorsQuery(w http.ResponseWriter, r *http.Request) {
+	req, err := parseSearchQuery(r.URL.Query())
 	if err != nil {
 		response.Error(w, err)
 		return
 	}
+	if max := h.config.Load().Server.MaxDimension; max > 0 && len(req.Query) > max {
+		err := &models.DimensionError{Max: max}
+		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "invalid vector dimension").WithDetails(err.Error()))
+		return
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
 
-	response.SuccessWithMeta(w, result.Results, &response.Meta{
-		Total: result.Total,
-		Page:  result.Page,
-		Limit: result.Limit,
-	})
+	h.search(w, r, req)
+}
+
+// search runs a validated vector search and writes its results, the body
+// of both SearchVectors and SearchVectorsQuery.
+func (h *Handler) search(w http.ResponseWriter, r *http.Request, req *models.SearchRequest) {
+	format, err := parseVectorFormat(r.URL.Query())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	h.sampleProfile(req)
+	start := time.Now()
+	result, err := h.store.SearchVectors(r.Context(), req)
+	h.logSlowQuery("search", start)
+	h.logSearchProfile("search", req, result, start)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+	queryID := h.recordSearch(r.Context(), &models.SearchEvent{
+		Kind:      "search",
+		Dimension: len(req.Query),
+		Filter:    req.Filter,
+		TopK:      req.TopK,
+		Results:   result.Total,
+	}, start)
+
+	meta := searchMeta(result, queryID)
+	if req.GroupBy != "" {
+		response.SuccessWithMeta(w, fitGroups(result.Groups, h.config.Load().Search.MaxResponseBytes, meta), meta)
+		return
+	}
+	h.writeSearchResults(w, r, result.Results, format, meta)
+}
+
+// searchMeta returns the response meta of a vector search, identified by
+// queryID in the search analytics.
+func searchMeta(result *models.SearchResponse, queryID string) *response.Meta {
+	meta := &response.Meta{
+		Total:   result.Total,
+		Page:    result.Page,
+		Limit:   result.Limit,
+		Offset:  result.Offset,
+		Reason:  result.Reason,
+		Weights: result.Weights,
+		Metric:  result.Metric,
+
+		ScoreNormalization: result.ScoreNormalization,
+		Returned:           result.Returned,
+		Expanded:           result.Expanded,
+		Collapsed:          result.Collapsed,
+		GroupsCapped:       result.GroupsCapped,
+		Approximate:        result.Approximate,
+		Capped:             result.Capped,
+		GapCut:             result.GapCut,
+		Fallback:           result.Fallback,
+		Collection:         result.Collection,
+		Cached:             result.Cached,
+		QueryID:            queryID,
+		TotalPages:         result.TotalPages,
+		HasNext:            &result.HasNext,
+	}
+	if result.Cluster != nil {
+		meta.Cluster = result.Cluster
+	}
+	return meta
 }
 
 func (h *Handler) HybridSearch(w http.ResponseWriter, r *http.Request) {
 	var req models.HybridSearchRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
 	if err := utils.ValidateStruct(&req); err != nil {
-		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "validation failed"))
+		response.Error(w, validationFailed(err))
 		return
 	}
 
+	format, err := parseVectorFormat(r.URL.Query())
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	start := time.Now()
 	result, err := h.store.HybridSearch(r.Context(), &req)
+	h.logSlowQuery("hybrid_search", start)
 	if err != nil {
 		response.Error(w, err)
 		return
 	}
+	queryID := h.recordSearch(r.Context(), &models.SearchEvent{
+		Kind:      "hybrid_search",
+		Text:      req.Query,
+		Dimension: len(req.QueryVector),
+		Results:   result.Total,
+	}, start)
+
+	meta := &response.Meta{
+		Total:   result.Total,
+		Page:    result.Page,
+		Limit:   result.Limit,
+		Offset:  result.Offset,
+		Reason:  result.Reason,
+		Weights: result.Weights,
+		Metric:  result.Metric,
+
+		Returned:   result.Returned,
+		Collection: result.Collection,
+		QueryID:    queryID,
+		TotalPages: result.TotalPages,
+		HasNext:    &result.HasNext,
+	}
+	maxBytes := h.config.Load().Search.MaxResponseBytes
+	if format != nil {
+		response.SuccessWithMeta(w, fitResults(format.hybridResults(result.Results), maxBytes, meta), meta)
+		return
+	}
+	response.SuccessWithMeta(w, fitResults(result.Results, maxBytes, meta), meta)
+}
+
+// BlendedSearch ranks vectors by a weighted blend of vector, keyword, fuzzy
+// and metadata scores.
+func (h *Handler) BlendedSearch(w http.ResponseWriter, r *http.Request) {
+	var req models.BlendedSearchRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
 
-	response.SuccessWithMeta(w, result.Results, &response.Meta{
-		Total: result.Total,
-		Page:  result.Page,
-		Limit: result.Limit,
-	})
+	start := time.Now()
+	result, err := h.store.BlendedSearch(r.Context(), &req)
+	h.logSlowQuery("blended_search", start)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+	queryID := h.recordSearch(r.Context(), &models.SearchEvent{
+		Kind:      "blended_search",
+		Text:      req.Query,
+		Dimension: len(req.QueryVector),
+		Filter:    req.Filter,
+		Results:   result.Total,
+	}, start)
+
+	meta := &response.Meta{
+		Total:   result.Total,
+		Page:    result.Page,
+		Limit:   result.Limit,
+		Offset:  result.Offset,
+		Reason:  result.Reason,
+		Weights: result.Weights,
+
+		Returned:   result.Returned,
+		Collection: result.Collection,
+		QueryID:    queryID,
+		TotalPages: result.TotalPages,
+		HasNext:    &result.HasNext,
+	}
+	response.SuccessWithMeta(w, fitResults(result.Results, h.config.Load().Search.MaxResponseBytes, meta), meta)
+}
+
+// UnifiedSearch searches vectors and documents in one query and merges the
+// results by score.
+func (h *Handler) UnifiedSearch(w http.ResponseWriter, r *http.Request) {
+	var req models.UnifiedSearchRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	start := time.Now()
+	result, err := h.store.UnifiedSearch(r.Context(), &req)
+	h.logSlowQuery("unified_search", start)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+	queryID := h.recordSearch(r.Context(), &models.SearchEvent{
+		Kind:      "unified_search",
+		Text:      req.Query,
+		Dimension: len(req.QueryVector),
+		Results:   result.Total,
+	}, start)
+
+	meta := &response.Meta{
+		Total:    result.Total,
+		Returned: result.Returned,
+		Page:     result.Page,
+		Limit:    result.Limit,
+		Offset:   result.Offset,
+		Weights:  result.Weights,
+		QueryID:  queryID,
+
+		Collection: result.Collection,
+	}
+	response.SuccessWithMeta(w, fitResults(result.Results, h.config.Load().Search.MaxResponseBytes, meta), meta)
+}
+
+// ProjectVectors returns low-dimensional coordinates of the filtered vectors
+// for plotting.
+func (h *Handler) ProjectVectors(w http.ResponseWriter, r *http.Request) {
+	var req models.ProjectRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	result, err := h.store.ProjectVectors(r.Context(), &req)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, result)
+}
+
+// AdhocSearch ranks the vectors given in the request against its query,
+// without storing them.
+func (h *Handler) AdhocSearch(w http.ResponseWriter, r *http.Request) {
+	var req models.AdhocSearchRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	result, err := h.store.AdhocSearch(r.Context(), &req)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	meta := &response.Meta{
+		Total:  result.Total,
+		Page:   result.Page,
+		Limit:  result.Limit,
+		Reason: result.Reason,
+		Metric: result.Metric,
+
+		ScoreNormalization: result.ScoreNormalization,
+		Returned:           result.Returned,
+		TotalPages:         result.TotalPages,
+		HasNext:            &result.HasNext,
+	}
+	// Ad-hoc searches have no offset to resume from, so results left out
+	// are only recorded as truncated
+	results := fitResults(result.Results, h.config.Load().Search.MaxResponseBytes, meta)
+	meta.HasNext = &result.HasNext
+	meta.NextOffset = 0
+	response.SuccessWithMeta(w, results, meta)
+}
+
+// Compare returns the similarity of two vectors given by ID or inline.
+func (h *Handler) Compare(w http.ResponseWriter, r *http.Request) {
+	var req models.CompareRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
+	}
+
+	result, err := h.store.Compare(r.Context(), &req)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, result)
 }
 
 func (h *Handler) CreateDocument(w http.ResponseWriter, r *http.Request) {
@@ -207,12 +899,12 @@ func (h *Handler) CreateDocument(w http.ResponseWriter, r *http.Request) {
 	logger.Info("CreateDocument: received request")
 
 	// Decode JSON body
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := h.decodeJSON(r, &req); err != nil {
 		logger.WithError(err).WithFields(logrus.Fields{
 			"endpoint": "/create-document",
 			"action":   "decode request",
 		}).Error("Failed to decode request body")
-		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "invalid JSON"))
+		response.Error(w, err)
 		return
 	}
 
@@ -227,7 +919,7 @@ func (h *Handler) CreateDocument(w http.ResponseWriter, r *http.Request) {
 			"endpoint": "/create-document",
 			"action":   "validate request",
 		}).Error("Validation failed")
-		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "validation failed"))
+		response.Error(w, validationFailed(err))
 		return
 	}
 
@@ -241,6 +933,8 @@ func (h *Handler) CreateDocument(w http.ResponseWriter, r *http.Request) {
 		Title:   req.Title,
 		Content: req.Content,
 		Tags:    req.Tags,
+
+		ExpiresAt: req.ExpiresAt,
 	}
 
 	logger.WithFields(logrus.Fields{
@@ -266,8 +960,43 @@ func (h *Handler) CreateDocument(w http.ResponseWriter, r *http.Request) {
 	response.Created(w, document)
 }
 
+// ValidateDocument runs the validation of CreateDocument without storing
+// the document, reporting every problem found by field.
+func (h *Handler) ValidateDocument(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateDocumentRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, validationResult(&req))
+}
+
+func validationResult(req interface{}) *models.ValidationResult {
+	errs := utils.ValidateStructWithDetails(req)
+	if errs == nil {
+		errs = make(map[string]string)
+	}
+	return &models.ValidationResult{Valid: len(errs) == 0, Errors: errs}
+}
+
+// validationFailed wraps a ValidateStruct error, listing the message for
+// each invalid field so clients can map them to form fields.
+func validationFailed(err error) *errors.AppError {
+	return errors.Wrap(err, http.StatusBadRequest, "validation failed").
+		WithValidationErrors(utils.ValidationErrors(err))
+}
+
+// errorDetails describes err for a validation result.
+func errorDetails(err error) string {
+	if appErr, ok := err.(*errors.AppError); ok && appErr.Details != "" {
+		return appErr.Details
+	}
+	return err.Error()
+}
+
 func (h *Handler) GetDocument(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := urlParam(r, "id")
 	if id == "" {
 		response.Error(w, errors.ErrInvalidInput.WithDetails("document ID is required"))
 		return
@@ -282,27 +1011,48 @@ func (h *Handler) GetDocument(w http.ResponseWriter, r *http.Request) {
 	response.Success(w, document)
 }
 
+// HeadDocument checks whether a document exists, responding 200 or 404
+// without a body.
+func (h *Handler) HeadDocument(w http.ResponseWriter, r *http.Request) {
+	exists, err := h.store.DocumentExists(r.Context(), urlParam(r, "id"))
+	headStatus(w, exists, err)
+}
+
+// headStatus answers a HEAD request with the status alone.
+func headStatus(w http.ResponseWriter, exists bool, err error) {
+	switch {
+	case err != nil:
+		code := http.StatusInternalServerError
+		if appErr, ok := err.(*errors.AppError); ok {
+			code = appErr.Code
+		}
+		w.WriteHeader(code)
+	case exists:
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
 func (h *Handler) UpdateDocument(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := urlParam(r, "id")
 	if id == "" {
 		response.Error(w, errors.ErrInvalidInput.WithDetails("document ID is required"))
 		return
 	}
 
 	var req models.UpdateDocumentRequest
-	if err := utils.ValidateStruct(&req); err != nil {
-		response.Error(w, errors.Wrap(err, http.StatusBadRequest, "validation failed"))
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
 		return
 	}
-
-	document := &models.Document{
-		ID:      id,
-		Title:   req.Title,
-		Content: req.Content,
-		Tags:    req.Tags,
+	if err := utils.ValidateStruct(&req); err != nil {
+		response.Error(w, validationFailed(err))
+		return
 	}
 
-	if err := h.store.UpdateDocument(r.Context(), id, document); err != nil {
+	document, err := h.store.UpdateDocument(r.Context(), id, &req)
+	if err != nil {
 		response.Error(w, err)
 		return
 	}
@@ -311,7 +1061,7 @@ func (h *Handler) UpdateDocument(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id := urlParam(r, "id")
 	if id == "" {
 		response.Error(w, errors.ErrInvalidInput.WithDetails("document ID is required"))
 		return
@@ -344,12 +1094,12 @@ func (h *Handler) ListDocuments(w http.ResponseWriter, r *http.Request) {
 
 	response.SuccessWithMeta(w, documents, &response.Meta{
 		Limit: limit,
-		Page:  (offset/limit) + 1,
+		Page:  (offset / limit) + 1,
 	})
 }
 
 func (h *Handler) ListDocumentsByTag(w http.ResponseWriter, r *http.Request) {
-	tag := chi.URLParam(r, "tag")
+	tag := urlParam(r, "tag")
 	if tag == "" {
 		response.Error(w, errors.ErrInvalidInput.WithDetails("tag is required"))
 		return
@@ -373,10 +1123,27 @@ func (h *Handler) ListDocumentsByTag(w http.ResponseWriter, r *http.Request) {
 
 	response.SuccessWithMeta(w, documents, &response.Meta{
 		Limit: limit,
-		Page:  (offset/limit) + 1,
+		Page:  (offset / limit) + 1,
 	})
 }
 
+// BulkTagDocuments adds and removes tags on every document matching a filter.
+func (h *Handler) BulkTagDocuments(w http.ResponseWriter, r *http.Request) {
+	var req models.BulkTagRequest
+	if err := h.decodeJSON(r, &req); err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	changed, err := h.store.BulkTagDocuments(r.Context(), &req)
+	if err != nil {
+		response.Error(w, err)
+		return
+	}
+
+	response.Success(w, map[string]int{"changed": changed})
+}
+
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	if err := h.store.Health(r.Context()); err != nil {
 		response.Error(w, err)
@@ -387,3 +1154,15 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 		"status": "healthy",
 	})
 }
+
+// namedVectors converts the named vectors of a request for storage.
+func namedVectors(named map[string]models.Embedding) map[string][]float64 {
+	if len(named) == 0 {
+		return nil
+	}
+	vectors := make(map[string][]float64, len(named))
+	for name, vector := range named {
+		vectors[name] = vector
+	}
+	return vectors
+}
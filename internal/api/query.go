@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// parseSearchQuery builds a search request from URL query parameters.
+//
+// The query vector is read from either `vector`, a comma-separated list of
+// floats, or `vector_b64`, base64 of little-endian packed float32 values.
+// Filters are given as repeated `filter=key:value` parameters.
+func parseSearchQuery(query url.Values) (*models.SearchRequest, error) {
+	req := &models.SearchRequest{
+		TopK:  10,
+		Page:  1,
+		Limit: 10,
+	}
+
+	var err error
+	switch {
+	case query.Get("vector") != "" && query.Get("vector_b64") != "":
+		return nil, errors.New(http.StatusBadRequest, "only one of vector and vector_b64 may be set")
+	case query.Get("vector") != "":
+		req.Query, err = parseVectorCSV(query.Get("vector"))
+	case query.Get("vector_b64") != "":
+		req.Query, err = parseVectorBase64(query.Get("vector_b64"))
+	default:
+		return nil, errors.ErrEmptyQuery
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusBadRequest, "invalid query vector")
+	}
+
+	for _, filter := range query["filter"] {
+		key, value, ok := strings.Cut(filter, ":")
+		if !ok || key == "" {
+			return nil, errors.New(http.StatusBadRequest, "invalid filter").
+				WithDetails(fmt.Sprintf("filter %q must be of the form key:value", filter))
+		}
+		if req.Filter == nil {
+			req.Filter = make(map[string]string)
+		}
+		req.Filter[key] = value
+	}
+
+	req.CollapseBy = query.Get("collapse_by")
+	req.GroupBy = query.Get("group_by")
+	req.Metric = query.Get("metric")
+	req.ScoreNormalization = query.Get("score_normalization")
+	req.Target = query.Get("target")
+	req.Pooling = query.Get("pooling")
+	req.OnDimensionMismatch = query.Get("on_dimension_mismatch")
+	req.Collection = query.Get("collection")
+	if raw := query.Get("normalize_query"); raw != "" {
+		if req.NormalizeQuery, err = strconv.ParseBool(raw); err != nil {
+			return nil, errors.Wrap(err, http.StatusBadRequest, "invalid normalize_query")
+		}
+	}
+	if raw := query.Get("return_cluster"); raw != "" {
+		if req.ReturnCluster, err = strconv.ParseBool(raw); err != nil {
+			return nil, errors.Wrap(err, http.StatusBadRequest, "invalid return_cluster")
+		}
+	}
+	if raw := query.Get("return_percentile"); raw != "" {
+		if req.ReturnPercentile, err = strconv.ParseBool(raw); err != nil {
+			return nil, errors.Wrap(err, http.StatusBadRequest, "invalid return_percentile")
+		}
+	}
+	if raw := query.Get("popularity_boost"); raw != "" {
+		if req.PopularityBoost, err = strconv.ParseFloat(raw, 64); err != nil {
+			return nil, errors.Wrap(err, http.StatusBadRequest, "invalid popularity_boost")
+		}
+	}
+	if raw := query.Get("gap_cutoff"); raw != "" {
+		gap, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, http.StatusBadRequest, "invalid gap_cutoff")
+		}
+		req.GapCutoff = &gap
+	}
+	req.DocumentTagFilter = query["document_tag"]
+
+	for name, target := range map[string]*int{"top_k": &req.TopK, "page": &req.Page, "limit": &req.Limit, "offset": &req.Offset, "group_size": &req.GroupSize, "min_k": &req.MinK, "max_k": &req.MaxK} {
+		if raw := query.Get(name); raw != "" {
+			if *target, err = strconv.Atoi(raw); err != nil {
+				return nil, errors.Wrap(err, http.StatusBadRequest, "invalid "+name)
+			}
+		}
+	}
+
+	return req, nil
+}
+
+func parseVectorCSV(raw string) ([]float64, error) {
+	parts := strings.Split(raw, ",")
+	vector := make([]float64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, fmt.Errorf("element %d is not a finite number", i)
+		}
+		vector[i] = value
+	}
+	return vector, nil
+}
+
+func parseVectorBase64(raw string) ([]float64, error) {
+	data, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		// Fall back to the URL-safe alphabet, which survives query strings
+		// without escaping
+		data, err = base64.URLEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 || len(data)%4 != 0 {
+		return nil, fmt.Errorf("packed vector length %d is not a multiple of 4", len(data))
+	}
+
+	vector := make([]float64, len(data)/4)
+	for i := range vector {
+		value := math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+			return nil, fmt.Errorf("element %d is not a finite number", i)
+		}
+		vector[i] = float64(value)
+	}
+	return vector, nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"sort"
+
+	"vectraDB/pkg/response"
+)
+
+// fitResults returns the leading results whose JSON array encoding fits in
+// maxBytes, so large metadata or echoed embeddings can't produce responses
+// thin clients run out of memory on. Truncation is recorded in meta, along
+// with the offset to request the rest from; a maxBytes of 0 returns every
+// result.
+func fitResults[T any](results []T, maxBytes int, meta *response.Meta) []T {
+	if maxBytes <= 0 {
+		return results
+	}
+
+	size := len("[]")
+	for i, result := range results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return results
+		}
+		if i > 0 {
+			size += len(",")
+		}
+		if size += len(data); size > maxBytes {
+			meta.Truncated = true
+			meta.TruncatedFrom = max(meta.Total, len(results))
+			meta.Returned = i
+			// Related vectors trail the page's results, so dropping only
+			// them leaves nothing to resume from. A single result too
+			// large to fit is skipped rather than offered again.
+			if i < len(results)-meta.Expanded {
+				hasNext := true
+				meta.HasNext = &hasNext
+				meta.NextOffset = meta.Offset + max(i, 1)
+			}
+			return results[:i]
+		}
+	}
+	return results
+}
+
+// fitGroups fits grouped results in maxBytes like fitResults, filling the
+// groups in key order from a budget they share and leaving out the groups
+// left without room. Groups can't be resumed from an offset, so a cut is
+// only recorded as truncated.
+func fitGroups[T any](groups map[string][]T, maxBytes int, meta *response.Meta) map[string][]T {
+	if maxBytes <= 0 {
+		return groups
+	}
+
+	keys := make([]string, 0, len(groups))
+	total := 0
+	for key, results := range groups {
+		keys = append(keys, key)
+		total += len(results)
+	}
+	sort.Strings(keys)
+
+	fitted := make(map[string][]T, len(groups))
+	remaining := maxBytes - len("{}")
+	returned := 0
+	for i, key := range keys {
+		name, err := json.Marshal(key)
+		if err != nil {
+			return groups
+		}
+		budget := remaining - len(name) - len(":")
+		if i > 0 {
+			budget -= len(",")
+		}
+		if budget < len("[]") {
+			meta.Truncated = true
+			break
+		}
+
+		group := &response.Meta{}
+		results := fitResults(groups[key], budget, group)
+		data, err := json.Marshal(results)
+		if err != nil {
+			return groups
+		}
+		remaining = budget - len(data)
+		fitted[key] = results
+		returned += len(results)
+		if group.Truncated {
+			meta.Truncated = true
+		}
+	}
+
+	if meta.Truncated {
+		meta.TruncatedFrom = total
+		meta.Returned = returned
+	}
+	return fitted
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/response"
+)
+
+// streamResults writes a successful search response in the same shape as
+// response.SuccessWithMeta, but encodes the results one at a time and
+// flushes every SEARCH_STREAM_FLUSH_RESULTS of them, so a large result set
+// is never buffered whole. HTTP/2 flow control then blocks the writes while
+// a slow client catches up. success follows the results, so an encoding
+// failure after the status was sent ends the body with an error instead.
+// It writes nothing and returns false when streaming is disabled or the
+// request isn't over HTTP/2.
+func streamResults[T any](h *Handler, w http.ResponseWriter, r *http.Request, results []T, meta *response.Meta) bool {
+	cfg := h.config.Load().Search
+	flusher, ok := w.(http.Flusher)
+	if !cfg.Stream || r.ProtoMajor != 2 || !ok {
+		return false
+	}
+	flushEvery := cfg.StreamFlushResults
+	if flushEvery <= 0 {
+		flushEvery = 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(`{"data":[`)); err != nil {
+		return true
+	}
+	for i := range results {
+		data, err := json.Marshal(&results[i])
+		if err != nil {
+			streamError(w, flusher, err)
+			return true
+		}
+		if i > 0 {
+			data = append([]byte(","), data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return true // The client went away
+		}
+		if (i+1)%flushEvery == 0 {
+			flusher.Flush()
+		}
+	}
+
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		streamError(w, flusher, err)
+		return true
+	}
+	trailer := `],"success":true,"meta":` + string(metaData)
+	if now := response.Timestamp(w); !now.IsZero() {
+		timestamp, err := json.Marshal(now)
+		if err != nil {
+			streamError(w, flusher, err)
+			return true
+		}
+		trailer += `,"timestamp":` + string(timestamp)
+	}
+	w.Write([]byte(trailer + "}\n"))
+	flusher.Flush()
+	return true
+}
+
+// streamError ends a streamed response whose results failed to encode,
+// closing the results array and reporting the failure in place of success.
+func streamError(w http.ResponseWriter, flusher http.Flusher, err error) {
+	logger.WithError(err).Error("Failed to encode streamed search results")
+	errInfo, _ := json.Marshal(&response.ErrorInfo{
+		Code:    http.StatusInternalServerError,
+		Message: "failed to encode search results",
+	})
+	w.Write([]byte(`],"success":false,"error":` + string(errInfo) + "}\n"))
+	flusher.Flush()
+}
+
+// writeSearchResults writes a page of vector search results with their
+// embeddings in format, streaming them when enabled.
+func (h *Handler) writeSearchResults(w http.ResponseWriter, r *http.Request, results []models.SearchResult, format *vectorFormat, meta *response.Meta) {
+	maxBytes := h.config.Load().Search.MaxResponseBytes
+	if format != nil {
+		formatted := fitResults(format.searchResults(results), maxBytes, meta)
+		if !streamResults(h, w, r, formatted, meta) {
+			response.SuccessWithMeta(w, formatted, meta)
+		}
+		return
+	}
+
+	results = fitResults(results, maxBytes, meta)
+	if !streamResults(h, w, r, results, meta) {
+		response.SuccessWithMeta(w, results, meta)
+	}
+}
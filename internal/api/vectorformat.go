@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// Formats embeddings can be returned in, chosen per request with the
+// vector_format query parameter
+const (
+	vectorFormatFloat64 = "float64"
+	vectorFormatFloat32 = "float32"
+	vectorFormatBase64  = "base64"
+	vectorFormatRounded = "rounded"
+)
+
+const (
+	defaultVectorDecimals = 4
+	maxVectorDecimals     = 15
+)
+
+// vectorFormat is how the embeddings of a response are written. float32
+// writes each value with the shortest representation a float32 round-trips
+// through, rounded with decimals digits after the point and base64 packs
+// little-endian float32 values into a string, like the vector_b64 query
+// parameter reads. The nil format writes full float64 values.
+type vectorFormat struct {
+	name     string
+	decimals int
+}
+
+// parseVectorFormat reads the vector_format and vector_decimals query
+// parameters, returning nil for the default float64 format.
+func parseVectorFormat(query url.Values) (*vectorFormat, error) {
+	format := &vectorFormat{name: query.Get("vector_format"), decimals: defaultVectorDecimals}
+	switch format.name {
+	case "", vectorFormatFloat64:
+		return nil, nil
+	case vectorFormatFloat32, vectorFormatBase64:
+	case vectorFormatRounded:
+		if raw := query.Get("vector_decimals"); raw != "" {
+			decimals, err := strconv.Atoi(raw)
+			if err != nil || decimals < 0 || decimals > maxVectorDecimals {
+				return nil, errors.New(http.StatusBadRequest, "invalid vector_decimals").WithDetails(raw)
+			}
+			format.decimals = decimals
+		}
+	default:
+		return nil, errors.New(http.StatusBadRequest, "invalid vector_format").WithDetails(format.name)
+	}
+	return format, nil
+}
+
+// encode returns values in the format, to be marshaled in their place.
+func (f *vectorFormat) encode(values []float64) interface{} {
+	if values == nil {
+		return nil
+	}
+	switch f.name {
+	case vectorFormatFloat32:
+		encoded := make([]float32, len(values))
+		for i, value := range values {
+			encoded[i] = float32(value)
+		}
+		return encoded
+	case vectorFormatBase64:
+		data := make([]byte, 4*len(values))
+		for i, value := range values {
+			binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(float32(value)))
+		}
+		return base64.StdEncoding.EncodeToString(data)
+	default:
+		scale := math.Pow(10, float64(f.decimals))
+		encoded := make([]float64, len(values))
+		for i, value := range values {
+			encoded[i] = math.Round(value*scale) / scale
+		}
+		return encoded
+	}
+}
+
+// storedVector names models.Vector so formattedVector can embed it next to
+// the fields it overrides.
+type storedVector = models.Vector
+
+// formattedVector marshals like the vector it embeds, with its embeddings
+// written in a vectorFormat.
+type formattedVector struct {
+	*storedVector
+	Vector       interface{}            `json:"vector"`
+	NamedVectors map[string]interface{} `json:"named_vectors,omitempty"`
+}
+
+func (f *vectorFormat) vector(vector *models.Vector) *formattedVector {
+	if vector == nil {
+		return nil
+	}
+	formatted := &formattedVector{storedVector: vector, Vector: f.encode(vector.Vector)}
+	if len(vector.NamedVectors) > 0 {
+		formatted.NamedVectors = make(map[string]interface{}, len(vector.NamedVectors))
+		for name, values := range vector.NamedVectors {
+			formatted.NamedVectors[name] = f.encode(values)
+		}
+	}
+	return formatted
+}
+
+func (f *vectorFormat) vectors(vectors []*models.Vector) []*formattedVector {
+	formatted := make([]*formattedVector, len(vectors))
+	for i, vector := range vectors {
+		formatted[i] = f.vector(vector)
+	}
+	return formatted
+}
+
+type formattedResult struct {
+	*models.SearchResult
+	Vector *formattedVector `json:"vector"`
+}
+
+func (f *vectorFormat) searchResults(results []models.SearchResult) []formattedResult {
+	formatted := make([]formattedResult, len(results))
+	for i := range results {
+		formatted[i] = formattedResult{SearchResult: &results[i], Vector: f.vector(&results[i].Vector)}
+	}
+	return formatted
+}
+
+type formattedHybridResult struct {
+	*models.HybridSearchResult
+	Vector *formattedVector `json:"vector,omitempty"`
+}
+
+func (f *vectorFormat) hybridResults(results []models.HybridSearchResult) []formattedHybridResult {
+	formatted := make([]formattedHybridResult, len(results))
+	for i := range results {
+		formatted[i] = formattedHybridResult{HybridSearchResult: &results[i], Vector: f.vector(results[i].Vector)}
+	}
+	return formatted
+}
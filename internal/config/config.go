@@ -3,13 +3,17 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Logging  LoggingConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Logging   LoggingConfig
+	Search    SearchConfig
+	Debug     DebugConfig
+	Analytics AnalyticsConfig
 }
 
 type ServerConfig struct {
@@ -17,16 +21,213 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// MaxConns bounds the number of in-flight API requests, 0 means
+	// unbounded.
+	MaxConns int
+	// RateLimit is the number of requests per second accepted by the API,
+	// 0 disables rate limiting.
+	RateLimit int
+	// AdminToken is the bearer token required on admin routes
+	AdminToken string
+	// StrictJSON rejects request bodies containing unknown fields
+	StrictJSON bool
+	// MaxDimension bounds the length of vectors in request bodies, 0 means
+	// unbounded.
+	MaxDimension int
+	// MaxBodyBytes caps the size of JSON request bodies, 0 means unbounded.
+	MaxBodyBytes int64
+	// AtomicBatchUpdates makes batch updates all-or-nothing unless a
+	// request says otherwise.
+	AtomicBatchUpdates bool
+	// UpsertOnPut makes PUT on a vector that doesn't exist create it rather
+	// than fail with not found.
+	UpsertOnPut bool
+	// IndexExportLimit bounds the entries of a page of the index export.
+	IndexExportLimit int
+	// ResponseTimestamps stamps responses with the time they were sent.
+	ResponseTimestamps bool
 }
 
 type DatabaseConfig struct {
-	Path    string
-	Timeout time.Duration
+	Path                string
+	Timeout             time.Duration
+	SoftDelete          bool
+	CompactionThreshold float64
+	StrictLoad          bool
+	AutoMigrate         bool
+	ReadThrough         bool
+	Precision           string
+	SparseThreshold     float64
+
+	// CursorSecret signs pagination cursors, which expire after CursorTTL
+	CursorSecret string
+	CursorTTL    time.Duration
+
+	Quantization string
+	PQSubspaces  int
+	PQTrainSize  int
+	PQRescore    int
+	PQCacheSize  int
+
+	IndexType      string
+	IndexThreshold int
+	IndexAlgorithm string
+	IndexEfSearch  int
+	IndexProbes    int
+	// CollectionKey is the metadata key naming the collection of a vector.
+	CollectionKey string
+	// AccessStats counts vector retrievals for popularity ranking,
+	// flushing them every AccessFlushInterval.
+	AccessStats         bool
+	AccessFlushInterval time.Duration
+	// DefragInterval schedules defragmenting the database file inside
+	// DefragWindow, 0 disables it, once DefragMinFreeRatio of its pages
+	// are free.
+	DefragInterval     time.Duration
+	DefragWindow       string
+	DefragMinFreeRatio float64
+	// IndexFallback reruns index searches recalling too little exactly.
+	IndexFallback         bool
+	IndexFallbackMinScore float64
+
+	// KeywordMaxPostings bounds the BM25 statistics kept for hybrid search
+	KeywordMaxPostings int
+	// KeywordCountEmpty counts vectors without text towards BM25 statistics
+	KeywordCountEmpty bool
+
+	// InsertHooks names the built-in hooks run on inserted vectors
+	InsertHooks []string
+
+	DocumentRetention     time.Duration
+	DocumentSweepInterval time.Duration
+
+	ValidateIDs bool
+	IDPattern   string
+
+	MaxMetadataEntries     int
+	MaxMetadataKeyLength   int
+	MaxMetadataValueLength int
+
+	// NormalizeMetadata lowercases and trims metadata keys, values and
+	// filters, PreserveOriginalMetadata keeps the metadata as written
+	NormalizeMetadata        bool
+	PreserveOriginalMetadata bool
 }
 
 type LoggingConfig struct {
 	Level  string
 	Format string
+	// RequestIDs adds the request ID to logs emitted by the store
+	RequestIDs bool
+	// RouteLevels sets the level and sample rate requests to some routes
+	// are logged at, see middleware.ParseRouteLogLevels
+	RouteLevels []string
+}
+
+type SearchConfig struct {
+	// MaxConcurrent bounds the number of in-flight search requests,
+	// 0 means unbounded.
+	MaxConcurrent int
+	// SlowQueryThreshold logs searches that take longer than this,
+	// 0 disables slow query logging.
+	SlowQueryThreshold time.Duration
+	// SkipZeroVectors leaves zero-magnitude vectors out of results
+	// instead of scoring them 0.
+	SkipZeroVectors bool
+	// MaxCandidates bounds the vectors scored per search, scoring a random
+	// sample above it, 0 scores every candidate.
+	MaxCandidates int
+	// MaxRadiusResults caps the results of a radius search.
+	MaxRadiusResults int
+	// Calibration sets a confidence on vector search results, "" or
+	// "sigmoid" mapping CalibrationMidpoint to 0.5 with CalibrationSlope.
+	Calibration         string
+	CalibrationSlope    float64
+	CalibrationMidpoint float64
+	// ClusterCount is the number of topic clusters searches can report the
+	// query's cluster of, 0 sizes them to the store; ClusterLabelKey is the
+	// metadata key labelling them.
+	ClusterCount    int
+	ClusterLabelKey string
+	// MaxAdhocVectors bounds the vectors of an ad-hoc search.
+	MaxAdhocVectors int
+	// MaxGroups bounds the groups returned by a grouped search.
+	MaxGroups int
+	// MaxResponseBytes caps the encoded size of the results returned by a
+	// search, dropping the lowest ranked ones, 0 means unbounded.
+	MaxResponseBytes int
+	// ProfileRate is the fraction of vector searches whose candidate
+	// counts and per-phase timings are logged, 0 disables profiling.
+	ProfileRate float64
+	// ProfileSeed seeds the sampling of profiled searches, so the same
+	// sequence of searches is sampled on every run, 0 seeds it randomly.
+	ProfileSeed int
+	// NegativeWeight scales the penalty for similarity to negative examples
+	// in searches that don't set their own.
+	NegativeWeight float64
+	// SnapshotMaxAge bounds how long a search scores its snapshot of the
+	// store, 0 is unbounded.
+	SnapshotMaxAge time.Duration
+	// CacheSize is the number of vector search responses cached until the
+	// next write or CacheTTL, 0 disables the cache.
+	CacheSize int
+	CacheTTL  time.Duration
+	// CacheWarm is the number of the most frequent cached searches
+	// replayed on startup, 0 disables warming.
+	CacheWarm int
+	// VectorPooling combines the scores of a record's named vectors in
+	// searches that don't set their own, "none", "max" or "mean".
+	VectorPooling string
+	// OnDimensionMismatch fits queries of another dimension than the
+	// stored vectors in searches that don't set their own policy,
+	// "reject", "pad_zero" or "truncate".
+	OnDimensionMismatch string
+	// RequireWeights rejects searches with both a query vector and text
+	// but no weights instead of weighting them equally.
+	RequireWeights bool
+	// MaxQueryTerms bounds the distinct terms of keyword queries, longer
+	// ones are truncated to their rarest terms or rejected by OnLongQuery,
+	// "truncate" or "reject".
+	MaxQueryTerms int
+	OnLongQuery   string
+	// FuzzyMinSimilarity is the lowest edit similarity a fuzzy match counts
+	// with, raising lower request bounds, and FuzzyMaxComparisons bounds
+	// the distinct tokens a fuzzy query is compared to.
+	FuzzyMinSimilarity  float64
+	FuzzyMaxComparisons int
+	// Stream writes vector search results to HTTP/2 clients as they are
+	// encoded, flushing every StreamFlushResults results, instead of
+	// buffering the whole response. It also enables cleartext HTTP/2.
+	Stream             bool
+	StreamFlushResults int
+}
+
+type DebugConfig struct {
+	// LogBodies logs request and response bodies with the request ID. It
+	// is expensive and may leak data, so it is off by default.
+	LogBodies bool
+	// LogBodyRoutes restricts body logging to routes starting with one of
+	// these prefixes, relative to where the API is mounted such as
+	// /vectors, empty logs every route.
+	LogBodyRoutes []string
+	// MaxBodyBytes caps the logged size of each body.
+	MaxBodyBytes int
+	// RedactFields are JSON keys whose values are replaced in logged bodies.
+	RedactFields []string
+}
+
+type AnalyticsConfig struct {
+	// Enabled records search queries for the admin analytics endpoint.
+	// Query vectors are never recorded, only their dimension.
+	Enabled bool
+	// Feedback accepts and stores the results users clicked after
+	// searching, for per-query click-through rates.
+	Feedback bool
+	// FlushInterval is how often recorded searches and feedback are
+	// written to disk; those older than Retention are pruned, 0 keeps
+	// them indefinitely.
+	FlushInterval time.Duration
+	Retention     time.Duration
 }
 
 func Load() *Config {
@@ -36,14 +237,131 @@ func Load() *Config {
 			ReadTimeout:  getDurationEnv("READ_TIMEOUT", 30*time.Second),
 			WriteTimeout: getDurationEnv("WRITE_TIMEOUT", 30*time.Second),
 			IdleTimeout:  getDurationEnv("IDLE_TIMEOUT", 120*time.Second),
+			MaxConns:     getIntEnv("MAX_CONNS", 0),
+			RateLimit:    getIntEnv("RATE_LIMIT", 0),
+			AdminToken:   getEnv("ADMIN_TOKEN", ""),
+			StrictJSON:   getBoolEnv("STRICT_JSON", false),
+			MaxDimension: getIntEnv("MAX_VECTOR_DIMENSION", 10000),
+			MaxBodyBytes: int64(getIntEnv("MAX_BODY_BYTES", 64<<20)),
+
+			AtomicBatchUpdates: getBoolEnv("BATCH_ATOMIC_UPDATES", false),
+			UpsertOnPut:        getBoolEnv("UPSERT_ON_PUT", false),
+			IndexExportLimit:   getIntEnv("INDEX_EXPORT_LIMIT", 10000),
+			ResponseTimestamps: getBoolEnv("RESPONSE_TIMESTAMPS", true),
 		},
 		Database: DatabaseConfig{
 			Path:    getEnv("DB_PATH", "vectra.db"),
 			Timeout: getDurationEnv("DB_TIMEOUT", 1*time.Second),
+
+			SoftDelete:          getBoolEnv("DB_SOFT_DELETE", false),
+			CompactionThreshold: getFloatEnv("DB_COMPACTION_THRESHOLD", 0.2),
+			StrictLoad:          getBoolEnv("DB_STRICT_LOAD", false),
+			AutoMigrate:         getBoolEnv("DB_AUTO_MIGRATE", true),
+			ReadThrough:         getBoolEnv("DB_READ_THROUGH", false),
+			Precision:           getEnv("DB_PRECISION", "float64"),
+			SparseThreshold:     getFloatEnv("DB_SPARSE_THRESHOLD", 0),
+
+			CursorSecret: getEnv("CURSOR_SECRET", ""),
+			CursorTTL:    getDurationEnv("CURSOR_TTL", 24*time.Hour),
+
+			Quantization: getEnv("DB_QUANTIZATION", ""),
+			PQSubspaces:  getIntEnv("DB_PQ_SUBSPACES", 8),
+			PQTrainSize:  getIntEnv("DB_PQ_TRAIN_SIZE", 1000),
+			PQRescore:    getIntEnv("DB_PQ_RESCORE", 100),
+			PQCacheSize:  getIntEnv("DB_PQ_CACHE_SIZE", 0),
+
+			IndexType:      getEnv("DB_INDEX_TYPE", "flat"),
+			IndexThreshold: getIntEnv("DB_INDEX_THRESHOLD", 10000),
+			IndexAlgorithm: getEnv("DB_INDEX_ALGORITHM", "hnsw"),
+			IndexEfSearch:  getIntEnv("DB_INDEX_EF_SEARCH", 64),
+			IndexProbes:    getIntEnv("DB_INDEX_PROBES", 8),
+
+			IndexFallback:         getBoolEnv("DB_INDEX_FALLBACK", false),
+			IndexFallbackMinScore: getFloatEnv("DB_INDEX_FALLBACK_MIN_SCORE", 0),
+
+			CollectionKey: getEnv("DB_COLLECTION_KEY", "collection"),
+
+			AccessStats:         getBoolEnv("DB_ACCESS_STATS", false),
+			AccessFlushInterval: getDurationEnv("DB_ACCESS_FLUSH_INTERVAL", time.Minute),
+
+			DefragInterval:     getDurationEnv("DB_DEFRAG_INTERVAL", 0),
+			DefragWindow:       getEnv("DB_DEFRAG_WINDOW", ""),
+			DefragMinFreeRatio: getFloatEnv("DB_DEFRAG_MIN_FREE_RATIO", 0.2),
+
+			KeywordMaxPostings: getIntEnv("DB_KEYWORD_MAX_POSTINGS", 10000000),
+			KeywordCountEmpty:  getBoolEnv("DB_KEYWORD_COUNT_EMPTY", false),
+
+			InsertHooks: getListEnv("DB_INSERT_HOOKS"),
+
+			DocumentRetention:     getDurationEnv("DB_DOCUMENT_RETENTION", 0),
+			DocumentSweepInterval: getDurationEnv("DB_DOCUMENT_SWEEP_INTERVAL", time.Minute),
+
+			ValidateIDs: getBoolEnv("DB_VALIDATE_IDS", false),
+			IDPattern:   getEnv("DB_ID_PATTERN", ""),
+
+			MaxMetadataEntries:     getIntEnv("MAX_METADATA_ENTRIES", 100),
+			MaxMetadataKeyLength:   getIntEnv("MAX_METADATA_KEY_LENGTH", 256),
+			MaxMetadataValueLength: getIntEnv("MAX_METADATA_VALUE_LENGTH", 4096),
+
+			NormalizeMetadata:        getBoolEnv("DB_NORMALIZE_METADATA", false),
+			PreserveOriginalMetadata: getBoolEnv("DB_PRESERVE_ORIGINAL_METADATA", false),
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("LOG_LEVEL", "info"),
-			Format: getEnv("LOG_FORMAT", "json"),
+			Level:      getEnv("LOG_LEVEL", "info"),
+			Format:     getEnv("LOG_FORMAT", "json"),
+			RequestIDs: getBoolEnv("LOG_REQUEST_IDS", true),
+
+			RouteLevels: getListEnv("LOG_ROUTE_LEVELS"),
+		},
+		Search: SearchConfig{
+			MaxConcurrent:      getIntEnv("SEARCH_MAX_CONCURRENT", 0),
+			SlowQueryThreshold: getDurationEnv("SLOW_QUERY_THRESHOLD", 0),
+			SkipZeroVectors:    getBoolEnv("SEARCH_SKIP_ZERO_VECTORS", false),
+			MaxCandidates:      getIntEnv("SEARCH_MAX_CANDIDATES", 0),
+			MaxRadiusResults:   getIntEnv("SEARCH_MAX_RADIUS_RESULTS", 1000),
+			MaxGroups:          getIntEnv("SEARCH_MAX_GROUPS", 100),
+			MaxResponseBytes:   getIntEnv("SEARCH_MAX_RESPONSE_BYTES", 0),
+			ProfileRate:        getFloatEnv("SEARCH_PROFILE_RATE", 0),
+			ProfileSeed:        getIntEnv("SEARCH_PROFILE_SEED", 0),
+			NegativeWeight:     getFloatEnv("SEARCH_NEGATIVE_WEIGHT", 0.5),
+			SnapshotMaxAge:     getDurationEnv("SEARCH_SNAPSHOT_MAX_AGE", 0),
+			CacheSize:          getIntEnv("SEARCH_CACHE_SIZE", 0),
+			CacheTTL:           getDurationEnv("SEARCH_CACHE_TTL", time.Minute),
+			CacheWarm:          getIntEnv("SEARCH_CACHE_WARM", 0),
+			VectorPooling:      getEnv("SEARCH_VECTOR_POOLING", "none"),
+			Stream:             getBoolEnv("SEARCH_STREAM", false),
+			StreamFlushResults: getIntEnv("SEARCH_STREAM_FLUSH_RESULTS", 100),
+
+			Calibration:         getEnv("SEARCH_CALIBRATION", ""),
+			CalibrationSlope:    getFloatEnv("SEARCH_CALIBRATION_SLOPE", 10),
+			CalibrationMidpoint: getFloatEnv("SEARCH_CALIBRATION_MIDPOINT", 0.5),
+
+			ClusterCount:    getIntEnv("SEARCH_CLUSTER_COUNT", 0),
+			ClusterLabelKey: getEnv("SEARCH_CLUSTER_LABEL_KEY", ""),
+
+			MaxAdhocVectors: getIntEnv("SEARCH_MAX_ADHOC_VECTORS", 10000),
+
+			OnDimensionMismatch: getEnv("SEARCH_ON_DIMENSION_MISMATCH", "reject"),
+
+			RequireWeights: getBoolEnv("SEARCH_REQUIRE_WEIGHTS", false),
+
+			MaxQueryTerms: getIntEnv("SEARCH_MAX_QUERY_TERMS", 128),
+			OnLongQuery:   getEnv("SEARCH_ON_LONG_QUERY", "truncate"),
+
+			FuzzyMinSimilarity:  getFloatEnv("SEARCH_FUZZY_MIN_SIMILARITY", 0),
+			FuzzyMaxComparisons: getIntEnv("SEARCH_FUZZY_MAX_COMPARISONS", 10000),
+		},
+		Debug: DebugConfig{
+			LogBodies:     getBoolEnv("DEBUG_LOG_BODIES", false),
+			LogBodyRoutes: getListEnv("DEBUG_LOG_BODY_ROUTES"),
+			MaxBodyBytes:  getIntEnv("DEBUG_MAX_BODY_BYTES", 4096),
+			RedactFields:  getListEnv("DEBUG_REDACT_FIELDS"),
+		},
+		Analytics: AnalyticsConfig{
+			Enabled:       getBoolEnv("ANALYTICS_ENABLED", false),
+			Feedback:      getBoolEnv("ANALYTICS_FEEDBACK", false),
+			FlushInterval: getDurationEnv("ANALYTICS_FLUSH_INTERVAL", time.Second),
+			Retention:     getDurationEnv("ANALYTICS_RETENTION", 30*24*time.Hour),
 		},
 	}
 }
@@ -55,6 +373,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getListEnv splits a comma-separated variable, dropping empty entries.
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -73,6 +402,15 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getBoolEnv(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"time"
 
@@ -27,23 +29,48 @@ func New(config Config) *Logger {
 	log.SetLevel(level)
 
 	// Set log format
-	if config.Format == "json" {
-		log.SetFormatter(&logrus.JSONFormatter{
-			TimestampFormat: time.RFC3339,
-		})
-	} else {
-		log.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp:   true,
-			TimestampFormat: time.RFC3339,
-		})
-	}
+	formatter, err := NewFormatter(config.Format)
+	log.SetFormatter(formatter)
 
 	// Set output
 	log.SetOutput(os.Stdout)
 
+	if err != nil {
+		log.WithError(err).Warn("Falling back to json log format")
+	}
+
 	return &Logger{Logger: log}
 }
 
+// NewFormatter returns the formatter for a log format: "json", "text" or
+// "console", a human-friendly format for local development that is colored
+// when writing to a terminal. Unknown formats return an error along with
+// the json formatter.
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "json", "":
+		return &logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339,
+		}, nil
+	case "text":
+		return &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+		}, nil
+	case "console":
+		// Colors are enabled by logrus only when the output is a terminal
+		return &logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: "15:04:05.000",
+			PadLevelText:    true,
+		}, nil
+	default:
+		return &logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339,
+		}, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
 func (l *Logger) WithField(key string, value interface{}) *logrus.Entry {
 	return l.Logger.WithField(key, value)
 }
@@ -62,6 +89,33 @@ func Init(config Config) {
 	Default = New(config)
 }
 
+// SetLevel changes the level of the default logger at runtime.
+func SetLevel(level string) error {
+	if Default == nil {
+		Init(Config{Level: "info", Format: "json"})
+	}
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Default.SetLevel(parsed)
+	return nil
+}
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the ID of the HTTP
+// request it serves, so code below the HTTP layer can log it.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
 func WithField(key string, value interface{}) *logrus.Entry {
 	if Default == nil {
 		Init(Config{Level: "info", Format: "json"})
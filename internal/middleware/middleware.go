@@ -1,36 +1,47 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/sirupsen/logrus"
 	"vectraDB/internal/logger"
+	"vectraDB/pkg/errors"
+	"vectraDB/pkg/response"
 )
 
-func LoggingMiddleware() func(http.Handler) http.Handler {
+// LoggingMiddleware logs every request at info, or at the level and sample
+// rate of the route it matches in routes.
+func LoggingMiddleware(routes []RouteLogLevel) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			
+
 			// Wrap the response writer to capture status code
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-			
+
 			// Process the request
 			next.ServeHTTP(ww, r)
-			
+
 			// Log the request
 			duration := time.Since(start)
-			
+			level, rate := routeLogLevel(routes, r)
+			if !sampled(rate) {
+				return
+			}
+
 			logger.WithFields(logrus.Fields{
-				"method":     r.Method,
-				"url":        r.URL.String(),
-				"status":     ww.Status(),
-				"duration":   duration.String(),
+				"method":      r.Method,
+				"url":         r.URL.String(),
+				"status":      ww.Status(),
+				"duration":    duration.String(),
 				"remote_addr": r.RemoteAddr,
-				"user_agent": r.UserAgent(),
-			}).Info("HTTP request")
+				"user_agent":  r.UserAgent(),
+			}).Log(level, "HTTP request")
 		})
 	}
 }
@@ -40,7 +51,7 @@ func CORSMiddleware() func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Set CORS headers
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
 			w.Header().Set("Access-Control-Expose-Headers", "Link")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
@@ -63,16 +74,16 @@ func RecoveryMiddleware() func(http.Handler) http.Handler {
 			defer func() {
 				if err := recover(); err != nil {
 					logger.WithFields(logrus.Fields{
-						"error":   err,
-						"method":  r.Method,
-						"url":     r.URL.String(),
+						"error":       err,
+						"method":      r.Method,
+						"url":         r.URL.String(),
 						"remote_addr": r.RemoteAddr,
 					}).Error("Panic recovered")
-					
+
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				}
 			}()
-			
+
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -82,8 +93,20 @@ func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
 	return middleware.Timeout(timeout)
 }
 
+// RequestIDMiddleware assigns each request an ID and carries it in the
+// request context for logger.RequestID.
 func RequestIDMiddleware() func(http.Handler) http.Handler {
-	return middleware.RequestID
+	return func(next http.Handler) http.Handler {
+		return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := logger.ContextWithRequestID(r.Context(), middleware.GetReqID(r.Context()))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}))
+	}
+}
+
+// GetRequestID returns the ID assigned by RequestIDMiddleware, if any.
+func GetRequestID(ctx context.Context) string {
+	return logger.RequestID(ctx)
 }
 
 func RealIPMiddleware() func(http.Handler) http.Handler {
@@ -93,3 +116,21 @@ func RealIPMiddleware() func(http.Handler) http.Handler {
 func CompressMiddleware() func(http.Handler) http.Handler {
 	return middleware.Compress(5)
 }
+
+// AdminAuthMiddleware requires a bearer token matching token. An empty token
+// leaves the routes open, which is only suitable for local development.
+func AdminAuthMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token != "" {
+				provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+					response.Error(w, errors.ErrUnauthorized)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
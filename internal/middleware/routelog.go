@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RouteLogLevel sets how requests to the routes starting with Prefix, and
+// using Method when it is set, are logged: at Level, and for only a
+// SampleRate fraction of them.
+type RouteLogLevel struct {
+	Method     string
+	Prefix     string
+	Level      logrus.Level
+	SampleRate float64
+}
+
+// ParseRouteLogLevels parses route log levels of the form
+// "[METHOD ]PREFIX=LEVEL[:RATE]", such as "POST /api/v1/vectors=info" or
+// "/api/v1/search=debug:0.1". Invalid entries are skipped and reported in
+// the returned error.
+func ParseRouteLogLevels(specs []string) ([]RouteLogLevel, error) {
+	routes := make([]RouteLogLevel, 0, len(specs))
+	var invalid []string
+	for _, spec := range specs {
+		route, err := parseRouteLogLevel(spec)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q: %v", spec, err))
+			continue
+		}
+		routes = append(routes, route)
+	}
+	if len(invalid) > 0 {
+		return routes, fmt.Errorf("invalid route log levels %s", strings.Join(invalid, ", "))
+	}
+	return routes, nil
+}
+
+func parseRouteLogLevel(spec string) (RouteLogLevel, error) {
+	route, setting, ok := strings.Cut(spec, "=")
+	if !ok {
+		return RouteLogLevel{}, fmt.Errorf("missing level")
+	}
+	r := RouteLogLevel{Prefix: strings.TrimSpace(route), SampleRate: 1}
+	if method, prefix, ok := strings.Cut(r.Prefix, " "); ok {
+		r.Method, r.Prefix = strings.ToUpper(method), strings.TrimSpace(prefix)
+	}
+
+	level, rate, sampled := strings.Cut(setting, ":")
+	var err error
+	if r.Level, err = logrus.ParseLevel(strings.TrimSpace(level)); err != nil {
+		return RouteLogLevel{}, err
+	}
+	if sampled {
+		if r.SampleRate, err = strconv.ParseFloat(strings.TrimSpace(rate), 64); err != nil || r.SampleRate < 0 || r.SampleRate > 1 {
+			return RouteLogLevel{}, fmt.Errorf("sample rate must be between 0 and 1")
+		}
+	}
+	return r, nil
+}
+
+// routeLogLevel returns the level and sample rate requests are logged with,
+// from the matching route with the longest prefix. Requests matching no
+// route are logged at info.
+func routeLogLevel(routes []RouteLogLevel, r *http.Request) (logrus.Level, float64) {
+	level, rate, longest := logrus.InfoLevel, 1.0, -1
+	for _, route := range routes {
+		if route.Method != "" && route.Method != r.Method {
+			continue
+		}
+		if strings.HasPrefix(r.URL.Path, route.Prefix) && len(route.Prefix) > longest {
+			level, rate, longest = route.Level, route.SampleRate, len(route.Prefix)
+		}
+	}
+	return level, rate
+}
+
+// sampled reports whether to log a request logged at rate.
+func sampled(rate float64) bool {
+	return rate >= 1 || rand.Float64() < rate
+}
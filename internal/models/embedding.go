@@ -0,0 +1,73 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// Embedding is an embedding given in a request, whose length is checked
+// against the maximum dimension as the request is decoded.
+type Embedding []float64
+
+// maxDimension bounds the length of decoded embeddings, 0 is unbounded
+var maxDimension atomic.Int64
+
+// SetMaxDimension sets the maximum length of embeddings decoded from
+// requests, 0 for none. Decoding is process-wide, so the last limit set
+// applies to every handler.
+func SetMaxDimension(max int) {
+	maxDimension.Store(int64(max))
+}
+
+// DimensionError is returned for an embedding in a request longer than the
+// maximum dimension.
+type DimensionError struct {
+	Max int
+}
+
+func (e *DimensionError) Error() string {
+	return fmt.Sprintf("vector has more than %d dimensions", e.Max)
+}
+
+// UnmarshalJSON decodes null to a nil embedding and [] to an empty, non-nil
+// one, so validation can tell a vector left out, which "required" rejects
+// and "omitempty" skips, from an empty one, which "min=1" rejects. Values
+// are read one at a time and decoding stops with a DimensionError as soon
+// as there are more than the maximum dimension, so an oversized embedding
+// is never allocated.
+func (e *Embedding) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		*e = nil
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return &json.UnmarshalTypeError{Value: fmt.Sprint(token), Type: reflect.TypeOf(*e)}
+	}
+
+	max := int(maxDimension.Load())
+	values := make([]float64, 0)
+	for decoder.More() {
+		if max > 0 && len(values) == max {
+			return &DimensionError{Max: max}
+		}
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		value, ok := token.(float64)
+		if !ok {
+			return &json.UnmarshalTypeError{Value: fmt.Sprint(token), Type: reflect.TypeOf(value)}
+		}
+		values = append(values, value)
+	}
+	*e = values
+	return nil
+}
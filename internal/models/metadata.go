@@ -0,0 +1,88 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// literalPrefix marks metadata values given as JSON numbers or booleans,
+// which are kept in their literal form after it. String values starting
+// with it are rejected.
+const literalPrefix = "\x00"
+
+// Metadata maps keys to scalar values. Values are stored as strings;
+// numbers and booleans are accepted in JSON input, kept in their literal
+// form, so an integer 2020 is stored as "2020" rather than a float, and
+// written back as the JSON numbers and booleans they were. Filters and
+// indexes match values by MetadataText, so a filter on 2020 matches the
+// integer exactly.
+type Metadata map[string]string
+
+// MetadataText returns the literal form of a metadata value, whether it was
+// given as a string, a number or a boolean.
+func MetadataText(value string) string {
+	return strings.TrimPrefix(value, literalPrefix)
+}
+
+// MetadataLiteral returns the value a JSON number or boolean literal is
+// stored as.
+func MetadataLiteral(literal string) string {
+	return literalPrefix + literal
+}
+
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+
+	raw := make(map[string]json.RawMessage, len(m))
+	for key, value := range m {
+		if literal, ok := strings.CutPrefix(value, literalPrefix); ok {
+			raw[key] = json.RawMessage(literal)
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		raw[key] = data
+	}
+	return json.Marshal(raw)
+}
+
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*m = nil
+		return nil
+	}
+
+	metadata := make(Metadata, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			if strings.HasPrefix(v, literalPrefix) {
+				return fmt.Errorf("metadata value for key %q must not start with a NUL character", key)
+			}
+			metadata[key] = v
+		case json.Number:
+			metadata[key] = MetadataLiteral(v.String())
+		case bool:
+			metadata[key] = MetadataLiteral(strconv.FormatBool(v))
+		default:
+			return fmt.Errorf("metadata value for key %q must be a string, number or boolean", key)
+		}
+	}
+
+	*m = metadata
+	return nil
+}
@@ -5,12 +5,26 @@ import (
 )
 
 type Vector struct {
-	ID       string            `json:"id" validate:"required"`
-	Vector   []float64         `json:"vector" validate:"required,min=1"`
-	Text     string            `json:"text"`
-	Metadata map[string]string `json:"metadata,omitempty"`
-	CreatedAt time.Time        `json:"created_at"`
-	UpdatedAt time.Time        `json:"updated_at"`
+	ID       string    `json:"id" validate:"required"`
+	Vector   []float64 `json:"vector" validate:"required,min=1"`
+	Text     string    `json:"text"`
+	Metadata Metadata  `json:"metadata,omitempty"`
+	// EmbeddingModel and EmbeddingVersion record which model produced the
+	// embedding. Both are indexed and can be used as filter keys.
+	EmbeddingModel   string    `json:"embedding_model,omitempty"`
+	EmbeddingVersion string    `json:"embedding_version,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// DeletedAt is set on tombstones left behind by soft deletes
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Boost multiplies the vector's search score, 0 means no boost
+	Boost float64 `json:"boost,omitempty"`
+	// NamedVectors holds further embeddings of the record by name, such as
+	// of a document's title and summary, for searches to target or pool
+	NamedVectors map[string][]float64 `json:"named_vectors,omitempty"`
+	// OriginalMetadata is the metadata as written, kept when the store
+	// normalizes metadata and is configured to preserve it
+	OriginalMetadata Metadata `json:"original_metadata,omitempty"`
 }
 
 type Document struct {
@@ -20,37 +34,320 @@ type Document struct {
 	Tags      []string  `json:"tags,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// ExpiresAt is when the document stops being readable and becomes
+	// eligible for purging, nil keeps it indefinitely
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the document's retention has run out at now.
+func (d *Document) Expired(now time.Time) bool {
+	return d.ExpiresAt != nil && !now.Before(*d.ExpiresAt)
 }
 
 type SearchRequest struct {
-	Query   []float64          `json:"query" validate:"required,min=1"`
-	TopK    int                `json:"top_k" validate:"min=1,max=1000"`
-	Filter  map[string]string  `json:"filter,omitempty"`
-	Page    int                `json:"page,omitempty" validate:"min=1"`
-	Limit   int                `json:"limit,omitempty" validate:"min=1,max=100"`
+	Query   Embedding          `json:"query" validate:"required,min=1"`
+	TopK    int                `json:"top_k" validate:"omitempty,min=1,max=1000"`
+	Filter  Metadata           `json:"filter,omitempty"`
+	Page    int                `json:"page,omitempty" validate:"omitempty,min=1"`
+	Limit   int                `json:"limit,omitempty" validate:"omitempty,min=1,max=100"`
 	Weights map[string]float64 `json:"weights,omitempty"`
+	// Offset starts the window at this result instead of at Page, to
+	// resume after a truncated response
+	Offset int `json:"offset,omitempty" validate:"omitempty,min=0"`
+	// RecencyWeight blends an exponential decay of the vector's age into
+	// the score, 0 ranks by similarity alone
+	RecencyWeight float64 `json:"recency_weight,omitempty" validate:"min=0,max=1"`
+	// HalfLife is the age at which the recency component halves, as a Go
+	// duration string such as "24h"
+	HalfLife string `json:"half_life,omitempty"`
+	// MinScore drops results scoring below it
+	MinScore *float64 `json:"min_score,omitempty"`
+	// Radius returns every vector within this cosine distance (1 minus
+	// similarity, before recency and boosts) of the query instead of the
+	// top-k, up to the store's radius result cap
+	Radius *float64 `json:"radius,omitempty" validate:"omitempty,min=0,max=2"`
+	// CollapseBy keeps only the best result per distinct value of this
+	// metadata key, results without the key are kept
+	CollapseBy string `json:"collapse_by,omitempty"`
+	// GroupBy also returns the best GroupSize results, 1 by default, per
+	// distinct value of this metadata key, for the groups of the best
+	// results up to the store's group limit. Results without the key are
+	// left out of the groups
+	GroupBy   string `json:"group_by,omitempty"`
+	GroupSize int    `json:"group_size,omitempty" validate:"omitempty,min=1,max=100"`
+	// ExpandRelated appends the vectors listed in the related_ids metadata
+	// of the page's results, at most ExpandLimit of them. They must match
+	// the filters and MinScore like other results
+	ExpandRelated bool `json:"expand_related,omitempty"`
+	ExpandLimit   int  `json:"expand_limit,omitempty" validate:"omitempty,min=1,max=100"`
+	// GapCutoff sizes the results adaptively instead of returning the
+	// top-k: they are cut at the largest drop in score between consecutive
+	// results, when that drop is at least GapCutoff, keeping between MinK
+	// (default 1) and MaxK (default TopK) results
+	GapCutoff *float64 `json:"gap_cutoff,omitempty" validate:"omitempty,min=0"`
+	MinK      int      `json:"min_k,omitempty" validate:"omitempty,min=1,max=1000"`
+	MaxK      int      `json:"max_k,omitempty" validate:"omitempty,min=1,max=1000"`
+	// DocumentTagFilter keeps only vectors linked, by their document_id
+	// metadata, to a document with one of these tags
+	DocumentTagFilter []string `json:"document_tag_filter,omitempty"`
+	// Profile asks for a SearchProfile in the response
+	Profile bool `json:"-"`
+	// Metric ranks results by cosine similarity (the default), dot
+	// product or euclidean distance, scored as 1 / (1 + distance)
+	Metric string `json:"metric,omitempty" validate:"omitempty,oneof=cosine dot euclidean"`
+	// NegativeVectors and NegativeIDs are examples to rank away from. Each
+	// score is reduced by NegativeWeight times the mean similarity to them,
+	// NegativeWeight defaulting to the store's
+	NegativeVectors []Embedding `json:"negative_vectors,omitempty"`
+	NegativeIDs     []string    `json:"negative_ids,omitempty"`
+	NegativeWeight  float64     `json:"negative_weight,omitempty" validate:"min=0,max=1"`
+	// ScoreNormalization rescales the returned scores once results are
+	// ranked: raw leaves them as scored, unit maps them to 0..1 and rank
+	// replaces them with their percentile rank within the results. Defaults
+	// to unit for cosine and raw for the other metrics. MinScore and
+	// GapCutoff compare against the returned scores, and can't be combined
+	// with rank; Radius is a distance between raw cosine scores
+	ScoreNormalization string `json:"score_normalization,omitempty" validate:"omitempty,oneof=raw unit rank"`
+	// Target scores the named vector of each record with this name instead
+	// of its vector, skipping records without it. Pooling instead scores
+	// each record by the max or mean score of its vector and named vectors,
+	// defaulting to the store's
+	Target  string `json:"target,omitempty"`
+	Pooling string `json:"pooling,omitempty" validate:"omitempty,oneof=none max mean"`
+	// NormalizeQuery scales the query to unit length before scoring, so the
+	// dot metric ranks like cosine over unit-length vectors
+	NormalizeQuery bool `json:"normalize_query,omitempty"`
+	// ReturnCluster reports the topic cluster nearest the query
+	ReturnCluster bool `json:"return_cluster,omitempty"`
+	// OnDimensionMismatch is what a query of another dimension than most
+	// stored vectors does: reject skips the vectors it can't be scored
+	// against, pad_zero pads a shorter query with zeros and truncate cuts a
+	// longer one. Defaults to the store's
+	OnDimensionMismatch string `json:"on_dimension_mismatch,omitempty" validate:"omitempty,oneof=reject pad_zero truncate"`
+	// PopularityBoost multiplies scores by 1 plus it times the vector's
+	// popularity, 0..1 by the log of its retrieval count relative to the
+	// most retrieved vector. It needs the store to count retrievals
+	PopularityBoost float64 `json:"popularity_boost,omitempty" validate:"min=0,max=10"`
+	// ReturnPercentile sets the percentile rank of each result among every
+	// candidate scored, before the score threshold, top-k and pagination:
+	// the share of the other candidates scoring lower, from 1 for the best
+	// to 0 for the worst
+	ReturnPercentile bool `json:"return_percentile,omitempty"`
+	// Collection restricts the search to a collection, or to the collection
+	// an alias of this name points to
+	Collection string `json:"collection,omitempty"`
+}
+
+// Alias is a name for a collection. Previous is the collection it pointed
+// to before it was last set.
+type Alias struct {
+	Alias      string `json:"alias"`
+	Collection string `json:"collection"`
+	Previous   string `json:"previous,omitempty"`
+}
+
+type SetAliasRequest struct {
+	Collection string `json:"collection" validate:"required"`
+}
+
+// CollectionConfig overrides the store's defaults for a collection. Metric
+// is the metric searches of the collection use when they don't set one, and
+// Dimension, when set, is the only dimension its vectors may be written
+// with.
+type CollectionConfig struct {
+	Collection string `json:"collection"`
+	Metric     string `json:"metric,omitempty"`
+	Dimension  int    `json:"dimension,omitempty"`
+}
+
+type SetCollectionConfigRequest struct {
+	Metric    string `json:"metric,omitempty" validate:"omitempty,oneof=cosine dot euclidean"`
+	Dimension int    `json:"dimension,omitempty" validate:"min=0"`
+}
+
+// PopularVector is a vector and the number of times it was retrieved.
+type PopularVector struct {
+	ID    string `json:"id"`
+	Count int64  `json:"count"`
+}
+
+// QueryCluster is the topic cluster whose centroid is nearest a search
+// query. IDs change when the clusters are refitted, Label doesn't.
+type QueryCluster struct {
+	ID int `json:"id"`
+	// Label is the most common value of the label key in the cluster
+	Label string `json:"label,omitempty"`
+	// Size is the number of vectors in the cluster, Similarity the cosine
+	// similarity of the query to its centroid
+	Size       int     `json:"size"`
+	Similarity float64 `json:"similarity"`
+}
+
+// SearchProfile breaks down the cost of a vector search.
+type SearchProfile struct {
+	// Vectors is the number of vectors stored, Matched the number matching
+	// the filters and Candidates the number scored
+	Vectors    int
+	Matched    int
+	Candidates int
+	// Time spent filtering, scoring candidates and ranking the results
+	Filter time.Duration
+	Score  time.Duration
+	Rank   time.Duration
+}
+
+// Selectivity is the share of stored vectors matching the filters.
+func (p *SearchProfile) Selectivity() float64 {
+	if p.Vectors == 0 {
+		return 0
+	}
+	return float64(p.Matched) / float64(p.Vectors)
+}
+
+// BoostFactor returns the factor the vector's search score is multiplied by.
+func (v *Vector) BoostFactor() float64 {
+	if v.Boost == 0 {
+		return 1
+	}
+	return v.Boost
 }
 
+// RelatedIDsKey is the metadata key listing the comma-separated IDs of
+// vectors linked to a vector
+const RelatedIDsKey = "related_ids"
+
+// DocumentIDKey is the metadata key linking a vector to a document
+const DocumentIDKey = "document_id"
+
 type SearchResult struct {
 	Vector Vector  `json:"vector"`
 	Score  float64 `json:"score"`
+	// Confidence is the calibrated score, set when the store calibrates
+	// scores. Unlike Score it is comparable across queries
+	Confidence *float64 `json:"confidence,omitempty"`
+	// Percentile is the percentile rank of the result among every scored
+	// candidate, set when the search asks for it
+	Percentile *float64 `json:"percentile,omitempty"`
+	// ExpandedFrom is set on results added by ExpandRelated to the ID of
+	// the direct match that links to them
+	ExpandedFrom string `json:"expanded_from,omitempty"`
 }
 
+// Reasons reported when a search returns no results
+const (
+	ReasonEmptyStore        = "empty_store"
+	ReasonNoFilterMatch     = "no_filter_match"
+	ReasonBelowThreshold    = "below_threshold"
+	ReasonDimensionMismatch = "dimension_mismatch"
+	ReasonPageOutOfRange    = "page_out_of_range"
+)
+
+// Similarity metrics
+const (
+	MetricCosine    = "cosine"
+	MetricDot       = "dot"
+	MetricEuclidean = "euclidean"
+)
+
+// Poolings of the scores of a record's vectors
+const (
+	PoolingNone = "none"
+	PoolingMax  = "max"
+	PoolingMean = "mean"
+)
+
+// Policies for search queries of another dimension than the stored vectors
+const (
+	DimensionMismatchReject   = "reject"
+	DimensionMismatchPadZero  = "pad_zero"
+	DimensionMismatchTruncate = "truncate"
+)
+
+// Score normalizations
+const (
+	NormalizationRaw  = "raw"
+	NormalizationUnit = "unit"
+	NormalizationRank = "rank"
+)
+
+// SearchResponse is one page of search results. Total is the number of
+// results left after the score threshold, collapsing and the top_k cut, or
+// the radius cap for radius searches, which ignore TopK; Page and Limit, or
+// Offset, select the window of them returned. Expanded related vectors
+// follow the window and count towards Returned but not towards Total.
 type SearchResponse struct {
-	Total   int            `json:"total"`
-	Page    int            `json:"page"`
-	Limit   int            `json:"limit"`
-	Results []SearchResult `json:"results"`
+	Total    int            `json:"total"`
+	Returned int            `json:"returned"`
+	Page     int            `json:"page"`
+	Limit    int            `json:"limit"`
+	Offset   int            `json:"offset"`
+	Results  []SearchResult `json:"results"`
+	// Expanded is the number of results added by ExpandRelated, which
+	// follow the page's results and don't count towards Total
+	Expanded int `json:"expanded,omitempty"`
+	// Reason explains why no results were returned, empty otherwise
+	Reason string `json:"reason,omitempty"`
+	// Weights, Metric and ScoreNormalization are the effective scoring
+	// parameters after defaults were applied, so clients can reproduce the
+	// scores
+	Weights            map[string]float64 `json:"weights,omitempty"`
+	Metric             string             `json:"metric,omitempty"`
+	ScoreNormalization string             `json:"score_normalization,omitempty"`
+	// Collapsed is the number of results dropped by CollapseBy
+	Collapsed int `json:"collapsed,omitempty"`
+	// Groups holds the best results per value of the GroupBy key, ranked
+	// like Results but without the top-k cut. GroupsCapped is set when
+	// results of more groups than the limit were left out
+	Groups       map[string][]SearchResult `json:"groups,omitempty"`
+	GroupsCapped bool                      `json:"groups_capped,omitempty"`
+	// Approximate is set when only a sample of the candidates was scored
+	Approximate bool `json:"approximate,omitempty"`
+	// GapCut is set when GapCutoff cut the results at a score gap
+	GapCut bool `json:"gap_cut,omitempty"`
+	// Fallback is set when an index search recalled too little and was
+	// rerun as an exact search
+	Fallback bool `json:"fallback,omitempty"`
+	// Capped is set when a radius search matched more vectors than the cap
+	Capped     bool `json:"capped,omitempty"`
+	TotalPages int  `json:"total_pages"`
+	HasNext    bool `json:"has_next"`
+	// Cached is set when the response was served from the search cache
+	Cached bool `json:"cached,omitempty"`
+	// Cluster is the topic cluster of the query when it was asked for
+	Cluster *QueryCluster `json:"cluster,omitempty"`
+	// Collection is the collection searched, once aliases are resolved
+	Collection string `json:"collection,omitempty"`
+	// Profile is set when the request asked for it and the search ran
+	Profile *SearchProfile `json:"-"`
 }
 
 type HybridSearchRequest struct {
 	Query         string    `json:"query" validate:"required"`
-	QueryVector   []float64 `json:"query_vector" validate:"required,min=1"`
+	QueryVector   Embedding `json:"query_vector" validate:"omitempty,min=1"`
 	VectorWeight  float64   `json:"vector_weight" validate:"min=0,max=1"`
 	KeywordWeight float64   `json:"keyword_weight" validate:"min=0,max=1"`
 	FuzzyWeight   float64   `json:"fuzzy_weight" validate:"min=0,max=1"`
-	Limit         int       `json:"limit" validate:"min=1,max=100"`
-	Page          int       `json:"page" validate:"min=1"`
+	Limit         int       `json:"limit" validate:"omitempty,min=1,max=100"`
+	Page          int       `json:"page" validate:"omitempty,min=1"`
+	// Offset starts the window at this result instead of at Page, to
+	// resume after a truncated response
+	Offset int `json:"offset,omitempty" validate:"omitempty,min=0"`
+	// AllowKeywordOnly falls back to pure keyword search when QueryVector
+	// is empty instead of rejecting the request
+	AllowKeywordOnly bool `json:"allow_keyword_only,omitempty"`
+	// MinScore drops results whose hybrid score is below it
+	MinScore *float64 `json:"min_score,omitempty"`
+	// IncludeVector returns the full vector with each result, with its
+	// embedding only if IncludeEmbedding is set too
+	IncludeVector    bool `json:"include_vector,omitempty"`
+	IncludeEmbedding bool `json:"include_embedding,omitempty"`
+	// QueryTermDecay saturates terms repeated in Query: each repetition of
+	// a term counts QueryTermDecay times as much as the one before, so 0
+	// counts every term once. By default each repetition counts fully
+	QueryTermDecay *float64 `json:"query_term_decay,omitempty" validate:"omitempty,min=0,max=1"`
+	// Collection restricts the search to a collection, or to the collection
+	// an alias of this name points to
+	Collection string `json:"collection,omitempty"`
 }
 
 type HybridSearchResult struct {
@@ -59,26 +356,275 @@ type HybridSearchResult struct {
 	VectorScore  float64 `json:"vector_score"`
 	KeywordScore float64 `json:"keyword_score"`
 	HybridScore  float64 `json:"hybrid_score"`
+	// Vector is only set when requested with IncludeVector
+	Vector *Vector `json:"vector,omitempty"`
 }
 
+// HybridSearchResponse is one page of hybrid search results, with Total
+// and Returned as in SearchResponse.
 type HybridSearchResponse struct {
-	Total   int                   `json:"total"`
-	Page    int                   `json:"page"`
-	Limit   int                   `json:"limit"`
-	Results []HybridSearchResult  `json:"results"`
+	Total    int                  `json:"total"`
+	Returned int                  `json:"returned"`
+	Page     int                  `json:"page"`
+	Limit    int                  `json:"limit"`
+	Offset   int                  `json:"offset"`
+	Results  []HybridSearchResult `json:"results"`
+	Reason   string               `json:"reason,omitempty"`
+	Weights  map[string]float64   `json:"weights,omitempty"`
+	Metric   string               `json:"metric,omitempty"`
+	// Collection is the collection searched, once aliases are resolved
+	Collection string `json:"collection,omitempty"`
+
+	TotalPages int  `json:"total_pages"`
+	HasNext    bool `json:"has_next"`
+}
+
+// UnifiedSearchRequest searches vectors and documents at once. Vectors are
+// ranked by hybrid search, keyword-only when QueryVector is empty, and
+// documents by BM25 over their title and content.
+type UnifiedSearchRequest struct {
+	Query       string    `json:"query" validate:"required"`
+	QueryVector Embedding `json:"query_vector" validate:"omitempty,min=1"`
+	// VectorsWeight and DocumentsWeight scale each source's normalized
+	// scores, both default to 0.5
+	VectorsWeight   float64 `json:"vectors_weight" validate:"min=0,max=1"`
+	DocumentsWeight float64 `json:"documents_weight" validate:"min=0,max=1"`
+	Limit           int     `json:"limit" validate:"omitempty,min=1,max=100"`
+	Page            int     `json:"page" validate:"omitempty,min=1"`
+	// Offset starts the window at this result instead of at Page, to
+	// resume after a truncated response
+	Offset int `json:"offset,omitempty" validate:"omitempty,min=0"`
+	// Collection restricts the vectors searched to a collection, or to the
+	// collection an alias of this name points to. Documents aren't in
+	// collections and are all searched
+	Collection string `json:"collection,omitempty"`
+}
+
+// Result types of a unified search
+const (
+	ResultTypeVector   = "vector"
+	ResultTypeDocument = "document"
+)
+
+type UnifiedSearchResult struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	// Score is the weighted score after normalizing each source so its best
+	// result scores 1, SourceScore the score within its source
+	Score       float64 `json:"score"`
+	SourceScore float64 `json:"source_score"`
+	// Text is set on vectors, Title on documents
+	Text  string `json:"text,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type UnifiedSearchResponse struct {
+	Total    int                   `json:"total"`
+	Returned int                   `json:"returned"`
+	Page     int                   `json:"page"`
+	Limit    int                   `json:"limit"`
+	Offset   int                   `json:"offset"`
+	Results  []UnifiedSearchResult `json:"results"`
+	Weights  map[string]float64    `json:"weights,omitempty"`
+	// Collection is the collection searched, once aliases are resolved
+	Collection string `json:"collection,omitempty"`
+}
+
+// BlendedSearchRequest ranks vectors by one score blending four weighted
+// components, each scored 0..1: the similarity of the vector to
+// QueryVector, the BM25 relevance of its text to Query relative to the best
+// match, how closely its text fuzzily matches the terms of Query, and the
+// share of the MetadataMatch pairs its metadata has. Weights are normalized
+// to sum to 1; when all are 0 the vector and keyword components are
+// weighted equally, or whichever of them has a query alone.
+type BlendedSearchRequest struct {
+	Query       string    `json:"query,omitempty"`
+	QueryVector Embedding `json:"query_vector,omitempty" validate:"omitempty,min=1"`
+	// MetadataMatch holds the metadata pairs the metadata component scores,
+	// unlike Filter it doesn't exclude vectors without them
+	MetadataMatch Metadata `json:"metadata_match,omitempty"`
+	Filter        Metadata `json:"filter,omitempty"`
+
+	VectorWeight   float64 `json:"vector_weight" validate:"min=0"`
+	KeywordWeight  float64 `json:"keyword_weight" validate:"min=0"`
+	FuzzyWeight    float64 `json:"fuzzy_weight" validate:"min=0"`
+	MetadataWeight float64 `json:"metadata_weight" validate:"min=0"`
+
+	// FuzzyMinSimilarity and FuzzyMaxEdits bound which tokens fuzzily
+	// match a query term: those whose edit similarity is at least
+	// FuzzyMinSimilarity, or those at most FuzzyMaxEdits edits away. A
+	// number of edits suits short terms better, where a single edit is a
+	// large share of the term. At most one of them can be set; by default
+	// every token counts by its similarity
+	FuzzyMinSimilarity float64 `json:"fuzzy_min_similarity,omitempty" validate:"min=0,max=1"`
+	FuzzyMaxEdits      int     `json:"fuzzy_max_edits,omitempty" validate:"min=0,max=10"`
+
+	// MinScore drops results whose blended score is below it
+	MinScore *float64 `json:"min_score,omitempty"`
+	Limit    int      `json:"limit" validate:"omitempty,min=1,max=100"`
+	Page     int      `json:"page" validate:"omitempty,min=1"`
+	// Offset starts the window at this result instead of at Page, to
+	// resume after a truncated response
+	Offset int `json:"offset,omitempty" validate:"omitempty,min=0"`
+	// Collection restricts the search to a collection, or to the collection
+	// an alias of this name points to
+	Collection string `json:"collection,omitempty"`
+}
+
+type BlendedSearchResult struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	// Score is the blended score, Components the score of each component
+	// before weighting
+	Score      float64            `json:"score"`
+	Components map[string]float64 `json:"components"`
+}
+
+// BlendedSearchResponse is one page of blended search results, with Total
+// and Returned as in SearchResponse. Weights are the normalized weights.
+type BlendedSearchResponse struct {
+	Total    int                   `json:"total"`
+	Returned int                   `json:"returned"`
+	Page     int                   `json:"page"`
+	Limit    int                   `json:"limit"`
+	Offset   int                   `json:"offset"`
+	Results  []BlendedSearchResult `json:"results"`
+	Reason   string                `json:"reason,omitempty"`
+	Weights  map[string]float64    `json:"weights,omitempty"`
+	// Collection is the collection searched, once aliases are resolved
+	Collection string `json:"collection,omitempty"`
+
+	TotalPages int  `json:"total_pages"`
+	HasNext    bool `json:"has_next"`
+}
+
+// CompareRequest compares two vectors, each given by ID or inline.
+type CompareRequest struct {
+	A VectorRef `json:"a"`
+	B VectorRef `json:"b"`
+	// Metric defaults to MetricCosine
+	Metric string `json:"metric,omitempty" validate:"omitempty,oneof=cosine dot euclidean"`
+}
+
+type CompareResponse struct {
+	Metric string `json:"metric"`
+	// Score is higher for more similar vectors, Distance is lower
+	Score     float64 `json:"score"`
+	Distance  float64 `json:"distance"`
+	Dimension int     `json:"dimension"`
+}
+
+// AdhocSearchRequest ranks the vectors it carries against Query without
+// storing them.
+type AdhocSearchRequest struct {
+	Query   Embedding     `json:"query" validate:"required,min=1"`
+	Vectors []AdhocVector `json:"vectors" validate:"required,min=1,dive"`
+	TopK    int           `json:"top_k" validate:"omitempty,min=1,max=1000"`
+	Filter  Metadata      `json:"filter,omitempty"`
+	// MinScore drops results scoring below it
+	MinScore *float64 `json:"min_score,omitempty"`
+	// Metric and ScoreNormalization score results like a vector search
+	Metric             string `json:"metric,omitempty" validate:"omitempty,oneof=cosine dot euclidean"`
+	ScoreNormalization string `json:"score_normalization,omitempty" validate:"omitempty,oneof=raw unit rank"`
+}
+
+// AdhocVector is one vector of the corpus of an ad-hoc search.
+type AdhocVector struct {
+	ID       string    `json:"id" validate:"required"`
+	Vector   Embedding `json:"vector" validate:"required,min=1"`
+	Metadata Metadata  `json:"metadata,omitempty"`
+}
+
+// ProjectRequest projects the vectors matching Filter onto their principal
+// components.
+type ProjectRequest struct {
+	Filter Metadata `json:"filter,omitempty"`
+	// Dimensions is the number of components, defaults to 2
+	Dimensions int `json:"dimensions,omitempty" validate:"omitempty,min=1,max=10"`
+}
+
+type ProjectedVector struct {
+	ID          string    `json:"id"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type ProjectResponse struct {
+	Dimensions int `json:"dimensions"`
+	// ExplainedVariance is the share of the set's variance along each
+	// component
+	ExplainedVariance []float64         `json:"explained_variance"`
+	Points            []ProjectedVector `json:"points"`
+	// Cached is set when a previously fitted projection was reused
+	Cached bool `json:"cached"`
 }
 
 type CreateVectorRequest struct {
-	ID       string            `json:"id" validate:"required"`
-	Vector   []float64         `json:"vector" validate:"required,min=1"`
-	Text     string            `json:"text"`
-	Metadata map[string]string `json:"metadata,omitempty"`
+	ID       string    `json:"id" validate:"required"`
+	Vector   Embedding `json:"vector" validate:"required,min=1"`
+	Text     string    `json:"text"`
+	Metadata Metadata  `json:"metadata,omitempty"`
+
+	EmbeddingModel   string  `json:"embedding_model,omitempty"`
+	EmbeddingVersion string  `json:"embedding_version,omitempty"`
+	Boost            float64 `json:"boost,omitempty" validate:"min=0"`
+
+	NamedVectors map[string]Embedding `json:"named_vectors,omitempty" validate:"omitempty,dive,keys,required,endkeys,min=1"`
+}
+
+// BatchCreateVectorsRequest holds vectors to insert in one request. Each
+// vector is validated and inserted on its own.
+type BatchCreateVectorsRequest struct {
+	Vectors []CreateVectorRequest `json:"vectors" validate:"required,min=1,max=1000"`
+}
+
+// BatchUpdateVectorsRequest holds updates to apply in one request. Atomic
+// applies all of them or none, defaulting to the server's setting.
+type BatchUpdateVectorsRequest struct {
+	Vectors []BatchUpdateVector `json:"vectors" validate:"required,min=1,max=1000"`
+	Atomic  *bool               `json:"atomic,omitempty"`
+}
+
+// BatchUpdateVector is an update of the vector with ID.
+type BatchUpdateVector struct {
+	ID string `json:"id" validate:"required"`
+	UpdateVectorRequest
+}
+
+// BatchItemResult is the outcome of one item of a batch: the HTTP status it
+// would have had as a single request and, when it failed, why.
+type BatchItemResult struct {
+	ID               string            `json:"id"`
+	Status           int               `json:"status"`
+	Error            string            `json:"error,omitempty"`
+	ValidationErrors map[string]string `json:"validation_errors,omitempty"`
+}
+
+type BatchResponse struct {
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Items     []BatchItemResult `json:"items"`
 }
 
 type UpdateVectorRequest struct {
-	Vector   []float64         `json:"vector" validate:"required,min=1"`
-	Text     string            `json:"text"`
-	Metadata map[string]string `json:"metadata,omitempty"`
+	Vector   Embedding `json:"vector" validate:"required,min=1"`
+	Text     string    `json:"text"`
+	Metadata Metadata  `json:"metadata,omitempty"`
+
+	EmbeddingModel   string  `json:"embedding_model,omitempty"`
+	EmbeddingVersion string  `json:"embedding_version,omitempty"`
+	Boost            float64 `json:"boost,omitempty" validate:"min=0"`
+
+	NamedVectors map[string]Embedding `json:"named_vectors,omitempty" validate:"omitempty,dive,keys,required,endkeys,min=1"`
+}
+
+// PatchVectorRequest updates the fields of a vector it sets. A vector that
+// is null or missing leaves the embedding as it is, while an empty one is
+// invalid, so metadata can be updated without resending the embedding.
+type PatchVectorRequest struct {
+	Vector   Embedding `json:"vector" validate:"omitempty,min=1"`
+	Text     *string   `json:"text,omitempty"`
+	Metadata Metadata  `json:"metadata,omitempty"`
+	Boost    *float64  `json:"boost,omitempty" validate:"omitempty,min=0"`
 }
 
 type CreateDocumentRequest struct {
@@ -86,10 +632,186 @@ type CreateDocumentRequest struct {
 	Title   string   `json:"title" validate:"required"`
 	Content string   `json:"content" validate:"required"`
 	Tags    []string `json:"tags,omitempty"`
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type UpdateDocumentRequest struct {
 	Title   string   `json:"title" validate:"required"`
 	Content string   `json:"content" validate:"required"`
 	Tags    []string `json:"tags,omitempty"`
+
+	// ExpiresAt replaces the document's expiry, which is kept when it's
+	// nil unless KeepForever clears it
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// KeepForever clears the document's expiry
+	KeepForever bool `json:"keep_forever,omitempty" validate:"excluded_with=ExpiresAt"`
+}
+
+// DocumentFilter selects documents by ID or by tags, a document must match
+// every criterion set.
+type DocumentFilter struct {
+	IDs []string `json:"ids,omitempty"`
+	// Tags selects documents carrying all of these tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (f *DocumentFilter) Matches(doc *Document) bool {
+	if len(f.IDs) > 0 && !contains(f.IDs, doc.ID) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !contains(doc.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
+
+type BulkTagRequest struct {
+	Filter     DocumentFilter `json:"filter"`
+	AddTags    []string       `json:"add_tags,omitempty"`
+	RemoveTags []string       `json:"remove_tags,omitempty"`
+}
+
+// ValidationResult reports the problems found in a payload validated
+// without being stored, keyed by field.
+type ValidationResult struct {
+	Valid  bool              `json:"valid"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type ChangesResponse struct {
+	Changes    []*Vector `json:"changes"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+type QuarantinedRecord struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+	Size  int    `json:"size"`
+}
+
+type Posting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// IndexEntry is a metadata key/value of the inverted index with the number
+// of vectors indexed under it, and their IDs when asked for.
+type IndexEntry struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Count int      `json:"count"`
+	IDs   []string `json:"ids,omitempty"`
+}
+
+// IndexExport is one page of the inverted index, resumed with NextCursor.
+type IndexExport struct {
+	Entries    []IndexEntry `json:"entries"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// SearchEvent records a search for analytics. Query vectors are reduced to
+// their dimension.
+type SearchEvent struct {
+	// QueryID is issued by the server and returned with the search results
+	QueryID   string    `json:"query_id"`
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Text      string    `json:"text,omitempty"`
+	Dimension int       `json:"dimension,omitempty"`
+	Filter    Metadata  `json:"filter,omitempty"`
+	TopK      int       `json:"top_k,omitempty"`
+	Results   int       `json:"results"`
+	LatencyMS float64   `json:"latency_ms"`
+}
+
+// SearchFeedbackRequest reports the results a user clicked after a search.
+// QueryID is the query_id returned with the search results.
+type SearchFeedbackRequest struct {
+	QueryID    string   `json:"query_id" validate:"required,max=256"`
+	ClickedIDs []string `json:"clicked_ids" validate:"omitempty,max=1000,dive,required"`
+}
+
+// SearchFeedback is the recorded feedback on one search.
+type SearchFeedback struct {
+	Time       time.Time `json:"time"`
+	QueryID    string    `json:"query_id"`
+	ClickedIDs []string  `json:"clicked_ids,omitempty"`
+}
+
+// QueryFeedback aggregates the feedback on the searches of a query text,
+// "" for searches by vector alone. Searches counts the recorded searches,
+// ClickThroughRate is the share of them with at least one click, and
+// ClickedIDs counts the clicks on each result.
+type QueryFeedback struct {
+	Query            string         `json:"query"`
+	Searches         int            `json:"searches"`
+	ClickedSearches  int            `json:"clicked_searches"`
+	Clicks           int            `json:"clicks"`
+	ClickThroughRate float64        `json:"click_through_rate"`
+	ClickedIDs       map[string]int `json:"clicked_ids"`
+}
+
+type StoreStats struct {
+	Vectors     int `json:"vectors"`
+	Documents   int `json:"documents"`
+	Tombstones  int `json:"tombstones"`
+	Compactions int `json:"compactions"`
+	// Index is the search path, "flat", "hnsw" or "ivf"
+	Index string `json:"index"`
+	// Snapshots is the number of searches scoring a snapshot of the store
+	// and SnapshotVectors the number of vectors they keep in memory
+	Snapshots       int `json:"snapshots"`
+	SnapshotVectors int `json:"snapshot_vectors"`
+	// DiskReads is the number of quantized embeddings read from disk
+	// because the value cache didn't hold them
+	DiskReads int64 `json:"disk_reads"`
+	// Quantized is the number of vectors kept as product quantization
+	// codes, zero until the quantizer is trained
+	Quantized int `json:"quantized"`
+	// Defragmentations is the number of times the database file was
+	// defragmented and DefragReclaimedBytes the disk space it freed
+	Defragmentations     int64 `json:"defragmentations"`
+	DefragReclaimedBytes int64 `json:"defrag_reclaimed_bytes"`
+	// WarmedSearches is the number of frequent searches of the previous
+	// run replayed into the search cache at startup
+	WarmedSearches int64 `json:"warmed_searches"`
+}
+
+// ClusterFitResult reports a fit of the topic clusters searches report.
+type ClusterFitResult struct {
+	Clusters  int    `json:"clusters"`
+	Vectors   int    `json:"vectors"`
+	Dimension int    `json:"dimension"`
+	Duration  string `json:"duration"`
+}
+
+// IndexBuildResult reports a build of the vector search index. Layers is
+// reported for an HNSW index and Lists for an IVF one.
+type IndexBuildResult struct {
+	Index     string `json:"index"`
+	Vectors   int    `json:"vectors"`
+	Dimension int    `json:"dimension"`
+	Layers    int    `json:"layers,omitempty"`
+	Lists     int    `json:"lists,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// DefragResult reports a defragmentation of the database file.
+type DefragResult struct {
+	SizeBefore int64  `json:"size_before"`
+	SizeAfter  int64  `json:"size_after"`
+	Reclaimed  int64  `json:"reclaimed"`
+	Duration   string `json:"duration"`
 }
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// VectorRef refers to a stored vector by ID, given as a JSON string, or
+// holds an inline vector, given as a JSON array of numbers.
+type VectorRef struct {
+	ID     string
+	Vector Embedding
+}
+
+func (r *VectorRef) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		*r = VectorRef{ID: id}
+		return nil
+	}
+
+	var vector Embedding
+	if err := json.Unmarshal(data, &vector); err != nil {
+		if tooLong, ok := err.(*DimensionError); ok {
+			return tooLong
+		}
+		return fmt.Errorf("vector reference must be an ID or an array of numbers")
+	}
+	*r = VectorRef{Vector: vector}
+	return nil
+}
+
+func (r VectorRef) MarshalJSON() ([]byte, error) {
+	if r.Vector != nil {
+		return json.Marshal(r.Vector)
+	}
+	return json.Marshal(r.ID)
+}
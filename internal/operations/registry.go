@@ -0,0 +1,178 @@
+package operations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"vectraDB/pkg/errors"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// maxFinished bounds how many finished operations are kept for inspection.
+const maxFinished = 100
+
+var ErrOperationNotFound = errors.New(http.StatusNotFound, "operation not found")
+
+// Operation is a long-running task executed in the background.
+type Operation struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	Status     Status      `json:"status"`
+	Progress   float64     `json:"progress"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Func is the body of an operation. It must return promptly once ctx is
+// cancelled and may report progress between 0 and 1. An operation that
+// returns no error succeeded, even if it was cancelled after its work was
+// committed.
+type Func func(ctx context.Context, progress func(float64)) (interface{}, error)
+
+// Registry tracks background operations so they can be inspected and
+// cancelled by ID.
+type Registry struct {
+	mu         sync.Mutex
+	operations map[string]*Operation
+}
+
+func NewRegistry() *Registry {
+	return &Registry{operations: make(map[string]*Operation)}
+}
+
+// Start runs fn in a background goroutine and returns the new operation.
+func (r *Registry) Start(kind string, fn Func) Operation {
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &Operation{
+		ID:        newID(),
+		Kind:      kind,
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.prune()
+	r.operations[op.ID] = op
+	snapshot := *op
+	r.mu.Unlock()
+
+	go func() {
+		defer close(op.done)
+		defer cancel()
+
+		result, err := fn(ctx, func(progress float64) {
+			r.mu.Lock()
+			op.Progress = progress
+			r.mu.Unlock()
+		})
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		now := time.Now()
+		op.FinishedAt = &now
+		switch {
+		case err != nil && ctx.Err() != nil:
+			op.Status = StatusCancelled
+		case err != nil:
+			op.Status = StatusFailed
+			op.Error = err.Error()
+		default:
+			op.Status = StatusSucceeded
+			op.Progress = 1
+			op.Result = result
+		}
+	}()
+
+	return snapshot
+}
+
+// Get returns a snapshot of the operation.
+func (r *Registry) Get(id string) (Operation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	op, ok := r.operations[id]
+	if !ok {
+		return Operation{}, ErrOperationNotFound
+	}
+	return *op, nil
+}
+
+// Cancel cancels a running operation. Cancelling a finished operation is a
+// no-op.
+func (r *Registry) Cancel(id string) error {
+	r.mu.Lock()
+	op, ok := r.operations[id]
+	r.mu.Unlock()
+	if !ok {
+		return ErrOperationNotFound
+	}
+
+	op.cancel()
+	return nil
+}
+
+// Wait blocks until the operation finishes or ctx is done.
+func (r *Registry) Wait(ctx context.Context, id string) (Operation, error) {
+	r.mu.Lock()
+	op, ok := r.operations[id]
+	r.mu.Unlock()
+	if !ok {
+		return Operation{}, ErrOperationNotFound
+	}
+
+	select {
+	case <-op.done:
+	case <-ctx.Done():
+		return Operation{}, ctx.Err()
+	}
+	return r.Get(id)
+}
+
+// prune drops the oldest finished operations beyond maxFinished. The caller
+// must hold r.mu.
+func (r *Registry) prune() {
+	finished := make([]*Operation, 0)
+	for _, op := range r.operations {
+		if op.FinishedAt != nil {
+			finished = append(finished, op)
+		}
+	}
+	if len(finished) <= maxFinished {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(*finished[j].FinishedAt)
+	})
+	for _, op := range finished[:len(finished)-maxFinished] {
+		delete(r.operations, op.ID)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
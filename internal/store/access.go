@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+const defaultAccessFlushInterval = time.Minute
+
+// With Config.AccessStats set, the store counts how often each vector is
+// retrieved, by GetVector or as a vector search result. Counts are kept in
+// memory, so recording them only takes accessMu, and the increments are
+// written to the access bucket, keyed by vector ID with big-endian counts,
+// every Config.AccessFlushInterval and when the store is closed. Counts
+// recorded since the last flush are lost on a crash. Deleting a vector
+// drops its count, so a deleted vector can't hold the highest count.
+
+// loadAccessCounts reads the persisted counts into memory.
+func (s *boltStore) loadAccessCounts() error {
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("access"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			if len(v) != 8 {
+				return nil // Skip invalid counts
+			}
+			if _, exists := s.vectors[string(k)]; !exists {
+				s.accessDropped[string(k)] = true
+				return nil
+			}
+			count := int64(binary.BigEndian.Uint64(v))
+			s.accessCounts[string(k)] = count
+			s.accessMax = max(s.accessMax, count)
+			return nil
+		})
+	})
+}
+
+// recordAccess counts a retrieval of each of ids.
+func (s *boltStore) recordAccess(ids ...string) {
+	if !s.config.AccessStats || len(ids) == 0 {
+		return
+	}
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	for _, id := range ids {
+		s.accessCounts[id]++
+		s.accessPending[id]++
+		s.accessMax = max(s.accessMax, s.accessCounts[id])
+	}
+}
+
+// dropAccess forgets the retrievals of a deleted vector, finding the new
+// highest count if it held it. The persisted count is deleted by the next
+// flush.
+func (s *boltStore) dropAccess(id string) {
+	if !s.config.AccessStats {
+		return
+	}
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	count, counted := s.accessCounts[id]
+	if !counted {
+		return
+	}
+	delete(s.accessCounts, id)
+	delete(s.accessPending, id)
+	s.accessDropped[id] = true
+	if count == s.accessMax {
+		s.accessMax = 0
+		for _, other := range s.accessCounts {
+			s.accessMax = max(s.accessMax, other)
+		}
+	}
+}
+
+// runAccessFlusher flushes recorded retrievals every interval until s.done
+// is closed.
+func (s *boltStore) runAccessFlusher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.flushAccess(); err != nil {
+				logger.WithError(err).Error("Failed to flush access counts")
+			}
+		}
+	}
+}
+
+// flushAccess adds the retrievals recorded since the last flush to the
+// persisted counts and deletes those of deleted vectors. Changes that fail
+// to be written are kept for the next flush.
+func (s *boltStore) flushAccess() error {
+	s.accessMu.Lock()
+	pending, dropped := s.accessPending, s.accessDropped
+	s.accessPending = make(map[string]int64)
+	s.accessDropped = make(map[string]bool)
+	s.accessMu.Unlock()
+	if len(pending) == 0 && len(dropped) == 0 {
+		return nil
+	}
+
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("access"))
+		if err != nil {
+			return err
+		}
+		for id := range dropped {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		for id, n := range pending {
+			count := n
+			if v := bucket.Get([]byte(id)); len(v) == 8 {
+				count += int64(binary.BigEndian.Uint64(v))
+			}
+			if err := bucket.Put([]byte(id), binary.BigEndian.AppendUint64(nil, uint64(count))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.accessMu.Lock()
+		for id, n := range pending {
+			if _, counted := s.accessCounts[id]; counted {
+				s.accessPending[id] += n
+			}
+		}
+		for id := range dropped {
+			s.accessDropped[id] = true
+		}
+		s.accessMu.Unlock()
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to flush access counts")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"vectors": len(pending),
+		"dropped": len(dropped),
+	}).Debug("Flushed access counts")
+	return nil
+}
+
+// popularityScores returns the popularity of each of ids, the logarithm of
+// its retrieval count relative to that of the most retrieved vector, so it
+// ranges 0..1.
+func (s *boltStore) popularityScores(ids []string) map[string]float64 {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	scores := make(map[string]float64, len(ids))
+	if s.accessMax == 0 {
+		return scores
+	}
+	for _, id := range ids {
+		scores[id] = math.Log1p(float64(s.accessCounts[id])) / math.Log1p(float64(s.accessMax))
+	}
+	return scores
+}
+
+// PopularVectors returns the limit most retrieved vectors, most retrieved
+// first, and ties by ID.
+func (s *boltStore) PopularVectors(ctx context.Context, limit int) ([]models.PopularVector, error) {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	popular := make([]models.PopularVector, 0, len(s.accessCounts))
+	for id, count := range s.accessCounts {
+		popular = append(popular, models.PopularVector{ID: id, Count: count})
+	}
+	sort.Slice(popular, func(i, j int) bool {
+		if popular[i].Count != popular[j].Count {
+			return popular[i].Count > popular[j].Count
+		}
+		return popular[i].ID < popular[j].ID
+	})
+	if len(popular) > limit {
+		popular = popular[:limit]
+	}
+	return popular, nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// defaultMaxAdhocVectors bounds the corpus of an ad-hoc search
+const defaultMaxAdhocVectors = 10000
+
+// AdhocSearch ranks the vectors given with the request against its query,
+// scoring them like stored vectors without storing them, so it reads no
+// store state beyond its configuration.
+func (s *boltStore) AdhocSearch(ctx context.Context, req *models.AdhocSearchRequest) (*models.SearchResponse, error) {
+	if len(req.Query) == 0 {
+		return nil, errors.ErrEmptyQuery
+	}
+	if len(req.Vectors) > s.config.MaxAdhocVectors {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").
+			WithDetails(fmt.Sprintf("ad-hoc searches take at most %d vectors, got %d", s.config.MaxAdhocVectors, len(req.Vectors)))
+	}
+
+	// Set defaults
+	if req.TopK <= 0 {
+		req.TopK = 10
+	}
+	if req.Metric == "" {
+		req.Metric = models.MetricCosine
+	}
+	if req.ScoreNormalization == "" {
+		req.ScoreNormalization = defaultNormalization(req.Metric)
+	}
+	if req.ScoreNormalization == models.NormalizationRank && req.MinScore != nil {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").WithDetails("min_score can't be combined with rank normalization")
+	}
+	returned := returnedScore(req.ScoreNormalization, req.Metric)
+
+	score := s.valuesScorer(req.Query, req.Metric)
+	results := make([]models.SearchResult, 0, len(req.Vectors))
+	matched, scored := 0, 0
+	for _, vector := range req.Vectors {
+		if !matchesFilter(vector.Metadata, req.Filter) {
+			continue
+		}
+		matched++
+		similarity, err := score(vector.Vector)
+		if err != nil {
+			continue
+		}
+		scored++
+		if req.MinScore != nil && returned(similarity) < *req.MinScore {
+			continue
+		}
+		results = append(results, models.SearchResult{
+			Vector: models.Vector{ID: vector.ID, Vector: vector.Vector, Metadata: vector.Metadata},
+			Score:  similarity,
+		})
+	}
+
+	var reason string
+	switch {
+	case len(req.Vectors) == 0:
+		reason = models.ReasonEmptyStore
+	case matched == 0:
+		reason = models.ReasonNoFilterMatch
+	case scored == 0:
+		reason = models.ReasonDimensionMismatch
+	case len(results) == 0:
+		reason = models.ReasonBelowThreshold
+	}
+
+	// Sort by score (descending), then ID so ties rank the same every time
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Vector.ID < results[j].Vector.ID
+	})
+	if len(results) > req.TopK {
+		results = results[:req.TopK]
+	}
+
+	s.calibrate(results)
+	normalizeSearchScores(results, req.ScoreNormalization, req.Metric)
+
+	return &models.SearchResponse{
+		Total:    len(results),
+		Returned: len(results),
+		Page:     1,
+		Limit:    req.TopK,
+		Results:  results,
+		Reason:   reason,
+		Metric:   req.Metric,
+
+		ScoreNormalization: req.ScoreNormalization,
+		TotalPages:         totalPages(len(results), req.TopK),
+	}, nil
+}
+
+// matchesFilter reports whether metadata has every pair of filter, by the
+// literal form of the values.
+func matchesFilter(metadata, filter models.Metadata) bool {
+	for key, value := range filter {
+		if actual, ok := metadata[key]; !ok || models.MetadataText(actual) != models.MetadataText(value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+const defaultCollectionKey = "collection"
+
+// Collections partition the vectors by the value of their
+// Config.CollectionKey metadata, and a vector search given a collection only
+// scores its vectors. Aliases name collections: a search given an alias
+// searches the collection it points to, resolved once when the search
+// starts, so repointing an alias switches searches from one collection to
+// the other at once. Rebuilding a collection without downtime is done by
+// writing the new vectors to another collection and repointing the alias
+// once they are all written. Aliases are kept in the aliases bucket, and
+// the per-collection overrides of collections.go in the collections bucket.
+
+// loadAliases reads the persisted aliases into memory.
+func (s *boltStore) loadAliases() error {
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("aliases"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			s.aliases[string(k)] = string(v)
+			return nil
+		})
+	})
+}
+
+// resolveCollection returns the collection name refers to, the target of
+// the alias name or name itself when it's not an alias, with its config,
+// nil when it has none. Both are read together, so a repointed alias can't
+// pair one collection with the config of the other.
+func (s *boltStore) resolveCollection(name string) (string, *models.CollectionConfig) {
+	s.aliasMu.RLock()
+	defer s.aliasMu.RUnlock()
+
+	collection := name
+	if target, ok := s.aliases[name]; ok {
+		collection = target
+	}
+	return collection, s.collections[collection]
+}
+
+// scopeToCollection restricts a vector search given a collection to the
+// vectors of the collection it resolves to, which it returns, and has it
+// use the collection's metric when it sets none.
+func (s *boltStore) scopeToCollection(req *models.SearchRequest) string {
+	if req.Collection == "" {
+		return ""
+	}
+	collection, config := s.resolveCollection(req.Collection)
+	if config != nil && req.Metric == "" {
+		req.Metric = config.Metric
+	}
+	req.Filter = s.collectionFilter(collection, req.Filter)
+	return collection
+}
+
+// collectionFilter returns a copy of filter that also only matches the
+// vectors of collection.
+func (s *boltStore) collectionFilter(collection string, filter models.Metadata) models.Metadata {
+	scoped := make(models.Metadata, len(filter)+1)
+	for key, value := range filter {
+		scoped[key] = value
+	}
+	scoped[s.config.CollectionKey] = collection
+	return scoped
+}
+
+// SetAlias points alias at collection, returning the alias with the
+// collection it pointed at before, if any. Aliases resolve one level, so an
+// alias can't point at another alias, nor name a collection aliases point
+// at.
+func (s *boltStore) SetAlias(ctx context.Context, alias, collection string) (*models.Alias, error) {
+	if alias == "" || collection == "" {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").WithDetails("alias and collection are required")
+	}
+
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	if _, ok := s.aliases[collection]; ok || collection == alias {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").WithDetails("an alias can't point at another alias")
+	}
+	if _, ok := s.collections[alias]; ok {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").
+			WithDetails(fmt.Sprintf("%q is a configured collection", alias))
+	}
+	for existing, target := range s.aliases {
+		if target == alias {
+			return nil, errors.New(http.StatusBadRequest, "invalid input").
+				WithDetails(fmt.Sprintf("%q is the collection alias %q points at", alias, existing))
+		}
+	}
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("aliases"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(alias), []byte(collection))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to store alias")
+	}
+
+	previous := s.aliases[alias]
+	s.aliases[alias] = collection
+	s.log(ctx).WithFields(logrus.Fields{
+		"alias": alias,
+		"from":  previous,
+		"to":    collection,
+	}).Info("Repointed collection alias")
+
+	return &models.Alias{Alias: alias, Collection: collection, Previous: previous}, nil
+}
+
+// DeleteAlias removes alias, returning it with the collection it pointed
+// at. Searches started before it keep the collection they resolved.
+func (s *boltStore) DeleteAlias(ctx context.Context, alias string) (*models.Alias, error) {
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	collection, ok := s.aliases[alias]
+	if !ok {
+		return nil, errors.New(http.StatusNotFound, "alias not found")
+	}
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("aliases"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(alias))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to delete alias")
+	}
+
+	delete(s.aliases, alias)
+	s.log(ctx).WithFields(logrus.Fields{
+		"alias":      alias,
+		"collection": collection,
+	}).Info("Deleted collection alias")
+
+	return &models.Alias{Alias: alias, Collection: collection}, nil
+}
+
+// ListAliases returns every alias, sorted by name.
+func (s *boltStore) ListAliases(ctx context.Context) ([]models.Alias, error) {
+	s.aliasMu.RLock()
+	defer s.aliasMu.RUnlock()
+
+	aliases := make([]models.Alias, 0, len(s.aliases))
+	for alias, collection := range s.aliases {
+		aliases = append(aliases, models.Alias{Alias: alias, Collection: collection})
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].Alias < aliases[j].Alias
+	})
+	return aliases, nil
+}
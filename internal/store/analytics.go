@@ -0,0 +1,223 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+const (
+	defaultEventFlushInterval = time.Second
+	// eventBatchSize is the number of buffered events that triggers a
+	// flush before the interval is up
+	eventBatchSize = 1000
+	// maxPendingEvents bounds the events buffered while flushes fail
+	maxPendingEvents = 100 * eventBatchSize
+)
+
+// Search events and feedback are buffered in memory and written to disk in
+// batches, see flushEvents, so recording one costs no write transaction.
+// They are keyed by their time in big-endian nanoseconds followed by a
+// sequence number, so keys sort chronologically and never collide. Events
+// buffered since the last flush are lost on a crash.
+
+// pendingEvent is an event waiting to be written to its bucket.
+type pendingEvent struct {
+	bucket string
+	time   time.Time
+	data   []byte
+}
+
+// RecordSearch buffers a search event for the analytics bucket.
+func (s *boltStore) RecordSearch(ctx context.Context, event *models.SearchEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to marshal search event")
+	}
+
+	if err := s.appendEvent("analytics", event.Time, data); err != nil {
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to record search event")
+	}
+
+	return nil
+}
+
+// ListSearchEvents returns up to limit search events recorded in [from, to),
+// oldest first. A zero to leaves the range open-ended.
+func (s *boltStore) ListSearchEvents(ctx context.Context, from, to time.Time, limit int) ([]*models.SearchEvent, error) {
+	events := make([]*models.SearchEvent, 0)
+	if limit <= 0 {
+		return events, nil
+	}
+
+	err := s.scanEvents("analytics", from, to, func(v []byte) bool {
+		var event models.SearchEvent
+		if err := json.Unmarshal(v, &event); err != nil {
+			return true // Skip invalid events
+		}
+		events = append(events, &event)
+		return len(events) < limit
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to list search events")
+	}
+
+	return events, nil
+}
+
+// appendEvent buffers an event recorded at t for the named bucket, waking
+// the flusher once a batch is pending. Events are dropped with an error
+// while maxPendingEvents are waiting to be written.
+func (s *boltStore) appendEvent(name string, t time.Time, data []byte) error {
+	s.eventsMu.Lock()
+	defer s.eventsMu.Unlock()
+
+	if len(s.eventsPending) >= maxPendingEvents {
+		return errors.New(http.StatusServiceUnavailable, "too many events waiting to be written")
+	}
+	s.eventsPending = append(s.eventsPending, pendingEvent{bucket: name, time: t, data: data})
+	if len(s.eventsPending) >= eventBatchSize {
+		select {
+		case s.eventsFull <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// runEventFlusher flushes buffered events every interval or once a batch is
+// pending, until s.done is closed.
+func (s *boltStore) runEventFlusher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.eventsFull:
+		}
+		if err := s.flushEvents(); err != nil {
+			logger.WithError(err).Error("Failed to flush search events")
+		}
+	}
+}
+
+// flushEvents writes the buffered events in one transaction and prunes
+// those past Config.EventRetention from the buckets written to. Events that
+// fail to be written are kept for the next flush.
+func (s *boltStore) flushEvents() error {
+	s.eventsMu.Lock()
+	pending := s.eventsPending
+	s.eventsPending = nil
+	s.eventsMu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := s.update(func(tx *bbolt.Tx) error {
+		buckets := make(map[string]*bbolt.Bucket)
+		for _, event := range pending {
+			bucket := buckets[event.bucket]
+			if bucket == nil {
+				var err error
+				if bucket, err = tx.CreateBucketIfNotExists([]byte(event.bucket)); err != nil {
+					return err
+				}
+				buckets[event.bucket] = bucket
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			key := make([]byte, 16)
+			binary.BigEndian.PutUint64(key, uint64(event.time.UnixNano()))
+			binary.BigEndian.PutUint64(key[8:], seq)
+			if err := bucket.Put(key, event.data); err != nil {
+				return err
+			}
+		}
+
+		if s.config.EventRetention <= 0 {
+			return nil
+		}
+		cutoff := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(-s.config.EventRetention).UnixNano()))
+		for _, bucket := range buckets {
+			var expired [][]byte
+			cursor := bucket.Cursor()
+			for k, _ := cursor.First(); k != nil && bytes.Compare(k[:8], cutoff) < 0; k, _ = cursor.Next() {
+				expired = append(expired, k)
+			}
+			for _, k := range expired {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.eventsMu.Lock()
+		s.eventsPending = append(pending, s.eventsPending...)
+		if excess := len(s.eventsPending) - maxPendingEvents; excess > 0 {
+			s.eventsPending = s.eventsPending[excess:]
+		}
+		s.eventsMu.Unlock()
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to flush search events")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"events": len(pending),
+	}).Debug("Flushed search events")
+	return nil
+}
+
+// scanEvents calls fn with the events of the named bucket recorded in
+// [from, to), oldest first, until it returns false. A zero to leaves the
+// range open-ended.
+func (s *boltStore) scanEvents(name string, from, to time.Time, fn func(v []byte) bool) error {
+	// Buffered events are written first so they're included
+	if err := s.flushEvents(); err != nil {
+		return err
+	}
+
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(name))
+		if bucket == nil {
+			return nil // Nothing recorded yet
+		}
+
+		start := make([]byte, 8)
+		if !from.IsZero() {
+			binary.BigEndian.PutUint64(start, uint64(from.UnixNano()))
+		}
+		var end []byte
+		if !to.IsZero() {
+			end = make([]byte, 8)
+			binary.BigEndian.PutUint64(end, uint64(to.UnixNano()))
+		}
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(start); k != nil; k, v = cursor.Next() {
+			if end != nil && bytes.Compare(k[:8], end) >= 0 {
+				break
+			}
+			if !fn(v) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
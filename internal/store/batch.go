@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// UpdateVectors applies a batch of updates and returns the error of each,
+// nil for those applied. In atomic mode every update is checked first and
+// all are written in a single transaction, so either all apply or none do,
+// and the in-memory state is only changed once the transaction commits.
+// The updates are applied to copies of the vectors, so an aborted batch
+// leaves them as given. Otherwise each update is applied on its own. The
+// returned error is set when the batch could not be processed at all.
+func (s *boltStore) UpdateVectors(ctx context.Context, vectors []*models.Vector, atomic bool) ([]error, error) {
+	errs := make([]error, len(vectors))
+	if !atomic {
+		for i, vector := range vectors {
+			errs[i] = s.UpdateVector(ctx, vector.ID, vector)
+		}
+		return errs, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The hooks and normalization modify the vectors in place
+	updates := make([]*models.Vector, len(vectors))
+	for i, vector := range vectors {
+		update := *vector
+		update.Metadata = maps.Clone(vector.Metadata)
+		updates[i] = &update
+	}
+
+	failed := false
+	seen := make(map[string]bool, len(updates))
+	old := make([]*models.Vector, len(updates))
+	for i, vector := range updates {
+		if err := s.runInsertHooks(ctx, vector); err != nil {
+			errs[i], failed = err, true
+			continue
+		}
+		s.normalizeMetadata(vector)
+		if err := s.validateMetadata(vector.Metadata); err != nil {
+			errs[i], failed = err, true
+			continue
+		}
+		if err := s.validateCollection(vector); err != nil {
+			errs[i], failed = err, true
+			continue
+		}
+		if seen[vector.ID] {
+			errs[i] = errors.New(http.StatusBadRequest, "invalid input").WithDetails("vector " + vector.ID + " is updated more than once")
+			failed = true
+			continue
+		}
+		seen[vector.ID] = true
+
+		var exists bool
+		if old[i], exists = s.vectors[vector.ID]; !exists {
+			errs[i], failed = errors.ErrVectorNotFound, true
+		}
+	}
+	if failed {
+		return abortBatch(errs), nil
+	}
+
+	now := time.Now()
+	data := make([][]byte, len(updates))
+	for i, vector := range updates {
+		vector.CreatedAt = old[i].CreatedAt
+		vector.UpdatedAt = now
+
+		var err error
+		if data[i], err = json.Marshal(vector); err != nil {
+			errs[i] = errors.Wrap(err, http.StatusInternalServerError, "failed to marshal vector")
+			return abortBatch(errs), nil
+		}
+	}
+
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("vectors"))
+		for i, vector := range updates {
+			if err := bucket.Put([]byte(vector.ID), data[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to update vectors")
+	}
+
+	s.replaced(ctx, old, updates)
+
+	return errs, nil
+}
+
+// abortBatch marks the updates of a batch that didn't fail as aborted.
+func abortBatch(errs []error) []error {
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = errors.ErrBatchAborted
+		}
+	}
+	return errs
+}
@@ -0,0 +1,387 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// Components of a blended search score
+const (
+	componentVector   = "vector"
+	componentKeyword  = "keyword"
+	componentFuzzy    = "fuzzy"
+	componentMetadata = "metadata"
+)
+
+// BlendedSearch ranks vectors by a weighted blend of vector similarity,
+// keyword relevance, fuzzy text matching and metadata matches, each scored
+// 0..1 so the weights alone decide how much each counts.
+func (s *boltStore) BlendedSearch(ctx context.Context, req *models.BlendedSearchRequest) (*models.BlendedSearchResponse, error) {
+	weights, err := blendWeights(req, s.config.RequireWeights)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set defaults
+	if req.Limit <= 0 {
+		req.Limit = 10
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+
+	// A search given a collection only scores its vectors
+	var collection string
+	if req.Collection != "" {
+		collection, _ = s.resolveCollection(req.Collection)
+		req.Filter = s.collectionFilter(collection, req.Filter)
+	}
+
+	s.mu.RLock()
+	vectors := s.filterVectors(req.Filter)
+	if len(vectors) == 0 {
+		reason := models.ReasonNoFilterMatch
+		if len(s.vectors) == 0 {
+			reason = models.ReasonEmptyStore
+		}
+		s.mu.RUnlock()
+		return &models.BlendedSearchResponse{
+			Page:    req.Page,
+			Limit:   req.Limit,
+			Results: []models.BlendedSearchResult{},
+			Reason:  reason,
+			Weights: weights,
+
+			Collection: collection,
+		}, nil
+	}
+
+	// Keyword and fuzzy scores are only computed when they count, keyword
+	// scores while the lock is held as they read the corpus statistics
+	var keywordScores, fuzzyScores []float64
+	if weights[componentKeyword] > 0 {
+		if keywordScores, err = s.keywordScores(ctx, req.Query, vectors, noTermDecay); err != nil {
+			s.mu.RUnlock()
+			return nil, err
+		}
+		best := 0.0
+		for _, score := range keywordScores {
+			if score > best {
+				best = score
+			}
+		}
+		for i := range keywordScores {
+			if best > 0 {
+				keywordScores[i] /= best
+			}
+		}
+	}
+
+	// The other components are scored on a snapshot, without holding the
+	// lock
+	snapshot, release := s.snapshot(vectors)
+	defer release()
+	score := s.snapshotScorer(req.QueryVector, models.MetricCosine)
+	match := s.normalizeFilter(req.MetadataMatch)
+	s.mu.RUnlock()
+
+	if weights[componentFuzzy] > 0 {
+		match, err := s.fuzzyMatcher(req)
+		if err != nil {
+			return nil, err
+		}
+		if fuzzyScores, err = s.fuzzyScores(ctx, req.Query, vectors, match); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]models.BlendedSearchResult, 0, len(vectors))
+	for i := range snapshot {
+		vector := snapshot[i].vector
+		components := make(map[string]float64, len(weights))
+		if weights[componentVector] > 0 {
+			// Vectors of another dimension score 0
+			components[componentVector] = 0
+			if similarity, err := score(&snapshot[i]); err == nil {
+				components[componentVector] = unitScore(similarity, models.MetricCosine)
+			}
+		}
+		if keywordScores != nil {
+			components[componentKeyword] = keywordScores[i]
+		}
+		if fuzzyScores != nil {
+			components[componentFuzzy] = fuzzyScores[i]
+		}
+		if weights[componentMetadata] > 0 {
+			matched := 0
+			for key, value := range match {
+				if actual, ok := vector.Metadata[key]; ok && models.MetadataText(actual) == models.MetadataText(value) {
+					matched++
+				}
+			}
+			components[componentMetadata] = float64(matched) / float64(len(match))
+		}
+
+		blended := 0.0
+		for component, value := range components {
+			blended += weights[component] * value
+		}
+		blended *= vector.BoostFactor()
+		if req.MinScore != nil && blended < *req.MinScore {
+			continue
+		}
+
+		results = append(results, models.BlendedSearchResult{
+			ID:         vector.ID,
+			Text:       vector.Text,
+			Score:      blended,
+			Components: components,
+		})
+	}
+	results = dropDeleted(s, results, func(result models.BlendedSearchResult) string { return result.ID })
+
+	var reason string
+	if len(results) == 0 {
+		reason = models.ReasonBelowThreshold
+	}
+
+	// Sort by blended score (descending), then ID so ties page stably
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	// Apply pagination
+	total := len(results)
+	start := pageStart(req.Page, req.Limit, req.Offset)
+	end := start + req.Limit
+	if start >= total {
+		results = []models.BlendedSearchResult{}
+		if total > 0 {
+			reason = models.ReasonPageOutOfRange
+		}
+	} else {
+		if end > total {
+			end = total
+		}
+		results = results[start:end]
+	}
+
+	return &models.BlendedSearchResponse{
+		Total:    total,
+		Returned: len(results),
+		Page:     req.Page,
+		Limit:    req.Limit,
+		Offset:   start,
+		Results:  results,
+		Reason:   reason,
+		Weights:  weights,
+
+		Collection: collection,
+		TotalPages: totalPages(total, req.Limit),
+		HasNext:    start+req.Limit < total,
+	}, nil
+}
+
+// blendWeights returns the weights of a blended search normalized to sum to
+// 1, leaving out components weighted 0. Weighted components must have their
+// query. With requireWeights a query with both a vector and text must set
+// weights.
+func blendWeights(req *models.BlendedSearchRequest, requireWeights bool) (map[string]float64, error) {
+	if req.Query == "" && len(req.QueryVector) == 0 && len(req.MetadataMatch) == 0 {
+		return nil, errors.ErrEmptyQuery
+	}
+
+	weights := map[string]float64{
+		componentVector:   req.VectorWeight,
+		componentKeyword:  req.KeywordWeight,
+		componentFuzzy:    req.FuzzyWeight,
+		componentMetadata: req.MetadataWeight,
+	}
+	if req.VectorWeight+req.KeywordWeight+req.FuzzyWeight+req.MetadataWeight == 0 {
+		if requireWeights && len(req.QueryVector) > 0 && req.Query != "" {
+			return nil, errWeightsRequired("vector_weight", "keyword_weight")
+		}
+		if len(req.QueryVector) > 0 {
+			weights[componentVector] = 1
+		}
+		if req.Query != "" {
+			weights[componentKeyword] = 1
+		}
+	}
+
+	missing := map[string]bool{
+		componentVector:   len(req.QueryVector) == 0,
+		componentKeyword:  req.Query == "",
+		componentFuzzy:    req.Query == "",
+		componentMetadata: len(req.MetadataMatch) == 0,
+	}
+	sum := 0.0
+	for component, weight := range weights {
+		if weight > 0 && missing[component] {
+			return nil, errors.New(http.StatusBadRequest, "invalid input").
+				WithDetails(component + " is weighted but its query is missing")
+		}
+		sum += weight
+	}
+	if sum == 0 {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").WithDetails("no component is weighted")
+	}
+
+	for component, weight := range weights {
+		if weight == 0 {
+			delete(weights, component)
+			continue
+		}
+		weights[component] = weight / sum
+	}
+	return weights, nil
+}
+
+// fuzzyMatcher returns how a blended search scores the match of a token to
+// a query term: by edit similarity, 0 for tokens past the request's
+// similarity or edit distance bound. A similarity bound below
+// Config.FuzzyMinSimilarity is raised to it, and requests setting neither
+// bound get it.
+func (s *boltStore) fuzzyMatcher(req *models.BlendedSearchRequest) (func(term, token string) float64, error) {
+	switch {
+	case req.FuzzyMinSimilarity > 0 && req.FuzzyMaxEdits > 0:
+		return nil, errors.New(http.StatusBadRequest, "invalid input").
+			WithDetails("fuzzy_min_similarity and fuzzy_max_edits can't be combined")
+	case req.FuzzyMaxEdits > 0:
+		return func(term, token string) float64 {
+			distance, longest := editDistance(term, token)
+			if distance > req.FuzzyMaxEdits {
+				return 0
+			}
+			return distanceSimilarity(distance, longest)
+		}, nil
+	}
+
+	minSimilarity := max(req.FuzzyMinSimilarity, s.config.FuzzyMinSimilarity)
+	if minSimilarity == 0 {
+		return editSimilarity, nil
+	}
+	return func(term, token string) float64 {
+		if similarity := editSimilarity(term, token); similarity >= minSimilarity {
+			return similarity
+		}
+		return 0
+	}, nil
+}
+
+// fuzzyScores scores how closely the text of each vector matches the terms
+// of query: the mean, over query terms, of the match of the closest token
+// of the text. Matches are computed once per distinct token, for at most
+// Config.FuzzyMaxComparisons tokens; tokens past them match nothing, so a
+// huge corpus of distinct tokens can't stall the search. Queries are
+// bounded by Config.MaxQueryTerms under the same Config.OnLongQuery policy
+// as keyword queries: queryTerms rejects them under LongQueryReject, and
+// otherwise they are truncated to their first terms rather than the
+// rarest, since misspelled terms are rare too.
+func (s *boltStore) fuzzyScores(ctx context.Context, query string, vectors []*models.Vector, match func(term, token string) float64) ([]float64, error) {
+	scores := make([]float64, len(vectors))
+	terms, err := s.queryTerms(query, noTermDecay)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return scores, nil
+	}
+	if max := s.config.MaxQueryTerms; len(terms) > max {
+		s.log(ctx).WithFields(logrus.Fields{
+			"terms":     len(terms),
+			"max_terms": max,
+		}).Warn("Truncated fuzzy query to its first terms")
+		terms = terms[:max]
+	}
+	totalWeight := 0.0
+	for _, term := range terms {
+		totalWeight += term.weight
+	}
+
+	similarities := make(map[string][]float64)
+	capped := false
+	for i, vector := range vectors {
+		best := make([]float64, len(terms))
+		for _, token := range s.tokenize(vector.Text) {
+			tokenSimilarities, ok := similarities[token]
+			if !ok {
+				if len(similarities) >= s.config.FuzzyMaxComparisons {
+					capped = true
+					continue
+				}
+				tokenSimilarities = make([]float64, len(terms))
+				for j, term := range terms {
+					tokenSimilarities[j] = match(term.term, token)
+				}
+				similarities[token] = tokenSimilarities
+			}
+			for j, similarity := range tokenSimilarities {
+				if similarity > best[j] {
+					best[j] = similarity
+				}
+			}
+		}
+
+		sum := 0.0
+		for j, similarity := range best {
+			sum += similarity * terms[j].weight
+		}
+		scores[i] = sum / totalWeight
+	}
+	if capped {
+		s.log(ctx).WithFields(logrus.Fields{
+			"compared":        len(similarities),
+			"max_comparisons": s.config.FuzzyMaxComparisons,
+		}).Warn("Stopped comparing fuzzy query terms to further tokens")
+	}
+
+	return scores, nil
+}
+
+// editSimilarity is 1 minus the Levenshtein distance between a and b
+// relative to the longer of them, 1 for equal strings and 0 for strings
+// sharing nothing.
+func editSimilarity(a, b string) float64 {
+	return distanceSimilarity(editDistance(a, b))
+}
+
+func distanceSimilarity(distance, longest int) float64 {
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(distance)/float64(longest)
+}
+
+// editDistance returns the Levenshtein distance between a and b, in runes,
+// and the length of the longer of them.
+func editDistance(a, b string) (int, int) {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)], longest
+}
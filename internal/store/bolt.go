@@ -1,13 +1,18 @@
 package store
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
 	"vectraDB/internal/models"
 	"vectraDB/pkg/errors"
 )
@@ -15,62 +20,447 @@ import (
 type boltStore struct {
 	db     *bbolt.DB
 	config Config
-	mu     sync.RWMutex
-	
+	// Guards the in-memory vectors. Writers hold it across their bbolt
+	// commit, which bbolt serializes per file anyway, so sharding it, or
+	// the vectors bucket, wouldn't let writes run in parallel
+	mu sync.RWMutex
+
+	// Whether the store opened db, rather than being handed it through
+	// Config.DB, and may close or replace it
+	ownsDB bool
+
 	// In-memory cache for vectors
 	vectors map[string]*models.Vector
 	// Inverted index for metadata filtering
 	index map[string]map[string]map[string]bool
+	// Soft-deleted vectors awaiting compaction
+	tombstones  map[string]*models.Vector
+	compactions int
+	compacting  atomic.Bool
+	// Deletion times of hard-deleted and compacted vectors by ID, for the
+	// change feed
+	deletions map[string]time.Time
+	// Records that failed to load
+	quarantine []models.QuarantinedRecord
+	// Embeddings kept in float32 precision, keyed by vector ID
+	values32 map[string][]float32
+	// Mostly-zero embeddings kept as sparse vectors, keyed by vector ID
+	sparse map[string]*sparseVector
+	// Product quantizer, nil until trained. While it's being trained
+	// pqPending records the vectors written meanwhile, to encode once it's
+	// installed, and pqTraining is set
+	pq         *pqIndex
+	pqPending  map[string]bool
+	pqTraining atomic.Bool
+	// Recently read full-precision embeddings of quantized vectors, nil
+	// when disabled, and the number of embeddings read from disk
+	valueCache *valueCache
+	diskReads  atomic.Int64
+	// Index searches restrict their candidates with, nil while searches are
+	// flat, and the write count it was built at. While it's being built
+	// annPending records the vectors written meanwhile, to index once it's
+	// installed. indexBuildMu serializes builds and indexBuilding is set
+	// while one runs in the background
+	ann           annIndex
+	annWrites     int64
+	annPending    map[string]bool
+	indexBuildMu  sync.Mutex
+	indexBuilding atomic.Bool
+	// BM25 statistics of vector text
+	keywords *keywordIndex
+	// Key signing pagination cursors
+	cursorSecret []byte
+	// Pattern new vector IDs must match, nil when IDs aren't validated
+	idPattern *regexp.Regexp
+	// Built-in and configured hooks run on inserted vectors
+	insertHooks []InsertHook
+	// Number of vector writes, used to tell when cached projections are
+	// stale
+	writes atomic.Int64
+	// Number of live search snapshots and of the vectors they hold
+	liveSnapshots   atomic.Int64
+	snapshotVectors atomic.Int64
+	// Cached vector search responses by request, most recently used first
+	// in searchOrder, and the number of runs of each search, guarded by
+	// cacheMu
+	cacheMu      sync.Mutex
+	searchCache  map[string]*list.Element
+	searchOrder  *list.List
+	searchCounts map[string]int
+	// Number of persisted searches run again at startup
+	warmedSearches atomic.Int64
+	// Fitted projections by filter, guarded by projMu
+	projMu      sync.Mutex
+	projections map[string]*projection
+	// Dimension most vectors share and the write count it was found at,
+	// guarded by dimMu
+	dimMu     sync.Mutex
+	dim       int
+	dimWrites int64
+	// Topic clusters searches report, nil until first fitted, guarded by
+	// clusterMu. clusterFitMu serializes fits and clusterFitting is set
+	// while one runs in the background
+	clusterMu      sync.Mutex
+	clusters       *topicClusters
+	clusterFitMu   sync.Mutex
+	clusterFitting atomic.Bool
+	// Retrieval counts by vector ID, those not yet flushed to disk, the IDs
+	// of deleted vectors whose counts are still on disk and the highest
+	// count, guarded by accessMu
+	accessMu      sync.Mutex
+	accessCounts  map[string]int64
+	accessPending map[string]int64
+	accessDropped map[string]bool
+	accessMax     int64
+	// Search events and feedback not yet written to disk, guarded by
+	// eventsMu. eventsFull wakes the flusher once a batch is pending
+	eventsMu      sync.Mutex
+	eventsPending []pendingEvent
+	eventsFull    chan struct{}
+	// Collections by alias and collection configs by collection, guarded
+	// by aliasMu
+	aliasMu     sync.RWMutex
+	aliases     map[string]string
+	collections map[string]*models.CollectionConfig
+	// Held shared by every transaction and exclusively while the database
+	// is swapped for its defragmented copy, see defrag.go
+	dbMu            sync.RWMutex
+	defragMu        sync.Mutex
+	defragWindow    *timeWindow
+	defrags         atomic.Int64
+	defragReclaimed atomic.Int64
+
+	// Document IDs by tag, guarded by docMu
+	docMu   sync.RWMutex
+	docTags map[string]map[string]bool
+	// Document expiries by ID and a heap of them for the janitor, guarded
+	// by docMu. The heap keeps superseded expiries until they're popped
+	docExpiry map[string]time.Time
+	expiries  expiryHeap
+	// Number of stored documents, kept so it can be read without a scan
+	docCount atomic.Int64
+
+	// Closed to stop the background janitor
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// One-off background tasks started by goBackground, which Close waits
+	// for. bgClosed is set once no more may start, guarded by bgMu
+	bgMu       sync.Mutex
+	bgClosed   bool
+	background sync.WaitGroup
 }
 
 func NewBoltStore(config Config) (Store, error) {
-	db, err := bbolt.Open(config.DBPath, 0600, &bbolt.Options{
-		Timeout: config.Timeout,
-	})
+	switch config.Precision {
+	case "":
+		config.Precision = PrecisionFloat64
+	case PrecisionFloat64, PrecisionFloat32:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid precision").WithDetails(config.Precision)
+	}
+	switch config.VectorPooling {
+	case "", models.PoolingNone, models.PoolingMax, models.PoolingMean:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid vector pooling").WithDetails(config.VectorPooling)
+	}
+	switch config.OnDimensionMismatch {
+	case "":
+		config.OnDimensionMismatch = models.DimensionMismatchReject
+	case models.DimensionMismatchReject, models.DimensionMismatchPadZero, models.DimensionMismatchTruncate:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid dimension mismatch policy").WithDetails(config.OnDimensionMismatch)
+	}
+	switch config.OnLongQuery {
+	case "":
+		config.OnLongQuery = LongQueryTruncate
+	case LongQueryTruncate, LongQueryReject:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid long query policy").WithDetails(config.OnLongQuery)
+	}
+	if config.FuzzyMinSimilarity < 0 || config.FuzzyMinSimilarity > 1 {
+		return nil, errors.New(http.StatusInternalServerError, "invalid fuzzy min similarity").WithDetails("must be between 0 and 1")
+	}
+	switch config.Quantization {
+	case "", QuantizationPQ:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid quantization").WithDetails(config.Quantization)
+	}
+	if config.PQSubspaces <= 0 {
+		config.PQSubspaces = defaultPQSubspaces
+	}
+	if config.PQCentroids <= 0 || config.PQCentroids > 256 {
+		config.PQCentroids = defaultPQCentroids
+	}
+	if config.PQTrainSize <= 0 {
+		config.PQTrainSize = defaultPQTrainSize
+	}
+	if config.PQRescore <= 0 {
+		config.PQRescore = defaultPQRescore
+	}
+	var values *valueCache
+	if config.PQCacheSize > 0 {
+		values = newValueCache(config.PQCacheSize)
+	}
+	if config.CursorTTL <= 0 {
+		config.CursorTTL = defaultCursorTTL
+	}
+	secret, err := cursorSecret(config.CursorSecret)
 	if err != nil {
-		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to open database")
+		return nil, err
+	}
+	switch config.IndexType {
+	case "":
+		config.IndexType = IndexFlat
+	case IndexFlat, IndexAuto:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid index type").WithDetails(config.IndexType)
+	}
+	if config.IndexThreshold <= 0 {
+		config.IndexThreshold = defaultIndexThreshold
+	}
+	switch config.IndexAlgorithm {
+	case "":
+		config.IndexAlgorithm = IndexHNSW
+	case IndexHNSW, IndexIVF:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid index algorithm").WithDetails(config.IndexAlgorithm)
+	}
+	if config.IndexProbes <= 0 {
+		config.IndexProbes = defaultIndexProbes
+	}
+	if config.IndexEfSearch <= 0 {
+		config.IndexEfSearch = defaultIndexEfSearch
+	}
+	if config.Tokenizer == nil {
+		config.Tokenizer = WhitespaceTokenizer{}
+	}
+	insertHooks, err := builtinHooks(config.BuiltinHooks, config.Tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	insertHooks = append(insertHooks, config.InsertHooks...)
+	var idPattern *regexp.Regexp
+	if config.ValidateIDs {
+		if config.IDPattern == "" {
+			config.IDPattern = defaultIDPattern
+		}
+		if idPattern, err = regexp.Compile(config.IDPattern); err != nil {
+			return nil, errors.Wrap(err, http.StatusInternalServerError, "invalid ID pattern").WithDetails(config.IDPattern)
+		}
+	}
+	if config.MaxQueryTerms <= 0 {
+		config.MaxQueryTerms = defaultMaxQueryTerms
+	}
+	if config.FuzzyMaxComparisons <= 0 {
+		config.FuzzyMaxComparisons = defaultFuzzyMaxComparisons
+	}
+	if config.KeywordMaxPostings <= 0 {
+		config.KeywordMaxPostings = defaultKeywordMaxPostings
+	}
+	if config.NegativeWeight <= 0 {
+		config.NegativeWeight = defaultNegativeWeight
+	}
+	if config.SearchCacheTTL <= 0 {
+		config.SearchCacheTTL = defaultSearchCacheTTL
+	}
+	if config.MaxRadiusResults <= 0 {
+		config.MaxRadiusResults = defaultMaxRadiusResults
+	}
+	if config.CollectionKey == "" {
+		config.CollectionKey = defaultCollectionKey
+	}
+	defragWindow, err := parseTimeWindow(config.DefragWindow)
+	if err != nil {
+		return nil, errors.New(http.StatusInternalServerError, "invalid defragmentation window").WithDetails(err.Error())
+	}
+	if config.CompactionBatchSize <= 0 {
+		config.CompactionBatchSize = defaultCompactionBatchSize
+	}
+	if config.AccessFlushInterval <= 0 {
+		config.AccessFlushInterval = defaultAccessFlushInterval
+	}
+	if config.EventFlushInterval <= 0 {
+		config.EventFlushInterval = defaultEventFlushInterval
+	}
+	if config.DefragMinFreeRatio <= 0 {
+		config.DefragMinFreeRatio = defaultDefragMinFreeRatio
+	}
+	if config.MaxAdhocVectors <= 0 {
+		config.MaxAdhocVectors = defaultMaxAdhocVectors
+	}
+	switch config.Calibration {
+	case CalibrationNone, CalibrationSigmoid:
+	default:
+		return nil, errors.New(http.StatusInternalServerError, "invalid calibration").WithDetails(config.Calibration)
+	}
+	if config.CalibrationSlope <= 0 {
+		config.CalibrationSlope = defaultCalibrationSlope
+	}
+	if config.MaxSearchGroups <= 0 {
+		config.MaxSearchGroups = defaultMaxSearchGroups
+	}
+	if config.MaxMetadataEntries <= 0 {
+		config.MaxMetadataEntries = defaultMaxMetadataEntries
+	}
+	if config.MaxMetadataKeyLength <= 0 {
+		config.MaxMetadataKeyLength = defaultMaxMetadataKeyLength
+	}
+	if config.MaxMetadataValueLength <= 0 {
+		config.MaxMetadataValueLength = defaultMaxMetadataValueLength
+	}
+
+	db, ownsDB := config.DB, config.DB == nil
+	if ownsDB {
+		db, err = bbolt.Open(config.DBPath, 0600, &bbolt.Options{
+			Timeout:  config.Timeout,
+			OpenFile: config.OpenFile,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to open database")
+		}
 	}
 
 	store := &boltStore{
-		db:      db,
-		config:  config,
-		vectors: make(map[string]*models.Vector),
-		index:   make(map[string]map[string]map[string]bool),
+		db:         db,
+		config:     config,
+		ownsDB:     ownsDB,
+		dimWrites:  -1,
+		vectors:    make(map[string]*models.Vector),
+		index:      make(map[string]map[string]map[string]bool),
+		tombstones: make(map[string]*models.Vector),
+		deletions:  make(map[string]time.Time),
+		values32:   make(map[string][]float32),
+		sparse:     make(map[string]*sparseVector),
+		docTags:    make(map[string]map[string]bool),
+		docExpiry:  make(map[string]time.Time),
+		keywords:   newKeywordIndex(config.KeywordCountEmpty),
+		valueCache: values,
+		idPattern:  idPattern,
+
+		cursorSecret: secret,
+
+		insertHooks: insertHooks,
+
+		projections:  make(map[string]*projection),
+		searchCache:  make(map[string]*list.Element),
+		searchOrder:  list.New(),
+		searchCounts: make(map[string]int),
+		done:         make(chan struct{}),
+		eventsFull:   make(chan struct{}, 1),
+
+		accessCounts:  make(map[string]int64),
+		accessPending: make(map[string]int64),
+		accessDropped: make(map[string]bool),
+		aliases:       make(map[string]string),
+		collections:   make(map[string]*models.CollectionConfig),
+
+		defragWindow: defragWindow,
+	}
+
+	// A database handed in through Config.DB stays open when the store
+	// can't be opened on it
+	fail := func(err error) (Store, error) {
+		if ownsDB {
+			db.Close()
+		}
+		return nil, err
 	}
 
 	// Initialize buckets
 	if err := store.initBuckets(); err != nil {
-		db.Close()
-		return nil, err
+		return fail(err)
+	}
+
+	// Upgrade records written by older versions
+	if err := store.migrate(); err != nil {
+		return fail(err)
 	}
 
 	// Load vectors into memory
 	if err := store.loadVectors(); err != nil {
-		db.Close()
-		return nil, err
+		return fail(err)
+	}
+	if err := store.loadDeletions(); err != nil {
+		return fail(errors.Wrap(err, http.StatusInternalServerError, "failed to load deletions"))
+	}
+	// Nothing is served yet, so the quantizer and index are built before
+	// returning
+	if store.pqDue() {
+		if err := store.trainQuantizer(context.Background()); err != nil {
+			return fail(err)
+		}
+	}
+	if store.indexDue() {
+		if _, err := store.BuildIndex(context.Background()); err != nil {
+			return fail(err)
+		}
+	}
+
+	if err := store.loadDocumentIndex(); err != nil {
+		return fail(errors.Wrap(err, http.StatusInternalServerError, "failed to load document index"))
+	}
+
+	if err := store.loadAliases(); err != nil {
+		return fail(errors.Wrap(err, http.StatusInternalServerError, "failed to load aliases"))
+	}
+
+	if err := store.loadCollectionConfigs(); err != nil {
+		return fail(errors.Wrap(err, http.StatusInternalServerError, "failed to load collection configs"))
+	}
+
+	if config.AccessStats {
+		if err := store.loadAccessCounts(); err != nil {
+			return fail(errors.Wrap(err, http.StatusInternalServerError, "failed to load access counts"))
+		}
+	}
+
+	var warmSearches []string
+	if config.SearchCacheWarm > 0 && config.SearchCacheSize > 0 {
+		if warmSearches, err = store.loadWarmSearches(); err != nil {
+			return fail(err)
+		}
+	}
+
+	// Background work starts once nothing can fail anymore, so a failed
+	// open leaves nothing running
+	if config.AccessStats {
+		store.goBackground(func() { store.runAccessFlusher(config.AccessFlushInterval) })
+	}
+
+	store.goBackground(func() { store.runEventFlusher(config.EventFlushInterval) })
+
+	if len(warmSearches) > 0 {
+		store.goBackground(func() { store.warmSearchCache(warmSearches) })
+	}
+
+	if config.DocumentSweepInterval > 0 {
+		store.goBackground(func() { store.runJanitor(config.DocumentSweepInterval) })
+	}
+
+	if config.DefragInterval > 0 && ownsDB {
+		store.goBackground(func() { store.runDefragmenter(config.DefragInterval) })
 	}
 
 	return store, nil
 }
 
+// initBuckets creates the vectors bucket. The documents bucket is created
+// by the first document write, so document reads handle it missing, as in
+// databases from before documents were supported.
 func (s *boltStore) initBuckets() error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
+	return s.update(func(tx *bbolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte("vectors"))
 		if err != nil {
 			return errors.Wrap(err, http.StatusInternalServerError, "failed to create vectors bucket")
 		}
-		
-		_, err = tx.CreateBucketIfNotExists([]byte("documents"))
-		if err != nil {
-			return errors.Wrap(err, http.StatusInternalServerError, "failed to create documents bucket")
-		}
-		
+
 		return nil
 	})
 }
 
 func (s *boltStore) loadVectors() error {
-	return s.db.View(func(tx *bbolt.Tx) error {
+	return s.view(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("vectors"))
 		if bucket == nil {
 			return nil
@@ -79,18 +469,58 @@ func (s *boltStore) loadVectors() error {
 		return bucket.ForEach(func(k, v []byte) error {
 			var vector models.Vector
 			if err := json.Unmarshal(v, &vector); err != nil {
-				return errors.Wrap(err, http.StatusInternalServerError, "failed to unmarshal vector")
+				if s.config.StrictLoad {
+					return errors.Wrap(err, http.StatusInternalServerError, "failed to unmarshal vector")
+				}
+
+				// Skip the record so one corrupted entry doesn't take the
+				// whole service down
+				logger.WithError(err).WithField("vector_id", string(k)).Error("Quarantined corrupted vector record")
+				s.quarantine = append(s.quarantine, models.QuarantinedRecord{
+					ID:    string(k),
+					Error: err.Error(),
+					Size:  len(v),
+				})
+				return nil
 			}
-			
-			s.vectors[string(k)] = &vector
+
+			s.normalizeLoaded(&vector)
+			if vector.DeletedAt != nil {
+				s.tombstones[string(k)] = &vector
+				return nil
+			}
+
+			s.vectors[string(k)] = s.cacheVector(&vector)
 			s.addToIndex(&vector)
 			return nil
 		})
 	})
 }
 
-func (s *boltStore) addToIndex(vector *models.Vector) {
+// Reserved index keys for fields indexed alongside the metadata
+const (
+	EmbeddingModelKey   = "embedding_model"
+	EmbeddingVersionKey = "embedding_version"
+)
+
+// indexedFields returns the key/value pairs a vector is indexed under.
+// Metadata is indexed by its literal form, whatever its JSON type.
+func indexedFields(vector *models.Vector) map[string]string {
+	fields := make(map[string]string, len(vector.Metadata)+2)
 	for key, val := range vector.Metadata {
+		fields[key] = models.MetadataText(val)
+	}
+	if vector.EmbeddingModel != "" {
+		fields[EmbeddingModelKey] = vector.EmbeddingModel
+	}
+	if vector.EmbeddingVersion != "" {
+		fields[EmbeddingVersionKey] = vector.EmbeddingVersion
+	}
+	return fields
+}
+
+func (s *boltStore) addToIndex(vector *models.Vector) {
+	for key, val := range indexedFields(vector) {
 		if _, ok := s.index[key]; !ok {
 			s.index[key] = make(map[string]map[string]bool)
 		}
@@ -99,10 +529,11 @@ func (s *boltStore) addToIndex(vector *models.Vector) {
 		}
 		s.index[key][val][vector.ID] = true
 	}
+	s.indexText(vector)
 }
 
 func (s *boltStore) removeFromIndex(vector *models.Vector) {
-	for key, val := range vector.Metadata {
+	for key, val := range indexedFields(vector) {
 		if fieldMap, ok := s.index[key]; ok {
 			if idMap, ok := fieldMap[val]; ok {
 				delete(idMap, vector.ID)
@@ -112,9 +543,24 @@ func (s *boltStore) removeFromIndex(vector *models.Vector) {
 			}
 		}
 	}
+	s.unindexText(vector)
 }
 
 func (s *boltStore) InsertVector(ctx context.Context, vector *models.Vector) error {
+	if err := s.runInsertHooks(ctx, vector); err != nil {
+		return err
+	}
+	if err := s.validateID(vector.ID); err != nil {
+		return err
+	}
+	s.normalizeMetadata(vector)
+	if err := s.validateMetadata(vector.Metadata); err != nil {
+		return err
+	}
+	if err := s.validateCollection(vector); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -135,34 +581,119 @@ func (s *boltStore) InsertVector(ctx context.Context, vector *models.Vector) err
 	}
 
 	// Store in database
-	err = s.db.Update(func(tx *bbolt.Tx) error {
+	err = s.update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("vectors"))
 		return bucket.Put([]byte(vector.ID), data)
 	})
 	if err != nil {
+		s.log(ctx).WithError(err).WithField("vector_id", vector.ID).Error("Failed to store vector")
 		return errors.Wrap(err, http.StatusInternalServerError, "failed to store vector")
 	}
 
-	// Update in-memory cache
-	s.vectors[vector.ID] = vector
+	// Update in-memory cache and index only once the vector is persisted
+	s.vectors[vector.ID] = s.cacheVector(vector)
 	s.addToIndex(vector)
+	delete(s.tombstones, vector.ID)
+	s.writes.Add(1)
+	s.maybeTrainPQ(ctx)
+	s.maybeBuildIndex(ctx)
 
 	return nil
 }
 
 func (s *boltStore) GetVector(ctx context.Context, id string) (*models.Vector, error) {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	vector, exists := s.vectors[id]
-	if !exists {
+	if exists {
+		defer s.mu.RUnlock()
+		s.recordAccess(id)
+		return s.materialize(vector), nil
+	}
+	s.mu.RUnlock()
+
+	if !s.config.ReadThrough {
 		return nil, errors.ErrVectorNotFound
 	}
+	vector, err := s.readThrough(ctx, id)
+	if err == nil {
+		s.recordAccess(id)
+	}
+	return vector, err
+}
+
+// readThrough looks up a vector missing from memory on disk, caching and
+// indexing it when it's found there. The lookup is made without s.mu, so
+// misses don't hold up other reads and writes, and repeated under it only
+// when the vector was found, in case it was deleted in between.
+func (s *boltStore) readThrough(ctx context.Context, id string) (*models.Vector, error) {
+	if vector, err := s.readStored(id); err != nil || vector == nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another read may have reconciled it in the meantime
+	if vector, exists := s.vectors[id]; exists {
+		return s.materialize(vector), nil
+	}
+
+	vector, err := s.readStored(id)
+	if err != nil || vector == nil {
+		return nil, err
+	}
+	s.normalizeLoaded(vector)
+
+	s.log(ctx).WithField("vector_id", id).Warn("Reconciled vector found on disk but missing from memory")
+	s.vectors[id] = s.cacheVector(vector)
+	s.addToIndex(vector)
+	s.writes.Add(1)
+	return s.materialize(s.vectors[id]), nil
+}
 
+// readStored reads a live vector from disk, returning ErrVectorNotFound
+// when there's none.
+func (s *boltStore) readStored(id string) (*models.Vector, error) {
+	var vector *models.Vector
+	err := s.view(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte("vectors")).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		vector = &models.Vector{}
+		return json.Unmarshal(data, vector)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to read vector")
+	}
+	if vector == nil || vector.DeletedAt != nil {
+		return nil, errors.ErrVectorNotFound
+	}
 	return vector, nil
 }
 
+// VectorExists reports whether a vector is stored, without reading its
+// embedding.
+func (s *boltStore) VectorExists(ctx context.Context, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.vectors[id]
+	return exists, nil
+}
+
 func (s *boltStore) UpdateVector(ctx context.Context, id string, vector *models.Vector) error {
+	if err := s.runInsertHooks(ctx, vector); err != nil {
+		return err
+	}
+	s.normalizeMetadata(vector)
+	if err := s.validateMetadata(vector.Metadata); err != nil {
+		return err
+	}
+	if err := s.validateCollection(vector); err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -171,9 +702,58 @@ func (s *boltStore) UpdateVector(ctx context.Context, id string, vector *models.
 	if !exists {
 		return errors.ErrVectorNotFound
 	}
+	return s.replaceVector(ctx, oldVector, vector)
+}
+
+// PatchVector updates the fields of a vector the patch sets, leaving the
+// others, including the embedding when the patch has none, as they are.
+func (s *boltStore) PatchVector(ctx context.Context, id string, patch *models.PatchVectorRequest) (*models.Vector, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldVector, exists := s.vectors[id]
+	if !exists {
+		return nil, errors.ErrVectorNotFound
+	}
+
+	vector := *s.materialize(oldVector)
+	if patch.Vector != nil {
+		vector.Vector = patch.Vector
+	}
+	if patch.Text != nil {
+		vector.Text = *patch.Text
+	}
+	if patch.Metadata != nil {
+		vector.Metadata = patch.Metadata
+	}
+	if patch.Boost != nil {
+		vector.Boost = *patch.Boost
+	}
+	// Hooks see the patched vector, so derived metadata follows the new text
+	// and embedding. The metadata map is copied first as the hooks may
+	// modify it in place
+	vector.Metadata = maps.Clone(vector.Metadata)
+	if err := s.runInsertHooks(ctx, &vector); err != nil {
+		return nil, err
+	}
+	s.normalizeMetadata(&vector)
+	if err := s.validateMetadata(vector.Metadata); err != nil {
+		return nil, err
+	}
+	if err := s.validateCollection(&vector); err != nil {
+		return nil, err
+	}
+
+	if err := s.replaceVector(ctx, oldVector, &vector); err != nil {
+		return nil, err
+	}
+	return &vector, nil
+}
 
-	// Remove old vector from index
-	s.removeFromIndex(oldVector)
+// replaceVector writes vector in place of oldVector, keeping its ID and
+// creation time. The caller must hold s.mu.
+func (s *boltStore) replaceVector(ctx context.Context, oldVector, vector *models.Vector) error {
+	id := oldVector.ID
 
 	// Set timestamps
 	vector.ID = id
@@ -187,21 +767,35 @@ func (s *boltStore) UpdateVector(ctx context.Context, id string, vector *models.
 	}
 
 	// Update in database
-	err = s.db.Update(func(tx *bbolt.Tx) error {
+	err = s.update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("vectors"))
 		return bucket.Put([]byte(id), data)
 	})
 	if err != nil {
+		s.log(ctx).WithError(err).WithField("vector_id", id).Error("Failed to update vector")
 		return errors.Wrap(err, http.StatusInternalServerError, "failed to update vector")
 	}
 
-	// Update in-memory cache
-	s.vectors[id] = vector
-	s.addToIndex(vector)
+	// Update in-memory cache and index only once the update is persisted,
+	// so a failed write leaves them matching the database
+	s.replaced(ctx, []*models.Vector{oldVector}, []*models.Vector{vector})
 
 	return nil
 }
 
+// replaced swaps the persisted replacements of old into the in-memory cache
+// and index, and starts an index build when one is due. The caller must
+// hold s.mu.
+func (s *boltStore) replaced(ctx context.Context, old, vectors []*models.Vector) {
+	for i, vector := range vectors {
+		s.removeFromIndex(old[i])
+		s.vectors[vector.ID] = s.cacheVector(vector)
+		s.addToIndex(vector)
+		s.writes.Add(1)
+	}
+	s.maybeBuildIndex(ctx)
+}
+
 func (s *boltStore) DeleteVector(ctx context.Context, id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -212,10 +806,18 @@ func (s *boltStore) DeleteVector(ctx context.Context, id string) error {
 		return errors.ErrVectorNotFound
 	}
 
-	// Remove from database
-	err := s.db.Update(func(tx *bbolt.Tx) error {
+	if s.config.SoftDelete {
+		return s.softDelete(vector)
+	}
+
+	// Remove from database, logging the delete for the change feed
+	now := time.Now()
+	err := s.update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("vectors"))
-		return bucket.Delete([]byte(id))
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return logDeletion(tx, id, now)
 	})
 	if err != nil {
 		return errors.Wrap(err, http.StatusInternalServerError, "failed to delete vector")
@@ -223,35 +825,109 @@ func (s *boltStore) DeleteVector(ctx context.Context, id string) error {
 
 	// Remove from in-memory cache
 	delete(s.vectors, id)
+	s.deletions[id] = now
+	s.uncacheVector(id)
 	s.removeFromIndex(vector)
+	s.dropAccess(id)
+	s.writes.Add(1)
 
 	return nil
 }
 
+// ListVectors lists vectors in ID order. The page is found by walking the
+// keys of the vectors bucket, which are sorted, so only the vectors of the
+// page are read from the cache. Quantized embeddings are read back once the
+// transaction is done, as reading them opens one of their own.
 func (s *boltStore) ListVectors(ctx context.Context, limit, offset int) ([]*models.Vector, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	vectors := make([]*models.Vector, 0, len(s.vectors))
-	for _, vector := range s.vectors {
-		vectors = append(vectors, vector)
+	vectors := make([]*models.Vector, 0)
+	err := s.view(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket([]byte("vectors")).Cursor()
+		skipped := 0
+
+		for k, _ := cursor.First(); k != nil && len(vectors) < limit; k, _ = cursor.Next() {
+			// Tombstones and quarantined records aren't listed
+			vector, ok := s.vectors[string(k)]
+			if !ok {
+				continue
+			}
+
+			// Skip until we reach the offset
+			if skipped < offset {
+				skipped++
+				continue
+			}
+
+			vectors = append(vectors, vector)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to list vectors")
 	}
 
-	// Apply pagination
-	start := offset
-	end := offset + limit
-	if start >= len(vectors) {
-		return []*models.Vector{}, nil
+	for i, vector := range vectors {
+		vectors[i] = s.materialize(vector)
 	}
-	if end > len(vectors) {
-		end = len(vectors)
+	return vectors, nil
+}
+
+// ValidateVector runs the insert hooks and the checks InsertVector applies
+// to a vector without storing it. They run on a copy, so the vector is left
+// as given.
+func (s *boltStore) ValidateVector(ctx context.Context, vector *models.Vector) error {
+	candidate := *vector
+	candidate.Metadata = maps.Clone(vector.Metadata)
+	if err := s.runInsertHooks(ctx, &candidate); err != nil {
+		return err
 	}
+	if err := s.validateID(candidate.ID); err != nil {
+		return err
+	}
+	s.normalizeMetadata(&candidate)
+	if err := s.validateMetadata(candidate.Metadata); err != nil {
+		return err
+	}
+	return s.validateCollection(&candidate)
+}
+
+func (s *boltStore) Stats(ctx context.Context) (*models.StoreStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return vectors[start:end], nil
+	return &models.StoreStats{
+		Vectors:     len(s.vectors),
+		Documents:   int(s.docCount.Load()),
+		Tombstones:  len(s.tombstones),
+		Compactions: s.compactions,
+		Index:       s.indexName(),
+
+		Snapshots:       int(s.liveSnapshots.Load()),
+		SnapshotVectors: int(s.snapshotVectors.Load()),
+		DiskReads:       s.diskReads.Load(),
+		Quantized:       s.quantized(),
+
+		Defragmentations:     s.defrags.Load(),
+		DefragReclaimedBytes: s.defragReclaimed.Load(),
+		WarmedSearches:       s.warmedSearches.Load(),
+	}, nil
+}
+
+// Quarantine returns the records that were skipped at startup because they
+// could not be decoded.
+func (s *boltStore) Quarantine(ctx context.Context) ([]models.QuarantinedRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]models.QuarantinedRecord, len(s.quarantine))
+	copy(records, s.quarantine)
+	return records, nil
 }
 
 func (s *boltStore) Health(ctx context.Context) error {
-	return s.db.View(func(tx *bbolt.Tx) error {
+	return s.view(func(tx *bbolt.Tx) error {
 		// Try to access the vectors bucket
 		bucket := tx.Bucket([]byte("vectors"))
 		if bucket == nil {
@@ -261,6 +937,45 @@ func (s *boltStore) Health(ctx context.Context) error {
 	})
 }
 
+// goBackground runs fn in a goroutine Close waits for, returning false
+// without running it once the store is closing.
+func (s *boltStore) goBackground(fn func()) bool {
+	s.bgMu.Lock()
+	defer s.bgMu.Unlock()
+	if s.bgClosed {
+		return false
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+	return true
+}
+
 func (s *boltStore) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.bgMu.Lock()
+	s.bgClosed = true
+	s.bgMu.Unlock()
+	s.background.Wait()
+	// Wait for a running defragmentation, which would otherwise reopen the
+	// database once it's closed
+	s.defragMu.Lock()
+	defer s.defragMu.Unlock()
+	if err := s.flushAccess(); err != nil {
+		logger.WithError(err).Error("Failed to flush access counts")
+	}
+	if err := s.flushEvents(); err != nil {
+		logger.WithError(err).Error("Failed to flush search events")
+	}
+	if err := s.saveWarmSearches(); err != nil {
+		logger.WithError(err).Error("Failed to save warm searches")
+	}
+	if !s.ownsDB {
+		return nil
+	}
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
 	return s.db.Close()
 }
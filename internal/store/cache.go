@@ -0,0 +1,160 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
+
+	"vectraDB/internal/models"
+)
+
+const defaultSearchCacheTTL = time.Minute
+
+// cachedSearch is a search response along with the store's write count when
+// it was computed. Any write since makes it stale.
+type cachedSearch struct {
+	key      string
+	response *models.SearchResponse
+	writes   int64
+	expires  time.Time
+}
+
+// searchCacheKey identifies a search by every parameter of the request, so
+// searches differing in anything affecting ranking, such as the metric,
+// weights or minimum score, never share an entry. The request must have its
+// defaults applied.
+func searchCacheKey(req *models.SearchRequest) string {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// cachedSearchResponse returns a copy of the cached response for key, or
+// nil if there is none or it is stale.
+func (s *boltStore) cachedSearchResponse(key string) *models.SearchResponse {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	s.countSearch(key)
+	element, ok := s.searchCache[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*cachedSearch)
+	if entry.writes != s.writes.Load() || time.Now().After(entry.expires) {
+		s.searchOrder.Remove(element)
+		delete(s.searchCache, key)
+		return nil
+	}
+	s.searchOrder.MoveToFront(element)
+
+	response := copySearchResponse(entry.response)
+	response.Cached = true
+	response.Profile = nil
+	return response
+}
+
+// cacheSearchResponse caches response under key if no write happened since
+// writes was read, before the search started, evicting the least recently
+// used response when the cache is full.
+func (s *boltStore) cacheSearchResponse(key string, writes int64, response *models.SearchResponse) {
+	if writes != s.writes.Load() {
+		return
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	entry := &cachedSearch{
+		key:      key,
+		response: copySearchResponse(response),
+		writes:   writes,
+		expires:  time.Now().Add(s.config.SearchCacheTTL),
+	}
+	if element, ok := s.searchCache[key]; ok {
+		element.Value = entry
+		s.searchOrder.MoveToFront(element)
+		return
+	}
+	if s.searchOrder.Len() >= s.config.SearchCacheSize {
+		oldest := s.searchOrder.Back()
+		s.searchOrder.Remove(oldest)
+		delete(s.searchCache, oldest.Value.(*cachedSearch).key)
+	}
+	s.searchCache[key] = s.searchOrder.PushFront(entry)
+}
+
+// FlushSearchCache empties the search response cache, for when the database
+// was changed behind the store's back, and returns the number of responses
+// evicted.
+func (s *boltStore) FlushSearchCache(ctx context.Context) (int, error) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	evicted := len(s.searchCache)
+	s.searchCache = make(map[string]*list.Element)
+	s.searchOrder.Init()
+	return evicted, nil
+}
+
+// copySearchResponse deep-copies a search response, so neither the cache
+// nor the callers it serves see the changes the others make to theirs.
+func copySearchResponse(response *models.SearchResponse) *models.SearchResponse {
+	copied := *response
+	copied.Results = copySearchResults(response.Results)
+	copied.Weights = maps.Clone(response.Weights)
+	if response.Groups != nil {
+		copied.Groups = make(map[string][]models.SearchResult, len(response.Groups))
+		for value, group := range response.Groups {
+			copied.Groups[value] = copySearchResults(group)
+		}
+	}
+	if response.Cluster != nil {
+		cluster := *response.Cluster
+		copied.Cluster = &cluster
+	}
+	return &copied
+}
+
+func copySearchResults(results []models.SearchResult) []models.SearchResult {
+	if results == nil {
+		return nil
+	}
+	copied := make([]models.SearchResult, len(results))
+	for i, result := range results {
+		copied[i] = result
+		copied[i].Vector = *copyVector(&result.Vector)
+		if result.Confidence != nil {
+			confidence := *result.Confidence
+			copied[i].Confidence = &confidence
+		}
+		if result.Percentile != nil {
+			percentile := *result.Percentile
+			copied[i].Percentile = &percentile
+		}
+	}
+	return copied
+}
+
+// copyVector deep-copies a vector's embeddings and metadata.
+func copyVector(vector *models.Vector) *models.Vector {
+	copied := *vector
+	copied.Vector = slices.Clone(vector.Vector)
+	copied.Metadata = maps.Clone(vector.Metadata)
+	copied.OriginalMetadata = maps.Clone(vector.OriginalMetadata)
+	if vector.DeletedAt != nil {
+		deletedAt := *vector.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+	if vector.NamedVectors != nil {
+		copied.NamedVectors = make(map[string][]float64, len(vector.NamedVectors))
+		for name, values := range vector.NamedVectors {
+			copied.NamedVectors[name] = slices.Clone(values)
+		}
+	}
+	return &copied
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"container/heap"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/models"
+)
+
+// Hard deletes and compactions leave no record of a vector in the vectors
+// bucket, so the time of each is kept in the deletions bucket by vector ID.
+// The log is kept for as long as the change feed goes back, which is
+// forever, and holds one entry per deleted ID.
+
+// loadDeletions reads the deletion log into memory.
+func (s *boltStore) loadDeletions() error {
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("deletions"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			nanos, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return err
+			}
+			s.deletions[string(k)] = time.Unix(0, nanos)
+			return nil
+		})
+	})
+}
+
+// logDeletion records in tx that the vector id was deleted at.
+func logDeletion(tx *bbolt.Tx, id string, at time.Time) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte("deletions"))
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(id), []byte(strconv.FormatInt(at.UnixNano(), 10)))
+}
+
+// ListChanges returns vectors updated after since, ordered by update time,
+// including deleted vectors so consumers can drop them. Tombstones are
+// reported as they are, and vectors deleted outright or compacted as their
+// ID with DeletedAt and UpdatedAt set to the time of the delete, unless the
+// ID was written again since. Pages are resumed with the cursor returned in
+// NextCursor.
+func (s *boltStore) ListChanges(ctx context.Context, since time.Time, cursor string, limit int) (*models.ChangesResponse, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	afterTime, afterID := since, ""
+	if cursor != "" {
+		var err error
+		if afterTime, afterID, err = s.decodeChangeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep the limit+1 oldest changes after the cursor in a heap whose root
+	// is the newest of them, so a page costs a pass over the vectors but
+	// never copies or sorts more than a page.
+	page := make(changeHeap, 0, limit+1)
+	add := func(vector *models.Vector) {
+		if !vector.UpdatedAt.After(afterTime) && !(vector.UpdatedAt.Equal(afterTime) && afterID != "" && vector.ID > afterID) {
+			return
+		}
+		if len(page) <= limit {
+			heap.Push(&page, vector)
+		} else if changeBefore(vector, page[0]) {
+			page[0] = vector
+			heap.Fix(&page, 0)
+		}
+	}
+	s.mu.RLock()
+	for _, set := range []map[string]*models.Vector{s.vectors, s.tombstones} {
+		for _, vector := range set {
+			add(vector)
+		}
+	}
+	for id, deletedAt := range s.deletions {
+		// Skip IDs written again since, and deletes before the cursor
+		// without making a change of them
+		if s.vectors[id] != nil || s.tombstones[id] != nil || deletedAt.Before(afterTime) {
+			continue
+		}
+		add(&models.Vector{ID: id, UpdatedAt: deletedAt, DeletedAt: &deletedAt})
+	}
+
+	changes := make([]*models.Vector, len(page))
+	for i := len(page) - 1; i >= 0; i-- {
+		changes[i] = s.materialize(heap.Pop(&page).(*models.Vector))
+	}
+	s.mu.RUnlock()
+
+	result := &models.ChangesResponse{Changes: changes}
+	if len(changes) > limit {
+		result.Changes = changes[:limit]
+		last := result.Changes[limit-1]
+		result.NextCursor = s.encodeChangeCursor(last.UpdatedAt, last.ID)
+	}
+
+	return result, nil
+}
+
+// changeBefore reports whether a comes before b in the change feed.
+func changeBefore(a, b *models.Vector) bool {
+	if !a.UpdatedAt.Equal(b.UpdatedAt) {
+		return a.UpdatedAt.Before(b.UpdatedAt)
+	}
+	return a.ID < b.ID
+}
+
+// changeHeap holds a page of changes, latest first.
+type changeHeap []*models.Vector
+
+func (h changeHeap) Len() int           { return len(h) }
+func (h changeHeap) Less(i, j int) bool { return changeBefore(h[j], h[i]) }
+func (h changeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *changeHeap) Push(x any)        { *h = append(*h, x.(*models.Vector)) }
+func (h *changeHeap) Pop() any {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+func (s *boltStore) encodeChangeCursor(updatedAt time.Time, id string) string {
+	return s.signCursor("changes", strconv.FormatInt(updatedAt.UnixNano(), 10)+"|"+id)
+}
+
+func (s *boltStore) decodeChangeCursor(cursor string) (time.Time, string, error) {
+	raw, err := s.verifyCursor("changes", cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	nanos, id, ok := strings.Cut(raw, "|")
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return time.Unix(0, n), id, nil
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+)
+
+// Topic clusters group the stored vectors of the common dimension around
+// centroids, so a search can report which cluster its query falls in. They
+// reuse the centroids of the IVF index when it's built, and are otherwise
+// trained by k-means. Training never runs on a search: the first search
+// asking for clusters starts it in the background and searches report
+// whichever clusters were fitted last, none until the first fit completes.
+// Like cached projections they are refitted once a significant share of the
+// vectors has been written, which renumbers them; labels are the stable way
+// to tell them apart. FitClusters fits them on demand.
+type topicClusters struct {
+	dim       int
+	centroids [][]float32
+	// labels holds the most common value of Config.ClusterLabelKey among
+	// the vectors of each cluster, sizes their number
+	labels []string
+	sizes  []int
+	// size and writes are the number of vectors clustered and the store's
+	// write count at the time, used to decide when to refit
+	size   int
+	writes int64
+}
+
+// queryCluster returns the cluster nearest query among the clusters fitted
+// last, nil when none are fitted yet or no vectors of its dimension are
+// clustered. Missing or stale clusters are refitted in the background. The
+// caller must hold s.mu.
+func (s *boltStore) queryCluster(query []float64) *models.QueryCluster {
+	writes := s.writes.Load()
+	s.clusterMu.Lock()
+	c := s.clusters
+	s.clusterMu.Unlock()
+
+	if c == nil || float64(writes-c.writes) > refitRatio*float64(c.size) {
+		s.refitClusters()
+	}
+	if c == nil || len(query) != c.dim {
+		return nil
+	}
+
+	query = unit(query)
+	id := nearestCentroid(c.centroids, query)
+	centroid := make([]float64, c.dim)
+	for d, v := range c.centroids[id] {
+		centroid[d] = float64(v)
+	}
+	similarity, _ := cosineSimilarity(query, centroid)
+	return &models.QueryCluster{
+		ID:         id,
+		Label:      c.labels[id],
+		Size:       c.sizes[id],
+		Similarity: similarity,
+	}
+}
+
+// refitClusters fits the clusters in the background, unless a fit is
+// already running.
+func (s *boltStore) refitClusters() {
+	if !s.clusterFitting.CompareAndSwap(false, true) {
+		return
+	}
+	started := s.goBackground(func() {
+		defer s.clusterFitting.Store(false)
+		if _, err := s.FitClusters(context.Background()); err != nil {
+			logger.WithError(err).Error("Failed to fit topic clusters")
+		}
+	})
+	if !started {
+		s.clusterFitting.Store(false)
+	}
+}
+
+// clusterPoint is a vector being clustered, its embedding at unit length.
+type clusterPoint struct {
+	id      string
+	values  []float64
+	label   string
+	labeled bool
+}
+
+// FitClusters fits the topic clusters searches report to the vectors of
+// the common dimension, into Config.ClusterCount clusters, by default the
+// square root of their number as for the IVF index. The embeddings are
+// copied under the read lock, each read once, and the clusters trained
+// once it's released.
+func (s *boltStore) FitClusters(ctx context.Context) (*models.ClusterFitResult, error) {
+	s.clusterFitMu.Lock()
+	defer s.clusterFitMu.Unlock()
+	start := time.Now()
+
+	s.mu.RLock()
+	dim, writes := s.commonDimension(), s.writes.Load()
+	var centroids [][]float32
+	if ivf, ok := s.ann.(*ivfIndex); ok && ivf.dim == dim {
+		centroids = ivf.centroids
+	}
+	points := make([]clusterPoint, 0, len(s.vectors))
+	if dim > 0 {
+		for id, vector := range s.vectors {
+			if values := s.values(vector); len(values) == dim {
+				label, labeled := vector.Metadata[s.config.ClusterLabelKey]
+				label = models.MetadataText(label)
+				points = append(points, clusterPoint{id: id, values: unit(values), label: label, labeled: labeled && s.config.ClusterLabelKey != ""})
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c := &topicClusters{dim: dim, size: len(points), writes: writes}
+	if len(points) > 0 {
+		// Sort so the centroids are reproducible
+		sort.Slice(points, func(i, j int) bool { return points[i].id < points[j].id })
+		if centroids == nil {
+			lists := s.config.ClusterCount
+			if lists <= 0 {
+				lists = min(int(math.Sqrt(float64(len(points)))), maxIVFLists)
+			}
+			values := make([][]float64, len(points))
+			for i, point := range points {
+				values[i] = point.values
+			}
+			centroids = trainCentroids(values, max(min(lists, len(points)), 1))
+		}
+		c.assign(centroids, points)
+	}
+
+	s.clusterMu.Lock()
+	s.clusters = c
+	s.clusterMu.Unlock()
+
+	result := &models.ClusterFitResult{
+		Clusters:  len(c.centroids),
+		Vectors:   c.size,
+		Dimension: dim,
+		Duration:  time.Since(start).String(),
+	}
+	logger.WithFields(logrus.Fields{
+		"clusters":  result.Clusters,
+		"vectors":   result.Vectors,
+		"dimension": dim,
+		"duration":  result.Duration,
+	}).Info("Fitted topic clusters")
+	return result, nil
+}
+
+// assign sets the centroids of the clusters and sizes and labels them from
+// the points nearest each.
+func (c *topicClusters) assign(centroids [][]float32, points []clusterPoint) {
+	c.centroids = centroids
+	c.labels = make([]string, len(centroids))
+	c.sizes = make([]int, len(centroids))
+	values := make([]map[string]int, len(centroids))
+	for _, point := range points {
+		cluster := nearestCentroid(centroids, point.values)
+		c.sizes[cluster]++
+		if point.labeled {
+			if values[cluster] == nil {
+				values[cluster] = make(map[string]int)
+			}
+			values[cluster][point.label]++
+		}
+	}
+	for cluster, counts := range values {
+		best := 0
+		for value, n := range counts {
+			if n > best || (n == best && value < c.labels[cluster]) {
+				c.labels[cluster], best = value, n
+			}
+		}
+	}
+}
+
+// trainCentroids runs k-means over a sample of points, unit-length vectors
+// in a reproducible order, ivfTrainPerList per centroid.
+func trainCentroids(points [][]float64, lists int) [][]float32 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([][]float64, len(points))
+	copy(samples, points)
+	rng.Shuffle(len(samples), func(i, j int) { samples[i], samples[j] = samples[j], samples[i] })
+	if len(samples) > lists*ivfTrainPerList {
+		samples = samples[:lists*ivfTrainPerList]
+	}
+	return kmeans(samples, lists, ivfKMeansIterations, rng)
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// A collection can override the store's defaults with a config kept in the
+// collections bucket by collection name. Searches of the collection, or of
+// an alias pointing to it, use its metric when they don't set one, and
+// vectors written to it must have its dimension. Configs name collections
+// rather than aliases, so repointing an alias switches searches to the
+// config of the new collection along with its vectors.
+
+// loadCollectionConfigs reads the persisted collection configs into memory.
+func (s *boltStore) loadCollectionConfigs() error {
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("collections"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var config models.CollectionConfig
+			if err := json.Unmarshal(v, &config); err != nil {
+				return err
+			}
+			config.Collection = string(k)
+			s.collections[config.Collection] = &config
+			return nil
+		})
+	})
+}
+
+// validateCollection checks a vector against the config of the collection
+// its Config.CollectionKey metadata names, if it has one.
+func (s *boltStore) validateCollection(vector *models.Vector) error {
+	collection := models.MetadataText(vector.Metadata[s.config.CollectionKey])
+	if collection == "" {
+		return nil
+	}
+
+	s.aliasMu.RLock()
+	config := s.collections[collection]
+	s.aliasMu.RUnlock()
+
+	if config != nil && config.Dimension > 0 && len(vector.Vector) != config.Dimension {
+		return errors.New(http.StatusBadRequest, "invalid vector dimension").
+			WithDetails(fmt.Sprintf("collection %q has %d dimensions, the vector has %d", collection, config.Dimension, len(vector.Vector)))
+	}
+	return nil
+}
+
+// SetCollectionConfig replaces the config of a collection. It applies to
+// searches started and vectors written after it returns; vectors already
+// stored are left as they are.
+func (s *boltStore) SetCollectionConfig(ctx context.Context, config *models.CollectionConfig) (*models.CollectionConfig, error) {
+	if config.Collection == "" {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").WithDetails("collection is required")
+	}
+
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	if target, ok := s.aliases[config.Collection]; ok {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").
+			WithDetails(fmt.Sprintf("%q is an alias, configure the collection %q it points at instead", config.Collection, target))
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to marshal collection config")
+	}
+	err = s.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("collections"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(config.Collection), data)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to store collection config")
+	}
+
+	stored := *config
+	s.collections[config.Collection] = &stored
+	s.log(ctx).WithFields(logrus.Fields{
+		"collection": config.Collection,
+		"metric":     config.Metric,
+		"dimension":  config.Dimension,
+	}).Info("Configured collection")
+
+	return config, nil
+}
+
+// DeleteCollectionConfig removes the config of a collection, returning it,
+// so the collection goes back to the store's defaults.
+func (s *boltStore) DeleteCollectionConfig(ctx context.Context, collection string) (*models.CollectionConfig, error) {
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	config, ok := s.collections[collection]
+	if !ok {
+		return nil, errors.New(http.StatusNotFound, "collection config not found")
+	}
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("collections"))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.Delete([]byte(collection))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to delete collection config")
+	}
+
+	delete(s.collections, collection)
+	s.log(ctx).WithField("collection", collection).Info("Deleted collection config")
+
+	return config, nil
+}
+
+// ListCollectionConfigs returns every collection config, sorted by
+// collection.
+func (s *boltStore) ListCollectionConfigs(ctx context.Context) ([]models.CollectionConfig, error) {
+	s.aliasMu.RLock()
+	defer s.aliasMu.RUnlock()
+
+	configs := make([]models.CollectionConfig, 0, len(s.collections))
+	for _, config := range s.collections {
+		configs = append(configs, *config)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Collection < configs[j].Collection
+	})
+	return configs, nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// defaultCompactionBatchSize is the number of tombstones a compaction
+// removes per transaction
+const defaultCompactionBatchSize = 1000
+
+// softDelete replaces a vector with a tombstone. The caller must hold s.mu.
+func (s *boltStore) softDelete(vector *models.Vector) error {
+	now := time.Now()
+	tombstone := *s.materialize(vector)
+	tombstone.DeletedAt = &now
+	tombstone.UpdatedAt = now
+
+	data, err := json.Marshal(&tombstone)
+	if err != nil {
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to marshal vector")
+	}
+
+	err = s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("vectors"))
+		return bucket.Put([]byte(vector.ID), data)
+	})
+	if err != nil {
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to delete vector")
+	}
+
+	delete(s.vectors, vector.ID)
+	s.uncacheVector(vector.ID)
+	s.removeFromIndex(vector)
+	s.dropAccess(vector.ID)
+	s.tombstones[vector.ID] = &tombstone
+	s.writes.Add(1)
+
+	// Compaction runs in the background, tracked so Close waits for it
+	if s.shouldCompact() && s.compacting.CompareAndSwap(false, true) {
+		started := s.goBackground(func() {
+			defer s.compacting.Store(false)
+			s.compact(context.Background(), true, nil)
+		})
+		if !started {
+			s.compacting.Store(false)
+		}
+	}
+
+	return nil
+}
+
+// shouldCompact reports whether the tombstone ratio crossed the configured
+// threshold. The caller must hold s.mu.
+func (s *boltStore) shouldCompact() bool {
+	if s.config.CompactionThreshold <= 0 || len(s.tombstones) == 0 {
+		return false
+	}
+	ratio := float64(len(s.tombstones)) / float64(len(s.vectors)+len(s.tombstones))
+	return ratio > s.config.CompactionThreshold
+}
+
+// Compact permanently removes tombstones left behind by soft deletes, which
+// the change feed keeps reporting from the deletion log, and returns the
+// number of records reclaimed. It reports its progress from 0
+// to 1 to progress, if set, after each batch, and stops between batches
+// once ctx is done, keeping the tombstones already removed.
+func (s *boltStore) Compact(ctx context.Context, progress func(float64)) (int, error) {
+	return s.compact(ctx, false, progress)
+}
+
+// compact removes the tombstones Config.CompactionBatchSize at a time, each
+// batch in a transaction of its own, so the database is never left holding
+// some of a batch.
+func (s *boltStore) compact(ctx context.Context, automatic bool, progress func(float64)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.tombstones) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(s.tombstones))
+	for id := range s.tombstones {
+		ids = append(ids, id)
+	}
+
+	reclaimed := 0
+	for start := 0; start < len(ids); start += s.config.CompactionBatchSize {
+		if err := ctx.Err(); err != nil {
+			logger.WithFields(logrus.Fields{
+				"reclaimed": reclaimed,
+				"remaining": len(s.tombstones),
+			}).Info("Compaction cancelled")
+			return reclaimed, err
+		}
+
+		batch := ids[start:min(start+s.config.CompactionBatchSize, len(ids))]
+		err := s.update(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket([]byte("vectors"))
+			for _, id := range batch {
+				if err := bucket.Delete([]byte(id)); err != nil {
+					return err
+				}
+				if err := logDeletion(tx, id, *s.tombstones[id].DeletedAt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logger.WithError(err).Error("Compaction failed")
+			return reclaimed, errors.Wrap(err, http.StatusInternalServerError, "failed to compact vectors")
+		}
+
+		for _, id := range batch {
+			s.deletions[id] = *s.tombstones[id].DeletedAt
+			delete(s.tombstones, id)
+		}
+		reclaimed += len(batch)
+		if progress != nil {
+			progress(float64(reclaimed) / float64(len(ids)))
+		}
+	}
+	s.compactions++
+
+	logger.WithFields(logrus.Fields{
+		"reclaimed":   reclaimed,
+		"automatic":   automatic,
+		"compactions": s.compactions,
+	}).Info("Compaction finished")
+
+	return reclaimed, nil
+}
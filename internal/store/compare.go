@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// Compare scores two vectors, referenced by ID or given inline, under the
+// requested metric.
+func (s *boltStore) Compare(ctx context.Context, req *models.CompareRequest) (*models.CompareResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if req.Metric == "" {
+		req.Metric = models.MetricCosine
+	}
+
+	a, err := s.resolveRef(req.A, "a")
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.resolveRef(req.B, "b")
+	if err != nil {
+		return nil, err
+	}
+	if len(a) != len(b) {
+		return nil, errors.New(http.StatusBadRequest, "invalid vector dimension").
+			WithDetails(fmt.Sprintf("a has %d dimensions, b has %d", len(a), len(b)))
+	}
+
+	result := &models.CompareResponse{
+		Metric:    req.Metric,
+		Dimension: len(a),
+	}
+	switch req.Metric {
+	case models.MetricCosine:
+		similarity, err := cosineSimilarity(a, b)
+		if err != nil {
+			return nil, errors.New(http.StatusBadRequest, "invalid vector data").
+				WithDetails("cosine similarity is undefined for zero-magnitude vectors")
+		}
+		result.Score = similarity
+		result.Distance = 1 - similarity
+	case models.MetricDot:
+		for i := range a {
+			result.Score += a[i] * b[i]
+		}
+		result.Distance = -result.Score
+	case models.MetricEuclidean:
+		for i := range a {
+			result.Distance += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		result.Distance = math.Sqrt(result.Distance)
+		result.Score = 1 / (1 + result.Distance)
+	default:
+		return nil, errors.New(http.StatusBadRequest, "invalid input").WithDetails(fmt.Sprintf("unknown metric %q", req.Metric))
+	}
+
+	return result, nil
+}
+
+// resolveRef returns the embedding a reference points to. The caller must
+// hold s.mu.
+func (s *boltStore) resolveRef(ref models.VectorRef, name string) ([]float64, error) {
+	if ref.Vector != nil {
+		if len(ref.Vector) == 0 {
+			return nil, errors.New(http.StatusBadRequest, "invalid vector data").WithDetails(name + " is empty")
+		}
+		return ref.Vector, nil
+	}
+	if ref.ID == "" {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").WithDetails(name + " must be a vector ID or an array of numbers")
+	}
+
+	vector, ok := s.vectors[ref.ID]
+	if !ok {
+		return nil, errors.New(http.StatusNotFound, "vector not found").WithDetails(ref.ID)
+	}
+	return s.values(vector), nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"time"
+
+	"vectraDB/pkg/errors"
+)
+
+var (
+	ErrInvalidCursor = errors.New(http.StatusBadRequest, "invalid cursor")
+	ErrExpiredCursor = errors.New(http.StatusBadRequest, "expired cursor")
+)
+
+const defaultCursorTTL = 24 * time.Hour
+
+// Pagination cursors are signed so clients can't forge them to resume from
+// arbitrary positions, and can carry query state safely. A cursor is the
+// base64 encoding of its expiry in nanoseconds, its kind and its payload,
+// then a dot and the base64 HMAC-SHA256 of those bytes under
+// Config.CursorSecret. The kind keeps a cursor of one listing from being
+// accepted by another.
+
+// cursorSecret returns the configured secret, or a random one when none is
+// set, in which case cursors don't survive a restart.
+func cursorSecret(secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to generate cursor secret")
+	}
+	return random, nil
+}
+
+// signCursor returns a signed cursor of kind carrying payload, expiring
+// after Config.CursorTTL.
+func (s *boltStore) signCursor(kind, payload string) string {
+	raw := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(s.config.CursorTTL).UnixNano()))
+	raw = append(raw, kind+"|"+payload...)
+	return base64.RawURLEncoding.EncodeToString(raw) + "." + base64.RawURLEncoding.EncodeToString(s.cursorMAC(raw))
+}
+
+// verifyCursor returns the payload of a cursor of kind, failing with
+// ErrInvalidCursor when it wasn't signed by this store for kind and with
+// ErrExpiredCursor once it has expired.
+func (s *boltStore) verifyCursor(kind, cursor string) (string, error) {
+	encoded, encodedMAC, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return "", ErrInvalidCursor
+	}
+	// Strict decoding, so no two encodings of a cursor are accepted
+	encoding := base64.RawURLEncoding.Strict()
+	raw, err := encoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	mac, err := encoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.cursorMAC(raw)) || len(raw) < 8 {
+		return "", ErrInvalidCursor
+	}
+
+	cursorKind, payload, ok := strings.Cut(string(raw[8:]), "|")
+	if !ok || cursorKind != kind {
+		return "", ErrInvalidCursor
+	}
+	if time.Now().UnixNano() > int64(binary.BigEndian.Uint64(raw[:8])) {
+		return "", ErrExpiredCursor
+	}
+	return payload, nil
+}
+
+func (s *boltStore) cursorMAC(raw []byte) []byte {
+	mac := hmac.New(sha256.New, s.cursorSecret)
+	mac.Write(raw)
+	return mac.Sum(nil)
+}
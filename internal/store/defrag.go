@@ -0,0 +1,281 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// ErrSharedDB is returned when defragmenting a database handed to the
+// store through Config.DB, which it can't close and replace.
+var ErrSharedDB = errors.New(http.StatusConflict, "cannot defragment a shared database")
+
+const (
+	// defragCopyAttempts is the number of copies tried while writes go on
+	// before the database is copied with writes held off
+	defragCopyAttempts = 3
+	// defragTxMaxSize bounds the size of the transactions filling the copy
+	defragTxMaxSize = 64 << 20
+	// defaultDefragMinFreeRatio is the share of pages that must be free
+	// for a scheduled defragmentation to run
+	defaultDefragMinFreeRatio = 0.2
+)
+
+// bbolt reuses the pages freed by deletes and updates but never shrinks its
+// file, so a database with heavy churn keeps the size of its peak.
+// Defragmenting copies the records into a new, compact file that replaces
+// the database.
+//
+// Every transaction holds dbMu shared, through view and update, so the
+// database can only be swapped once none is running. The copy is made under
+// the shared lock, while reads and writes go on, and is only kept when no
+// write was committed during it, which is checked under the exclusive lock
+// the swap holds. When writes land during every attempt the last copy is
+// made under the exclusive lock, stalling the store for its duration.
+
+// view runs fn in a read transaction on the current database.
+func (s *boltStore) view(fn func(tx *bbolt.Tx) error) error {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	return s.db.View(fn)
+}
+
+// update runs fn in a write transaction on the current database.
+func (s *boltStore) update(fn func(tx *bbolt.Tx) error) error {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	return s.db.Update(fn)
+}
+
+// Defragment rewrites the database into a compact file, returning the space
+// reclaimed on disk.
+func (s *boltStore) Defragment(ctx context.Context) (*models.DefragResult, error) {
+	if !s.ownsDB {
+		return nil, ErrSharedDB
+	}
+	s.defragMu.Lock()
+	defer s.defragMu.Unlock()
+
+	start := time.Now()
+	path := s.db.Path()
+	before, err := fileSize(path)
+	if err != nil {
+		return nil, err
+	}
+	tmp := path + ".defrag"
+
+	locked := false
+	for attempt := 1; !locked; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		last := attempt == defragCopyAttempts
+		if last {
+			s.dbMu.Lock()
+			locked = true
+		} else {
+			s.dbMu.RLock()
+		}
+		txID := s.lastTxID()
+		err := s.copyDB(tmp)
+		if !last {
+			s.dbMu.RUnlock()
+		}
+		if err != nil {
+			if locked {
+				s.dbMu.Unlock()
+			}
+			os.Remove(tmp)
+			return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to copy database")
+		}
+
+		if !last {
+			s.dbMu.Lock()
+			if locked = s.lastTxID() == txID; !locked {
+				s.dbMu.Unlock()
+			}
+		}
+	}
+	defer s.dbMu.Unlock()
+
+	if err := s.swapDB(path, tmp); err != nil {
+		return nil, err
+	}
+
+	after, err := fileSize(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.DefragResult{
+		SizeBefore: before,
+		SizeAfter:  after,
+		Reclaimed:  before - after,
+		Duration:   time.Since(start).String(),
+	}
+	s.defrags.Add(1)
+	s.defragReclaimed.Add(result.Reclaimed)
+
+	logger.WithFields(logrus.Fields{
+		"size_before": before,
+		"size_after":  after,
+		"reclaimed":   result.Reclaimed,
+		"duration":    result.Duration,
+	}).Info("Defragmented database")
+	return result, nil
+}
+
+// lastTxID returns the ID of the last committed transaction. The caller
+// must hold dbMu.
+func (s *boltStore) lastTxID() int {
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return -1
+	}
+	defer tx.Rollback()
+	return tx.ID()
+}
+
+// copyDB copies the database into a new file at path. The caller must hold
+// dbMu.
+func (s *boltStore) copyDB(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dst, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: s.config.Timeout})
+	if err != nil {
+		return err
+	}
+	if err := bbolt.Compact(dst, s.db, defragTxMaxSize); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// swapDB replaces the database at path with the copy at tmp and reopens it.
+// The caller must hold dbMu exclusively.
+func (s *boltStore) swapDB(path, tmp string) error {
+	options := &bbolt.Options{Timeout: s.config.Timeout, OpenFile: s.config.OpenFile}
+	if err := s.db.Close(); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to close database")
+	}
+
+	renameErr := os.Rename(tmp, path)
+	if renameErr != nil {
+		os.Remove(tmp)
+	}
+	// Reopen the database even when the copy couldn't replace it
+	db, err := bbolt.Open(path, 0600, options)
+	if err != nil {
+		logger.WithError(err).Error("Failed to reopen database after defragmenting")
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to reopen database")
+	}
+	s.db = db
+	if renameErr != nil {
+		return errors.Wrap(renameErr, http.StatusInternalServerError, "failed to replace database")
+	}
+	return nil
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, errors.Wrap(err, http.StatusInternalServerError, "failed to stat database")
+	}
+	return info.Size(), nil
+}
+
+// runDefragmenter defragments the database every interval inside the
+// configured window, when it has free pages to reclaim, until s.done is
+// closed.
+func (s *boltStore) runDefragmenter(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			if !s.defragWindow.contains(now) || !s.fragmented() {
+				continue
+			}
+			if _, err := s.Defragment(context.Background()); err != nil {
+				logger.WithError(err).Error("Scheduled defragmentation failed")
+			}
+		}
+	}
+}
+
+// fragmented reports whether at least Config.DefragMinFreeRatio of the
+// database's pages are free, so a copy would leave enough of them out to be
+// worth making.
+func (s *boltStore) fragmented() bool {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	stats := s.db.Stats()
+	size, err := fileSize(s.db.Path())
+	if err != nil || size == 0 {
+		return false
+	}
+	// Info reads the memory map a write may be growing, which a read
+	// transaction holds in place
+	var pageSize int
+	s.db.View(func(tx *bbolt.Tx) error {
+		pageSize = tx.DB().Info().PageSize
+		return nil
+	})
+	pages := size / int64(pageSize)
+	return float64(stats.FreePageN+stats.PendingPageN) >= s.config.DefragMinFreeRatio*float64(pages)
+}
+
+// timeWindow is a daily window of local time, from start up to end minutes
+// past midnight. It wraps past midnight when end is before start. The nil
+// window is always open.
+type timeWindow struct {
+	start, end int
+}
+
+// parseTimeWindow parses a window written "HH:MM-HH:MM", "" for none.
+func parseTimeWindow(raw string) (*timeWindow, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(raw, "-")
+	if !ok {
+		return nil, fmt.Errorf("window %q isn't of the form HH:MM-HH:MM", raw)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("window %q: %w", raw, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("window %q: %w", raw, err)
+	}
+	return &timeWindow{
+		start: start.Hour()*60 + start.Minute(),
+		end:   end.Hour()*60 + end.Minute(),
+	}, nil
+}
+
+func (w *timeWindow) contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/models"
+)
+
+// fitQueryDimension applies the dimension mismatch policy of a search to
+// its query, returning it padded with zeros or truncated to the dimension
+// most stored vectors have. Under the default reject policy, and for
+// queries the policy doesn't apply to, the query is returned unchanged and
+// vectors of another dimension are skipped. The caller must hold s.mu.
+func (s *boltStore) fitQueryDimension(ctx context.Context, query []float64, policy string) []float64 {
+	if policy == "" || policy == models.DimensionMismatchReject {
+		return query
+	}
+	dim, from := s.commonDimension(), len(query)
+	switch {
+	case dim == 0 || len(query) == dim:
+		return query
+	case policy == models.DimensionMismatchPadZero && len(query) < dim:
+		padded := make([]float64, dim)
+		copy(padded, query)
+		query = padded
+	case policy == models.DimensionMismatchTruncate && len(query) > dim:
+		query = query[:dim:dim]
+	default:
+		return query
+	}
+
+	s.log(ctx).WithFields(logrus.Fields{
+		"policy": policy,
+		"from":   from,
+		"to":     dim,
+	}).Info("Fitted query to the dimension of the stored vectors")
+	return query
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// Documents are not kept in memory, but their tags are indexed so documents
+// can be listed by tag without scanning the bucket, their expiries so the
+// janitor doesn't scan it either, and they're counted so Stats doesn't.
+// s.docMu guards the indexes and is held across document writes so they
+// stay consistent with the bucket.
+
+func (s *boltStore) loadDocumentIndex() error {
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("documents"))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var doc models.Document
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return nil // Skip invalid documents
+			}
+			s.docCount.Add(1)
+			s.indexDocument(&doc)
+			return nil
+		})
+	})
+}
+
+// indexDocument indexes the tags and expiry of doc. The caller must hold
+// s.docMu.
+func (s *boltStore) indexDocument(doc *models.Document) {
+	s.trackExpiry(doc)
+	for _, tag := range doc.Tags {
+		if _, ok := s.docTags[tag]; !ok {
+			s.docTags[tag] = make(map[string]bool)
+		}
+		s.docTags[tag][doc.ID] = true
+	}
+}
+
+// unindexDocument drops the tags and expiry of doc from the indexes. The
+// caller must hold s.docMu.
+func (s *boltStore) unindexDocument(doc *models.Document) {
+	delete(s.docExpiry, doc.ID)
+	for _, tag := range doc.Tags {
+		if ids, ok := s.docTags[tag]; ok {
+			delete(ids, doc.ID)
+			if len(ids) == 0 {
+				delete(s.docTags, tag)
+			}
+		}
+	}
+}
+
+// taggedDocumentIDs returns the sorted IDs of the documents with tag.
+func (s *boltStore) taggedDocumentIDs(tag string) []string {
+	s.docMu.RLock()
+	defer s.docMu.RUnlock()
+
+	ids := make([]string, 0, len(s.docTags[tag]))
+	for id := range s.docTags[tag] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// filterByDocumentTags keeps the vectors whose linked, unexpired document
+// has one of tags. The documents with the tags are looked up once, rather
+// than once per vector.
+func (s *boltStore) filterByDocumentTags(vectors []*models.Vector, tags []string) []*models.Vector {
+	now := time.Now()
+	s.docMu.RLock()
+	documents := make(map[string]bool)
+	for _, tag := range tags {
+		for id := range s.docTags[tag] {
+			// Expired documents awaiting the janitor are already gone
+			if expiresAt, ok := s.docExpiry[id]; ok && !now.Before(expiresAt) {
+				continue
+			}
+			documents[id] = true
+		}
+	}
+	s.docMu.RUnlock()
+
+	filtered := make([]*models.Vector, 0, len(vectors))
+	for _, vector := range vectors {
+		if documents[vector.Metadata[models.DocumentIDKey]] {
+			filtered = append(filtered, vector)
+		}
+	}
+	return filtered
+}
+
+// BulkTagDocuments adds and removes tags on every document matching the
+// filter in a single transaction and returns the number of documents
+// changed.
+func (s *boltStore) BulkTagDocuments(ctx context.Context, req *models.BulkTagRequest) (int, error) {
+	if len(req.Filter.IDs) == 0 && len(req.Filter.Tags) == 0 {
+		return 0, errors.New(http.StatusBadRequest, "invalid input").WithDetails("filter must set ids or tags")
+	}
+
+	s.docMu.Lock()
+	defer s.docMu.Unlock()
+
+	var before, after []*models.Document
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("documents"))
+		if err != nil {
+			return err
+		}
+
+		// Collect changes first, the bucket can't be written while iterating
+		updates := make(map[string][]byte)
+		now := time.Now()
+		err = bucket.ForEach(func(k, v []byte) error {
+			var doc models.Document
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return nil // Skip invalid documents
+			}
+			if doc.Expired(now) || !req.Filter.Matches(&doc) {
+				return nil
+			}
+
+			tags, changed := retag(doc.Tags, req.AddTags, req.RemoveTags)
+			if !changed {
+				return nil
+			}
+			updated := doc
+			updated.Tags = tags
+			updated.UpdatedAt = now
+
+			data, err := json.Marshal(&updated)
+			if err != nil {
+				return err
+			}
+			updates[string(k)] = data
+			before = append(before, &doc)
+			after = append(after, &updated)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for id, data := range updates {
+			if err := bucket.Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, http.StatusInternalServerError, "failed to update document tags")
+	}
+
+	for i := range before {
+		s.unindexDocument(before[i])
+		s.indexDocument(after[i])
+	}
+
+	return len(after), nil
+}
+
+// retag returns tags with add appended and remove dropped, preserving the
+// existing order, and whether anything changed.
+func retag(tags, add, remove []string) ([]string, bool) {
+	drop := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		drop[tag] = true
+	}
+
+	result := make([]string, 0, len(tags)+len(add))
+	present := make(map[string]bool, len(tags)+len(add))
+	for _, tag := range tags {
+		if drop[tag] || present[tag] {
+			continue
+		}
+		present[tag] = true
+		result = append(result, tag)
+	}
+	for _, tag := range add {
+		if drop[tag] || present[tag] {
+			continue
+		}
+		present[tag] = true
+		result = append(result, tag)
+	}
+
+	return result, len(result) != len(tags) || !sameTags(result, tags)
+}
+
+func sameTags(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -12,16 +12,17 @@ import (
 )
 
 func (s *boltStore) InsertDocument(ctx context.Context, doc *models.Document) error {
-	// Check if document already exists
-	existing, err := s.GetDocument(ctx, doc.ID)
-	if err == nil && existing != nil {
-		return errors.ErrDocumentExists
-	}
+	s.docMu.Lock()
+	defer s.docMu.Unlock()
 
 	// Set timestamps
 	now := time.Now()
 	doc.CreatedAt = now
 	doc.UpdatedAt = now
+	if doc.ExpiresAt == nil && s.config.DocumentRetention > 0 {
+		expiresAt := now.Add(s.config.DocumentRetention)
+		doc.ExpiresAt = &expiresAt
+	}
 
 	// Marshal document
 	data, err := json.Marshal(doc)
@@ -29,28 +30,58 @@ func (s *boltStore) InsertDocument(ctx context.Context, doc *models.Document) er
 		return errors.Wrap(err, http.StatusInternalServerError, "failed to marshal document")
 	}
 
-	// Store in database
-	err = s.db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("documents"))
-		if bucket == nil {
-			return errors.New(http.StatusInternalServerError, "documents bucket not found")
+	// Store in database, checking the document doesn't exist in the same
+	// transaction. Expired documents awaiting the janitor are replaced
+	var existing *models.Document
+	err = s.update(func(tx *bbolt.Tx) error {
+		// Created lazily for databases that predate documents
+		bucket, err := tx.CreateBucketIfNotExists([]byte("documents"))
+		if err != nil {
+			return err
+		}
+		if stored := bucket.Get([]byte(doc.ID)); stored != nil {
+			existing = &models.Document{}
+			if err := json.Unmarshal(stored, existing); err == nil && !existing.Expired(now) {
+				return errors.ErrDocumentExists
+			}
 		}
 		return bucket.Put([]byte(doc.ID), data)
 	})
+	if err == errors.ErrDocumentExists {
+		return err
+	}
 	if err != nil {
 		return errors.Wrap(err, http.StatusInternalServerError, "failed to store document")
 	}
+	if existing != nil {
+		s.unindexDocument(existing)
+	} else {
+		s.docCount.Add(1)
+	}
+	s.indexDocument(doc)
 
 	return nil
 }
 
 func (s *boltStore) GetDocument(ctx context.Context, id string) (*models.Document, error) {
+	doc, err := s.readDocument(id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Expired(time.Now()) {
+		return nil, errors.ErrDocumentNotFound
+	}
+	return doc, nil
+}
+
+// readDocument reads a document from the bucket, expired or not.
+func (s *boltStore) readDocument(id string) (*models.Document, error) {
 	var doc models.Document
 
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("documents"))
 		if bucket == nil {
-			return errors.New(http.StatusInternalServerError, "documents bucket not found")
+			return errors.ErrDocumentNotFound
 		}
 
 		data := bucket.Get([]byte(id))
@@ -67,81 +98,111 @@ func (s *boltStore) GetDocument(ctx context.Context, id string) (*models.Documen
 	return &doc, nil
 }
 
-func (s *boltStore) UpdateDocument(ctx context.Context, id string, doc *models.Document) error {
+// DocumentExists reports whether an unexpired document is stored.
+func (s *boltStore) DocumentExists(ctx context.Context, id string) (bool, error) {
+	_, err := s.GetDocument(ctx, id)
+	if err == errors.ErrDocumentNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// UpdateDocument replaces the title, content and tags of a document and
+// returns it as stored.
+func (s *boltStore) UpdateDocument(ctx context.Context, id string, req *models.UpdateDocumentRequest) (*models.Document, error) {
+	s.docMu.Lock()
+	defer s.docMu.Unlock()
+
 	// Check if document exists
 	existing, err := s.GetDocument(ctx, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Set timestamps
-	doc.ID = id
-	doc.CreatedAt = existing.CreatedAt
-	doc.UpdatedAt = time.Now()
+	// Set timestamps, keeping the expiry unless a new one is given or it's
+	// cleared
+	doc := &models.Document{
+		ID:        id,
+		Title:     req.Title,
+		Content:   req.Content,
+		Tags:      req.Tags,
+		CreatedAt: existing.CreatedAt,
+		UpdatedAt: time.Now(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if req.KeepForever {
+		doc.ExpiresAt = nil
+	} else if doc.ExpiresAt == nil {
+		doc.ExpiresAt = existing.ExpiresAt
+	}
 
 	// Marshal document
 	data, err := json.Marshal(doc)
 	if err != nil {
-		return errors.Wrap(err, http.StatusInternalServerError, "failed to marshal document")
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to marshal document")
 	}
 
 	// Update in database
-	err = s.db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("documents"))
-		if bucket == nil {
-			return errors.New(http.StatusInternalServerError, "documents bucket not found")
+	err = s.update(func(tx *bbolt.Tx) error {
+		// Created lazily for databases that predate documents
+		bucket, err := tx.CreateBucketIfNotExists([]byte("documents"))
+		if err != nil {
+			return err
 		}
 		return bucket.Put([]byte(id), data)
 	})
 	if err != nil {
-		return errors.Wrap(err, http.StatusInternalServerError, "failed to update document")
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to update document")
 	}
+	s.unindexDocument(existing)
+	s.indexDocument(doc)
 
-	return nil
+	return doc, nil
 }
 
 func (s *boltStore) DeleteDocument(ctx context.Context, id string) error {
+	s.docMu.Lock()
+	defer s.docMu.Unlock()
+
 	// Check if document exists
-	_, err := s.GetDocument(ctx, id)
+	existing, err := s.GetDocument(ctx, id)
 	if err != nil {
 		return err
 	}
 
 	// Delete from database
-	err = s.db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("documents"))
-		if bucket == nil {
-			return errors.New(http.StatusInternalServerError, "documents bucket not found")
+	err = s.update(func(tx *bbolt.Tx) error {
+		// Created lazily for databases that predate documents
+		bucket, err := tx.CreateBucketIfNotExists([]byte("documents"))
+		if err != nil {
+			return err
 		}
 		return bucket.Delete([]byte(id))
 	})
 	if err != nil {
 		return errors.Wrap(err, http.StatusInternalServerError, "failed to delete document")
 	}
+	s.unindexDocument(existing)
+	s.docCount.Add(-1)
 
 	return nil
 }
 
 func (s *boltStore) ListDocuments(ctx context.Context, limit, offset int) ([]*models.Document, error) {
-	var documents []*models.Document
+	documents := make([]*models.Document, 0)
 
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("documents"))
 		if bucket == nil {
-			return errors.New(http.StatusInternalServerError, "documents bucket not found")
+			return nil // No documents written yet
 		}
 
 		cursor := bucket.Cursor()
 		count := 0
 		skipped := 0
+		now := time.Now()
 
 		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			// Skip until we reach the offset
-			if skipped < offset {
-				skipped++
-				continue
-			}
-
 			// Stop if we've reached the limit
 			if count >= limit {
 				break
@@ -151,6 +212,15 @@ func (s *boltStore) ListDocuments(ctx context.Context, limit, offset int) ([]*mo
 			if err := json.Unmarshal(v, &doc); err != nil {
 				continue // Skip invalid documents
 			}
+			if doc.Expired(now) {
+				continue
+			}
+
+			// Skip until we reach the offset
+			if skipped < offset {
+				skipped++
+				continue
+			}
 
 			documents = append(documents, &doc)
 			count++
@@ -165,51 +235,43 @@ func (s *boltStore) ListDocuments(ctx context.Context, limit, offset int) ([]*mo
 	return documents, nil
 }
 
+// ListDocumentsByTag lists the documents with tag in ID order, using the
+// tag index rather than scanning the bucket.
 func (s *boltStore) ListDocumentsByTag(ctx context.Context, tag string, limit, offset int) ([]*models.Document, error) {
-	var documents []*models.Document
+	documents := make([]*models.Document, 0)
 
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	ids := s.taggedDocumentIDs(tag)
+	if offset >= len(ids) {
+		return documents, nil
+	}
+
+	err := s.view(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("documents"))
 		if bucket == nil {
-			return errors.New(http.StatusInternalServerError, "documents bucket not found")
+			return nil // No documents written yet
 		}
 
-		cursor := bucket.Cursor()
-		count := 0
 		skipped := 0
-
-		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
-			var doc models.Document
-			if err := json.Unmarshal(v, &doc); err != nil {
-				continue // Skip invalid documents
+		now := time.Now()
+		for _, id := range ids {
+			// Stop if we've reached the limit
+			if len(documents) >= limit {
+				break
 			}
 
-			// Check if document has the specified tag
-			hasTag := false
-			for _, docTag := range doc.Tags {
-				if docTag == tag {
-					hasTag = true
-					break
-				}
+			var doc models.Document
+			if err := json.Unmarshal(bucket.Get([]byte(id)), &doc); err != nil {
+				continue // Skip invalid or concurrently deleted documents
 			}
-
-			if !hasTag {
+			if doc.Expired(now) {
 				continue
 			}
-
 			// Skip until we reach the offset
 			if skipped < offset {
 				skipped++
 				continue
 			}
-
-			// Stop if we've reached the limit
-			if count >= limit {
-				break
-			}
-
 			documents = append(documents, &doc)
-			count++
 		}
 
 		return nil
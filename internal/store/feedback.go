@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// RecordFeedback buffers the clicks on the results of a search for the
+// feedback bucket.
+func (s *boltStore) RecordFeedback(ctx context.Context, feedback *models.SearchFeedback) error {
+	data, err := json.Marshal(feedback)
+	if err != nil {
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to marshal search feedback")
+	}
+
+	if err := s.appendEvent("feedback", feedback.Time, data); err != nil {
+		return errors.Wrap(err, http.StatusInternalServerError, "failed to record search feedback")
+	}
+
+	return nil
+}
+
+// maxFeedbackEvents bounds the searches, and separately the feedback,
+// QueryFeedback reads.
+const maxFeedbackEvents = 100000
+
+// QueryFeedback aggregates the feedback on the searches recorded in
+// [from, to) by query text, only for query when it is set, and returns up
+// to limit queries, most searched first. Searches are joined with the
+// feedback on them by query ID, so searches without feedback count as not
+// clicked. A zero to leaves the range open-ended. At most maxFeedbackEvents
+// searches are aggregated, oldest first.
+func (s *boltStore) QueryFeedback(ctx context.Context, from, to time.Time, query string, limit int) ([]*models.QueryFeedback, error) {
+	byQuery := make(map[string]*models.QueryFeedback)
+	searches := make(map[string]*models.QueryFeedback)
+
+	read := 0
+	err := s.scanEvents("analytics", from, to, func(v []byte) bool {
+		var event models.SearchEvent
+		if err := json.Unmarshal(v, &event); err != nil || event.QueryID == "" {
+			return true // Skip invalid events and those without a query ID
+		}
+		if query != "" && event.Text != query {
+			return true
+		}
+
+		aggregate, ok := byQuery[event.Text]
+		if !ok {
+			aggregate = &models.QueryFeedback{Query: event.Text, ClickedIDs: make(map[string]int)}
+			byQuery[event.Text] = aggregate
+		}
+		aggregate.Searches++
+		searches[event.QueryID] = aggregate
+		read++
+		return read < maxFeedbackEvents
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to read search events")
+	}
+
+	// Feedback follows its search, so it's read from the start of the range
+	// to the end of the recording
+	clicked := make(map[string]bool)
+	read = 0
+	err = s.scanEvents("feedback", from, time.Time{}, func(v []byte) bool {
+		var feedback models.SearchFeedback
+		if err := json.Unmarshal(v, &feedback); err != nil {
+			return true // Skip invalid feedback
+		}
+		aggregate, ok := searches[feedback.QueryID]
+		if !ok {
+			return true
+		}
+
+		if len(feedback.ClickedIDs) > 0 && !clicked[feedback.QueryID] {
+			clicked[feedback.QueryID] = true
+			aggregate.ClickedSearches++
+		}
+		for _, id := range feedback.ClickedIDs {
+			aggregate.Clicks++
+			aggregate.ClickedIDs[id]++
+		}
+		read++
+		return read < maxFeedbackEvents
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to read search feedback")
+	}
+
+	queries := make([]*models.QueryFeedback, 0, len(byQuery))
+	for _, query := range byQuery {
+		query.ClickThroughRate = float64(query.ClickedSearches) / float64(query.Searches)
+		queries = append(queries, query)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].Searches != queries[j].Searches {
+			return queries[i].Searches > queries[j].Searches
+		}
+		return queries[i].Query < queries[j].Query
+	})
+	if len(queries) > limit {
+		queries = queries[:limit]
+	}
+
+	return queries, nil
+}
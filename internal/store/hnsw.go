@@ -0,0 +1,385 @@
+package store
+
+import (
+	"container/heap"
+	"context"
+	"hash/fnv"
+	"math"
+	"slices"
+	"sort"
+
+	"vectraDB/internal/models"
+)
+
+const (
+	defaultIndexEfSearch = 64
+	// hnswM is the number of neighbours a node links to on each layer but
+	// the bottom one, where it links to twice as many
+	hnswM = 16
+	// hnswEfConstruction is the number of nearest nodes an insertion
+	// considers linking to on each layer
+	hnswEfConstruction = 100
+	hnswMaxLevel       = 16
+)
+
+// hnswIndex is a hierarchical navigable small world graph. Every vector is
+// a node linked to its nearest neighbours on each layer up to its own, the
+// upper layers holding exponentially fewer nodes. A search descends
+// greedily from the top layer to the bottom one, where it explores the
+// graph for the efSearch nodes nearest the query, or as many as the results
+// it asks for when that's more. Nodes keep their vectors normalized, so the
+// distance between them is their cosine distance.
+//
+// Links aren't symmetric, so removing a node only unlinks it from its own
+// neighbours, which are relinked among each other. Links left to it by
+// other nodes are skipped by searches and dropped as those nodes are
+// relinked, and the graph is rebuilt as writes accumulate.
+type hnswIndex struct {
+	dim      int
+	efSearch int
+	nodes    map[string]*hnswNode
+	entry    string
+	maxLevel int
+}
+
+type hnswNode struct {
+	values []float32
+	// links holds the IDs of the neighbours of the node on each layer up
+	// to its own
+	links [][]string
+}
+
+// hnswCandidate is a node and its distance to the vector a layer is
+// searched for.
+type hnswCandidate struct {
+	id   string
+	dist float64
+}
+
+// hnswHeap orders candidates nearest first, or farthest first when far is
+// set.
+type hnswHeap struct {
+	items []hnswCandidate
+	far   bool
+}
+
+func (h *hnswHeap) Len() int { return len(h.items) }
+func (h *hnswHeap) Less(i, j int) bool {
+	if h.far {
+		return h.items[i].dist > h.items[j].dist
+	}
+	return h.items[i].dist < h.items[j].dist
+}
+func (h *hnswHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *hnswHeap) Push(x any)    { h.items = append(h.items, x.(hnswCandidate)) }
+func (h *hnswHeap) Pop() any {
+	old := h.items
+	item := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return item
+}
+
+func newHNSWIndex(dim, efSearch int) *hnswIndex {
+	return &hnswIndex{
+		dim:      dim,
+		efSearch: efSearch,
+		nodes:    make(map[string]*hnswNode),
+	}
+}
+
+func (h *hnswIndex) dimension() int { return h.dim }
+func (h *hnswIndex) size() int      { return len(h.nodes) }
+func (h *hnswIndex) name() string   { return IndexHNSW }
+
+// hnswLevel draws the top layer of a node from its ID, so a graph rebuilt
+// from the same vectors is the same.
+func hnswLevel(id string) int {
+	hash := fnv.New64a()
+	hash.Write([]byte(id))
+	// FNV barely mixes the last bytes into the high bits, so IDs differing
+	// only in their suffix would all draw the same level without the
+	// murmur3 finalizer
+	x := hash.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	u := (float64(x>>11) + 1) / (1 << 53)
+	return min(int(-math.Log(u)/math.Log(hnswM)), hnswMaxLevel)
+}
+
+// maxLinks returns the number of neighbours a node links to on a layer.
+func maxLinks(level int) int {
+	if level == 0 {
+		return 2 * hnswM
+	}
+	return hnswM
+}
+
+func unit32(values []float64) []float32 {
+	v := unit(values)
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
+	}
+	return out
+}
+
+func cosineDistance(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return 1 - dot
+}
+
+func (h *hnswIndex) add(id string, values []float64) {
+	h.remove(id)
+	if len(values) != h.dim {
+		return
+	}
+	h.insert(id, unit32(values))
+}
+
+// insert links a node of normalized values into the graph.
+func (h *hnswIndex) insert(id string, values []float32) {
+	level := hnswLevel(id)
+	node := &hnswNode{values: values, links: make([][]string, level+1)}
+	if h.entry == "" {
+		h.nodes[id] = node
+		h.entry, h.maxLevel = id, level
+		return
+	}
+
+	entry := []hnswCandidate{{id: h.entry, dist: cosineDistance(values, h.nodes[h.entry].values)}}
+	for l := h.maxLevel; l > level; l-- {
+		entry = h.searchLayer(values, entry, 1, l)
+	}
+	h.nodes[id] = node
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		found := h.searchLayer(values, entry, hnswEfConstruction, l)
+		// Links other nodes kept to a removed node of the same ID can
+		// lead the search back to it
+		found = slices.DeleteFunc(found, func(c hnswCandidate) bool { return c.id == id })
+		node.links[l] = h.selectNeighbours(found, hnswM)
+		for _, neighbour := range node.links[l] {
+			h.link(neighbour, id, l)
+		}
+		if len(found) > 0 {
+			entry = found
+		}
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = id, level
+	}
+}
+
+// link adds a link from one node to another on a layer, reselecting the
+// neighbours of the node once it has too many.
+func (h *hnswIndex) link(from, to string, level int) {
+	node := h.nodes[from]
+	node.links[level] = append(node.links[level], to)
+	if len(node.links[level]) > maxLinks(level) {
+		h.relink(from, node.links[level], level)
+	}
+}
+
+// relink links a node on a layer to the best neighbours among the
+// candidates, skipping the removed ones.
+func (h *hnswIndex) relink(id string, candidates []string, level int) {
+	node := h.nodes[id]
+	scored := make([]hnswCandidate, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		other, ok := h.nodes[candidate]
+		if !ok || candidate == id || seen[candidate] || len(other.links) <= level {
+			continue
+		}
+		seen[candidate] = true
+		scored = append(scored, hnswCandidate{id: candidate, dist: cosineDistance(node.values, other.values)})
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		return scored[i].dist < scored[j].dist
+	})
+	node.links[level] = h.selectNeighbours(scored, maxLinks(level))
+}
+
+// selectNeighbours picks up to m neighbours among candidates sorted nearest
+// first, preferring those nearer the node than to any neighbour already
+// picked so links reach out in every direction, and filling up with the
+// nearest others.
+func (h *hnswIndex) selectNeighbours(candidates []hnswCandidate, m int) []string {
+	selected := make([]string, 0, min(m, len(candidates)))
+	var pruned []string
+	for _, candidate := range candidates {
+		if len(selected) == m {
+			break
+		}
+		values := h.nodes[candidate.id].values
+		keep := true
+		for _, id := range selected {
+			if cosineDistance(values, h.nodes[id].values) < candidate.dist {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, candidate.id)
+		} else {
+			pruned = append(pruned, candidate.id)
+		}
+	}
+	for _, id := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// searchLayer returns the ef nodes nearest the values found on a layer from
+// the entry candidates, nearest first.
+func (h *hnswIndex) searchLayer(values []float32, entry []hnswCandidate, ef, level int) []hnswCandidate {
+	visited := make(map[string]bool, ef*4)
+	candidates := &hnswHeap{}
+	nearest := &hnswHeap{far: true}
+	for _, c := range entry {
+		visited[c.id] = true
+		heap.Push(candidates, c)
+		heap.Push(nearest, c)
+	}
+	for nearest.Len() > ef {
+		heap.Pop(nearest)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if nearest.Len() >= ef && c.dist > nearest.items[0].dist {
+			break
+		}
+		node, ok := h.nodes[c.id]
+		if !ok || len(node.links) <= level {
+			continue
+		}
+		for _, id := range node.links[level] {
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			neighbour, ok := h.nodes[id]
+			if !ok || len(neighbour.links) <= level {
+				continue
+			}
+			dist := cosineDistance(values, neighbour.values)
+			if nearest.Len() < ef || dist < nearest.items[0].dist {
+				heap.Push(candidates, hnswCandidate{id: id, dist: dist})
+				heap.Push(nearest, hnswCandidate{id: id, dist: dist})
+				if nearest.Len() > ef {
+					heap.Pop(nearest)
+				}
+			}
+		}
+	}
+
+	found := make([]hnswCandidate, nearest.Len())
+	for i := len(found) - 1; i >= 0; i-- {
+		found[i] = heap.Pop(nearest).(hnswCandidate)
+	}
+	return found
+}
+
+func (h *hnswIndex) remove(id string) {
+	node, ok := h.nodes[id]
+	if !ok {
+		return
+	}
+	delete(h.nodes, id)
+
+	// Relink the neighbours of the node among each other
+	for level, links := range node.links {
+		for _, neighbour := range links {
+			other, ok := h.nodes[neighbour]
+			if !ok || len(other.links) <= level {
+				continue
+			}
+			candidates := make([]string, 0, len(other.links[level])+len(links))
+			candidates = append(candidates, other.links[level]...)
+			candidates = append(candidates, links...)
+			h.relink(neighbour, candidates, level)
+		}
+	}
+
+	if h.entry != id {
+		return
+	}
+	h.entry, h.maxLevel = "", 0
+	for other, node := range h.nodes {
+		if level := len(node.links) - 1; h.entry == "" || level > h.maxLevel || (level == h.maxLevel && other < h.entry) {
+			h.entry, h.maxLevel = other, level
+		}
+	}
+}
+
+// search returns the IDs of the ef nodes nearest the query.
+func (h *hnswIndex) search(query []float64, ef int) map[string]bool {
+	if h.entry == "" {
+		return nil
+	}
+	values := unit32(query)
+	entry := []hnswCandidate{{id: h.entry, dist: cosineDistance(values, h.nodes[h.entry].values)}}
+	for l := h.maxLevel; l > 0; l-- {
+		entry = h.searchLayer(values, entry, 1, l)
+	}
+	found := make(map[string]bool, ef)
+	for _, c := range h.searchLayer(values, entry, ef, 0) {
+		found[c.id] = true
+	}
+	return found
+}
+
+// restrict keeps the candidates among the nodes nearest the query.
+func (h *hnswIndex) restrict(candidates []*models.Vector, query []float64, k int) []*models.Vector {
+	found := h.search(query, max(h.efSearch, k))
+	restricted := make([]*models.Vector, 0, len(found))
+	for _, vector := range candidates {
+		if found[vector.ID] {
+			restricted = append(restricted, vector)
+		}
+	}
+	return restricted
+}
+
+// buildGraph builds an HNSW index over the vectors of ids of the given
+// dimension, nil when there are none. The vectors are inserted in ID order
+// so the graph is reproducible.
+func (s *boltStore) buildGraph(ctx context.Context, ids []string, dim int) (*hnswIndex, error) {
+	if dim == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+	sort.Strings(ids)
+	values := make(map[string][]float32, len(ids))
+	err := s.eachValues(ctx, ids, func(id string, v []float64) bool {
+		if len(v) == dim {
+			values[id] = unit32(v)
+		}
+		return true
+	})
+	if err != nil || len(values) == 0 {
+		return nil, err
+	}
+
+	hnsw := newHNSWIndex(dim, s.config.IndexEfSearch)
+	for i, id := range ids {
+		if i%valuesBatchSize == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if v, ok := values[id]; ok {
+			hnsw.insert(id, v)
+		}
+	}
+	return hnsw, nil
+}
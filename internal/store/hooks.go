@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// Built-in insert hooks, enabled by name through Config.BuiltinHooks
+const (
+	HookContentHash = "content_hash"
+	HookTokenCount  = "token_count"
+)
+
+// Metadata keys set by the built-in insert hooks
+const (
+	ContentHashKey = "content_hash"
+	TokenCountKey  = "token_count"
+)
+
+// InsertHook runs on every inserted or updated vector before it is validated
+// and persisted and may modify it, typically to derive metadata. An error
+// aborts the write.
+type InsertHook func(ctx context.Context, vector *models.Vector) error
+
+// ContentHashHook sets the content_hash metadata key to the SHA-256 of the
+// vector's text and embedding, so duplicate content can be found with a
+// filter.
+func ContentHashHook() InsertHook {
+	return func(ctx context.Context, vector *models.Vector) error {
+		h := sha256.New()
+		h.Write([]byte(vector.Text))
+		var buf [8]byte
+		for _, v := range vector.Vector {
+			binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+			h.Write(buf[:])
+		}
+		setMetadata(vector, ContentHashKey, hex.EncodeToString(h.Sum(nil)))
+		return nil
+	}
+}
+
+// TokenCountHook sets the token_count metadata key to the number of tokens
+// in the vector's text.
+func TokenCountHook(tokenizer Tokenizer) InsertHook {
+	return func(ctx context.Context, vector *models.Vector) error {
+		setMetadata(vector, TokenCountKey, strconv.Itoa(len(tokenizer.Tokenize(vector.Text))))
+		return nil
+	}
+}
+
+func setMetadata(vector *models.Vector, key, value string) {
+	if vector.Metadata == nil {
+		vector.Metadata = make(models.Metadata)
+	}
+	vector.Metadata[key] = value
+}
+
+// builtinHooks returns the built-in hooks with the given names.
+func builtinHooks(names []string, tokenizer Tokenizer) ([]InsertHook, error) {
+	hooks := make([]InsertHook, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case HookContentHash:
+			hooks = append(hooks, ContentHashHook())
+		case HookTokenCount:
+			hooks = append(hooks, TokenCountHook(tokenizer))
+		default:
+			return nil, errors.New(http.StatusInternalServerError, "invalid insert hook").WithDetails(name)
+		}
+	}
+	return hooks, nil
+}
+
+// runInsertHooks runs the configured hooks on vector in order.
+func (s *boltStore) runInsertHooks(ctx context.Context, vector *models.Vector) error {
+	for _, hook := range s.insertHooks {
+		if err := hook(ctx, vector); err != nil {
+			if appErr, ok := err.(*errors.AppError); ok {
+				return appErr
+			}
+			return errors.Wrap(err, http.StatusUnprocessableEntity, "insert hook failed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+const (
+	IndexFlat = "flat"
+	IndexAuto = "auto"
+	IndexHNSW = "hnsw"
+	IndexIVF  = "ivf"
+)
+
+// ErrFlatIndex is returned when building the index of a store whose
+// searches are configured to stay flat.
+var ErrFlatIndex = errors.New(http.StatusConflict, "vector search index is flat")
+
+const (
+	defaultIndexThreshold = 10000
+	// indexRetrainRatio is the share of the indexed vectors that must be
+	// written before the index is rebuilt
+	indexRetrainRatio = 0.5
+)
+
+// annIndex is the approximate nearest neighbour index an auto-indexed store
+// builds, Config.IndexAlgorithm selecting an hnswIndex or an ivfIndex.
+// Searches restrict the candidates they score on their snapshots to those
+// it finds near the query, without changing how they are scored. The
+// caller must hold s.mu, for writing to add and remove.
+type annIndex interface {
+	add(id string, values []float64)
+	remove(id string)
+	// restrict keeps the candidates the index finds near the query, k
+	// being the number of results the search asks for
+	restrict(candidates []*models.Vector, query []float64, k int) []*models.Vector
+	dimension() int
+	size() int
+	name() string
+}
+
+// unit returns a copy of values scaled to unit length.
+func unit(values []float64) []float64 {
+	v := make([]float64, len(values))
+	copy(v, values)
+	normalize(v)
+	return v
+}
+
+// indexName returns the search path vector searches take.
+func (s *boltStore) indexName() string {
+	if s.ann != nil {
+		return s.ann.name()
+	}
+	return IndexFlat
+}
+
+// maybeBuildIndex builds the index in the background once an auto-indexed
+// store holds enough vectors, switching searches from scoring every vector
+// to scoring those the index finds near the query, and rebuilds it once as
+// many vectors as a fraction indexRetrainRatio of those indexed have been
+// written since, as their distribution drifts from the one it was built
+// on. Searches use the index in place until its replacement is built. The
+// caller must hold s.mu.
+func (s *boltStore) maybeBuildIndex(ctx context.Context) {
+	if !s.indexDue() || !s.indexBuilding.CompareAndSwap(false, true) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	started := s.goBackground(func() {
+		defer s.indexBuilding.Store(false)
+		if _, err := s.BuildIndex(ctx); err != nil {
+			s.log(ctx).WithError(err).Error("Failed to build vector search index")
+		}
+	})
+	if !started {
+		s.indexBuilding.Store(false)
+	}
+}
+
+// indexDue reports whether the index should be built or rebuilt. The
+// caller must hold s.mu.
+func (s *boltStore) indexDue() bool {
+	if s.config.IndexType != IndexAuto || len(s.vectors) < s.config.IndexThreshold {
+		return false
+	}
+	return s.ann == nil || float64(s.writes.Load()-s.annWrites) > indexRetrainRatio*float64(s.ann.size())
+}
+
+// BuildIndex builds the index of the configured algorithm over the vectors
+// of the common dimension, replacing the one searches use. The vectors are
+// read in batches under the read lock and the index built with no lock
+// held, so searches and writes go on meanwhile. Vectors written during the
+// build are recorded in s.annPending and indexed once it's installed.
+func (s *boltStore) BuildIndex(ctx context.Context) (*models.IndexBuildResult, error) {
+	if s.config.IndexType != IndexAuto {
+		return nil, ErrFlatIndex
+	}
+	s.indexBuildMu.Lock()
+	defer s.indexBuildMu.Unlock()
+	start := time.Now()
+
+	s.mu.Lock()
+	dim, writes, rebuild := s.commonDimension(), s.writes.Load(), s.ann != nil
+	ids := make([]string, 0, len(s.vectors))
+	for id := range s.vectors {
+		ids = append(ids, id)
+	}
+	s.annPending = make(map[string]bool)
+	s.mu.Unlock()
+
+	index, err := s.buildANN(ctx, ids, dim)
+	if err != nil || index == nil {
+		s.mu.Lock()
+		s.annPending = nil
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return &models.IndexBuildResult{Index: s.config.IndexAlgorithm, Duration: time.Since(start).String()}, nil
+	}
+
+	s.mu.Lock()
+	for id := range s.annPending {
+		if vector, ok := s.vectors[id]; ok {
+			index.add(id, s.values(vector))
+		} else {
+			index.remove(id)
+		}
+	}
+	s.ann, s.annWrites, s.annPending = index, writes, nil
+	result := &models.IndexBuildResult{
+		Index:     index.name(),
+		Vectors:   index.size(),
+		Dimension: dim,
+	}
+	fields := logrus.Fields{}
+	switch index := index.(type) {
+	case *ivfIndex:
+		result.Lists = len(index.centroids)
+		fields["lists"], fields["probes"] = result.Lists, index.probes
+	case *hnswIndex:
+		result.Layers = index.maxLevel + 1
+		fields["layers"], fields["ef_search"] = result.Layers, index.efSearch
+	}
+	s.mu.Unlock()
+	result.Duration = time.Since(start).String()
+
+	name := strings.ToUpper(result.Index)
+	message := "Switched vector search from flat to " + name + " index"
+	if rebuild {
+		message = "Rebuilt " + name + " index"
+	}
+	fields["vectors"], fields["dimension"], fields["duration"] = result.Vectors, dim, result.Duration
+	s.log(ctx).WithFields(fields).Info(message)
+	return result, nil
+}
+
+// buildANN builds an index of the configured algorithm over the vectors of
+// ids of the given dimension, nil when there are none.
+func (s *boltStore) buildANN(ctx context.Context, ids []string, dim int) (annIndex, error) {
+	if s.config.IndexAlgorithm == IndexIVF {
+		ivf, err := s.trainIndex(ctx, ids, dim)
+		if ivf == nil {
+			return nil, err
+		}
+		return ivf, nil
+	}
+	hnsw, err := s.buildGraph(ctx, ids, dim)
+	if hnsw == nil {
+		return nil, err
+	}
+	return hnsw, nil
+}
@@ -2,8 +2,10 @@ package store
 
 import (
 	"context"
+	"os"
 	"time"
 
+	"go.etcd.io/bbolt"
 	"vectraDB/internal/models"
 )
 
@@ -11,17 +13,56 @@ type VectorStore interface {
 	// Vector operations
 	InsertVector(ctx context.Context, vector *models.Vector) error
 	GetVector(ctx context.Context, id string) (*models.Vector, error)
+	VectorExists(ctx context.Context, id string) (bool, error)
 	UpdateVector(ctx context.Context, id string, vector *models.Vector) error
+	PatchVector(ctx context.Context, id string, patch *models.PatchVectorRequest) (*models.Vector, error)
+	UpdateVectors(ctx context.Context, vectors []*models.Vector, atomic bool) ([]error, error)
 	DeleteVector(ctx context.Context, id string) error
 	ListVectors(ctx context.Context, limit, offset int) ([]*models.Vector, error)
-	
+	ValidateVector(ctx context.Context, vector *models.Vector) error
+	ListChanges(ctx context.Context, since time.Time, cursor string, limit int) (*models.ChangesResponse, error)
+	PopularVectors(ctx context.Context, limit int) ([]models.PopularVector, error)
+
 	// Search operations
 	SearchVectors(ctx context.Context, req *models.SearchRequest) (*models.SearchResponse, error)
 	HybridSearch(ctx context.Context, req *models.HybridSearchRequest) (*models.HybridSearchResponse, error)
-	
+	UnifiedSearch(ctx context.Context, req *models.UnifiedSearchRequest) (*models.UnifiedSearchResponse, error)
+	BlendedSearch(ctx context.Context, req *models.BlendedSearchRequest) (*models.BlendedSearchResponse, error)
+	AdhocSearch(ctx context.Context, req *models.AdhocSearchRequest) (*models.SearchResponse, error)
+	Compare(ctx context.Context, req *models.CompareRequest) (*models.CompareResponse, error)
+	ProjectVectors(ctx context.Context, req *models.ProjectRequest) (*models.ProjectResponse, error)
+
+	// Collection aliases
+	SetAlias(ctx context.Context, alias, collection string) (*models.Alias, error)
+	DeleteAlias(ctx context.Context, alias string) (*models.Alias, error)
+	ListAliases(ctx context.Context) ([]models.Alias, error)
+
+	// Collection configuration
+	SetCollectionConfig(ctx context.Context, config *models.CollectionConfig) (*models.CollectionConfig, error)
+	DeleteCollectionConfig(ctx context.Context, collection string) (*models.CollectionConfig, error)
+	ListCollectionConfigs(ctx context.Context) ([]models.CollectionConfig, error)
+
+	// Search analytics
+	RecordSearch(ctx context.Context, event *models.SearchEvent) error
+	ListSearchEvents(ctx context.Context, from, to time.Time, limit int) ([]*models.SearchEvent, error)
+	RecordFeedback(ctx context.Context, feedback *models.SearchFeedback) error
+	QueryFeedback(ctx context.Context, from, to time.Time, query string, limit int) ([]*models.QueryFeedback, error)
+
+	// Maintenance operations
+	Compact(ctx context.Context, progress func(float64)) (int, error)
+	Defragment(ctx context.Context) (*models.DefragResult, error)
+	FlushSearchCache(ctx context.Context) (int, error)
+	FitClusters(ctx context.Context) (*models.ClusterFitResult, error)
+	BuildIndex(ctx context.Context) (*models.IndexBuildResult, error)
+	Stats(ctx context.Context) (*models.StoreStats, error)
+	Quarantine(ctx context.Context) ([]models.QuarantinedRecord, error)
+	IndexPostings(ctx context.Context, key, value string) ([]string, error)
+	VectorPostings(ctx context.Context, id string) ([]models.Posting, error)
+	ExportIndex(ctx context.Context, cursor string, limit int, withIDs bool) (*models.IndexExport, error)
+
 	// Health check
 	Health(ctx context.Context) error
-	
+
 	// Close the store
 	Close() error
 }
@@ -30,14 +71,16 @@ type DocumentStore interface {
 	// Document operations
 	InsertDocument(ctx context.Context, doc *models.Document) error
 	GetDocument(ctx context.Context, id string) (*models.Document, error)
-	UpdateDocument(ctx context.Context, id string, doc *models.Document) error
+	DocumentExists(ctx context.Context, id string) (bool, error)
+	UpdateDocument(ctx context.Context, id string, req *models.UpdateDocumentRequest) (*models.Document, error)
 	DeleteDocument(ctx context.Context, id string) error
 	ListDocuments(ctx context.Context, limit, offset int) ([]*models.Document, error)
 	ListDocumentsByTag(ctx context.Context, tag string, limit, offset int) ([]*models.Document, error)
-	
+	BulkTagDocuments(ctx context.Context, req *models.BulkTagRequest) (int, error)
+
 	// Health check
 	Health(ctx context.Context) error
-	
+
 	// Close the store
 	Close() error
 }
@@ -48,8 +91,235 @@ type Store interface {
 }
 
 type Config struct {
-	DBPath    string
-	Timeout   time.Duration
+	DBPath  string
+	Timeout time.Duration
+	// Deprecated: MaxConns is ignored. In-flight API requests are bounded
+	// by the server's MAX_CONNS setting instead.
 	MaxConns  int
 	BatchSize int
+	// OpenFile opens the database file, os.OpenFile when nil
+	OpenFile func(name string, flag int, perm os.FileMode) (*os.File, error)
+	// DB is an already open database to use instead of opening DBPath, for
+	// applications sharing one with the store. It stays owned by the
+	// caller: Close leaves it open and it's never defragmented
+	DB *bbolt.DB
+	// CursorSecret signs pagination cursors, which stay valid for
+	// CursorTTL, a day by default. A random secret is generated when it's
+	// empty, so cursors don't survive a restart
+	CursorSecret string
+	CursorTTL    time.Duration
+
+	// SoftDelete keeps deleted vectors as tombstones until they are compacted
+	SoftDelete bool
+	// CompactionThreshold is the tombstone ratio above which compaction runs
+	// automatically in the background, 0 disables auto-compaction
+	CompactionThreshold float64
+	// CompactionBatchSize is the number of tombstones a compaction removes
+	// per transaction, 1000 by default. Cancelling a compaction takes effect
+	// between batches
+	CompactionBatchSize int
+
+	// Precision of the in-memory embeddings and similarity computation,
+	// PrecisionFloat64 (default) or PrecisionFloat32
+	Precision string
+
+	// SparseThreshold is the ratio of zero dimensions above which a vector
+	// is kept in memory as a sparse vector, 0 keeps every vector dense
+	SparseThreshold float64
+
+	// StrictLoad fails startup on the first corrupted vector record instead
+	// of quarantining it
+	StrictLoad bool
+	// ManualMigration fails opening a database with records written by an
+	// older version instead of upgrading them to the current schema on
+	// startup
+	ManualMigration bool
+	// ReadThrough looks up vectors missing from memory on disk before
+	// reporting them not found, caching those found there, so a write
+	// missed by the in-memory cache heals on the first read
+	ReadThrough bool
+
+	// DocumentRetention is the default lifetime of documents inserted
+	// without an expiry, 0 keeps them indefinitely
+	DocumentRetention time.Duration
+	// DocumentSweepInterval is how often expired documents are purged in
+	// the background, 0 disables the janitor
+	DocumentSweepInterval time.Duration
+
+	// Tokenizer is used for keyword scoring, defaults to WhitespaceTokenizer
+	Tokenizer Tokenizer
+	// VectorPooling is how searches that don't say otherwise combine the
+	// scores of a record's vector and named vectors: "" or "none" scores
+	// the vector alone, "max" and "mean" pool the scores
+	VectorPooling string
+	// OnDimensionMismatch is the policy of searches that don't set their
+	// own for queries of another dimension than most stored vectors,
+	// models.DimensionMismatchReject (the default), PadZero or Truncate
+	OnDimensionMismatch string
+	// RequireWeights rejects hybrid, blended and unified searches with both
+	// a query vector and text that set no weights, instead of weighting
+	// them equally
+	RequireWeights bool
+	// MaxQueryTerms bounds the distinct terms of a keyword query, defaults
+	// to 128. OnLongQuery is what happens to longer queries,
+	// LongQueryTruncate (the default) to keep their highest IDF terms or
+	// LongQueryReject
+	MaxQueryTerms int
+	OnLongQuery   string
+	// FuzzyMinSimilarity is the lowest edit similarity a fuzzy match of a
+	// blended search counts with, the bound of searches setting none and
+	// the floor of those setting a lower one; 0 counts every token.
+	// FuzzyMaxComparisons bounds the distinct tokens a fuzzy query is
+	// compared to, defaults to 10000
+	FuzzyMinSimilarity  float64
+	FuzzyMaxComparisons int
+	// NormalizeMetadata lowercases and trims metadata keys and values as
+	// vectors are written, and filters the same way, so filters match
+	// regardless of case and surrounding whitespace. PreserveOriginalMetadata
+	// keeps the metadata as written in the vector's OriginalMetadata
+	NormalizeMetadata        bool
+	PreserveOriginalMetadata bool
+	// KeywordMaxPostings bounds the BM25 postings kept for hybrid search to
+	// this many term and vector pairs. Past it they are dropped and each
+	// hybrid search tokenizes the vectors it scores
+	KeywordMaxPostings int
+	// KeywordCountEmpty counts vectors whose text has no tokens towards the
+	// BM25 corpus, as documents of length 0. By default they are left out
+	// of it, so they don't shrink the average length real text is
+	// normalized by, and only score through the vector component
+	KeywordCountEmpty bool
+
+	// BuiltinHooks names the built-in insert hooks to run, HookContentHash
+	// and HookTokenCount. They run before InsertHooks
+	BuiltinHooks []string
+	// InsertHooks run on every inserted or updated vector before it is
+	// persisted
+	InsertHooks []InsertHook
+
+	// ValidateIDs rejects new vector IDs that don't match IDPattern, which
+	// defaults to alphanumerics, dashes, underscores and dots
+	ValidateIDs bool
+	IDPattern   string
+
+	// Metadata limits, zero values fall back to the defaults
+	MaxMetadataEntries     int
+	MaxMetadataKeyLength   int
+	MaxMetadataValueLength int
+
+	// SkipZeroVectors leaves zero-magnitude vectors out of search results
+	// instead of scoring them 0
+	SkipZeroVectors bool
+
+	// MaxCandidates bounds the number of vectors scored per search. Above
+	// it a random sample is scored and results are flagged approximate,
+	// 0 scores every candidate
+	MaxCandidates int
+	// MaxRadiusResults caps the results of a radius search, defaults to
+	// 1000
+	MaxRadiusResults int
+	// Calibration sets a confidence on vector search results,
+	// CalibrationSigmoid or CalibrationNone. The sigmoid maps the score
+	// CalibrationMidpoint to 0.5 with slope CalibrationSlope, defaulting
+	// to 10
+	Calibration         string
+	CalibrationSlope    float64
+	CalibrationMidpoint float64
+	// ClusterCount is the number of topic clusters searches report the
+	// cluster of their query from, by default the square root of the
+	// number of vectors. ClusterLabelKey is the metadata key whose most
+	// common value in a cluster labels it
+	ClusterCount    int
+	ClusterLabelKey string
+	// MaxAdhocVectors bounds the vectors of an ad-hoc search, defaults to
+	// 10000
+	MaxAdhocVectors int
+
+	// CollectionKey is the metadata key whose value is the collection of a
+	// vector, defaults to "collection"
+	CollectionKey string
+
+	// AccessStats counts how often each vector is retrieved, flushing the
+	// counts to disk every AccessFlushInterval, defaulting to a minute
+	AccessStats         bool
+	AccessFlushInterval time.Duration
+
+	// Search events and feedback are buffered and written to disk every
+	// EventFlushInterval, defaulting to a second, or as soon as a batch
+	// fills. Those older than EventRetention are pruned as new ones are
+	// written, 0 keeps them indefinitely
+	EventFlushInterval time.Duration
+	EventRetention     time.Duration
+
+	// DefragInterval is how often the database file is checked for free
+	// pages and defragmented, 0 disables it. DefragWindow restricts it to
+	// a daily local time window written "HH:MM-HH:MM", "" for any time
+	DefragInterval time.Duration
+	DefragWindow   string
+
+	// DefragMinFreeRatio is the share of the database file's pages that
+	// must be free for a scheduled defragmentation to run, defaulting to
+	// 0.2
+	DefragMinFreeRatio float64
+	// MaxSearchGroups bounds the groups returned by a grouped search,
+	// defaults to 100
+	MaxSearchGroups int
+	// NegativeWeight scales the penalty for similarity to the negative
+	// examples of a search that doesn't set its own, defaults to 0.5
+	NegativeWeight float64
+	// SnapshotMaxAge bounds how long a vector search scores its snapshot of
+	// the store, keeping deleted vectors in memory. Past it the search
+	// returns the best of the candidates scored so far, flagged
+	// approximate. 0 is unbounded
+	SnapshotMaxAge time.Duration
+	// SearchCacheSize is the number of vector search responses cached, 0
+	// disables the cache. Entries are dropped on any vector write or after
+	// SearchCacheTTL, which defaults to a minute, and the least recently
+	// used when the cache is full
+	SearchCacheSize int
+	SearchCacheTTL  time.Duration
+	// SearchCacheWarm is the number of the most frequent cached searches
+	// persisted on close and run again in the background on startup to
+	// warm the cache, 0 disables warming
+	SearchCacheWarm int
+
+	// Quantization compresses in-memory embeddings, "" (none) or
+	// QuantizationPQ for product quantization
+	Quantization string
+	// PQSubspaces is the number of subspaces, and bytes per vector code
+	PQSubspaces int
+	// PQCentroids is the number of centroids per subspace, at most 256
+	PQCentroids int
+	// PQTrainSize is the number of vectors needed before the codebooks are
+	// trained; vectors stay in full precision until then
+	PQTrainSize int
+	// PQRescore is the number of best approximate candidates rescored with
+	// the full-precision vectors read from disk
+	PQRescore int
+	// PQCacheSize is the number of full-precision embeddings read from disk
+	// kept in an LRU cache, 0 reads them from disk every time
+	PQCacheSize int
+
+	// IndexType selects how vector searches find candidates, IndexFlat
+	// scores every vector and IndexAuto switches to an approximate index
+	// once IndexThreshold vectors are stored, an HNSW graph or, with
+	// IndexAlgorithm set to IndexIVF, an IVF index
+	IndexType      string
+	IndexThreshold int
+	IndexAlgorithm string
+	// IndexEfSearch is the number of nodes nearest the query an HNSW search
+	// finds, at least top_k
+	IndexEfSearch int
+	// IndexProbes is the number of IVF clusters nearest the query a search
+	// scores
+	IndexProbes int
+	// IndexFallback reruns an index search as an exact search when it
+	// finds fewer candidates than asked for, among those matching
+	// the filter, or, with IndexFallbackMinScore set, its results score
+	// below it
+	IndexFallback         bool
+	IndexFallbackMinScore float64
+
+	// LogRequestIDs adds the ID of the HTTP request a store operation runs
+	// for, taken from its context, to the logs it emits
+	LogRequestIDs bool
 }
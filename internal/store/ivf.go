@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"vectraDB/internal/models"
+)
+
+const (
+	defaultIndexProbes = 8
+	// maxIVFLists bounds the number of clusters, which is the square root of
+	// the number of vectors when the index is built
+	maxIVFLists = 1024
+	// ivfTrainPerList is the number of sampled vectors per cluster the
+	// centroids are trained on
+	ivfTrainPerList     = 32
+	ivfKMeansIterations = 10
+)
+
+// ivfIndex is an inverted file index. Vectors are clustered around
+// centroids and a search only scores the vectors of the clusters nearest the
+// query. Vectors and centroids are normalized, so the nearest centroid by
+// Euclidean distance is the most similar by cosine. Searches probe the
+// probes clusters nearest the query, however many results they ask for.
+type ivfIndex struct {
+	dim         int
+	probes      int
+	centroids   [][]float32
+	assignments map[string]int
+}
+
+func (ivf *ivfIndex) add(id string, values []float64) {
+	if len(values) != ivf.dim {
+		delete(ivf.assignments, id)
+		return
+	}
+	ivf.assignments[id] = nearestCentroid(ivf.centroids, unit(values))
+}
+
+func (ivf *ivfIndex) remove(id string) {
+	delete(ivf.assignments, id)
+}
+
+func (ivf *ivfIndex) dimension() int { return ivf.dim }
+func (ivf *ivfIndex) size() int      { return len(ivf.assignments) }
+func (ivf *ivfIndex) name() string   { return IndexIVF }
+
+// probe returns the n clusters nearest the query.
+func (ivf *ivfIndex) probe(query []float64, n int) map[int]bool {
+	query = unit(query)
+	dists := make([]float64, len(ivf.centroids))
+	order := make([]int, len(ivf.centroids))
+	for c, centroid := range ivf.centroids {
+		for d, v := range query {
+			diff := v - float64(centroid[d])
+			dists[c] += diff * diff
+		}
+		order[c] = c
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return dists[order[i]] < dists[order[j]]
+	})
+
+	if n > len(order) {
+		n = len(order)
+	}
+	probed := make(map[int]bool, n)
+	for _, c := range order[:n] {
+		probed[c] = true
+	}
+	return probed
+}
+
+// restrict keeps the candidates assigned to the clusters nearest the query.
+func (ivf *ivfIndex) restrict(candidates []*models.Vector, query []float64, k int) []*models.Vector {
+	probed := ivf.probe(query, ivf.probes)
+	restricted := make([]*models.Vector, 0, len(candidates))
+	for _, vector := range candidates {
+		if c, ok := ivf.assignments[vector.ID]; ok && probed[c] {
+			restricted = append(restricted, vector)
+		}
+	}
+	return restricted
+}
+
+// trainIndex trains an IVF index on a sample of the vectors of ids of the
+// given dimension and assigns them to its clusters, nil when there are
+// none.
+func (s *boltStore) trainIndex(ctx context.Context, ids []string, dim int) (*ivfIndex, error) {
+	if dim == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+	lists := min(max(int(math.Sqrt(float64(len(ids)))), 1), maxIVFLists)
+
+	// Sort before sampling so the centroids are reproducible
+	sort.Strings(ids)
+	samples := make([][]float64, 0, lists*ivfTrainPerList)
+	err := s.eachValues(ctx, sampleOrder(ids), func(id string, values []float64) bool {
+		if len(values) == dim {
+			samples = append(samples, unit(values))
+		}
+		return len(samples) < cap(samples)
+	})
+	if err != nil || len(samples) == 0 {
+		return nil, err
+	}
+
+	ivf := &ivfIndex{
+		dim:         dim,
+		probes:      s.config.IndexProbes,
+		centroids:   trainCentroids(samples, min(lists, len(samples))),
+		assignments: make(map[string]int, len(ids)),
+	}
+	err = s.eachValues(ctx, ids, func(id string, values []float64) bool {
+		ivf.add(id, values)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ivf, nil
+}
@@ -0,0 +1,310 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// defaultKeywordMaxPostings bounds the BM25 statistics kept for hybrid
+// search, about a gigabyte of postings
+const defaultKeywordMaxPostings = 10000000
+
+// defaultMaxQueryTerms bounds the distinct terms of a keyword query
+const defaultMaxQueryTerms = 128
+
+// defaultFuzzyMaxComparisons bounds the distinct tokens a fuzzy query is
+// compared to
+const defaultFuzzyMaxComparisons = 10000
+
+// Policies for keyword queries with more distinct terms than
+// Config.MaxQueryTerms
+const (
+	LongQueryTruncate = "truncate"
+	LongQueryReject   = "reject"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.5
+	bm25B  = 0.75
+)
+
+// keywordIndex holds the corpus statistics BM25 scores vector text with,
+// maintained as vectors are written so a hybrid search only has to tokenize
+// its query. Vectors whose text has no tokens are left out of the corpus
+// unless countEmpty is set, when they count with length 0.
+//
+// The postings are dropped once they outgrow Config.KeywordMaxPostings,
+// leaving the document frequencies and lengths, which only grow with the
+// vocabulary and the number of vectors. Scores are then computed by
+// tokenizing the vectors searched, against the same corpus-wide statistics.
+type keywordIndex struct {
+	// postings maps each term to the frequency of the term in each vector
+	// containing it, by vector ID, nil once dropped
+	postings map[string]map[string]int
+	// docFreqs is the number of vectors containing each term
+	docFreqs map[string]int
+	lengths  map[string]int
+	totalLen int
+	// size is the number of postings, kept up to date while they're dropped
+	size int
+
+	countEmpty bool
+}
+
+func newKeywordIndex(countEmpty bool) *keywordIndex {
+	return &keywordIndex{
+		postings:   make(map[string]map[string]int),
+		docFreqs:   make(map[string]int),
+		lengths:    make(map[string]int),
+		countEmpty: countEmpty,
+	}
+}
+
+// termFrequencies counts the occurrences of each token.
+func termFrequencies(tokens []string) map[string]int {
+	freqs := make(map[string]int)
+	for _, token := range tokens {
+		freqs[token]++
+	}
+	return freqs
+}
+
+func (k *keywordIndex) add(id string, tokens []string) {
+	if len(tokens) == 0 && !k.countEmpty {
+		return
+	}
+	for term, tf := range termFrequencies(tokens) {
+		k.docFreqs[term]++
+		k.size++
+		if k.postings == nil {
+			continue
+		}
+		docs, ok := k.postings[term]
+		if !ok {
+			docs = make(map[string]int)
+			k.postings[term] = docs
+		}
+		docs[id] = tf
+	}
+	k.lengths[id] = len(tokens)
+	k.totalLen += len(tokens)
+}
+
+func (k *keywordIndex) remove(id string, tokens []string) {
+	if _, ok := k.lengths[id]; !ok {
+		return
+	}
+	for term := range termFrequencies(tokens) {
+		if k.docFreqs[term]--; k.docFreqs[term] <= 0 {
+			delete(k.docFreqs, term)
+		}
+		k.size--
+		if docs, ok := k.postings[term]; ok {
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(k.postings, term)
+			}
+		}
+	}
+	k.totalLen -= k.lengths[id]
+	delete(k.lengths, id)
+}
+
+// avgDocLen returns the number of vectors in the corpus and their average
+// length in tokens.
+func (k *keywordIndex) avgDocLen() (float64, float64) {
+	n := float64(len(k.lengths))
+	if n == 0 {
+		return 0, 0
+	}
+	return n, float64(k.totalLen) / n
+}
+
+// scores returns the BM25 score of every vector containing a query term,
+// by vector ID. The postings must be kept.
+func (k *keywordIndex) scores(query []queryTerm) map[string]float64 {
+	scores := make(map[string]float64)
+	n, avgDocLen := k.avgDocLen()
+	if n == 0 {
+		return scores
+	}
+	for _, term := range query {
+		docs := k.postings[term.term]
+		df := float64(len(docs))
+		for id, tf := range docs {
+			scores[id] += term.weight * bm25(float64(tf), df, n, float64(k.lengths[id]), avgDocLen)
+		}
+	}
+	return scores
+}
+
+// score returns the BM25 score of a text of the corpus from its tokens.
+func (k *keywordIndex) score(query []queryTerm, tokens []string) float64 {
+	n, avgDocLen := k.avgDocLen()
+	if n == 0 || len(tokens) == 0 {
+		return 0
+	}
+	freqs := termFrequencies(tokens)
+	score := 0.0
+	for _, term := range query {
+		if tf := freqs[term.term]; tf > 0 {
+			score += term.weight * bm25(float64(tf), float64(k.docFreqs[term.term]), n, float64(len(tokens)), avgDocLen)
+		}
+	}
+	return score
+}
+
+// noTermDecay counts every repetition of a query term fully
+const noTermDecay = 1.0
+
+// queryTerm is a distinct term of a keyword query, weighted by how many
+// times it is repeated.
+type queryTerm struct {
+	term   string
+	weight float64
+}
+
+// queryTerms returns the distinct terms of query in order of first
+// occurrence. Each repetition of a term adds decay times the weight the
+// one before it added, so with decay 1 a term repeated n times weighs n
+// and with decay 0 it weighs 1. A query with more than
+// Config.MaxQueryTerms terms is rejected under LongQueryReject; otherwise
+// limitQueryTerms truncates it once document frequencies are known.
+func (s *boltStore) queryTerms(query string, decay float64) ([]queryTerm, error) {
+	var terms []queryTerm
+	positions := make(map[string]int)
+	increments := make(map[string]float64)
+	for _, token := range s.tokenize(query) {
+		i, ok := positions[token]
+		if !ok {
+			positions[token] = len(terms)
+			increments[token] = 1
+			terms = append(terms, queryTerm{term: token, weight: 1})
+			continue
+		}
+		increments[token] *= decay
+		terms[i].weight += increments[token]
+	}
+	if len(terms) > s.config.MaxQueryTerms && s.config.OnLongQuery == LongQueryReject {
+		return nil, errors.New(http.StatusBadRequest, "keyword query has too many terms").
+			WithDetails(fmt.Sprintf("%d distinct terms, at most %d are allowed", len(terms), s.config.MaxQueryTerms))
+	}
+	return terms, nil
+}
+
+// limitQueryTerms keeps the Config.MaxQueryTerms most significant terms of
+// a query, those with the highest IDF, in their order in the query. Every
+// term is scored against every document containing it, so the bound keeps a
+// pathological query from stalling the search; the rarest terms are the
+// ones that tell documents apart. df returns the number of documents
+// containing a term.
+func (s *boltStore) limitQueryTerms(ctx context.Context, terms []queryTerm, df func(term string) int) []queryTerm {
+	max := s.config.MaxQueryTerms
+	if len(terms) <= max {
+		return terms
+	}
+
+	// Terms no document contains score nothing and are dropped. IDF falls
+	// as document frequency rises, so of the rest the rarest are kept
+	order := make([]int, 0, len(terms))
+	for i, term := range terms {
+		if df(term.term) > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return df(terms[order[a]].term) < df(terms[order[b]].term)
+	})
+	order = order[:min(max, len(order))]
+	sort.Ints(order)
+
+	kept := make([]queryTerm, len(order))
+	for i, position := range order {
+		kept[i] = terms[position]
+	}
+	s.log(ctx).WithFields(logrus.Fields{
+		"terms":     len(terms),
+		"max_terms": max,
+	}).Warn("Truncated keyword query to its most significant terms")
+	return kept
+}
+
+// bm25 scores one query term occurring tf times in a document of docLen
+// tokens, where df of the n documents contain the term.
+func bm25(tf, df, n, docLen, avgDocLen float64) float64 {
+	idf := math.Log(1.0 + (n-df+0.5)/(df+0.5))
+	return idf * tf * (bm25K1 + 1.0) / (tf + bm25K1*(1.0-bm25B+bm25B*(docLen/avgDocLen)))
+}
+
+// indexText adds the text of a vector to the keyword statistics. Once they
+// would hold more than Config.KeywordMaxPostings postings the postings are
+// dropped and hybrid searches tokenize the vectors they score instead. The
+// caller must hold s.mu.
+func (s *boltStore) indexText(vector *models.Vector) {
+	s.keywords.add(vector.ID, s.tokenize(vector.Text))
+	if s.keywords.postings != nil && s.keywords.size > s.config.KeywordMaxPostings {
+		logger.WithFields(logrus.Fields{
+			"postings":     s.keywords.size,
+			"max_postings": s.config.KeywordMaxPostings,
+		}).Warn("Dropped BM25 postings past the postings limit, hybrid search will tokenize the vectors it scores")
+		s.keywords.postings = nil
+	}
+}
+
+// unindexText removes the text of a vector from the keyword statistics,
+// rebuilding the postings once they are back under nine tenths of
+// Config.KeywordMaxPostings, so a corpus hovering at the limit doesn't
+// rebuild them on every write. The caller must hold s.mu.
+func (s *boltStore) unindexText(vector *models.Vector) {
+	s.keywords.remove(vector.ID, s.tokenize(vector.Text))
+	if s.keywords.postings == nil && s.keywords.size <= s.config.KeywordMaxPostings/10*9 {
+		s.rebuildPostings(vector.ID)
+	}
+}
+
+// rebuildPostings rebuilds the keyword statistics of every vector but the
+// one being removed, which may still be cached. The caller must hold s.mu.
+func (s *boltStore) rebuildPostings(removed string) {
+	s.keywords = newKeywordIndex(s.config.KeywordCountEmpty)
+	for id, vector := range s.vectors {
+		if id != removed {
+			s.keywords.add(id, s.tokenize(vector.Text))
+		}
+	}
+	logger.WithField("postings", s.keywords.size).Info("Rebuilt BM25 postings back under the postings limit")
+}
+
+// keywordScores returns the BM25 scores of vectors for query, repeated
+// query terms saturating by decay. The scores are read from the postings
+// when they are kept and computed from the text of the vectors otherwise,
+// against the statistics of the whole corpus either way. The caller must
+// hold s.mu.
+func (s *boltStore) keywordScores(ctx context.Context, query string, vectors []*models.Vector, decay float64) ([]float64, error) {
+	terms, err := s.queryTerms(query, decay)
+	if err != nil {
+		return nil, err
+	}
+	terms = s.limitQueryTerms(ctx, terms, func(term string) int { return s.keywords.docFreqs[term] })
+
+	scores := make([]float64, len(vectors))
+	if s.keywords.postings == nil {
+		for i, vector := range vectors {
+			scores[i] = s.keywords.score(terms, s.tokenize(vector.Text))
+		}
+		return scores, nil
+	}
+	byID := s.keywords.scores(terms)
+	for i, vector := range vectors {
+		scores[i] = byID[vector.ID]
+	}
+	return scores, nil
+}
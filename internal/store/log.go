@@ -0,0 +1,21 @@
+package store
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/logger"
+)
+
+// log returns an entry for logging from a store operation running with
+// ctx, carrying the ID of the HTTP request it runs for when
+// Config.LogRequestIDs is set.
+func (s *boltStore) log(ctx context.Context) *logrus.Entry {
+	fields := logrus.Fields{}
+	if s.config.LogRequestIDs {
+		if id := logger.RequestID(ctx); id != "" {
+			fields["request_id"] = id
+		}
+	}
+	return logger.WithFields(fields)
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+)
+
+// valueCache keeps the most recently read full-precision embeddings of
+// quantized vectors, so vectors read repeatedly, such as by GetVector,
+// don't each cost a disk read. A miss reads the vector from bbolt by key.
+// s.vectors stays authoritative for which vectors exist: entries are only
+// looked up for vectors found there, and are dropped whenever the vector is
+// written or deleted.
+//
+// Entries are only filled under s.mu, so a write can't interleave between
+// reading a vector from disk and caching it. Readers share s.mu, so the
+// cache has its own lock.
+type valueCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type valueCacheEntry struct {
+	id     string
+	values []float64
+}
+
+func newValueCache(size int) *valueCache {
+	return &valueCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *valueCache) get(id string) ([]float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*valueCacheEntry).values, true
+}
+
+// put caches values for id, evicting the least recently used entry when
+// the cache is full.
+func (c *valueCache) put(id string, values []float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		element.Value.(*valueCacheEntry).values = values
+		c.order.MoveToFront(element)
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*valueCacheEntry).id)
+	}
+	c.entries[id] = c.order.PushFront(&valueCacheEntry{id: id, values: values})
+}
+
+func (c *valueCache) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.order.Remove(element)
+		delete(c.entries, id)
+	}
+}
+
+// readValues returns the full-precision embedding of a quantized vector,
+// from the value cache when it's enabled and holds it, from disk otherwise.
+// The caller must hold s.mu.
+func (s *boltStore) readValues(id string) []float64 {
+	if s.valueCache != nil {
+		if values, ok := s.valueCache.get(id); ok {
+			return values
+		}
+	}
+
+	values := s.loadValues(id)
+	s.diskReads.Add(1)
+	if s.valueCache != nil && values != nil {
+		s.valueCache.put(id, values)
+	}
+	return values
+}
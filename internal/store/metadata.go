@@ -0,0 +1,97 @@
+package store
+
+import (
+	"sort"
+	"strings"
+
+	"vectraDB/internal/models"
+)
+
+// normalizeMetadataValue is the form metadata keys and values are stored
+// and filtered in when Config.NormalizeMetadata is set.
+func normalizeMetadataValue(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// normalizeMetadata lowercases and trims the metadata keys and values of a
+// vector about to be written, keeping the metadata as given in
+// OriginalMetadata when Config.PreserveOriginalMetadata is set and
+// normalizing changed it. Keys differing only by case or whitespace
+// collapse into one, the first in sorted order winning.
+func (s *boltStore) normalizeMetadata(vector *models.Vector) {
+	vector.OriginalMetadata = nil
+	if !s.config.NormalizeMetadata || len(vector.Metadata) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(vector.Metadata))
+	for key := range vector.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	normalized := make(models.Metadata, len(vector.Metadata))
+	changed := false
+	for _, key := range keys {
+		k, v := normalizeMetadataValue(key), normalizeMetadataValue(vector.Metadata[key])
+		if _, ok := normalized[k]; ok {
+			changed = true
+			continue
+		}
+		normalized[k] = v
+		changed = changed || k != key || v != vector.Metadata[key]
+	}
+
+	if changed && s.config.PreserveOriginalMetadata {
+		vector.OriginalMetadata = vector.Metadata
+	}
+	vector.Metadata = normalized
+}
+
+// normalizeLoaded normalizes the metadata of a vector read back from disk,
+// which may have been written before Config.NormalizeMetadata was set, so
+// it's indexed and filtered like newly written ones. The record on disk is
+// left as it is until the vector is next written, and OriginalMetadata it
+// already carries is kept.
+func (s *boltStore) normalizeLoaded(vector *models.Vector) {
+	if !s.config.NormalizeMetadata {
+		return
+	}
+	original := vector.OriginalMetadata
+	s.normalizeMetadata(vector)
+	if vector.OriginalMetadata == nil {
+		vector.OriginalMetadata = original
+	}
+}
+
+// normalizeFilter mirrors normalizeMetadata on a metadata filter, matching
+// values by their literal form like the index. The embedding model and
+// version aren't metadata and are matched as given.
+func (s *boltStore) normalizeFilter(filter map[string]string) map[string]string {
+	if len(filter) == 0 {
+		return filter
+	}
+
+	normalized := make(map[string]string, len(filter))
+	for key, val := range filter {
+		normalized[s.normalizeKey(key)] = s.normalizeValue(key, models.MetadataText(val))
+	}
+	return normalized
+}
+
+// normalizeKey mirrors normalizeMetadata on a metadata key looked up on its
+// own, such as the key results are grouped or collapsed by.
+func (s *boltStore) normalizeKey(key string) string {
+	if !s.config.NormalizeMetadata || key == EmbeddingModelKey || key == EmbeddingVersionKey {
+		return key
+	}
+	return normalizeMetadataValue(key)
+}
+
+// normalizeValue mirrors normalizeMetadata on a value looked up under key.
+func (s *boltStore) normalizeValue(key, val string) string {
+	if !s.config.NormalizeMetadata || key == EmbeddingModelKey || key == EmbeddingVersionKey {
+		return val
+	}
+	return normalizeMetadataValue(val)
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"fmt"
+	"math"
+
+	"vectraDB/internal/models"
+)
+
+// metricScore scores values against query under the dot or euclidean
+// metric, higher scores ranking first. Euclidean distances map to
+// 1 / (1 + distance) as in Compare.
+func metricScore(metric string, query, values []float64) (float64, error) {
+	if len(query) != len(values) {
+		return 0, fmt.Errorf("vectors must have the same length")
+	}
+
+	switch metric {
+	case models.MetricDot:
+		dot := 0.0
+		for i := range query {
+			dot += query[i] * values[i]
+		}
+		return dot, nil
+	case models.MetricEuclidean:
+		dist := 0.0
+		for i := range query {
+			dist += (query[i] - values[i]) * (query[i] - values[i])
+		}
+		return 1 / (1 + math.Sqrt(dist)), nil
+	default:
+		return 0, fmt.Errorf("unknown metric %q", metric)
+	}
+}
+
+// metricScorer returns a function scoring cached vectors against query
+// under metric. Cosine uses scorer, the other metrics score the full
+// embedding.
+func (s *boltStore) metricScorer(query []float64, metric string) func(vector *models.Vector) (float64, error) {
+	if metric == models.MetricCosine {
+		return s.scorer(query)
+	}
+	return func(vector *models.Vector) (float64, error) {
+		return metricScore(metric, query, s.values(vector))
+	}
+}
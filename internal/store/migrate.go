@@ -0,0 +1,202 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// The database records the schema version its records were written with
+// in the meta bucket. Databases from before versioning have none and are
+// at version 0. On startup, records of an older version are upgraded by
+// each migration in turn. Migrations rewrite records in batches of
+// migrateBatchSize, each in its own transaction, so upgrading a large
+// database doesn't hold one huge transaction, and the version is only
+// stamped once they all succeed. An interrupted upgrade is resumed from
+// the start on the next startup, so migrations must be idempotent.
+
+const schemaVersion = 1
+
+// migrateBatchSize is the number of records a migration rewrites per
+// transaction
+const migrateBatchSize = 1000
+
+var schemaVersionKey = []byte("schema_version")
+
+// migrations[i] upgrades the records of version i to version i+1, returning
+// the number of records it rewrote.
+var migrations = []func(s *boltStore, now time.Time) (int, error){
+	backfillRecords,
+}
+
+// migrate brings the stored records up to schemaVersion. Empty databases
+// are stamped with the current version, others are migrated unless
+// Config.ManualMigration is set.
+func (s *boltStore) migrate() error {
+	version, empty := 0, false
+	err := s.update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return errors.Wrap(err, http.StatusInternalServerError, "failed to create meta bucket")
+		}
+		if stored := meta.Get(schemaVersionKey); stored != nil {
+			if version, err = strconv.Atoi(string(stored)); err != nil {
+				return errors.Wrap(err, http.StatusInternalServerError, "invalid schema version")
+			}
+		}
+		empty = isEmpty(tx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return errors.New(http.StatusInternalServerError, "unsupported schema version").
+			WithDetails(fmt.Sprintf("database schema version %d is newer than version %d this build supports", version, schemaVersion))
+	}
+	if version == schemaVersion {
+		return nil
+	}
+
+	if !empty {
+		if s.config.ManualMigration {
+			return errors.New(http.StatusInternalServerError, "database needs migration").
+				WithDetails(fmt.Sprintf("database schema version %d is older than version %d, enable migration to upgrade it", version, schemaVersion))
+		}
+
+		start := time.Now()
+		migrated := 0
+		for v := version; v < schemaVersion; v++ {
+			n, err := migrations[v](s, start)
+			if err != nil {
+				return err
+			}
+			migrated += n
+		}
+		logger.WithFields(logrus.Fields{
+			"from":     version,
+			"to":       schemaVersion,
+			"records":  migrated,
+			"duration": time.Since(start).String(),
+		}).Info("Migrated database schema")
+	}
+
+	return s.update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("meta")).Put(schemaVersionKey, []byte(strconv.Itoa(schemaVersion)))
+	})
+}
+
+// isEmpty reports whether no vectors or documents have been written.
+func isEmpty(tx *bbolt.Tx) bool {
+	for _, name := range []string{"vectors", "documents"} {
+		if bucket := tx.Bucket([]byte(name)); bucket != nil {
+			if k, _ := bucket.Cursor().First(); k != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// backfillRecords migrates to version 1. Records are rewritten in the
+// current shape, which keeps metadata numbers and booleans as their
+// literals, and missing timestamps are backfilled: updated_at from
+// created_at, and both from the time of the migration when there are none.
+// Records that fail to decode are left for loading to quarantine.
+func backfillRecords(s *boltStore, now time.Time) (int, error) {
+	vectors, err := s.rewriteRecords("vectors", func(data []byte) (interface{}, error) {
+		var vector models.Vector
+		if err := json.Unmarshal(data, &vector); err != nil {
+			return nil, err
+		}
+		backfillTimestamps(&vector.CreatedAt, &vector.UpdatedAt, now)
+		return &vector, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	documents, err := s.rewriteRecords("documents", func(data []byte) (interface{}, error) {
+		var doc models.Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		backfillTimestamps(&doc.CreatedAt, &doc.UpdatedAt, now)
+		return &doc, nil
+	})
+	return vectors + documents, err
+}
+
+func backfillTimestamps(createdAt, updatedAt *time.Time, now time.Time) {
+	if createdAt.IsZero() {
+		*createdAt = now
+	}
+	if updatedAt.IsZero() {
+		*updatedAt = *createdAt
+	}
+}
+
+// rewriteRecords re-encodes every record of a bucket upgraded by upgrade,
+// writing back those that changed, migrateBatchSize records per
+// transaction, and returns how many did.
+func (s *boltStore) rewriteRecords(name string, upgrade func(data []byte) (interface{}, error)) (int, error) {
+	rewritten := 0
+	var after []byte
+	for done := false; !done; {
+		err := s.update(func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket([]byte(name))
+			if bucket == nil {
+				done = true
+				return nil
+			}
+
+			// The bucket can't be written while it is iterated
+			updates := make(map[string][]byte)
+			cursor := bucket.Cursor()
+			k, v := cursor.First()
+			if after != nil {
+				if k, v = cursor.Seek(after); bytes.Equal(k, after) {
+					k, v = cursor.Next()
+				}
+			}
+			n := 0
+			for ; k != nil && n < migrateBatchSize; k, v = cursor.Next() {
+				n++
+				after = append(after[:0], k...)
+				record, err := upgrade(v)
+				if err != nil {
+					continue // Skip corrupted records
+				}
+				data, err := json.Marshal(record)
+				if err != nil {
+					return errors.Wrap(err, http.StatusInternalServerError, "failed to marshal migrated record")
+				}
+				if !bytes.Equal(data, v) {
+					updates[string(k)] = data
+				}
+			}
+			done = k == nil
+
+			for k, data := range updates {
+				if err := bucket.Put([]byte(k), data); err != nil {
+					return errors.Wrap(err, http.StatusInternalServerError, "failed to store migrated record")
+				}
+			}
+			rewritten += len(updates)
+			return nil
+		})
+		if err != nil {
+			return rewritten, err
+		}
+	}
+	return rewritten, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// Named vectors are kept in full precision on the cached vector. Searches
+// targeting them or pooling them with the vector score them directly, so
+// they skip the search index and PQ rescoring, which only know the vector.
+
+// multiVector reports whether a search scores named vectors.
+func multiVector(req *models.SearchRequest) bool {
+	return req.Target != "" || req.Pooling == models.PoolingMax || req.Pooling == models.PoolingMean
+}
+
+// validatePooling checks the multi-vector parameters of a search, applying
+// the store's default pooling.
+func (s *boltStore) validatePooling(req *models.SearchRequest) error {
+	if req.Target != "" && req.Pooling != "" && req.Pooling != models.PoolingNone {
+		return errors.New(http.StatusBadRequest, "invalid input").WithDetails("target and pooling can't be combined")
+	}
+	if req.Target == "" && req.Pooling == "" {
+		req.Pooling = s.config.VectorPooling
+	}
+	return nil
+}
+
+// valuesScorer scores full-precision values against query under metric,
+// like metricScorer scores cached vectors.
+func (s *boltStore) valuesScorer(query []float64, metric string) func(values []float64) (float64, error) {
+	if metric == models.MetricCosine {
+		return func(values []float64) (float64, error) {
+			return s.zeroMagnitude(cosineSimilarity(query, values))
+		}
+	}
+	return func(values []float64) (float64, error) {
+		return metricScore(metric, query, values)
+	}
+}
+
+// multiVectorScorer wraps a scorer of records so it scores their named
+// vectors as the search asks. vectorOf returns the vector of a record.
+func multiVectorScorer[T any](req *models.SearchRequest, score func(T) (float64, error), scoreValues func([]float64) (float64, error), vectorOf func(T) *models.Vector) func(T) (float64, error) {
+	if req.Target != "" {
+		return func(record T) (float64, error) {
+			values, ok := vectorOf(record).NamedVectors[req.Target]
+			if !ok {
+				return 0, fmt.Errorf("no named vector %q", req.Target)
+			}
+			return scoreValues(values)
+		}
+	}
+	if !multiVector(req) {
+		return score
+	}
+
+	return func(record T) (float64, error) {
+		var scores []float64
+		if similarity, err := score(record); err == nil {
+			scores = append(scores, similarity)
+		}
+		for _, values := range vectorOf(record).NamedVectors {
+			if similarity, err := scoreValues(values); err == nil {
+				scores = append(scores, similarity)
+			}
+		}
+		if len(scores) == 0 {
+			return 0, fmt.Errorf("no vector of the query's dimension")
+		}
+		return pool(req.Pooling, scores), nil
+	}
+}
+
+// pool combines the scores of a record's vectors.
+func pool(pooling string, scores []float64) float64 {
+	if pooling == models.PoolingMean {
+		sum := 0.0
+		for _, score := range scores {
+			sum += score
+		}
+		return sum / float64(len(scores))
+	}
+	best := math.Inf(-1)
+	for _, score := range scores {
+		best = math.Max(best, score)
+	}
+	return best
+}
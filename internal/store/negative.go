@@ -0,0 +1,60 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+const defaultNegativeWeight = 0.5
+
+// hasNegatives reports whether a search has negative examples.
+func hasNegatives(req *models.SearchRequest) bool {
+	return len(req.NegativeVectors) > 0 || len(req.NegativeIDs) > 0
+}
+
+// negativeScorer returns a function computing the penalty subtracted from a
+// vector's score for a search with negative examples: NegativeWeight times
+// its mean similarity to the examples, Rocchio style. It returns nil when
+// the search has no negative examples. The caller must hold s.mu.
+func (s *boltStore) negativeScorer(req *models.SearchRequest) (func(vector *models.Vector) float64, error) {
+	if !hasNegatives(req) {
+		return nil, nil
+	}
+
+	examples := make([][]float64, 0, len(req.NegativeVectors)+len(req.NegativeIDs))
+	for _, values := range req.NegativeVectors {
+		examples = append(examples, values)
+	}
+	for _, id := range req.NegativeIDs {
+		vector, ok := s.vectors[id]
+		if !ok {
+			return nil, errors.New(http.StatusNotFound, "vector not found").WithDetails(id)
+		}
+		examples = append(examples, s.values(vector))
+	}
+
+	scorers := make([]func(*models.Vector) (float64, error), len(examples))
+	for i, example := range examples {
+		if len(example) != len(req.Query) {
+			return nil, errors.New(http.StatusBadRequest, "invalid vector dimension").
+				WithDetails(fmt.Sprintf("negative example %d has %d dimensions, the query has %d", i, len(example), len(req.Query)))
+		}
+		scorers[i] = s.metricScorer(example, req.Metric)
+	}
+
+	weight := req.NegativeWeight / float64(len(scorers))
+	return func(vector *models.Vector) float64 {
+		penalty := 0.0
+		for _, score := range scorers {
+			// Examples that can't be scored against the vector don't
+			// penalize it
+			if similarity, err := score(vector); err == nil {
+				penalty += weight * similarity
+			}
+		}
+		return penalty
+	}, nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"math"
+	"sort"
+
+	"vectraDB/internal/models"
+)
+
+// Score calibrations
+const (
+	CalibrationNone    = ""
+	CalibrationSigmoid = "sigmoid"
+)
+
+const defaultCalibrationSlope = 10
+
+// calibrate sets the confidence of ranked results from their scores before
+// normalization. The sigmoid calibration maps Config.CalibrationMidpoint to
+// 0.5, rising faster around it the steeper Config.CalibrationSlope is, so a
+// confidence means the same whatever the query.
+func (s *boltStore) calibrate(results []models.SearchResult) {
+	if s.config.Calibration != CalibrationSigmoid {
+		return
+	}
+	for i := range results {
+		confidence := 1 / (1 + math.Exp(-s.config.CalibrationSlope*(results[i].Score-s.config.CalibrationMidpoint)))
+		results[i].Confidence = &confidence
+	}
+}
+
+// defaultNormalization is the score normalization applied when a search
+// doesn't ask for one. Cosine scores are shifted to 0..1, the other metrics
+// are returned as scored.
+func defaultNormalization(metric string) string {
+	if metric == models.MetricCosine {
+		return models.NormalizationUnit
+	}
+	return models.NormalizationRaw
+}
+
+// returnedScore returns the function mapping raw scores to the scores
+// returned under normalization, which min_score and gap_cutoff are
+// compared against. Rank normalization depends on the final results, so
+// they are rejected with it. Radius is a cosine distance and always
+// applies to the raw scores.
+func returnedScore(normalization, metric string) func(float64) float64 {
+	if normalization == models.NormalizationUnit {
+		return func(score float64) float64 { return unitScore(score, metric) }
+	}
+	return func(score float64) float64 { return score }
+}
+
+// normalizeSearchScores rescales the scores of ranked results in place. Both
+// rescalings are monotonic, so the ranking is preserved.
+func normalizeSearchScores(results []models.SearchResult, normalization, metric string) {
+	switch normalization {
+	case models.NormalizationUnit:
+		for i := range results {
+			results[i].Score = unitScore(results[i].Score, metric)
+		}
+	case models.NormalizationRank:
+		rankScores(results)
+	}
+}
+
+// unitScore maps a score under metric to 0..1. Cosine similarities are
+// shifted from -1..1, dot products go through the logistic function and
+// euclidean scores already lie in 0..1.
+func unitScore(score float64, metric string) float64 {
+	switch metric {
+	case models.MetricCosine:
+		return (score + 1) / 2
+	case models.MetricDot:
+		return 1 / (1 + math.Exp(-score))
+	}
+	return score
+}
+
+// rankScores replaces each score with its percentile rank, the share of the
+// other results scoring strictly lower, so the best result scores 1 and the
+// worst 0. Tied results share a rank.
+func rankScores(results []models.SearchResult) {
+	scores := make([]float64, len(results))
+	for i := range results {
+		scores[i] = results[i].Score
+	}
+	sort.Float64s(scores)
+	for i := range results {
+		results[i].Score = percentileRank(scores, results[i].Score)
+	}
+}
+
+// setPercentiles sets the percentile rank of results among the scores of
+// every candidate, sorted ascending.
+func setPercentiles(results []models.SearchResult, sorted []float64) {
+	for i := range results {
+		percentile := percentileRank(sorted, results[i].Score)
+		results[i].Percentile = &percentile
+	}
+}
+
+// percentileRank is the share of the other scores, sorted ascending, that
+// are strictly lower than score, 1 when it's the only one.
+func percentileRank(sorted []float64, score float64) float64 {
+	if len(sorted) < 2 {
+		return 1
+	}
+	return float64(sort.SearchFloat64s(sorted, score)) / float64(len(sorted)-1)
+}
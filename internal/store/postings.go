@@ -0,0 +1,165 @@
+package store
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"sort"
+
+	"vectraDB/internal/models"
+)
+
+// IndexPostings returns the IDs of the vectors indexed under key=value,
+// normalized like a filter.
+func (s *boltStore) IndexPostings(ctx context.Context, key, value string) ([]string, error) {
+	key, value = s.normalizeKey(key), s.normalizeValue(key, value)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.index[key][value]))
+	for id := range s.index[key][value] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// VectorPostings returns the index entries that reference the vector. The
+// index is scanned rather than the vector's metadata, so stale entries left
+// behind for a vector show up too.
+func (s *boltStore) VectorPostings(ctx context.Context, id string) ([]models.Posting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	postings := make([]models.Posting, 0)
+	for key, values := range s.index {
+		for value, ids := range values {
+			if ids[id] {
+				postings = append(postings, models.Posting{Key: key, Value: value})
+			}
+		}
+	}
+	sort.Slice(postings, func(i, j int) bool {
+		if postings[i].Key != postings[j].Key {
+			return postings[i].Key < postings[j].Key
+		}
+		return postings[i].Value < postings[j].Value
+	})
+
+	return postings, nil
+}
+
+// ExportIndex returns a page of the inverted index ordered by key and value,
+// resumed after cursor. Only the keys and values of the page are selected,
+// each keeping the smallest limit of them rather than sorting them all, and
+// only their IDs copied, so a full export doesn't copy the index once per
+// page.
+func (s *boltStore) ExportIndex(ctx context.Context, cursor string, limit int, withIDs bool) (*models.IndexExport, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	var afterKey, afterValue string
+	if cursor != "" {
+		var err error
+		if afterKey, afterValue, err = s.decodeIndexCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.RLock()
+	// Every key holds at least one value, so the page spans at most limit+1
+	// keys after the cursor's
+	keys := smallestAfter(s.index, afterKey, cursor == "", limit+1)
+	if _, ok := s.index[afterKey]; ok && cursor != "" {
+		keys = append([]string{afterKey}, keys...)
+	}
+	entries := make([]models.IndexEntry, 0, limit+1)
+	for _, key := range keys {
+		if len(entries) > limit {
+			break
+		}
+		values := s.index[key]
+		for _, value := range smallestAfter(values, afterValue, cursor == "" || key != afterKey, limit+1-len(entries)) {
+			entry := models.IndexEntry{Key: key, Value: value, Count: len(values[value])}
+			if withIDs {
+				entry.IDs = make([]string, 0, len(values[value]))
+				for id := range values[value] {
+					entry.IDs = append(entry.IDs, id)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	s.mu.RUnlock()
+
+	result := &models.IndexExport{Entries: entries}
+	if len(entries) > limit {
+		result.Entries = entries[:limit]
+		last := result.Entries[limit-1]
+		result.NextCursor = s.encodeIndexCursor(last.Key, last.Value)
+	}
+	for i := range result.Entries {
+		sort.Strings(result.Entries[i].IDs)
+	}
+
+	return result, nil
+}
+
+// smallestAfter returns, in order, the n smallest keys of m greater than
+// after, or of all its keys when all is set. Only the n smallest seen so
+// far are kept, in a max-heap, so selecting a page doesn't sort every key.
+func smallestAfter[V any](m map[string]V, after string, all bool, n int) []string {
+	h := &maxStringHeap{}
+	for key := range m {
+		if !all && key <= after {
+			continue
+		}
+		if h.Len() < n {
+			heap.Push(h, key)
+		} else if n > 0 && key < (*h)[0] {
+			(*h)[0] = key
+			heap.Fix(h, 0)
+		}
+	}
+	keys := make([]string, h.Len())
+	for i := len(keys) - 1; i >= 0; i-- {
+		keys[i] = heap.Pop(h).(string)
+	}
+	return keys
+}
+
+// maxStringHeap is a heap of strings, largest first.
+type maxStringHeap []string
+
+func (h maxStringHeap) Len() int           { return len(h) }
+func (h maxStringHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h maxStringHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxStringHeap) Push(x any)        { *h = append(*h, x.(string)) }
+func (h *maxStringHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// Index cursors carry the last key and value of a page as a JSON pair,
+// since keys and values may contain any character.
+func (s *boltStore) encodeIndexCursor(key, value string) string {
+	raw, _ := json.Marshal([2]string{key, value})
+	return s.signCursor("index", string(raw))
+}
+
+func (s *boltStore) decodeIndexCursor(cursor string) (string, string, error) {
+	raw, err := s.verifyCursor("index", cursor)
+	if err != nil {
+		return "", "", err
+	}
+	var pair [2]string
+	if err := json.Unmarshal([]byte(raw), &pair); err != nil {
+		return "", "", ErrInvalidCursor
+	}
+	return pair[0], pair[1], nil
+}
@@ -0,0 +1,383 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/models"
+)
+
+const QuantizationPQ = "pq"
+
+const (
+	defaultPQSubspaces = 8
+	defaultPQCentroids = 256
+	defaultPQTrainSize = 1000
+	defaultPQRescore   = 100
+	pqKMeansIterations = 10
+)
+
+// pqIndex holds product quantization codebooks and the codes of the vectors
+// encoded with them. Each vector is split into subspaces and every subspace
+// is replaced by the index of its nearest centroid, so a vector takes one
+// byte per subspace instead of eight bytes per dimension.
+type pqIndex struct {
+	dim int
+	// bounds[i] is the first dimension of subspace i, bounds[m] is dim
+	bounds    []int
+	codebooks [][][]float32
+	codes     map[string][]byte
+	norms     map[string]float32
+}
+
+func trainPQ(samples [][]float64, subspaces, centroids int, rng *rand.Rand) *pqIndex {
+	dim := len(samples[0])
+	if subspaces > dim {
+		subspaces = dim
+	}
+	if centroids > len(samples) {
+		centroids = len(samples)
+	}
+	if centroids > 256 {
+		centroids = 256
+	}
+
+	pq := &pqIndex{
+		dim:       dim,
+		bounds:    make([]int, subspaces+1),
+		codebooks: make([][][]float32, subspaces),
+		codes:     make(map[string][]byte),
+		norms:     make(map[string]float32),
+	}
+	for i := 0; i <= subspaces; i++ {
+		pq.bounds[i] = i * dim / subspaces
+	}
+
+	for m := 0; m < subspaces; m++ {
+		lo, hi := pq.bounds[m], pq.bounds[m+1]
+		points := make([][]float64, len(samples))
+		for i, sample := range samples {
+			points[i] = sample[lo:hi]
+		}
+		pq.codebooks[m] = kmeans(points, centroids, pqKMeansIterations, rng)
+	}
+
+	return pq
+}
+
+// kmeans clusters points into k centroids using Lloyd's algorithm seeded
+// with randomly chosen points.
+func kmeans(points [][]float64, k, iterations int, rng *rand.Rand) [][]float32 {
+	dim := len(points[0])
+	centroids := make([][]float32, k)
+	for i, p := range rng.Perm(len(points))[:k] {
+		centroids[i] = toFloat32(points[p])
+	}
+
+	assignment := make([]int, len(points))
+	for iter := 0; iter < iterations; iter++ {
+		for i, point := range points {
+			assignment[i] = nearestCentroid(centroids, point)
+		}
+
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for i := range sums {
+			sums[i] = make([]float64, dim)
+		}
+		for i, point := range points {
+			c := assignment[i]
+			counts[c]++
+			for d, v := range point {
+				sums[c][d] += v
+			}
+		}
+		for c := range centroids {
+			// Keep empty clusters where they are
+			if counts[c] == 0 {
+				continue
+			}
+			for d := range sums[c] {
+				centroids[c][d] = float32(sums[c][d] / float64(counts[c]))
+			}
+		}
+	}
+
+	return centroids
+}
+
+func nearestCentroid(centroids [][]float32, point []float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for c, centroid := range centroids {
+		dist := 0.0
+		for d, v := range point {
+			diff := v - float64(centroid[d])
+			dist += diff * diff
+		}
+		if dist < bestDist {
+			best, bestDist = c, dist
+		}
+	}
+	return best
+}
+
+func (pq *pqIndex) add(id string, values []float64) {
+	code := make([]byte, len(pq.codebooks))
+	for m := range pq.codebooks {
+		code[m] = byte(nearestCentroid(pq.codebooks[m], values[pq.bounds[m]:pq.bounds[m+1]]))
+	}
+
+	var norm float64
+	for _, v := range values {
+		norm += v * v
+	}
+
+	pq.codes[id] = code
+	pq.norms[id] = float32(math.Sqrt(norm))
+}
+
+func (pq *pqIndex) remove(id string) {
+	delete(pq.codes, id)
+	delete(pq.norms, id)
+}
+
+// table precomputes the dot product of each query subspace with every
+// centroid, so scoring a code is one lookup per subspace.
+func (pq *pqIndex) table(query []float64) [][]float32 {
+	table := make([][]float32, len(pq.codebooks))
+	for m, codebook := range pq.codebooks {
+		sub := query[pq.bounds[m]:pq.bounds[m+1]]
+		table[m] = make([]float32, len(codebook))
+		for c, centroid := range codebook {
+			var dot float32
+			for d, v := range sub {
+				dot += float32(v) * centroid[d]
+			}
+			table[m][c] = dot
+		}
+	}
+	return table
+}
+
+func (pq *pqIndex) approxDot(table [][]float32, code []byte) float32 {
+	var dot float32
+	for m, c := range code {
+		dot += table[m][c]
+	}
+	return dot
+}
+
+// maybeTrainPQ trains the quantizer in the background once enough vectors
+// are present. Searches score full-precision values until it's installed.
+// The caller must hold s.mu.
+func (s *boltStore) maybeTrainPQ(ctx context.Context) {
+	if !s.pqDue() || !s.pqTraining.CompareAndSwap(false, true) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	started := s.goBackground(func() {
+		defer s.pqTraining.Store(false)
+		if err := s.trainQuantizer(ctx); err != nil {
+			s.log(ctx).WithError(err).Error("Failed to train product quantizer")
+		}
+	})
+	if !started {
+		s.pqTraining.Store(false)
+	}
+}
+
+// quantized returns the number of vectors encoded by the quantizer. The
+// caller must hold s.mu.
+func (s *boltStore) quantized() int {
+	if s.pq == nil {
+		return 0
+	}
+	return len(s.pq.codes)
+}
+
+// pqDue reports whether the quantizer should be trained. The caller must
+// hold s.mu.
+func (s *boltStore) pqDue() bool {
+	return s.config.Quantization == QuantizationPQ && s.pq == nil && len(s.vectors) >= s.config.PQTrainSize
+}
+
+// trainQuantizer trains the quantizer on a sample of the vectors of the
+// common dimension, encodes them and re-caches them as codes. The sample
+// is read and the vectors encoded in batches under the read lock, and the
+// codebooks trained with no lock held, so searches and writes go on
+// meanwhile. Vectors written during training are recorded in s.pqPending
+// and encoded once it's installed.
+func (s *boltStore) trainQuantizer(ctx context.Context) error {
+	start := time.Now()
+
+	s.mu.Lock()
+	dim := s.commonDimension()
+	ids := make([]string, 0, len(s.vectors))
+	for id := range s.vectors {
+		ids = append(ids, id)
+	}
+	s.pqPending = make(map[string]bool)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.pqPending = nil
+		s.mu.Unlock()
+	}()
+	if dim == 0 {
+		return nil
+	}
+
+	// Sort before sampling so training is reproducible
+	sort.Strings(ids)
+	samples := make([][]float64, 0, min(len(ids), s.config.PQTrainSize))
+	err := s.eachValues(ctx, sampleOrder(ids), func(id string, values []float64) bool {
+		if len(values) == dim {
+			samples = append(samples, append([]float64(nil), values...))
+		}
+		return len(samples) < cap(samples)
+	})
+	if err != nil || len(samples) == 0 {
+		return err
+	}
+
+	pq := trainPQ(samples, s.config.PQSubspaces, s.config.PQCentroids, rand.New(rand.NewSource(1)))
+	err = s.eachValues(ctx, ids, func(id string, values []float64) bool {
+		if len(values) == dim {
+			pq.add(id, values)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for id := range s.pqPending {
+		pq.remove(id)
+		if vector, ok := s.vectors[id]; ok {
+			if values := s.values(vector); len(values) == dim {
+				pq.add(id, values)
+			}
+		}
+	}
+	s.pq = pq
+	// Drop the full-precision values of the encoded vectors
+	for id := range pq.codes {
+		cached := *s.vectors[id]
+		cached.Vector = nil
+		s.vectors[id] = &cached
+		delete(s.values32, id)
+		delete(s.sparse, id)
+	}
+	encoded := len(pq.codes)
+	s.mu.Unlock()
+
+	s.log(ctx).WithFields(logrus.Fields{
+		"vectors":   encoded,
+		"dimension": dim,
+		"subspaces": len(pq.codebooks),
+		"duration":  time.Since(start).String(),
+	}).Info("Trained product quantizer")
+	return nil
+}
+
+// commonDimension returns the dimension most vectors share, the larger one
+// on ties. Finding it reads every embedding, from disk under PQ, so it's
+// kept until the next write. The caller must hold s.mu.
+func (s *boltStore) commonDimension() int {
+	writes := s.writes.Load()
+	s.dimMu.Lock()
+	defer s.dimMu.Unlock()
+	if s.dimWrites == writes {
+		return s.dim
+	}
+
+	dims := make(map[int]int)
+	for _, vector := range s.vectors {
+		dims[len(s.values(vector))]++
+	}
+	dim, best := 0, 0
+	for d, n := range dims {
+		if n > best || (n == best && d > dim) {
+			dim, best = d, n
+		}
+	}
+	s.dim, s.dimWrites = dim, writes
+	return dim
+}
+
+// rescore keeps the n best results by approximate score and replaces their
+// scores with exact ones computed from the persisted vectors.
+func (s *boltStore) rescore(query []float64, results []models.SearchResult, n int) []models.SearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > n {
+		results = results[:n]
+	}
+
+	exact := results[:0]
+	s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("vectors"))
+		for _, result := range results {
+			if _, coded := s.pq.codes[result.Vector.ID]; !coded {
+				exact = append(exact, result)
+				continue
+			}
+
+			var stored models.Vector
+			if err := json.Unmarshal(bucket.Get([]byte(result.Vector.ID)), &stored); err != nil {
+				continue
+			}
+			score, err := s.zeroMagnitude(cosineSimilarity(query, stored.Vector))
+			if err != nil {
+				continue
+			}
+			result.Score = score
+			exact = append(exact, result)
+		}
+		return nil
+	})
+
+	return exact
+}
+
+// loadValues reads the embedding of a vector from disk.
+func (s *boltStore) loadValues(id string) []float64 {
+	var stored models.Vector
+	err := s.view(func(tx *bbolt.Tx) error {
+		return json.Unmarshal(tx.Bucket([]byte("vectors")).Get([]byte(id)), &stored)
+	})
+	if err != nil {
+		return nil
+	}
+	return stored.Vector
+}
+
+// pqScorer approximates the cosine similarity between query and coded
+// vectors. Vectors without a code are scored exactly.
+func (s *boltStore) pqScorer(query []float64) func(vector *models.Vector) (float64, error) {
+	table := s.pq.table(query)
+	var norm float64
+	for _, v := range query {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	return func(vector *models.Vector) (float64, error) {
+		code, ok := s.pq.codes[vector.ID]
+		if !ok {
+			return cosineSimilarity(query, s.values(vector))
+		}
+		if norm == 0 || s.pq.norms[vector.ID] == 0 {
+			return 0, errZeroMagnitude
+		}
+		return float64(s.pq.approxDot(table, code)) / (norm * float64(s.pq.norms[vector.ID])), nil
+	}
+}
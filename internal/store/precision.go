@@ -0,0 +1,208 @@
+package store
+
+import (
+	"fmt"
+	"math"
+
+	"vectraDB/internal/models"
+)
+
+const (
+	PrecisionFloat64 = "float64"
+	PrecisionFloat32 = "float32"
+)
+
+// In float32 precision the cached models.Vector carries no values; they are
+// kept in s.values32 instead, halving the memory used by embeddings. Sparse
+// vectors are kept in s.sparse. With product quantization only the codes
+// are kept and values are read from disk when needed, through the value
+// cache when PQCacheSize is set.
+//
+// Vectors are always persisted and returned as float64, so code reading
+// cached vectors must go through values, materialize and scorer rather than
+// using the Vector field directly.
+
+// cacheVector returns the representation of vector to keep in memory. The
+// caller must hold s.mu.
+func (s *boltStore) cacheVector(vector *models.Vector) *models.Vector {
+	if s.valueCache != nil {
+		s.valueCache.remove(vector.ID)
+	}
+	if s.ann != nil {
+		s.ann.add(vector.ID, vector.Vector)
+	}
+	if s.annPending != nil {
+		s.annPending[vector.ID] = true
+	}
+	if s.pqPending != nil {
+		s.pqPending[vector.ID] = true
+	}
+	if s.pq != nil && len(vector.Vector) == s.pq.dim {
+		s.pq.add(vector.ID, vector.Vector)
+		delete(s.values32, vector.ID)
+		delete(s.sparse, vector.ID)
+		cached := *vector
+		cached.Vector = nil
+		return &cached
+	}
+	if s.pq != nil {
+		s.pq.remove(vector.ID)
+	}
+
+	if sparse := s.sparsify(vector.Vector); sparse != nil {
+		s.sparse[vector.ID] = sparse
+		delete(s.values32, vector.ID)
+		cached := *vector
+		cached.Vector = nil
+		return &cached
+	}
+	delete(s.sparse, vector.ID)
+
+	if s.config.Precision != PrecisionFloat32 || vector.Vector == nil {
+		delete(s.values32, vector.ID)
+		return vector
+	}
+
+	s.values32[vector.ID] = toFloat32(vector.Vector)
+	cached := *vector
+	cached.Vector = nil
+	return &cached
+}
+
+// uncacheVector drops the values kept for id. The caller must hold s.mu.
+func (s *boltStore) uncacheVector(id string) {
+	if s.valueCache != nil {
+		s.valueCache.remove(id)
+	}
+	delete(s.values32, id)
+	delete(s.sparse, id)
+	if s.pq != nil {
+		s.pq.remove(id)
+	}
+	if s.ann != nil {
+		s.ann.remove(id)
+	}
+	if s.annPending != nil {
+		s.annPending[id] = true
+	}
+	if s.pqPending != nil {
+		s.pqPending[id] = true
+	}
+}
+
+// values returns the embedding of a cached vector as float64.
+func (s *boltStore) values(vector *models.Vector) []float64 {
+	if vector.Vector != nil {
+		return vector.Vector
+	}
+	if values, ok := s.values32[vector.ID]; ok {
+		return toFloat64(values)
+	}
+	if sparse, ok := s.sparse[vector.ID]; ok {
+		return sparse.dense()
+	}
+	if s.pq != nil {
+		if _, ok := s.pq.codes[vector.ID]; ok {
+			return s.readValues(vector.ID)
+		}
+	}
+	return nil
+}
+
+// materialize returns a cached vector with its embedding filled in, suitable
+// for returning to callers or persisting.
+func (s *boltStore) materialize(vector *models.Vector) *models.Vector {
+	if vector.Vector != nil {
+		return vector
+	}
+	values := s.values(vector)
+	if values == nil {
+		return vector
+	}
+
+	full := *vector
+	full.Vector = values
+	return &full
+}
+
+// scorer returns a function computing the cosine similarity between query
+// and cached vectors in the configured precision.
+func (s *boltStore) scorer(query []float64) func(vector *models.Vector) (float64, error) {
+	score := s.rawScorer(query)
+	return func(vector *models.Vector) (float64, error) {
+		return s.zeroMagnitude(score(vector))
+	}
+}
+
+func (s *boltStore) rawScorer(query []float64) func(vector *models.Vector) (float64, error) {
+	if s.pq != nil && len(query) == s.pq.dim {
+		return s.pqScorer(query)
+	}
+
+	score := s.denseScorer(query)
+	if len(s.sparse) == 0 {
+		return score
+	}
+
+	var sumSquares float64
+	for _, v := range query {
+		sumSquares += v * v
+	}
+	return func(vector *models.Vector) (float64, error) {
+		if sparse, ok := s.sparse[vector.ID]; ok {
+			return sparse.cosine(query, sumSquares)
+		}
+		return score(vector)
+	}
+}
+
+func (s *boltStore) denseScorer(query []float64) func(vector *models.Vector) (float64, error) {
+	if s.config.Precision != PrecisionFloat32 {
+		return func(vector *models.Vector) (float64, error) {
+			return cosineSimilarity(query, vector.Vector)
+		}
+	}
+
+	query32 := toFloat32(query)
+	return func(vector *models.Vector) (float64, error) {
+		if values, ok := s.values32[vector.ID]; ok {
+			return cosineSimilarity32(query32, values)
+		}
+		return cosineSimilarity(query, vector.Vector)
+	}
+}
+
+func cosineSimilarity32(a, b []float32) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("vectors must have the same length")
+	}
+
+	var dot, magA, magB float32
+	for i := range a {
+		dot += a[i] * b[i]
+		magA += a[i] * a[i]
+		magB += b[i] * b[i]
+	}
+
+	if magA == 0 || magB == 0 {
+		return 0, errZeroMagnitude
+	}
+
+	return float64(dot) / (math.Sqrt(float64(magA)) * math.Sqrt(float64(magB))), nil
+}
+
+func toFloat32(values []float64) []float32 {
+	out := make([]float32, len(values))
+	for i, v := range values {
+		out[i] = float32(v)
+	}
+	return out
+}
+
+func toFloat64(values []float32) []float64 {
+	out := make([]float64, len(values))
+	for i, v := range values {
+		out[i] = float64(v)
+	}
+	return out
+}
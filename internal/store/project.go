@@ -0,0 +1,310 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+const (
+	defaultProjectDimensions = 2
+	// maxCachedProjections bounds the cache of fitted projections, which is
+	// keyed by filter
+	maxCachedProjections = 16
+	// projectSampleSize bounds the number of vectors a projection is
+	// fitted on
+	projectSampleSize = 2000
+	// refitRatio is the share of the fitted set that must be written to
+	// before a cached projection is refitted
+	refitRatio = 0.1
+	// Power iteration stops after maxIterations or once successive
+	// components differ by less than convergence
+	maxIterations = 200
+	convergence   = 1e-12
+)
+
+// projection is a fitted PCA: vectors are projected by centering them on
+// mean and taking their dot product with each component.
+type projection struct {
+	mean       []float64
+	components [][]float64
+	explained  []float64
+	// size and writes are the number of vectors fitted and the store's
+	// write count at the time, used to decide when to refit
+	size   int
+	writes int64
+}
+
+func (p *projection) project(values []float64) []float64 {
+	coordinates := make([]float64, len(p.components))
+	for j, component := range p.components {
+		for i, value := range values {
+			coordinates[j] += (value - p.mean[i]) * component[i]
+		}
+	}
+	return coordinates
+}
+
+// stale reports whether enough vectors were written since the projection
+// was fitted that it should be refitted.
+func (p *projection) stale(writes int64) bool {
+	return float64(writes-p.writes) > refitRatio*float64(p.size)
+}
+
+// ProjectVectors returns the coordinates of the vectors matching the filter
+// along their principal components. The fitted projection is cached per
+// filter and dimension count and reused until a significant share of the
+// vectors has been written. It's fitted on a sample of at most
+// projectSampleSize vectors with no lock held, and the vectors are read
+// and projected in batches, so a large set doesn't hold up writes.
+func (s *boltStore) ProjectVectors(ctx context.Context, req *models.ProjectRequest) (*models.ProjectResponse, error) {
+	if req.Dimensions <= 0 {
+		req.Dimensions = defaultProjectDimensions
+	}
+
+	s.mu.RLock()
+	vectors := s.filterVectors(req.Filter)
+	writes := s.writes.Load()
+	s.mu.RUnlock()
+	ids := make([]string, len(vectors))
+	for i, vector := range vectors {
+		ids[i] = vector.ID
+	}
+	sort.Strings(ids)
+
+	result := &models.ProjectResponse{
+		Dimensions: req.Dimensions,
+		Points:     make([]models.ProjectedVector, 0, len(ids)),
+	}
+
+	// The first vector still stored sets the dimension of the set
+	first, dim := "", 0
+	err := s.eachValues(ctx, ids, func(id string, values []float64) bool {
+		first, dim = id, len(values)
+		return false
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to read vectors")
+	}
+	if first == "" {
+		return result, nil
+	}
+	if req.Dimensions > dim {
+		return nil, errors.New(http.StatusBadRequest, "invalid input").
+			WithDetails(fmt.Sprintf("cannot project %d-dimensional vectors to %d dimensions", dim, req.Dimensions))
+	}
+	mismatch := func(id string) error {
+		return errors.New(http.StatusBadRequest, "invalid vector dimension").
+			WithDetails(fmt.Sprintf("vectors %s and %s have different dimensions, filter the set to one dimension", first, id))
+	}
+
+	key := projectionKey(req.Filter, req.Dimensions)
+	s.projMu.Lock()
+	p, ok := s.projections[key]
+	s.projMu.Unlock()
+	if ok && (p.stale(writes) || len(p.mean) != dim) {
+		ok = false
+	}
+	if !ok {
+		var (
+			samples [][]float64
+			invalid string
+		)
+		err := s.eachValues(ctx, sampleOrder(ids), func(id string, values []float64) bool {
+			if len(values) != dim {
+				invalid = id
+				return false
+			}
+			samples = append(samples, append([]float64(nil), values...))
+			return len(samples) < projectSampleSize
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to read vectors")
+		}
+		if invalid != "" {
+			return nil, mismatch(invalid)
+		}
+
+		p = fitProjection(samples, req.Dimensions)
+		p.size, p.writes = len(ids), writes
+		s.projMu.Lock()
+		if len(s.projections) >= maxCachedProjections {
+			s.projections = make(map[string]*projection)
+		}
+		s.projections[key] = p
+		s.projMu.Unlock()
+	}
+
+	var invalid string
+	err = s.eachValues(ctx, ids, func(id string, values []float64) bool {
+		if len(values) != dim {
+			invalid = id
+			return false
+		}
+		result.Points = append(result.Points, models.ProjectedVector{
+			ID:          id,
+			Coordinates: p.project(values),
+		})
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to read vectors")
+	}
+	if invalid != "" {
+		return nil, mismatch(invalid)
+	}
+
+	result.Cached = ok
+	result.ExplainedVariance = p.explained
+	return result, nil
+}
+
+func projectionKey(filter models.Metadata, dimensions int) string {
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d", dimensions)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "\x00%s\x00%s", key, filter[key])
+	}
+	return b.String()
+}
+
+// fitProjection computes the top principal components of values by power
+// iteration on their covariance, deflating each component found from the
+// next. The covariance is applied as Xᵀ(Xv) so it is never materialized.
+func fitProjection(values [][]float64, dimensions int) *projection {
+	n, dim := len(values), len(values[0])
+
+	mean := make([]float64, dim)
+	for _, v := range values {
+		for i, value := range v {
+			mean[i] += value / float64(n)
+		}
+	}
+	centered := make([][]float64, n)
+	total := 0.0
+	for k, v := range values {
+		centered[k] = make([]float64, dim)
+		for i, value := range v {
+			centered[k][i] = value - mean[i]
+			total += centered[k][i] * centered[k][i]
+		}
+	}
+
+	p := &projection{
+		mean:       mean,
+		components: make([][]float64, 0, dimensions),
+		explained:  make([]float64, 0, dimensions),
+		size:       n,
+	}
+	rng := rand.New(rand.NewSource(1))
+	for len(p.components) < dimensions {
+		component := make([]float64, dim)
+		for i := range component {
+			component[i] = rng.Float64() - 0.5
+		}
+		orthogonalize(component, p.components)
+		normalize(component)
+
+		variance := 0.0
+		for iter := 0; iter < maxIterations; iter++ {
+			next := make([]float64, dim)
+			for _, x := range centered {
+				dot := 0.0
+				for i := range x {
+					dot += x[i] * component[i]
+				}
+				for i := range x {
+					next[i] += dot * x[i]
+				}
+			}
+			orthogonalize(next, p.components)
+			variance = normalize(next)
+			if variance == 0 {
+				// The data has no variance left, any orthogonal
+				// direction projects to 0
+				break
+			}
+
+			delta := 0.0
+			for i := range next {
+				delta += (next[i] - component[i]) * (next[i] - component[i])
+			}
+			component = next
+			if delta < convergence {
+				break
+			}
+		}
+
+		signComponent(component)
+		p.components = append(p.components, component)
+		if total > 0 {
+			p.explained = append(p.explained, variance/total)
+		} else {
+			p.explained = append(p.explained, 0)
+		}
+	}
+	return p
+}
+
+// orthogonalize removes the projections of v onto each of the orthonormal
+// basis vectors.
+func orthogonalize(v []float64, basis [][]float64) {
+	for _, b := range basis {
+		dot := 0.0
+		for i := range v {
+			dot += v[i] * b[i]
+		}
+		for i := range v {
+			v[i] -= dot * b[i]
+		}
+	}
+}
+
+// normalize scales v to unit length in place and returns its former length.
+// Vectors too short to normalize are zeroed.
+func normalize(v []float64) float64 {
+	norm := 0.0
+	for _, value := range v {
+		norm += value * value
+	}
+	norm = math.Sqrt(norm)
+	if norm < 1e-12 {
+		for i := range v {
+			v[i] = 0
+		}
+		return 0
+	}
+	for i := range v {
+		v[i] /= norm
+	}
+	return norm
+}
+
+// signComponent flips v so its largest element is positive, making the
+// direction of each component deterministic.
+func signComponent(v []float64) {
+	largest := 0
+	for i := range v {
+		if math.Abs(v[i]) > math.Abs(v[largest]) {
+			largest = i
+		}
+	}
+	if v[largest] < 0 {
+		for i := range v {
+			v[i] = -v[i]
+		}
+	}
+}
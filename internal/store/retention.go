@@ -0,0 +1,136 @@
+package store
+
+import (
+	"container/heap"
+	"encoding/json"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+)
+
+// Documents past their ExpiresAt are hidden from reads right away and
+// deleted by the janitor, which every Config.DocumentSweepInterval pops
+// the expiries due from s.expiries until the store is closed. Runs with
+// nothing due don't touch the database.
+
+// expiry is an entry of s.expiries.
+type expiry struct {
+	id        string
+	expiresAt time.Time
+}
+
+// expiryHeap orders document expiries, earliest first.
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// trackExpiry records the expiry of doc for the janitor, rebuilding the
+// heap once superseded expiries make up most of it. The caller must hold
+// s.docMu.
+func (s *boltStore) trackExpiry(doc *models.Document) {
+	if doc.ExpiresAt == nil {
+		delete(s.docExpiry, doc.ID)
+		return
+	}
+	if expiresAt, ok := s.docExpiry[doc.ID]; ok && expiresAt.Equal(*doc.ExpiresAt) {
+		return
+	}
+	s.docExpiry[doc.ID] = *doc.ExpiresAt
+	heap.Push(&s.expiries, expiry{id: doc.ID, expiresAt: *doc.ExpiresAt})
+
+	if len(s.expiries) > 2*len(s.docExpiry)+64 {
+		s.expiries = make(expiryHeap, 0, len(s.docExpiry))
+		for id, expiresAt := range s.docExpiry {
+			s.expiries = append(s.expiries, expiry{id: id, expiresAt: expiresAt})
+		}
+		heap.Init(&s.expiries)
+	}
+}
+
+// runJanitor purges expired documents every interval until s.done is
+// closed.
+func (s *boltStore) runJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if _, err := s.purgeExpiredDocuments(time.Now()); err != nil {
+				logger.WithError(err).Error("Failed to purge expired documents")
+			}
+		}
+	}
+}
+
+// purgeExpiredDocuments deletes the documents expired at now and returns how
+// many were deleted.
+func (s *boltStore) purgeExpiredDocuments(now time.Time) (int, error) {
+	s.docMu.Lock()
+	defer s.docMu.Unlock()
+
+	// Pop the expiries due, skipping those superseded since they were pushed
+	var due []expiry
+	for len(s.expiries) > 0 && !now.Before(s.expiries[0].expiresAt) {
+		e := heap.Pop(&s.expiries).(expiry)
+		if expiresAt, ok := s.docExpiry[e.id]; ok && expiresAt.Equal(e.expiresAt) {
+			due = append(due, e)
+		}
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	var expired []*models.Document
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("documents"))
+		if bucket == nil {
+			return nil
+		}
+
+		for _, e := range due {
+			var doc models.Document
+			if err := json.Unmarshal(bucket.Get([]byte(e.id)), &doc); err != nil || !doc.Expired(now) {
+				continue // Skip invalid documents
+			}
+			if err := bucket.Delete([]byte(e.id)); err != nil {
+				return err
+			}
+			expired = append(expired, &doc)
+		}
+		return nil
+	})
+	if err != nil {
+		// Retry on the next run
+		for _, e := range due {
+			heap.Push(&s.expiries, e)
+		}
+		return 0, err
+	}
+
+	for _, doc := range expired {
+		s.unindexDocument(doc)
+	}
+	s.docCount.Add(-int64(len(expired)))
+
+	if len(expired) > 0 {
+		logger.WithFields(logrus.Fields{
+			"documents": len(expired),
+		}).Info("Purged expired documents")
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"math/rand"
+)
+
+// valuesBatchSize is the number of vectors whose embeddings eachValues
+// reads per hold of the read lock
+const valuesBatchSize = 1024
+
+// sampleOrder returns a reproducible random permutation of ids, which
+// must be sorted, for sampling its first elements.
+func sampleOrder(ids []string) []string {
+	order := make([]string, len(ids))
+	copy(order, ids)
+	rng := rand.New(rand.NewSource(1))
+	rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	return order
+}
+
+// eachValues calls fn with the embedding of each vector of ids still
+// stored, in order, until it returns false. The embeddings are read in
+// batches, each under the read lock, so training an index over a large
+// store holds up writes only for short stretches, and fn is called with
+// the lock held. The caller must not hold s.mu.
+func (s *boltStore) eachValues(ctx context.Context, ids []string, fn func(id string, values []float64) bool) error {
+	for start := 0; start < len(ids); start += valuesBatchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		more := true
+		s.mu.RLock()
+		for _, id := range ids[start:min(start+valuesBatchSize, len(ids))] {
+			if vector, ok := s.vectors[id]; ok {
+				if more = fn(id, s.values(vector)); !more {
+					break
+				}
+			}
+		}
+		s.mu.RUnlock()
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
@@ -4,20 +4,60 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"math/rand"
+	"net/http"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"vectraDB/internal/models"
 	"vectraDB/pkg/errors"
 )
 
 func (s *boltStore) SearchVectors(ctx context.Context, req *models.SearchRequest) (*models.SearchResponse, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	collection := s.scopeToCollection(req)
+	response, poorRecall, err := s.searchVectors(ctx, req, false)
+	if !poorRecall {
+		s.finishSearch(response, collection)
+		return response, err
+	}
+	s.log(ctx).WithFields(logrus.Fields{
+		"top_k":     req.TopK,
+		"index":     s.indexName(),
+		"min_score": s.config.IndexFallbackMinScore,
+	}).Debug("Index search recalled too little, falling back to exact search")
+	response, _, err = s.searchVectors(ctx, req, true)
+	s.finishSearch(response, collection)
+	return response, err
+}
 
+// finishSearch sets the collection searched on a search response and
+// counts a retrieval of each of its results.
+func (s *boltStore) finishSearch(response *models.SearchResponse, collection string) {
+	if response == nil {
+		return
+	}
+	response.Collection = collection
+	if !s.config.AccessStats {
+		return
+	}
+	ids := make([]string, len(response.Results))
+	for i, result := range response.Results {
+		ids[i] = result.Vector.ID
+	}
+	s.recordAccess(ids...)
+}
+
+// searchVectors runs a vector search, scoring every candidate when exact is
+// set. An index search recalling fewer results than asked for, or results
+// scoring below Config.IndexFallbackMinScore, returns poorRecall instead of
+// a response when Config.IndexFallback is set.
+func (s *boltStore) searchVectors(ctx context.Context, req *models.SearchRequest, exact bool) (*models.SearchResponse, bool, error) {
 	// Validate request
 	if len(req.Query) == 0 {
-		return nil, errors.ErrEmptyQuery
+		return nil, false, errors.ErrEmptyQuery
 	}
 
 	// Set defaults
@@ -30,72 +70,453 @@ func (s *boltStore) SearchVectors(ctx context.Context, req *models.SearchRequest
 	if req.Page <= 0 {
 		req.Page = 1
 	}
+	if req.Metric == "" {
+		req.Metric = models.MetricCosine
+	}
+	if req.ScoreNormalization == "" {
+		req.ScoreNormalization = defaultNormalization(req.Metric)
+	}
+	if req.ScoreNormalization == models.NormalizationRank && (req.MinScore != nil || req.GapCutoff != nil) {
+		return nil, false, errors.New(http.StatusBadRequest, "invalid input").WithDetails("min_score and gap_cutoff can't be combined with rank normalization")
+	}
+	if err := s.validatePooling(req); err != nil {
+		return nil, false, err
+	}
+	if req.OnDimensionMismatch == "" {
+		req.OnDimensionMismatch = s.config.OnDimensionMismatch
+	}
+	if req.Radius != nil && req.Metric != models.MetricCosine {
+		return nil, false, errors.New(http.StatusBadRequest, "invalid input").WithDetails("radius requires the cosine metric")
+	}
+	if hasNegatives(req) && req.NegativeWeight == 0 {
+		req.NegativeWeight = s.config.NegativeWeight
+	}
+	if req.GapCutoff != nil {
+		if req.Radius != nil {
+			return nil, false, errors.New(http.StatusBadRequest, "invalid input").WithDetails("gap_cutoff and radius can't be combined")
+		}
+		if req.MinK <= 0 {
+			req.MinK = 1
+		}
+		if req.MaxK <= 0 {
+			req.MaxK = req.TopK
+		}
+		if req.MinK > req.MaxK {
+			return nil, false, errors.New(http.StatusBadRequest, "invalid input").WithDetails("min_k can't exceed max_k")
+		}
+	}
+
+	if req.PopularityBoost > 0 && !s.config.AccessStats {
+		return nil, false, errors.New(http.StatusBadRequest, "invalid input").WithDetails("popularity_boost needs access stats to be enabled")
+	}
+
+	halfLife := defaultHalfLife
+	if req.HalfLife != "" {
+		var err error
+		if halfLife, err = time.ParseDuration(req.HalfLife); err != nil || halfLife <= 0 {
+			return nil, false, errors.New(http.StatusBadRequest, "invalid input").WithDetails("half_life must be a positive duration")
+		}
+	}
+
+	weights := map[string]float64{
+		"vector":  1 - req.RecencyWeight,
+		"recency": req.RecencyWeight,
+	}
+	if hasNegatives(req) {
+		weights["negative"] = req.NegativeWeight
+	}
+	if req.PopularityBoost > 0 {
+		weights["popularity"] = req.PopularityBoost
+	}
+
+	// Document tags and retrieval counts change without vector writes, so
+	// searches filtering on tags or boosted by popularity aren't cached
+	var cacheKey string
+	writes := s.writes.Load()
+	if s.config.SearchCacheSize > 0 && len(req.DocumentTagFilter) == 0 && req.PopularityBoost == 0 {
+		cacheKey = searchCacheKey(req)
+		if cached := s.cachedSearchResponse(cacheKey); cached != nil {
+			return cached, false, nil
+		}
+	}
+
+	var profile *models.SearchProfile
+	phaseStart := time.Now()
+	if req.Profile {
+		profile = &models.SearchProfile{}
+	}
 
 	// Filter vectors based on metadata
+	s.mu.RLock()
+	if fitted := s.fitQueryDimension(ctx, req.Query, req.OnDimensionMismatch); len(fitted) != len(req.Query) {
+		req.Query = fitted
+	}
+	// Normalized once fitted, as padding and truncation change its length
+	if req.NormalizeQuery {
+		req.Query = unit(req.Query)
+	}
+	var cluster *models.QueryCluster
+	if req.ReturnCluster {
+		cluster = s.queryCluster(req.Query)
+	}
 	candidates := s.filterVectors(req.Filter)
+	if len(req.DocumentTagFilter) > 0 {
+		candidates = s.filterByDocumentTags(candidates, req.DocumentTagFilter)
+	}
+	if profile != nil {
+		profile.Vectors = len(s.vectors)
+		profile.Matched = len(candidates)
+	}
 	if len(candidates) == 0 {
+		reason := models.ReasonNoFilterMatch
+		if len(s.vectors) == 0 {
+			reason = models.ReasonEmptyStore
+		}
+		s.mu.RUnlock()
+		if profile != nil {
+			profile.Filter = time.Since(phaseStart)
+		}
 		return &models.SearchResponse{
 			Total:   0,
 			Page:    req.Page,
 			Limit:   req.Limit,
 			Results: []models.SearchResult{},
-		}, nil
+			Reason:  reason,
+			Weights: weights,
+			Metric:  req.Metric,
+			Cluster: cluster,
+			Profile: profile,
+
+			ScoreNormalization: req.ScoreNormalization,
+		}, false, nil
 	}
 
-	// Calculate similarity scores
-	results := make([]models.SearchResult, 0, len(candidates))
-	for _, vector := range candidates {
-		score, err := cosineSimilarity(req.Query, vector.Vector)
-		if err != nil {
-			continue // Skip invalid vectors
+	// A radius search returns every match within the radius, up to the cap
+	keep := req.TopK
+	if req.Radius != nil {
+		keep = s.config.MaxRadiusResults
+	}
+	if req.GapCutoff != nil {
+		keep = req.MaxK
+	}
+
+	// Past the auto index threshold only the candidates the index finds
+	// near the query are scored, filters matching none of them fall back to
+	// scoring every match
+	approximate, indexed := false, false
+	matched := len(candidates)
+	if s.ann != nil && !exact && len(req.Query) == s.ann.dimension() && req.Metric == models.MetricCosine && !multiVector(req) {
+		if restricted := s.ann.restrict(candidates, req.Query, keep); len(restricted) > 0 {
+			candidates = restricted
+			approximate, indexed = true, true
 		}
+	}
+	if s.config.MaxCandidates > 0 && len(candidates) > s.config.MaxCandidates {
+		candidates = sampleCandidates(candidates, s.config.MaxCandidates)
+		approximate = true
+	}
 
-		results = append(results, models.SearchResult{
-			Vector: *vector,
-			Score:  score,
-		})
+	if profile != nil {
+		profile.Candidates = len(candidates)
+		profile.Filter = time.Since(phaseStart)
+		phaseStart = time.Now()
 	}
 
-	// Sort by score (descending)
+	// Calculate similarity scores on a snapshot, without holding the lock
+	snapshot, release := s.snapshot(candidates)
+	defer release()
+	scoreValues := s.valuesScorer(req.Query, req.Metric)
+	scoreCandidate := multiVectorScorer(req, s.snapshotScorer(req.Query, req.Metric), scoreValues,
+		func(c *candidate) *models.Vector { return c.vector })
+	s.mu.RUnlock()
+
+	scoredCandidates, expired := s.scoreSnapshot(snapshot, scoreCandidate)
+	if expired {
+		approximate = true
+		s.log(ctx).WithFields(logrus.Fields{
+			"candidates": len(snapshot),
+			"scored":     len(scoredCandidates),
+			"max_age":    s.config.SnapshotMaxAge.String(),
+		}).Warn("Search snapshot expired before every candidate was scored")
+	}
+	scored := len(scoredCandidates)
+	if profile != nil {
+		profile.Score = time.Since(phaseStart)
+		phaseStart = time.Now()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	score := multiVectorScorer(req, s.metricScorer(req.Query, req.Metric), scoreValues,
+		func(vector *models.Vector) *models.Vector { return vector })
+	penalty, err := s.negativeScorer(req)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	results := s.revalidate(scoredCandidates, score)
+	scoredCandidates = nil
+	release()
+
+	// Quantized scores are approximate, rescore the best candidates exactly.
+	// Percentiles are still taken among every candidate, those left out
+	// with their quantized scores
+	var unrescored []models.SearchResult
+	if s.pq != nil && req.Metric == models.MetricCosine && !multiVector(req) {
+		rescore := s.config.PQRescore
+		if rescore < keep {
+			rescore = keep
+		}
+		if req.ReturnPercentile && len(results) > rescore {
+			sort.Slice(results, func(i, j int) bool {
+				return results[i].Score > results[j].Score
+			})
+			unrescored = slices.Clone(results[rescore:])
+		}
+		results = s.rescore(req.Query, results, rescore)
+	}
+	// Candidates the index found, before thresholds, collapsing and the
+	// gap cutoff drop any, which tells the fallback how well it recalled
+	found := len(results)
+
+	var popularity map[string]float64
+	if req.PopularityBoost > 0 {
+		ids := make([]string, 0, len(results)+len(unrescored))
+		for _, result := range slices.Concat(results, unrescored) {
+			ids = append(ids, result.Vector.ID)
+		}
+		popularity = s.popularityScores(ids)
+	}
+
+	var candidateScores []float64
+	if req.ReturnPercentile {
+		candidateScores = make([]float64, 0, len(results)+len(unrescored))
+	}
+
+	// adjust applies the negative penalty, recency, boost and popularity to
+	// the similarity of a result
+	adjust := func(result *models.SearchResult, popularity float64) {
+		if penalty != nil {
+			result.Score -= penalty(&result.Vector)
+		}
+		if req.RecencyWeight > 0 {
+			result.Score = (1-req.RecencyWeight)*result.Score + req.RecencyWeight*recencyDecay(result.Vector.CreatedAt, now, halfLife)
+		}
+		result.Score *= result.Vector.BoostFactor()
+		result.Score *= 1 + req.PopularityBoost*popularity
+	}
+
+	// Thresholds apply to the scores as returned, the radius to the raw
+	// cosine distance
+	returned := returnedScore(req.ScoreNormalization, req.Metric)
+	filtered := results[:0]
+	for _, result := range results {
+		if req.Radius != nil && 1-result.Score > *req.Radius {
+			continue
+		}
+		adjust(&result, popularity[result.Vector.ID])
+		if candidateScores != nil {
+			candidateScores = append(candidateScores, result.Score)
+		}
+		if req.MinScore != nil && returned(result.Score) < *req.MinScore {
+			continue
+		}
+		filtered = append(filtered, result)
+	}
+	results = filtered
+	for _, result := range unrescored {
+		if req.Radius != nil && 1-result.Score > *req.Radius {
+			continue
+		}
+		adjust(&result, popularity[result.Vector.ID])
+		candidateScores = append(candidateScores, result.Score)
+	}
+
+	var reason string
+	if len(results) == 0 {
+		reason = models.ReasonBelowThreshold
+		if scored == 0 {
+			reason = models.ReasonDimensionMismatch
+		}
+	}
+
+	// Sort by score (descending), then ID so ties rank the same every time
 	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score > results[j].Score
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Vector.ID < results[j].Vector.ID
 	})
+	if candidateScores != nil {
+		sort.Float64s(candidateScores)
+		setPercentiles(results, candidateScores)
+	}
+
+	collapsed := 0
+	if req.CollapseBy != "" {
+		results, collapsed = collapseBy(results, s.normalizeKey(req.CollapseBy))
+	}
+
+	var groups map[string][]models.SearchResult
+	groupsCapped := false
+	if req.GroupBy != "" {
+		groups, groupsCapped = groupBy(results, s.normalizeKey(req.GroupBy), req.GroupSize, s.config.MaxSearchGroups)
+	}
 
 	// Apply top-k limit
-	if len(results) > req.TopK {
-		results = results[:req.TopK]
+	capped := false
+	if len(results) > keep {
+		results = results[:keep]
+		capped = req.Radius != nil
+	}
+	gapCut := false
+	if req.GapCutoff != nil {
+		if cut := gapCutoff(results, returned, *req.GapCutoff, req.MinK); cut < len(results) {
+			results = results[:cut]
+			gapCut = true
+		}
+	}
+
+	// The index recalled too little when it found fewer candidates than
+	// asked for out of those matching the filter. A radius search has no
+	// number of results to recall
+	if indexed && s.config.IndexFallback {
+		wanted := req.TopK
+		if req.GapCutoff != nil {
+			wanted = req.MinK
+		}
+		if req.Radius != nil {
+			wanted = 0
+		}
+		if found < min(wanted, matched) || (len(results) > 0 && results[len(results)-1].Score < s.config.IndexFallbackMinScore) {
+			return nil, true, nil
+		}
 	}
 
 	// Apply pagination
 	total := len(results)
-	start := (req.Page - 1) * req.Limit
-	end := start + req.Limit
-	if start >= total {
-		results = []models.SearchResult{}
-	} else {
-		if end > total {
-			end = total
+	start := min(pageStart(req.Page, req.Limit, req.Offset), total)
+	end := min(start+req.Limit, total)
+	if start == total && total > 0 {
+		reason = models.ReasonPageOutOfRange
+	}
+
+	// Related vectors are expanded from the results of the page and go
+	// through the same filters and thresholds as direct matches. They
+	// follow the page's results and don't count towards the total
+	var expanded []models.SearchResult
+	if req.ExpandRelated {
+		limit := req.ExpandLimit
+		if limit <= 0 {
+			limit = defaultExpandLimit
+		}
+		filter := s.normalizeFilter(req.Filter)
+		eligible := func(vector *models.Vector) bool {
+			if !s.inFilter(vector.ID, filter) {
+				return false
+			}
+			return len(req.DocumentTagFilter) == 0 || len(s.filterByDocumentTags([]*models.Vector{vector}, req.DocumentTagFilter)) == 1
+		}
+		expanded = s.expandRelated(results[start:end], eligible, func(vector *models.Vector) (models.SearchResult, bool) {
+			similarity, err := score(vector)
+			if err != nil || (req.Radius != nil && 1-similarity > *req.Radius) {
+				return models.SearchResult{}, false
+			}
+			result := models.SearchResult{Vector: *vector, Score: similarity}
+			boost := 0.0
+			if req.PopularityBoost > 0 {
+				boost = s.popularityScores([]string{vector.ID})[vector.ID]
+			}
+			adjust(&result, boost)
+			return result, req.MinScore == nil || returned(result.Score) >= *req.MinScore
+		}, limit)
+		if candidateScores != nil {
+			setPercentiles(expanded, candidateScores)
 		}
-		results = results[start:end]
 	}
 
-	return &models.SearchResponse{
-		Total:   total,
-		Page:    req.Page,
-		Limit:   req.Limit,
-		Results: results,
-	}, nil
+	// Ranking, calibration and the radius above apply to the raw scores.
+	// Expanded results are normalized along with the ranked ones, so rank
+	// normalization places them among all of them
+	ranked := append(results[:len(results):len(results)], expanded...)
+	s.calibrate(ranked)
+	normalizeSearchScores(ranked, req.ScoreNormalization, req.Metric)
+	for _, group := range groups {
+		s.calibrate(group)
+		normalizeSearchScores(group, req.ScoreNormalization, req.Metric)
+	}
+
+	// Fill in embeddings kept in reduced precision
+	page := append(ranked[start:end:end], ranked[len(results):]...)
+	for i := range page {
+		page[i].Vector = *s.materialize(&page[i].Vector)
+	}
+	for _, group := range groups {
+		for i := range group {
+			group[i].Vector = *s.materialize(&group[i].Vector)
+		}
+	}
+	results = page
+
+	response := &models.SearchResponse{
+		Total:    total,
+		Returned: len(results),
+		Expanded: len(expanded),
+		Page:     req.Page,
+		Limit:    req.Limit,
+		Offset:   start,
+		Results:  results,
+		Reason:   reason,
+		Weights:  weights,
+		Metric:   req.Metric,
+		Cluster:  cluster,
+
+		ScoreNormalization: req.ScoreNormalization,
+		Collapsed:          collapsed,
+		Groups:             groups,
+		GroupsCapped:       groupsCapped,
+		Approximate:        approximate,
+		Capped:             capped,
+		GapCut:             gapCut,
+		Fallback:           exact,
+		TotalPages:         totalPages(total, req.Limit),
+		HasNext:            start+req.Limit < total,
+	}
+	if profile != nil {
+		profile.Rank = time.Since(phaseStart)
+		response.Profile = profile
+	}
+	// Approximate responses, from an index, a sample or a snapshot that
+	// expired before every candidate was scored, are never cached, so they
+	// aren't served as complete for the cache's lifetime
+	if cacheKey != "" && !approximate {
+		s.cacheSearchResponse(cacheKey, writes, response)
+	}
+	return response, false, nil
 }
 
-func (s *boltStore) HybridSearch(ctx context.Context, req *models.HybridSearchRequest) (*models.HybridSearchResponse, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// requireWeights rejects a query with both a vector and text that leaves
+// the weights of the named fields to their defaults, when the store is
+// configured to require them.
+func (s *boltStore) requireWeights(fields ...string) error {
+	if !s.config.RequireWeights {
+		return nil
+	}
+	return errWeightsRequired(fields...)
+}
+
+func errWeightsRequired(fields ...string) error {
+	return errors.New(http.StatusBadRequest, "search weights required").
+		WithDetails(fmt.Sprintf("the query has both a vector and text, set %s to say how much each counts", strings.Join(fields, " and ")))
+}
 
+func (s *boltStore) HybridSearch(ctx context.Context, req *models.HybridSearchRequest) (*models.HybridSearchResponse, error) {
 	// Validate request
 	if req.Query == "" {
 		return nil, errors.ErrEmptyQuery
 	}
-	if len(req.QueryVector) == 0 {
+	keywordOnly := len(req.QueryVector) == 0
+	if keywordOnly && !req.AllowKeywordOnly {
 		return nil, errors.ErrEmptyQuery
 	}
 
@@ -106,41 +527,77 @@ func (s *boltStore) HybridSearch(ctx context.Context, req *models.HybridSearchRe
 	if req.Page <= 0 {
 		req.Page = 1
 	}
-	if req.VectorWeight+req.KeywordWeight == 0 {
+	if keywordOnly {
+		req.VectorWeight = 0
+		req.KeywordWeight = 1
+	} else if req.VectorWeight+req.KeywordWeight == 0 {
+		if err := s.requireWeights("vector_weight", "keyword_weight"); err != nil {
+			return nil, err
+		}
 		req.VectorWeight = 0.5
 		req.KeywordWeight = 0.5
 	}
+	weights := map[string]float64{
+		"vector":  req.VectorWeight,
+		"keyword": req.KeywordWeight,
+	}
 
-	// Get all vectors
-	vectors := make([]*models.Vector, 0, len(s.vectors))
-	for _, vector := range s.vectors {
-		vectors = append(vectors, vector)
+	// Get all vectors, or those of the collection searched
+	var collection string
+	var filter models.Metadata
+	if req.Collection != "" {
+		collection, _ = s.resolveCollection(req.Collection)
+		filter = s.collectionFilter(collection, nil)
 	}
+	s.mu.RLock()
+	vectors := s.filterVectors(filter)
 
 	if len(vectors) == 0 {
+		reason := models.ReasonNoFilterMatch
+		if len(s.vectors) == 0 {
+			reason = models.ReasonEmptyStore
+		}
+		s.mu.RUnlock()
 		return &models.HybridSearchResponse{
-			Total:   0,
-			Page:    req.Page,
-			Limit:   req.Limit,
-			Results: []models.HybridSearchResult{},
+			Total:      0,
+			Page:       req.Page,
+			Limit:      req.Limit,
+			Results:    []models.HybridSearchResult{},
+			Reason:     reason,
+			Weights:    weights,
+			Metric:     models.MetricCosine,
+			Collection: collection,
 		}, nil
 	}
 
 	// Calculate BM25 scores for keyword search
-	texts := make([]string, len(vectors))
-	for i, vector := range vectors {
-		texts[i] = vector.Text
+	decay := noTermDecay
+	if req.QueryTermDecay != nil {
+		decay = *req.QueryTermDecay
+	}
+	bm25Scores, err := s.keywordScores(ctx, req.Query, vectors, decay)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, err
 	}
-	bm25Scores := s.calculateBM25Scores(req.Query, texts)
 
-	// Calculate hybrid scores
+	// Calculate hybrid scores on a snapshot, without holding the lock
+	snapshot, release := s.snapshot(vectors)
+	defer release()
+	score := s.snapshotScorer(req.QueryVector, models.MetricCosine)
+	s.mu.RUnlock()
+
 	results := make([]models.HybridSearchResult, 0, len(vectors))
-	for i, vector := range vectors {
+	captured := make(map[string]*candidate, len(vectors))
+	for i := range snapshot {
+		vector := snapshot[i].vector
+		captured[vector.ID] = &snapshot[i]
+
 		// Calculate vector similarity
 		vectorScore := 0.0
-		if len(vector.Vector) > 0 {
-			if score, err := cosineSimilarity(req.QueryVector, vector.Vector); err == nil {
-				vectorScore = score
+		if !keywordOnly {
+			if similarity, err := score(&snapshot[i]); err == nil {
+				vectorScore = similarity
 			}
 		}
 
@@ -148,7 +605,10 @@ func (s *boltStore) HybridSearch(ctx context.Context, req *models.HybridSearchRe
 		keywordScore := bm25Scores[i]
 
 		// Calculate hybrid score
-		hybridScore := req.VectorWeight*vectorScore + req.KeywordWeight*keywordScore
+		hybridScore := (req.VectorWeight*vectorScore + req.KeywordWeight*keywordScore) * vector.BoostFactor()
+		if req.MinScore != nil && hybridScore < *req.MinScore {
+			continue
+		}
 
 		results = append(results, models.HybridSearchResult{
 			ID:           vector.ID,
@@ -158,18 +618,31 @@ func (s *boltStore) HybridSearch(ctx context.Context, req *models.HybridSearchRe
 			HybridScore:  hybridScore,
 		})
 	}
+	results = dropDeleted(s, results, func(result models.HybridSearchResult) string { return result.ID })
 
-	// Sort by hybrid score (descending)
+	var reason string
+	if len(results) == 0 {
+		reason = models.ReasonBelowThreshold
+	}
+
+	// Sort by hybrid score (descending), then ID so ties rank the same
+	// every time
 	sort.Slice(results, func(i, j int) bool {
-		return results[i].HybridScore > results[j].HybridScore
+		if results[i].HybridScore != results[j].HybridScore {
+			return results[i].HybridScore > results[j].HybridScore
+		}
+		return results[i].ID < results[j].ID
 	})
 
 	// Apply pagination
 	total := len(results)
-	start := (req.Page - 1) * req.Limit
+	start := pageStart(req.Page, req.Limit, req.Offset)
 	end := start + req.Limit
 	if start >= total {
 		results = []models.HybridSearchResult{}
+		if total > 0 {
+			reason = models.ReasonPageOutOfRange
+		}
 	} else {
 		if end > total {
 			end = total
@@ -177,15 +650,53 @@ func (s *boltStore) HybridSearch(ctx context.Context, req *models.HybridSearchRe
 		results = results[start:end]
 	}
 
+	// Vectors are returned as they were scored
+	if req.IncludeVector {
+		for i := range results {
+			c := captured[results[i].ID]
+			vector := *c.vector
+			if req.IncludeEmbedding {
+				vector.Vector = s.candidateValues(c)
+			} else {
+				vector.Vector = nil
+			}
+			results[i].Vector = &vector
+		}
+	}
+
 	return &models.HybridSearchResponse{
-		Total:   total,
-		Page:    req.Page,
-		Limit:   req.Limit,
-		Results: results,
+		Total:    total,
+		Returned: len(results),
+		Page:     req.Page,
+		Limit:    req.Limit,
+		Offset:   start,
+		Results:  results,
+		Reason:   reason,
+		Weights:  weights,
+		Metric:   models.MetricCosine,
+
+		Collection: collection,
+		TotalPages: totalPages(total, req.Limit),
+		HasNext:    start+req.Limit < total,
 	}, nil
 }
 
+// totalPages returns the number of pages of limit results needed for total.
+func totalPages(total, limit int) int {
+	return (total + limit - 1) / limit
+}
+
+// pageStart returns the position of the first result of a window, which is
+// offset when it's set and the start of page otherwise.
+func pageStart(page, limit, offset int) int {
+	if offset > 0 {
+		return offset
+	}
+	return (page - 1) * limit
+}
+
 func (s *boltStore) filterVectors(filters map[string]string) []*models.Vector {
+	filters = s.normalizeFilter(filters)
 	if len(filters) == 0 {
 		// Return all vectors
 		vectors := make([]*models.Vector, 0, len(s.vectors))
@@ -237,6 +748,163 @@ func (s *boltStore) filterVectors(filters map[string]string) []*models.Vector {
 	return vectors
 }
 
+const defaultExpandLimit = 10
+
+// defaultMaxRadiusResults caps radius search results when the store config
+// doesn't
+const defaultMaxRadiusResults = 1000
+
+// expandRelated returns up to limit vectors linked from the results
+// through their related_ids metadata, that are eligible and that score
+// returns a result for. Vectors already in results are not repeated. The
+// caller must hold s.mu.
+func (s *boltStore) expandRelated(results []models.SearchResult, eligible func(*models.Vector) bool, score func(*models.Vector) (models.SearchResult, bool), limit int) []models.SearchResult {
+	seen := make(map[string]bool, len(results))
+	for _, result := range results {
+		seen[result.Vector.ID] = true
+	}
+
+	var expanded []models.SearchResult
+	for i := 0; i < len(results) && len(expanded) < limit; i++ {
+		for _, id := range strings.Split(results[i].Vector.Metadata[models.RelatedIDsKey], ",") {
+			id = strings.TrimSpace(id)
+			vector, ok := s.vectors[id]
+			if !ok || seen[id] {
+				continue
+			}
+			seen[id] = true
+			if !eligible(vector) {
+				continue
+			}
+
+			result, ok := score(vector)
+			if !ok {
+				continue
+			}
+			result.ExpandedFrom = results[i].Vector.ID
+			expanded = append(expanded, result)
+			if len(expanded) == limit {
+				break
+			}
+		}
+	}
+	return expanded
+}
+
+// inFilter reports whether the vector with the ID is indexed under every
+// pair of the normalized filters. The caller must hold s.mu.
+func (s *boltStore) inFilter(id string, filters map[string]string) bool {
+	for key, val := range filters {
+		if !s.index[key][val][id] {
+			return false
+		}
+	}
+	return true
+}
+
+// sampleCandidates returns n candidates chosen at random with a fixed seed,
+// reordering candidates in place. Candidates are collected in map order, so
+// they are sorted by ID first for the same candidates to give the same
+// sample.
+func sampleCandidates(candidates []*models.Vector, n int) []*models.Vector {
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].ID < candidates[j].ID })
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < n; i++ {
+		j := i + rng.Intn(len(candidates)-i)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	return candidates[:n]
+}
+
+// collapseBy keeps the first result for each distinct value of the metadata
+// key in results sorted by score, and returns the number dropped. Results
+// without the key are all kept.
+func collapseBy(results []models.SearchResult, key string) ([]models.SearchResult, int) {
+	seen := make(map[string]bool)
+	kept := results[:0]
+	for _, result := range results {
+		if value, ok := result.Vector.Metadata[key]; ok {
+			value = models.MetadataText(value)
+			if seen[value] {
+				continue
+			}
+			seen[value] = true
+		}
+		kept = append(kept, result)
+	}
+	return kept, len(results) - len(kept)
+}
+
+// defaultMaxSearchGroups bounds the groups of a grouped search when the
+// store config doesn't
+const defaultMaxSearchGroups = 100
+
+// gapCutoff returns how many of the ranked results to keep so they end at
+// the largest drop in score, mapped by returned, between consecutive
+// results, keeping at least minK. Drops smaller than minGap don't count,
+// keeping every result.
+func gapCutoff(results []models.SearchResult, returned func(float64) float64, minGap float64, minK int) int {
+	cut, widest := len(results), 0.0
+	for i := max(minK, 1); i < len(results); i++ {
+		if gap := returned(results[i-1].Score) - returned(results[i].Score); gap >= minGap && gap > widest {
+			cut, widest = i, gap
+		}
+	}
+	return cut
+}
+
+// groupBy collects the first size of the ranked results per distinct value
+// of the metadata key, for at most maxGroups values, reporting whether
+// results of further values were left out.
+func groupBy(results []models.SearchResult, key string, size, maxGroups int) (map[string][]models.SearchResult, bool) {
+	if size <= 0 {
+		size = 1
+	}
+	groups := make(map[string][]models.SearchResult)
+	capped := false
+	for _, result := range results {
+		value, ok := result.Vector.Metadata[key]
+		if !ok {
+			continue
+		}
+		value = models.MetadataText(value)
+		group, exists := groups[value]
+		if !exists && len(groups) >= maxGroups {
+			capped = true
+			continue
+		}
+		if len(group) < size {
+			groups[value] = append(group, result)
+		}
+	}
+	return groups, capped
+}
+
+const defaultHalfLife = 7 * 24 * time.Hour
+
+// recencyDecay is 1 for a vector created now and halves every halfLife.
+func recencyDecay(createdAt, now time.Time, halfLife time.Duration) float64 {
+	age := now.Sub(createdAt)
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// errZeroMagnitude is returned by the similarity functions when either
+// vector has zero magnitude, for which cosine similarity is undefined.
+var errZeroMagnitude = fmt.Errorf("zero-length vector")
+
+// zeroMagnitude scores zero-magnitude vectors 0 unless SkipZeroVectors is
+// set, in which case they are left out of results like other unscorable
+// vectors.
+func (s *boltStore) zeroMagnitude(similarity float64, err error) (float64, error) {
+	if err == errZeroMagnitude && !s.config.SkipZeroVectors {
+		return 0, nil
+	}
+	return similarity, err
+}
+
 func cosineSimilarity(a, b []float64) (float64, error) {
 	if len(a) != len(b) {
 		return 0, fmt.Errorf("vectors must have the same length")
@@ -250,26 +918,34 @@ func cosineSimilarity(a, b []float64) (float64, error) {
 	}
 
 	if magA == 0 || magB == 0 {
-		return 0, fmt.Errorf("zero-length vector")
+		return 0, errZeroMagnitude
 	}
 
 	return dot / (math.Sqrt(magA) * math.Sqrt(magB)), nil
 }
 
-func (s *boltStore) calculateBM25Scores(query string, texts []string) []float64 {
-	queryTerms := s.tokenize(query)
+func (s *boltStore) calculateBM25Scores(ctx context.Context, query string, texts []string, decay float64) ([]float64, error) {
+	queryTerms, err := s.queryTerms(query, decay)
+	if err != nil {
+		return nil, err
+	}
 	if len(queryTerms) == 0 {
-		return make([]float64, len(texts))
+		return make([]float64, len(texts)), nil
 	}
 
-	// Calculate document frequencies
+	// Calculate document frequencies. Texts without tokens are left out of
+	// the corpus unless Config.KeywordCountEmpty is set
 	docFreqs := make([]map[string]int, len(texts))
 	termDocCount := make(map[string]int)
 	totalLen := 0
+	docs := 0
 
 	for i, text := range texts {
 		tokens := s.tokenize(text)
 		totalLen += len(tokens)
+		if len(tokens) > 0 || s.config.KeywordCountEmpty {
+			docs++
+		}
 
 		freq := make(map[string]int)
 		seen := make(map[string]bool)
@@ -283,15 +959,17 @@ func (s *boltStore) calculateBM25Scores(query string, texts []string) []float64
 		docFreqs[i] = freq
 	}
 
+	queryTerms = s.limitQueryTerms(ctx, queryTerms, func(term string) int { return termDocCount[term] })
+
 	// Calculate average document length
-	avgDocLen := float64(totalLen) / float64(len(texts))
-	if len(texts) == 0 {
+	avgDocLen := float64(totalLen) / float64(docs)
+	if docs == 0 {
 		avgDocLen = 0
 	}
 
 	// Calculate BM25 scores
 	scores := make([]float64, len(texts))
-	N := float64(len(texts))
+	N := float64(docs)
 
 	for i, text := range texts {
 		freq := docFreqs[i]
@@ -300,36 +978,25 @@ func (s *boltStore) calculateBM25Scores(query string, texts []string) []float64
 		score := 0.0
 
 		for _, term := range queryTerms {
-			tf := float64(freq[term])
+			tf := float64(freq[term.term])
 			if tf == 0 {
 				continue
 			}
 
-			df := float64(termDocCount[term])
+			df := float64(termDocCount[term.term])
 			if df == 0 {
 				continue
 			}
 
-			// BM25 formula
-			idf := math.Log(1.0 + (N-df+0.5)/(df+0.5))
-			norm := tf * (1.5 + 1.0) / (tf + 1.5*(1.0-0.75+0.75*(docLen/avgDocLen)))
-			score += idf * norm
+			score += term.weight * bm25(tf, df, N, docLen, avgDocLen)
 		}
 
 		scores[i] = score
 	}
 
-	return scores
+	return scores, nil
 }
 
 func (s *boltStore) tokenize(text string) []string {
-	parts := strings.Fields(strings.ToLower(text))
-	tokens := make([]string, 0, len(parts))
-	for _, part := range parts {
-		part = strings.Trim(part, ".,!?\"'()[]{}:;")
-		if part != "" {
-			tokens = append(tokens, part)
-		}
-	}
-	return tokens
+	return s.config.Tokenizer.Tokenize(text)
 }
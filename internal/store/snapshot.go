@@ -0,0 +1,202 @@
+package store
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"vectraDB/internal/models"
+)
+
+// Vector search scores candidates without holding s.mu, so a long search
+// doesn't block writes. The candidates and the cached form of their
+// embeddings are captured under the lock, then scored after it is released.
+// Writes replace cached vectors and embeddings rather than modifying them,
+// so the captured references stay valid while the store changes. Once
+// scored, results are checked against the store again under the lock.
+//
+// Hybrid and blended search score every component of a vector on the same
+// snapshot, keyword statistics being read while it is captured. They return
+// vectors as they were captured, dropping only those deleted since.
+//
+// A snapshot keeps the vectors it captured in memory, even once deleted,
+// until the search releases it. Config.SnapshotMaxAge bounds how long a
+// search may score its snapshot, and the number of live snapshots and the
+// vectors they hold are reported in the store stats.
+
+// candidate is a vector captured for scoring along with the cached form of
+// its embedding.
+type candidate struct {
+	vector   *models.Vector
+	values32 []float32
+	sparse   *sparseVector
+	code     []byte
+	norm     float32
+}
+
+// scoredCandidate is a candidate and its similarity to the query.
+type scoredCandidate struct {
+	*candidate
+	score float64
+}
+
+// snapshotCheckInterval is the number of candidates scored between checks
+// of the snapshot's age
+const snapshotCheckInterval = 1024
+
+// snapshot captures vectors for scoring. The caller must hold s.mu, and call
+// release once done with the snapshot; release may be called more than once.
+// Release drops the snapshot's references to the captured vectors and
+// embeddings, so those deleted or replaced since can be reclaimed even while
+// the search goes on; the snapshot mustn't be used after it.
+func (s *boltStore) snapshot(vectors []*models.Vector) (snapshot []candidate, release func()) {
+	s.liveSnapshots.Add(1)
+	s.snapshotVectors.Add(int64(len(vectors)))
+	candidates := make([]candidate, len(vectors))
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			clear(candidates)
+			s.liveSnapshots.Add(-1)
+			s.snapshotVectors.Add(-int64(len(vectors)))
+		})
+	}
+
+	for i, vector := range vectors {
+		c := candidate{vector: vector}
+		if vector.Vector == nil {
+			c.values32 = s.values32[vector.ID]
+			c.sparse = s.sparse[vector.ID]
+			if s.pq != nil {
+				c.code = s.pq.codes[vector.ID]
+				c.norm = s.pq.norms[vector.ID]
+			}
+		}
+		candidates[i] = c
+	}
+	return candidates, release
+}
+
+// scoreSnapshot scores the candidates of a snapshot, skipping those that
+// can't be scored. Once the snapshot is older than Config.SnapshotMaxAge
+// scoring stops and expired is set, leaving the rest of the candidates
+// unscored.
+func (s *boltStore) scoreSnapshot(snapshot []candidate, score func(c *candidate) (float64, error)) (scored []scoredCandidate, expired bool) {
+	var deadline time.Time
+	if s.config.SnapshotMaxAge > 0 {
+		deadline = time.Now().Add(s.config.SnapshotMaxAge)
+	}
+
+	scored = make([]scoredCandidate, 0, len(snapshot))
+	for i := range snapshot {
+		if i > 0 && i%snapshotCheckInterval == 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			return scored, true
+		}
+		similarity, err := score(&snapshot[i])
+		if err != nil {
+			continue // Skip invalid vectors
+		}
+		scored = append(scored, scoredCandidate{candidate: &snapshot[i], score: similarity})
+	}
+	return scored, false
+}
+
+// snapshotScorer returns a function scoring captured candidates like
+// metricScorer scores cached vectors. The caller must hold s.mu while
+// creating it, but not while calling the function.
+func (s *boltStore) snapshotScorer(query []float64, metric string) func(c *candidate) (float64, error) {
+	if metric != models.MetricCosine {
+		return func(c *candidate) (float64, error) {
+			return metricScore(metric, query, s.candidateValues(c))
+		}
+	}
+
+	var sumSquares float64
+	for _, v := range query {
+		sumSquares += v * v
+	}
+	norm := math.Sqrt(sumSquares)
+
+	var table [][]float32
+	pq := s.pq
+	if pq != nil && len(query) == pq.dim {
+		table = pq.table(query)
+	}
+	var query32 []float32
+	if s.config.Precision == PrecisionFloat32 {
+		query32 = toFloat32(query)
+	}
+
+	return func(c *candidate) (float64, error) {
+		switch {
+		case table != nil && c.code != nil:
+			if norm == 0 || c.norm == 0 {
+				return s.zeroMagnitude(0, errZeroMagnitude)
+			}
+			return s.zeroMagnitude(float64(pq.approxDot(table, c.code))/(norm*float64(c.norm)), nil)
+		case c.sparse != nil:
+			return s.zeroMagnitude(c.sparse.cosine(query, sumSquares))
+		case c.values32 != nil && query32 != nil:
+			return s.zeroMagnitude(cosineSimilarity32(query32, c.values32))
+		case c.values32 != nil:
+			return s.zeroMagnitude(cosineSimilarity(query, toFloat64(c.values32)))
+		default:
+			return s.zeroMagnitude(cosineSimilarity(query, c.vector.Vector))
+		}
+	}
+}
+
+// candidateValues returns the embedding of a captured candidate as float64,
+// reading quantized vectors from disk.
+func (s *boltStore) candidateValues(c *candidate) []float64 {
+	switch {
+	case c.vector.Vector != nil:
+		return c.vector.Vector
+	case c.values32 != nil:
+		return toFloat64(c.values32)
+	case c.sparse != nil:
+		return c.sparse.dense()
+	case c.code != nil:
+		return s.loadValues(c.vector.ID)
+	}
+	return nil
+}
+
+// dropDeleted drops the results of vectors deleted since they were captured
+// for scoring.
+func dropDeleted[T any](s *boltStore, results []T, id func(T) string) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kept := results[:0]
+	for _, result := range results {
+		if _, ok := s.vectors[id(result)]; ok {
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
+
+// revalidate turns scored candidates into results against the current
+// state of the store. Vectors deleted since they were captured are dropped
+// and vectors replaced since are scored again. The caller must hold s.mu.
+func (s *boltStore) revalidate(scored []scoredCandidate, score func(*models.Vector) (float64, error)) []models.SearchResult {
+	results := make([]models.SearchResult, 0, len(scored))
+	for _, sc := range scored {
+		current, ok := s.vectors[sc.vector.ID]
+		if !ok {
+			continue
+		}
+		similarity := sc.score
+		if current != sc.vector {
+			var err error
+			if similarity, err = score(current); err != nil {
+				continue
+			}
+		}
+		results = append(results, models.SearchResult{
+			Vector: *current,
+			Score:  similarity,
+		})
+	}
+	return results
+}
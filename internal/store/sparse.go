@@ -0,0 +1,77 @@
+package store
+
+import (
+	"fmt"
+	"math"
+)
+
+// sparseVector keeps only the non-zero dimensions of an embedding. Vectors
+// whose ratio of zeros exceeds Config.SparseThreshold are cached this way,
+// taking 12 bytes per non-zero dimension instead of 8 bytes per dimension,
+// and are scored by iterating their non-zero dimensions only.
+type sparseVector struct {
+	dim     int
+	indices []int32
+	values  []float64
+	// sumSquares is the squared magnitude, computed once
+	sumSquares float64
+}
+
+// sparsify returns the sparse form of values if enough of them are zero,
+// nil otherwise.
+func (s *boltStore) sparsify(values []float64) *sparseVector {
+	if s.config.SparseThreshold <= 0 || len(values) == 0 {
+		return nil
+	}
+
+	nonZero := 0
+	for _, v := range values {
+		if v != 0 {
+			nonZero++
+		}
+	}
+	if float64(len(values)-nonZero)/float64(len(values)) <= s.config.SparseThreshold {
+		return nil
+	}
+
+	sparse := &sparseVector{
+		dim:     len(values),
+		indices: make([]int32, 0, nonZero),
+		values:  make([]float64, 0, nonZero),
+	}
+	for i, v := range values {
+		if v != 0 {
+			sparse.indices = append(sparse.indices, int32(i))
+			sparse.values = append(sparse.values, v)
+			sparse.sumSquares += v * v
+		}
+	}
+	return sparse
+}
+
+func (v *sparseVector) dense() []float64 {
+	values := make([]float64, v.dim)
+	for i, idx := range v.indices {
+		values[idx] = v.values[i]
+	}
+	return values
+}
+
+// cosine returns the cosine similarity between a dense query, whose squared
+// magnitude is given, and v. It matches cosineSimilarity on the dense form.
+func (v *sparseVector) cosine(query []float64, querySumSquares float64) (float64, error) {
+	if len(query) != v.dim {
+		return 0, fmt.Errorf("vectors must have the same length")
+	}
+
+	var dot float64
+	for i, idx := range v.indices {
+		dot += query[idx] * v.values[i]
+	}
+
+	if querySumSquares == 0 || v.sumSquares == 0 {
+		return 0, errZeroMagnitude
+	}
+
+	return dot / (math.Sqrt(querySumSquares) * math.Sqrt(v.sumSquares)), nil
+}
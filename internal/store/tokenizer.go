@@ -0,0 +1,24 @@
+package store
+
+import "strings"
+
+// Tokenizer splits text into the terms used for keyword scoring.
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// WhitespaceTokenizer lowercases text, splits it on whitespace and strips
+// surrounding punctuation. It is the default tokenizer.
+type WhitespaceTokenizer struct{}
+
+func (WhitespaceTokenizer) Tokenize(text string) []string {
+	parts := strings.Fields(strings.ToLower(text))
+	tokens := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.Trim(part, ".,!?\"'()[]{}:;")
+		if part != "" {
+			tokens = append(tokens, part)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// UnifiedSearch ranks vectors and documents together. Each source is scored
+// on its own, normalized so its best result scores 1 and weighted, then the
+// results are merged. Results that don't score above 0 in their source are
+// dropped.
+func (s *boltStore) UnifiedSearch(ctx context.Context, req *models.UnifiedSearchRequest) (*models.UnifiedSearchResponse, error) {
+	if req.Query == "" {
+		return nil, errors.ErrEmptyQuery
+	}
+
+	// Set defaults
+	if req.Limit <= 0 {
+		req.Limit = 10
+	}
+	if req.Page <= 0 {
+		req.Page = 1
+	}
+	if req.VectorsWeight+req.DocumentsWeight == 0 {
+		if len(req.QueryVector) > 0 {
+			if err := s.requireWeights("vectors_weight", "documents_weight"); err != nil {
+				return nil, err
+			}
+		}
+		req.VectorsWeight = 0.5
+		req.DocumentsWeight = 0.5
+	}
+
+	hybrid, err := s.HybridSearch(ctx, &models.HybridSearchRequest{
+		Query:            req.Query,
+		QueryVector:      req.QueryVector,
+		VectorWeight:     0.5,
+		KeywordWeight:    0.5,
+		AllowKeywordOnly: true,
+		Limit:            math.MaxInt32,
+		Collection:       req.Collection,
+	})
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([]models.UnifiedSearchResult, 0, len(hybrid.Results))
+	for _, result := range hybrid.Results {
+		vectors = append(vectors, models.UnifiedSearchResult{
+			Type:        models.ResultTypeVector,
+			ID:          result.ID,
+			SourceScore: result.HybridScore,
+			Text:        result.Text,
+		})
+	}
+
+	documents, err := s.scoreDocuments(ctx, req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	results := append(normalizeScores(vectors, req.VectorsWeight), normalizeScores(documents, req.DocumentsWeight)...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	// Apply pagination
+	total := len(results)
+	start := pageStart(req.Page, req.Limit, req.Offset)
+	end := start + req.Limit
+	if start >= total {
+		results = []models.UnifiedSearchResult{}
+	} else {
+		if end > total {
+			end = total
+		}
+		results = results[start:end]
+	}
+
+	return &models.UnifiedSearchResponse{
+		Total:    total,
+		Returned: len(results),
+		Page:     req.Page,
+		Limit:    req.Limit,
+		Offset:   start,
+		Results:  results,
+		Weights: map[string]float64{
+			"vectors":   req.VectorsWeight,
+			"documents": req.DocumentsWeight,
+		},
+		Collection: hybrid.Collection,
+	}, nil
+}
+
+// scoreDocuments returns the BM25 scores of every unexpired document's
+// title and content for query.
+func (s *boltStore) scoreDocuments(ctx context.Context, query string) ([]models.UnifiedSearchResult, error) {
+	var docs []models.Document
+	now := time.Now()
+	err := s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte("documents"))
+		if bucket == nil {
+			return nil // No documents written yet
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var doc models.Document
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return nil // Skip invalid documents
+			}
+			if doc.Expired(now) {
+				return nil
+			}
+			docs = append(docs, doc)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to read documents")
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Title + " " + doc.Content
+	}
+	scores, err := s.calculateBM25Scores(ctx, query, texts, noTermDecay)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.UnifiedSearchResult, len(docs))
+	for i, doc := range docs {
+		results[i] = models.UnifiedSearchResult{
+			Type:        models.ResultTypeDocument,
+			ID:          doc.ID,
+			SourceScore: scores[i],
+			Title:       doc.Title,
+		}
+	}
+	return results, nil
+}
+
+// normalizeScores sets Score to SourceScore divided by the best SourceScore
+// and multiplied by weight, dropping results not scoring above 0.
+func normalizeScores(results []models.UnifiedSearchResult, weight float64) []models.UnifiedSearchResult {
+	best := 0.0
+	for _, result := range results {
+		best = math.Max(best, result.SourceScore)
+	}
+
+	kept := results[:0]
+	for _, result := range results {
+		if result.SourceScore <= 0 {
+			continue
+		}
+		result.Score = weight * result.SourceScore / best
+		kept = append(kept, result)
+	}
+	return kept
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+const (
+	defaultMaxMetadataEntries     = 100
+	defaultMaxMetadataKeyLength   = 256
+	defaultMaxMetadataValueLength = 4096
+
+	// defaultIDPattern allows IDs that are safe in a URL path segment.
+	defaultIDPattern = `^[A-Za-z0-9._-]+$`
+)
+
+// validateID checks a new vector ID against the configured pattern.
+func (s *boltStore) validateID(id string) error {
+	if s.idPattern == nil || s.idPattern.MatchString(id) {
+		return nil
+	}
+	return errors.ErrInvalidVectorID.Detailed(fmt.Sprintf("vector ID %q must match %s", id, s.idPattern))
+}
+
+// validateMetadata enforces the configured metadata limits and rejects keys
+// reserved for indexed vector fields.
+func (s *boltStore) validateMetadata(metadata map[string]string) error {
+	if len(metadata) > s.config.MaxMetadataEntries {
+		return errors.New(http.StatusUnprocessableEntity, "metadata exceeds limits").
+			WithDetails(fmt.Sprintf("metadata has %d entries, at most %d are allowed", len(metadata), s.config.MaxMetadataEntries))
+	}
+
+	for key, value := range metadata {
+		if key == EmbeddingModelKey || key == EmbeddingVersionKey {
+			return errors.New(http.StatusUnprocessableEntity, "reserved metadata key").
+				WithDetails(fmt.Sprintf("metadata key %q is reserved, use the %s field instead", key, key))
+		}
+		if n := utf8.RuneCountInString(key); n > s.config.MaxMetadataKeyLength {
+			return errors.New(http.StatusUnprocessableEntity, "metadata exceeds limits").
+				WithDetails(fmt.Sprintf("metadata key %.32q... is %d characters, at most %d are allowed", key, n, s.config.MaxMetadataKeyLength))
+		}
+		if n := utf8.RuneCountInString(models.MetadataText(value)); n > s.config.MaxMetadataValueLength {
+			return errors.New(http.StatusUnprocessableEntity, "metadata exceeds limits").
+				WithDetails(fmt.Sprintf("metadata value for key %q is %d characters, at most %d are allowed", key, n, s.config.MaxMetadataValueLength))
+		}
+	}
+
+	return nil
+}
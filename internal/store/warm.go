@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/models"
+	"vectraDB/pkg/errors"
+)
+
+// With Config.SearchCacheWarm set, the store counts how often each cacheable
+// search is run. On close the most frequent are persisted, as their cache
+// keys rather than their responses, and on startup they are run again in
+// the background so the first searches after a restart hit a warm cache.
+
+var warmSearchesKey = []byte("warm_searches")
+
+// minTrackedSearches is the least number of distinct searches counted
+// before the counts are aged
+const minTrackedSearches = 1000
+
+// countSearch counts a run of the search cached under key. Once more
+// searches are counted than it takes to tell the most frequent apart, every
+// count is halved and the searches left at zero are forgotten, so old
+// favorites fade. The caller must hold s.cacheMu.
+func (s *boltStore) countSearch(key string) {
+	if s.config.SearchCacheWarm <= 0 {
+		return
+	}
+	if len(s.searchCounts) >= max(minTrackedSearches, 10*s.config.SearchCacheWarm) {
+		for k, n := range s.searchCounts {
+			if n /= 2; n == 0 {
+				delete(s.searchCounts, k)
+			} else {
+				s.searchCounts[k] = n
+			}
+		}
+	}
+	s.searchCounts[key]++
+}
+
+// saveWarmSearches persists the cache keys of the Config.SearchCacheWarm
+// most frequent searches, most frequent first.
+func (s *boltStore) saveWarmSearches() error {
+	if s.config.SearchCacheWarm <= 0 {
+		return nil
+	}
+
+	s.cacheMu.Lock()
+	keys := make([]string, 0, len(s.searchCounts))
+	for key := range s.searchCounts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if s.searchCounts[keys[i]] != s.searchCounts[keys[j]] {
+			return s.searchCounts[keys[i]] > s.searchCounts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	s.cacheMu.Unlock()
+	keys = keys[:min(len(keys), s.config.SearchCacheWarm)]
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return s.update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("meta")).Put(warmSearchesKey, data)
+	})
+}
+
+// loadWarmSearches returns the cache keys persisted by saveWarmSearches.
+func (s *boltStore) loadWarmSearches() ([]string, error) {
+	var keys []string
+	err := s.view(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte("meta")).Get(warmSearchesKey)
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &keys)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, http.StatusInternalServerError, "failed to load warm searches")
+	}
+	return keys, nil
+}
+
+// warmSearchCache runs the persisted searches to fill the cache, stopping
+// early when the store is closed.
+func (s *boltStore) warmSearchCache(keys []string) {
+	ctx := context.Background()
+	warmed := 0
+	for _, key := range keys {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		var req models.SearchRequest
+		if err := json.Unmarshal([]byte(key), &req); err != nil {
+			logger.WithError(err).Warn("Skipping an unreadable warm search")
+			continue
+		}
+		if _, _, err := s.searchVectors(ctx, &req, false); err != nil {
+			logger.WithError(err).Warn("Failed to run a warm search")
+			continue
+		}
+		warmed++
+		s.warmedSearches.Add(1)
+	}
+	logger.WithFields(logrus.Fields{
+		"searches": warmed,
+	}).Info("Warmed the search cache")
+}
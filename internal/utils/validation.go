@@ -12,13 +12,26 @@ type Validator struct {
 	validator *validator.Validate
 }
 
+// shared is the validator used by the package functions. Validators cache
+// struct metadata and are safe for concurrent use, so one is reused
+var shared = NewValidator()
+
 func NewValidator() *Validator {
 	v := validator.New()
-	
+
 	// Register custom validators
 	v.RegisterValidation("not_empty", notEmpty)
 	v.RegisterValidation("vector_dimension", vectorDimension)
-	
+
+	// Report errors under the JSON names clients send
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
 	return &Validator{validator: v}
 }
 
@@ -32,20 +45,19 @@ func (v *Validator) ValidateVar(field interface{}, tag string) error {
 
 func (v *Validator) GetValidationErrors(err error) map[string]string {
 	errors := make(map[string]string)
-	
+
 	if validationErrors, ok := err.(validator.ValidationErrors); ok {
 		for _, e := range validationErrors {
-			field := strings.ToLower(e.Field())
-			errors[field] = getErrorMessage(e)
+			errors[e.Field()] = getErrorMessage(e)
 		}
 	}
-	
+
 	return errors
 }
 
 func notEmpty(fl validator.FieldLevel) bool {
 	field := fl.Field()
-	
+
 	switch field.Kind() {
 	case reflect.Slice, reflect.Array, reflect.Map:
 		return field.Len() > 0
@@ -58,18 +70,18 @@ func notEmpty(fl validator.FieldLevel) bool {
 
 func vectorDimension(fl validator.FieldLevel) bool {
 	field := fl.Field()
-	
+
 	if field.Kind() != reflect.Slice {
 		return false
 	}
-	
+
 	// Check if it's a slice of float64
 	if field.Type().Elem().Kind() != reflect.Float64 {
 		return false
 	}
-	
+
 	length := field.Len()
-	
+
 	// Vector dimension should be between 1 and 10000
 	return length >= 1 && length <= 10000
 }
@@ -77,34 +89,38 @@ func vectorDimension(fl validator.FieldLevel) bool {
 func getErrorMessage(fe validator.FieldError) string {
 	switch fe.Tag() {
 	case "required":
-		return fmt.Sprintf("%s is required", fe.Field())
+		return fmt.Sprintf("%s is required", fe.StructField())
 	case "min":
-		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+		return fmt.Sprintf("%s must be at least %s", fe.StructField(), fe.Param())
 	case "max":
-		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+		return fmt.Sprintf("%s must be at most %s", fe.StructField(), fe.Param())
 	case "email":
-		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+		return fmt.Sprintf("%s must be a valid email address", fe.StructField())
 	case "url":
-		return fmt.Sprintf("%s must be a valid URL", fe.Field())
+		return fmt.Sprintf("%s must be a valid URL", fe.StructField())
 	case "not_empty":
-		return fmt.Sprintf("%s cannot be empty", fe.Field())
+		return fmt.Sprintf("%s cannot be empty", fe.StructField())
 	case "vector_dimension":
-		return fmt.Sprintf("%s must be a valid vector with dimension between 1 and 10000", fe.Field())
+		return fmt.Sprintf("%s must be a valid vector with dimension between 1 and 10000", fe.StructField())
 	default:
-		return fmt.Sprintf("%s is invalid", fe.Field())
+		return fmt.Sprintf("%s is invalid", fe.StructField())
 	}
 }
 
 func ValidateStruct(s interface{}) error {
-	v := NewValidator()
-	return v.Validate(s)
+	return shared.Validate(s)
 }
 
 func ValidateStructWithDetails(s interface{}) map[string]string {
-	v := NewValidator()
-	err := v.Validate(s)
+	err := shared.Validate(s)
 	if err == nil {
 		return nil
 	}
-	return v.GetValidationErrors(err)
+	return shared.GetValidationErrors(err)
+}
+
+// ValidationErrors returns the message for each invalid field of a
+// ValidateStruct error, keyed by JSON name.
+func ValidationErrors(err error) map[string]string {
+	return shared.GetValidationErrors(err)
 }
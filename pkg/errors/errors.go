@@ -1,6 +1,7 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"net/http"
 )
@@ -9,7 +10,11 @@ type AppError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Details string `json:"details,omitempty"`
-	Err     error  `json:"-"`
+	// ValidationErrors maps invalid request fields to their messages
+	ValidationErrors map[string]string `json:"validation_errors,omitempty"`
+	Err              error             `json:"-"`
+	// sentinel is the predefined error this one is a detailed copy of
+	sentinel *AppError
 }
 
 func (e *AppError) Error() string {
@@ -23,6 +28,17 @@ func (e *AppError) Unwrap() error {
 	return e.Err
 }
 
+// Is reports whether target is e or the predefined error e was copied from
+// by Detailed, so callers can match errors without comparing messages.
+func (e *AppError) Is(target error) bool {
+	return target == e || (e.sentinel != nil && target == e.sentinel)
+}
+
+// Is reports whether any error in err's chain matches target.
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
 func New(code int, message string) *AppError {
 	return &AppError{
 		Code:    code,
@@ -43,14 +59,28 @@ func (e *AppError) WithDetails(details string) *AppError {
 	return e
 }
 
+// Detailed returns a copy of a predefined error with details, leaving the
+// shared error unchanged. The copy still matches it with Is.
+func (e *AppError) Detailed(details string) *AppError {
+	copied := *e
+	copied.Details = details
+	copied.sentinel = e
+	return &copied
+}
+
+func (e *AppError) WithValidationErrors(errs map[string]string) *AppError {
+	e.ValidationErrors = errs
+	return e
+}
+
 var (
-	ErrNotFound         = New(http.StatusNotFound, "resource not found")
-	ErrInvalidInput     = New(http.StatusBadRequest, "invalid input")
-	ErrInternalError    = New(http.StatusInternalServerError, "internal server error")
-	ErrUnauthorized     = New(http.StatusUnauthorized, "unauthorized")
-	ErrForbidden        = New(http.StatusForbidden, "forbidden")
-	ErrConflict         = New(http.StatusConflict, "conflict")
-	ErrTooManyRequests  = New(http.StatusTooManyRequests, "too many requests")
+	ErrNotFound           = New(http.StatusNotFound, "resource not found")
+	ErrInvalidInput       = New(http.StatusBadRequest, "invalid input")
+	ErrInternalError      = New(http.StatusInternalServerError, "internal server error")
+	ErrUnauthorized       = New(http.StatusUnauthorized, "unauthorized")
+	ErrForbidden          = New(http.StatusForbidden, "forbidden")
+	ErrConflict           = New(http.StatusConflict, "conflict")
+	ErrTooManyRequests    = New(http.StatusTooManyRequests, "too many requests")
 	ErrServiceUnavailable = New(http.StatusServiceUnavailable, "service unavailable")
 )
 
@@ -60,6 +90,10 @@ var (
 	ErrVectorExists     = New(http.StatusConflict, "vector already exists")
 	ErrEmptyQuery       = New(http.StatusBadRequest, "query cannot be empty")
 	ErrInvalidDimension = New(http.StatusBadRequest, "invalid vector dimension")
+	ErrInvalidVectorID  = New(http.StatusUnprocessableEntity, "invalid vector ID")
+	// ErrBatchAborted is reported for the items of an all-or-nothing batch
+	// left unapplied because another item failed
+	ErrBatchAborted = New(http.StatusFailedDependency, "batch aborted")
 )
 
 var (
@@ -13,26 +13,108 @@ type Response struct {
 	Data      interface{} `json:"data,omitempty"`
 	Error     *ErrorInfo  `json:"error,omitempty"`
 	Meta      *Meta       `json:"meta,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
+	Timestamp time.Time   `json:"timestamp,omitzero"`
+}
+
+// untimedWriter marks a response writer whose responses carry no time.
+type untimedWriter struct {
+	http.ResponseWriter
+}
+
+func (w untimedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w untimedWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// WithoutTimestamps returns w marked so that responses written to it don't
+// carry the time they were sent. Identical requests then get
+// byte-identical responses, which suits caching and golden-file tests.
+func WithoutTimestamps(w http.ResponseWriter) http.ResponseWriter {
+	return untimedWriter{w}
+}
+
+// Timestamp returns the time to stamp a response written to w with, the
+// zero time when w, or a writer it wraps, was marked by WithoutTimestamps.
+func Timestamp(w http.ResponseWriter) time.Time {
+	for {
+		switch u := w.(type) {
+		case untimedWriter:
+			return time.Time{}
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = u.Unwrap()
+		default:
+			return time.Now()
+		}
+	}
 }
 
 type ErrorInfo struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Details string `json:"details,omitempty"`
+	// ValidationErrors maps each invalid request field to its message
+	ValidationErrors map[string]string `json:"validation_errors,omitempty"`
 }
 
 type Meta struct {
 	Total int `json:"total,omitempty"`
 	Page  int `json:"page,omitempty"`
 	Limit int `json:"limit,omitempty"`
+	// Offset is the position of the first search result among all of them
+	Offset  int                `json:"offset,omitempty"`
+	Reason  string             `json:"reason,omitempty"`
+	Weights map[string]float64 `json:"weights,omitempty"`
+	Metric  string             `json:"metric,omitempty"`
+	// ScoreNormalization is how search scores were rescaled
+	ScoreNormalization string `json:"score_normalization,omitempty"`
+	// Collapsed is the number of search results dropped by collapse_by
+	Collapsed int `json:"collapsed,omitempty"`
+	// GroupsCapped is set when a grouped search left out groups past the
+	// limit
+	GroupsCapped bool `json:"groups_capped,omitempty"`
+	// Approximate is set when only a sample of search candidates was scored
+	Approximate bool `json:"approximate,omitempty"`
+	// Capped is set when a radius search matched more vectors than the cap
+	Capped bool `json:"capped,omitempty"`
+	// GapCut is set when an adaptive search cut its results at a score gap
+	GapCut bool `json:"gap_cut,omitempty"`
+	// Fallback is set when a search fell back from its index to scoring
+	// every candidate
+	Fallback bool `json:"fallback,omitempty"`
+	// Collection is the collection a search ran on, with aliases resolved
+	Collection string `json:"collection,omitempty"`
+	// Returned is the number of search results in this page
+	Returned int `json:"returned,omitempty"`
+	// Expanded is the number of related vectors appended to the results
+	Expanded int `json:"expanded,omitempty"`
+	// Truncated is set when results were dropped to keep the response under
+	// the size limit, TruncatedFrom is the number of results in all and
+	// NextOffset is the offset to resume from
+	Truncated     bool `json:"truncated,omitempty"`
+	TruncatedFrom int  `json:"truncated_from,omitempty"`
+	NextOffset    int  `json:"next_offset,omitempty"`
+	// QueryID identifies a search recorded for analytics, for reporting
+	// feedback on its results
+	QueryID string `json:"query_id,omitempty"`
+	// Cached is set when search results were served from the cache
+	Cached bool `json:"cached,omitempty"`
+	// Cluster is the topic cluster of a search query, when asked for
+	Cluster interface{} `json:"cluster,omitempty"`
+	// TotalPages and HasNext are set on search results
+	TotalPages int   `json:"total_pages,omitempty"`
+	HasNext    *bool `json:"has_next,omitempty"`
 }
 
 func Success(w http.ResponseWriter, data interface{}) {
 	sendResponse(w, http.StatusOK, &Response{
 		Success:   true,
 		Data:      data,
-		Timestamp: time.Now(),
+		Timestamp: Timestamp(w),
 	})
 }
 
@@ -41,7 +123,7 @@ func SuccessWithMeta(w http.ResponseWriter, data interface{}, meta *Meta) {
 		Success:   true,
 		Data:      data,
 		Meta:      meta,
-		Timestamp: time.Now(),
+		Timestamp: Timestamp(w),
 	})
 }
 
@@ -49,7 +131,25 @@ func Created(w http.ResponseWriter, data interface{}) {
 	sendResponse(w, http.StatusCreated, &Response{
 		Success:   true,
 		Data:      data,
-		Timestamp: time.Now(),
+		Timestamp: Timestamp(w),
+	})
+}
+
+func Accepted(w http.ResponseWriter, data interface{}) {
+	sendResponse(w, http.StatusAccepted, &Response{
+		Success:   true,
+		Data:      data,
+		Timestamp: Timestamp(w),
+	})
+}
+
+// MultiStatus reports a batch in which some items failed, data holding the
+// outcome of each item.
+func MultiStatus(w http.ResponseWriter, data interface{}) {
+	sendResponse(w, http.StatusMultiStatus, &Response{
+		Success:   false,
+		Data:      data,
+		Timestamp: Timestamp(w),
 	})
 }
 
@@ -65,15 +165,17 @@ func Error(w http.ResponseWriter, err error) {
 		// Convert regular error to AppError
 		appErr = errors.Wrap(err, http.StatusInternalServerError, "internal server error")
 	}
-	
+
 	sendResponse(w, appErr.Code, &Response{
 		Success: false,
 		Error: &ErrorInfo{
 			Code:    appErr.Code,
 			Message: appErr.Message,
 			Details: appErr.Details,
+
+			ValidationErrors: appErr.ValidationErrors,
 		},
-		Timestamp: time.Now(),
+		Timestamp: Timestamp(w),
 	})
 }
 
@@ -85,7 +187,7 @@ func InternalError(w http.ResponseWriter, err error) {
 			Message: "internal server error",
 			Details: err.Error(),
 		},
-		Timestamp: time.Now(),
+		Timestamp: Timestamp(w),
 	})
 }
 
@@ -0,0 +1,1621 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/api"
+	"vectraDB/internal/config"
+	"vectraDB/internal/logger"
+	"vectraDB/internal/middleware"
+	"vectraDB/internal/models"
+	"vectraDB/internal/store"
+	"vectraDB/pkg/errors"
+)
+
+func newTestServer(t *testing.T, cfg *config.Config) (*httptest.Server, store.Store) {
+	cleanupAllTestDBs(t)
+	dbPath := "test_api_" + strings.ReplaceAll(t.Name(), "/", "_") + ".db"
+	cleanupTestDB(t, dbPath)
+
+	testStore, err := store.NewBoltStore(store.Config{
+		DBPath:  dbPath,
+		Timeout: 1 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { testStore.Close() })
+
+	handler := api.NewHandler(testStore, cfg)
+	server := httptest.NewServer(handler.Routes())
+	t.Cleanup(server.Close)
+
+	return server, testStore
+}
+
+func doRequest(t *testing.T, method, url, body string) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Failed to decode response %q: %v", data, err)
+		}
+	}
+	return resp, decoded
+}
+
+func TestHandler_ReloadLogLevel(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "info")
+	cfg := config.Load()
+	logger.Init(logger.Config{Level: cfg.Logging.Level, Format: cfg.Logging.Format})
+	t.Cleanup(func() { logger.SetLevel("info") })
+	server, _ := newTestServer(t, cfg)
+
+	// Change the log level and reload
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("DB_PATH", "other.db")
+	t.Setenv("SEARCH_STREAM", "true")
+	// Store settings and the admin token are only read at startup
+	t.Setenv("DB_SOFT_DELETE", "true")
+	t.Setenv("DB_PQ_SUBSPACES", "4")
+	t.Setenv("LOG_REQUEST_IDS", "false")
+	t.Setenv("ADMIN_TOKEN", "secret")
+	resp, body := doRequest(t, http.MethodPost, server.URL+"/admin/reload", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	if logger.Default.GetLevel() != logrus.DebugLevel {
+		t.Errorf("Expected log level debug, got %s", logger.Default.GetLevel())
+	}
+
+	data := body["data"].(map[string]interface{})
+	changed := data["changed"].([]interface{})
+	if len(changed) != 1 || changed[0] != "log_level" {
+		t.Errorf("Expected changed [log_level], got %v", changed)
+	}
+	expected := []interface{}{"admin_token", "db_path", "db_soft_delete", "db_pq_subspaces", "log_request_ids", "search_stream"}
+	if ignored := data["ignored"].([]interface{}); !reflect.DeepEqual(ignored, expected) {
+		t.Errorf("Expected ignored %v, got %v", expected, ignored)
+	}
+
+	// Ignored settings are reported again until a restart
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/admin/reload", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the admin token to be left as it was, got %d", resp.StatusCode)
+	}
+	if ignored := body["data"].(map[string]interface{})["ignored"].([]interface{}); !reflect.DeepEqual(ignored, expected) {
+		t.Errorf("Expected ignored %v on the second reload, got %v", expected, ignored)
+	}
+}
+
+func TestHandler_SearchQueryParams(t *testing.T) {
+	server, testStore := newTestServer(t, config.Load())
+
+	vectors := []*models.Vector{
+		{ID: "a", Vector: []float64{1, 0, 0}, Metadata: map[string]string{"topic": "ai"}},
+		{ID: "b", Vector: []float64{0, 1, 0}, Metadata: map[string]string{"topic": "math"}},
+		{ID: "c", Vector: []float64{0.9, 0.1, 0}, Metadata: map[string]string{"topic": "math"}},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(context.Background(), v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	// Pack [1, 0, 0] as little-endian float32
+	packed := make([]byte, 12)
+	binary.LittleEndian.PutUint32(packed, math.Float32bits(1))
+
+	tests := []struct {
+		name     string
+		query    string
+		status   int
+		expected []string
+	}{
+		{"comma", "vector=1,0,0", http.StatusOK, []string{"a", "c", "b"}},
+		{"comma with filter", "vector=1,0,0&filter=topic:math", http.StatusOK, []string{"c", "b"}},
+		{"base64", "vector_b64=" + url.QueryEscape(base64.StdEncoding.EncodeToString(packed)), http.StatusOK, []string{"a", "c", "b"}},
+		{"malformed comma", "vector=1,abc,0", http.StatusBadRequest, nil},
+		{"malformed base64", "vector_b64=AAAA!", http.StatusBadRequest, nil},
+		{"truncated base64", "vector_b64=AAA=", http.StatusBadRequest, nil},
+		{"malformed filter", "vector=1,0,0&filter=topic", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodGet, server.URL+"/search?"+tt.query, "")
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Expected status %d, got %d: %v", tt.status, resp.StatusCode, body)
+			}
+			if tt.expected == nil {
+				return
+			}
+
+			results := body["data"].([]interface{})
+			if len(results) != len(tt.expected) {
+				t.Fatalf("Expected %d results, got %d", len(tt.expected), len(results))
+			}
+			for i, id := range tt.expected {
+				got := results[i].(map[string]interface{})["vector"].(map[string]interface{})["id"]
+				if got != id {
+					t.Errorf("Expected result %d to be %s, got %v", i, id, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_AdminAuth(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	server, testStore := newTestServer(t, config.Load())
+
+	vector := &models.Vector{ID: "a", Vector: []float64{1, 2}, Metadata: map[string]string{"topic": "ai"}}
+	if err := testStore.InsertVector(context.Background(), vector); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	resp, _ := doRequest(t, http.MethodGet, server.URL+"/admin/index/topic/ai", "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 without token, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/admin/index/topic/ai", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data []string `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || len(body.Data) != 1 || body.Data[0] != "a" {
+		t.Errorf("Expected postings [a], got %d %v", resp.StatusCode, body.Data)
+	}
+}
+
+func TestHandler_Compact(t *testing.T) {
+	server, _ := newTestServer(t, config.Load())
+
+	resp, body := doRequest(t, http.MethodPost, server.URL+"/admin/compact", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if data := body["data"].(map[string]interface{}); data["reclaimed"] != 0.0 {
+		t.Errorf("Expected nothing reclaimed, got %v", data)
+	}
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/admin/compact?async=true", "")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", resp.StatusCode)
+	}
+	if data := body["data"].(map[string]interface{}); data["kind"] != "compact" || data["id"] == "" {
+		t.Errorf("Expected a compact operation, got %v", data)
+	}
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/admin/compact?async=maybe", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid async, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_FlushCache(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	server, _ := newTestServer(t, config.Load())
+
+	resp, _ := doRequest(t, http.MethodPost, server.URL+"/admin/cache/flush", "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 without token, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/admin/cache/flush", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data map[string]int `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.Data["evicted"] != 0 {
+		t.Errorf("Expected nothing evicted from the disabled cache, got %d %v", resp.StatusCode, body.Data)
+	}
+}
+
+func TestHandler_IntegerMetadataRoundTrip(t *testing.T) {
+	server, _ := newTestServer(t, config.Load())
+
+	resp, body := doRequest(t, http.MethodPost, server.URL+"/vectors",
+		`{"id": "v1", "vector": [1, 0], "metadata": {"year": 2020, "score": 0.5, "draft": false}}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %v", resp.StatusCode, body)
+	}
+	doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v2", "vector": [1, 0], "metadata": {"year": 2021}}`)
+	doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v4", "vector": [0, 1], "metadata": {"year": "2022"}}`)
+
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/vectors/v1", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	metadata := body["data"].(map[string]interface{})["metadata"].(map[string]interface{})
+	if metadata["year"] != 2020.0 || metadata["score"] != 0.5 || metadata["draft"] != false {
+		t.Errorf("Expected metadata values with their JSON types, got %v", metadata)
+	}
+	_, body = doRequest(t, http.MethodGet, server.URL+"/vectors/v4", "")
+	if metadata := body["data"].(map[string]interface{})["metadata"].(map[string]interface{}); metadata["year"] != "2022" {
+		t.Errorf("Expected string metadata to stay a string, got %v", metadata)
+	}
+
+	// Query string filters match numbers by their literal form
+	resp, body = doRequest(t, http.MethodGet, server.URL+"/search?vector=1,0&filter=year:2021", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, body)
+	}
+	if results := body["data"].([]interface{}); len(results) != 1 || results[0].(map[string]interface{})["vector"].(map[string]interface{})["id"] != "v2" {
+		t.Errorf("Expected query string filter to match v2 only, got %v", results)
+	}
+
+	resp, body = doRequest(t, http.MethodPost, server.URL+"/search", `{"query": [1, 0], "filter": {"year": 2020}}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, body)
+	}
+	results := body["data"].([]interface{})
+	if len(results) != 1 || results[0].(map[string]interface{})["vector"].(map[string]interface{})["id"] != "v1" {
+		t.Errorf("Expected integer filter to match v1 only, got %v", results)
+	}
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v3", "vector": [1, 0], "metadata": {"tags": ["a"]}}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for non-scalar metadata, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_SearchEchoesEffectiveWeights(t *testing.T) {
+	server, _ := newTestServer(t, config.Load())
+	doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v1", "vector": [1, 0], "text": "hello world"}`)
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		weights map[string]interface{}
+	}{
+		{"search default", "/search", `{"query": [1, 0]}`, map[string]interface{}{"vector": 1.0, "recency": 0.0}},
+		{"search recency", "/search", `{"query": [1, 0], "recency_weight": 0.25}`, map[string]interface{}{"vector": 0.75, "recency": 0.25}},
+		{"hybrid default", "/search/hybrid", `{"query": "hello", "query_vector": [1, 0]}`, map[string]interface{}{"vector": 0.5, "keyword": 0.5}},
+		{"hybrid explicit", "/search/hybrid", `{"query": "hello", "query_vector": [1, 0], "vector_weight": 0.2, "keyword_weight": 0.8}`, map[string]interface{}{"vector": 0.2, "keyword": 0.8}},
+		{"hybrid keyword only", "/search/hybrid", `{"query": "hello", "allow_keyword_only": true}`, map[string]interface{}{"vector": 0.0, "keyword": 1.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodPost, server.URL+tt.path, tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, body)
+			}
+			meta := body["meta"].(map[string]interface{})
+			if meta["metric"] != "cosine" {
+				t.Errorf("Expected metric cosine, got %v", meta["metric"])
+			}
+			if !reflect.DeepEqual(meta["weights"], tt.weights) {
+				t.Errorf("Expected weights %v, got %v", tt.weights, meta["weights"])
+			}
+		})
+	}
+}
+
+func TestHandler_SearchCollection(t *testing.T) {
+	server, testStore := newTestServer(t, config.Load())
+	ctx := context.Background()
+
+	for _, collection := range []string{"blue", "green"} {
+		for i := 0; i < 3; i++ {
+			err := testStore.InsertVector(ctx, &models.Vector{
+				ID:       fmt.Sprintf("%s-%d", collection, i),
+				Vector:   []float64{1, float64(i)},
+				Text:     "the quick brown fox",
+				Metadata: models.Metadata{"collection": collection},
+			})
+			if err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+	}
+	if _, err := testStore.SetAlias(ctx, "products", "green"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/search/hybrid", `{"query": "fox", "query_vector": [1, 0], "collection": "products"}`},
+		{"/search/blended", `{"query": "fox", "query_vector": [1, 0], "collection": "products"}`},
+		{"/search/unified", `{"query": "fox", "query_vector": [1, 0], "collection": "products"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodPost, server.URL+tt.path, tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, body)
+			}
+			results := body["data"].([]interface{})
+			if len(results) != 3 {
+				t.Errorf("Expected the 3 vectors of the green collection, got %v", results)
+			}
+			for _, result := range results {
+				if id := result.(map[string]interface{})["id"].(string); !strings.HasPrefix(id, "green-") {
+					t.Errorf("Expected only green results, got %s", id)
+				}
+			}
+			if collection := body["meta"].(map[string]interface{})["collection"]; collection != "green" {
+				t.Errorf("Expected meta.collection green, got %v", collection)
+			}
+		})
+	}
+}
+
+func TestHandler_StrictJSON(t *testing.T) {
+	body := `{"id": "v1", "vector": [1, 0], "vectors": [1, 0]}`
+
+	t.Run("lenient", func(t *testing.T) {
+		server, _ := newTestServer(t, config.Load())
+		resp, _ := doRequest(t, http.MethodPost, server.URL+"/vectors", body)
+		if resp.StatusCode != http.StatusCreated {
+			t.Errorf("Expected status 201 in lenient mode, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		t.Setenv("STRICT_JSON", "true")
+		server, _ := newTestServer(t, config.Load())
+		resp, result := doRequest(t, http.MethodPost, server.URL+"/vectors", body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 in strict mode, got %d", resp.StatusCode)
+		}
+		details, _ := result["error"].(map[string]interface{})["details"].(string)
+		if !strings.Contains(details, `"vectors"`) {
+			t.Errorf("Expected error to name the unknown field, got %q", details)
+		}
+	})
+}
+
+func TestHandler_DebugBodyLogging(t *testing.T) {
+	body := `{"id": "v1", "vector": [0.1, 0.2, 0.3, 0.4, 0.5, 0.6], "text": "secret text"}`
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		logged  bool
+		present []string
+		absent  []string
+	}{
+		{"disabled", nil, false, nil, nil},
+		{"enabled", map[string]string{"DEBUG_LOG_BODIES": "true", "DEBUG_REDACT_FIELDS": "text"}, true,
+			[]string{`\"id\":\"v1\"`, `0.4,\"... (2 more)\"`, `[REDACTED]`}, []string{"0.5,0.6", "secret text"}},
+		{"matching route", map[string]string{"DEBUG_LOG_BODIES": "true", "DEBUG_LOG_BODY_ROUTES": "/vectors"}, true,
+			[]string{`\"id\":\"v1\"`}, nil},
+		{"other route", map[string]string{"DEBUG_LOG_BODIES": "true", "DEBUG_LOG_BODY_ROUTES": "/search"}, false, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			var logs strings.Builder
+			logger.Init(logger.Config{Level: "info", Format: "json"})
+			logger.Default.SetOutput(&logs)
+			t.Cleanup(func() { logger.Init(logger.Config{Level: "info", Format: "json"}) })
+
+			// Route prefixes are relative to where the API is mounted
+			_, testStore := newTestServer(t, config.Load())
+			router := chi.NewRouter()
+			router.Mount("/api/v1", api.NewHandler(testStore, config.Load()).Routes())
+			server := httptest.NewServer(router)
+			t.Cleanup(server.Close)
+
+			resp, _ := doRequest(t, http.MethodPost, server.URL+"/api/v1/vectors", body)
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+			}
+
+			output := logs.String()
+			if logged := strings.Contains(output, "HTTP bodies"); logged != tt.logged {
+				t.Fatalf("Expected bodies logged %v, got logs %s", tt.logged, output)
+			}
+			for _, s := range tt.present {
+				if !strings.Contains(output, s) {
+					t.Errorf("Expected logs to contain %s, got %s", s, output)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(output, s) {
+					t.Errorf("Expected logs not to contain %s, got %s", s, output)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_DebugBodyLoggingKeepsBodyLimit(t *testing.T) {
+	t.Setenv("DEBUG_LOG_BODIES", "true")
+	t.Setenv("MAX_BODY_BYTES", "1024")
+	var logs strings.Builder
+	logger.Init(logger.Config{Level: "info", Format: "json"})
+	logger.Default.SetOutput(&logs)
+	t.Cleanup(func() { logger.Init(logger.Config{Level: "info", Format: "json"}) })
+	server, _ := newTestServer(t, config.Load())
+
+	text := strings.Repeat("x", 1<<16)
+	resp, _ := doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v1", "vector": [1], "text": "`+text+`"}`)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(logs.String(), "HTTP bodies") {
+		t.Fatalf("Expected bodies to be logged, got %s", logs.String())
+	}
+	if strings.Contains(logs.String(), text[:2048]) {
+		t.Error("Expected no more of the request body to be read than the body size limit")
+	}
+}
+
+func TestHandler_Compare(t *testing.T) {
+	server, _ := newTestServer(t, config.Load())
+	doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "a", "vector": [1, 0]}`)
+	doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "b", "vector": [1, 1]}`)
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		score    float64
+		distance float64
+	}{
+		{"ids", `{"a": "a", "b": "b"}`, http.StatusOK, 1 / math.Sqrt2, 1 - 1/math.Sqrt2},
+		{"inline", `{"a": [3, 4], "b": [3, 4]}`, http.StatusOK, 1, 0},
+		{"mixed euclidean", `{"a": "a", "b": [4, 4], "metric": "euclidean"}`, http.StatusOK, 1.0 / 6, 5},
+		{"dot", `{"a": "b", "b": [2, 3], "metric": "dot"}`, http.StatusOK, 5, -5},
+		{"dimension mismatch", `{"a": "a", "b": [1, 0, 0]}`, http.StatusBadRequest, 0, 0},
+		{"unknown id", `{"a": "a", "b": "missing"}`, http.StatusNotFound, 0, 0},
+		{"unknown metric", `{"a": "a", "b": "b", "metric": "manhattan"}`, http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodPost, server.URL+"/compare", tt.body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Expected status %d, got %d: %v", tt.status, resp.StatusCode, body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			data := body["data"].(map[string]interface{})
+			if score := data["score"].(float64); math.Abs(score-tt.score) > 1e-9 {
+				t.Errorf("Expected score %f, got %f", tt.score, score)
+			}
+			if distance := data["distance"].(float64); math.Abs(distance-tt.distance) > 1e-9 {
+				t.Errorf("Expected distance %f, got %f", tt.distance, distance)
+			}
+		})
+	}
+}
+
+func TestHandler_SearchAnalytics(t *testing.T) {
+	t.Setenv("ANALYTICS_ENABLED", "true")
+	server, _ := newTestServer(t, config.Load())
+	doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v1", "vector": [0.25, 0.75], "text": "hello world", "metadata": {"topic": "ai"}}`)
+
+	doRequest(t, http.MethodPost, server.URL+"/search", `{"query": [0.25, 0.75], "top_k": 5, "filter": {"topic": "ai"}}`)
+	doRequest(t, http.MethodPost, server.URL+"/search/hybrid", `{"query": "hello", "query_vector": [0.25, 0.75]}`)
+
+	resp, body := doRequest(t, http.MethodGet, server.URL+"/admin/analytics/searches", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, body)
+	}
+	events := body["data"].([]interface{})
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 recorded searches, got %v", events)
+	}
+
+	search := events[0].(map[string]interface{})
+	if search["kind"] != "search" || search["top_k"] != 5.0 || search["results"] != 1.0 || search["dimension"] != 2.0 {
+		t.Errorf("Expected search parameters to be recorded, got %v", search)
+	}
+	if filter := search["filter"].(map[string]interface{}); filter["topic"] != "ai" {
+		t.Errorf("Expected filter to be recorded, got %v", filter)
+	}
+	hybrid := events[1].(map[string]interface{})
+	if hybrid["kind"] != "hybrid_search" || hybrid["text"] != "hello" {
+		t.Errorf("Expected hybrid search text to be recorded, got %v", hybrid)
+	}
+	if encoded, _ := json.Marshal(events); strings.Contains(string(encoded), "0.75") {
+		t.Errorf("Expected query vectors to be redacted, got %s", encoded)
+	}
+
+	from := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339Nano))
+	_, body = doRequest(t, http.MethodGet, server.URL+"/admin/analytics/searches?from="+from, "")
+	if events := body["data"].([]interface{}); len(events) != 0 {
+		t.Errorf("Expected no searches after from, got %v", events)
+	}
+}
+
+func TestHandler_SearchFeedback(t *testing.T) {
+	server, _ := newTestServer(t, config.Load())
+	if resp, body := doRequest(t, http.MethodPost, server.URL+"/search/feedback", `{"query_id": "shoes"}`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403 while feedback is disabled, got %d: %v", resp.StatusCode, body)
+	}
+
+	// Feedback can be enabled without a restart
+	t.Setenv("ANALYTICS_FEEDBACK", "true")
+	if resp, body := doRequest(t, http.MethodPost, server.URL+"/admin/reload", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 reloading, got %d: %v", resp.StatusCode, body)
+	}
+	if resp, body := doRequest(t, http.MethodPost, server.URL+"/search/feedback", `{"clicked_ids": ["v1"]}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a query ID, got %d: %v", resp.StatusCode, body)
+	}
+
+	// Two of the three searches for shoes got clicks
+	t.Setenv("ANALYTICS_ENABLED", "true")
+	doRequest(t, http.MethodPost, server.URL+"/admin/reload", "")
+	var queryIDs []string
+	for _, text := range []string{"shoes", "shoes", "shoes", "socks"} {
+		resp, result := doRequest(t, http.MethodPost, server.URL+"/search/hybrid", `{"query": "`+text+`", "query_vector": [1, 0]}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, result)
+		}
+		queryID, _ := result["meta"].(map[string]interface{})["query_id"].(string)
+		if queryID == "" || slices.Contains(queryIDs, queryID) {
+			t.Fatalf("Expected a new query ID, got %q after %v", queryID, queryIDs)
+		}
+		queryIDs = append(queryIDs, queryID)
+	}
+	for _, body := range []string{
+		`{"query_id": "` + queryIDs[0] + `", "clicked_ids": ["v1", "v2"]}`,
+		`{"query_id": "` + queryIDs[1] + `", "clicked_ids": ["v1"]}`,
+		`{"query_id": "unknown", "clicked_ids": ["v1"]}`,
+	} {
+		if resp, result := doRequest(t, http.MethodPost, server.URL+"/search/feedback", body); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %v", resp.StatusCode, result)
+		}
+	}
+
+	resp, body := doRequest(t, http.MethodGet, server.URL+"/admin/analytics/feedback", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, body)
+	}
+	queries := body["data"].([]interface{})
+	if len(queries) != 2 {
+		t.Fatalf("Expected feedback on 2 queries, got %v", queries)
+	}
+	shoes := queries[0].(map[string]interface{})
+	if shoes["query"] != "shoes" || shoes["searches"] != 3.0 || shoes["clicked_searches"] != 2.0 || shoes["clicks"] != 3.0 {
+		t.Errorf("Expected shoes to be searched 3 times with 3 clicks in 2 of them, got %v", shoes)
+	}
+	if ctr := shoes["click_through_rate"].(float64); math.Abs(ctr-2.0/3) > 1e-9 {
+		t.Errorf("Expected a click-through rate of 2/3, got %v", ctr)
+	}
+	if clicked := shoes["clicked_ids"].(map[string]interface{}); clicked["v1"] != 2.0 || clicked["v2"] != 1.0 {
+		t.Errorf("Expected clicks by result, got %v", clicked)
+	}
+	if socks := queries[1].(map[string]interface{}); socks["query"] != "socks" || socks["searches"] != 1.0 || socks["click_through_rate"] != 0.0 {
+		t.Errorf("Expected socks to be searched once without clicks, got %v", socks)
+	}
+
+	_, body = doRequest(t, http.MethodGet, server.URL+"/admin/analytics/feedback?query=socks", "")
+	if queries := body["data"].([]interface{}); len(queries) != 1 || queries[0].(map[string]interface{})["query"] != "socks" {
+		t.Errorf("Expected only socks, got %v", queries)
+	}
+	from := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339Nano))
+	_, body = doRequest(t, http.MethodGet, server.URL+"/admin/analytics/feedback?from="+from, "")
+	if queries := body["data"].([]interface{}); len(queries) != 0 {
+		t.Errorf("Expected no searches after from, got %v", queries)
+	}
+}
+
+func TestHandler_ValidatePayloads(t *testing.T) {
+	server, testStore := newTestServer(t, config.Load())
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		errors map[string]string
+	}{
+		{"valid vector", "/vectors/validate", `{"id": "v1", "vector": [1, 0], "metadata": {"topic": "ai"}}`, nil},
+		{"missing id", "/vectors/validate", `{"vector": [1, 0]}`, map[string]string{"id": "ID is required"}},
+		{"empty vector", "/vectors/validate", `{"id": "v1", "vector": []}`, map[string]string{"vector": "Vector must be at least 1"}},
+		{"reserved metadata key", "/vectors/validate", `{"id": "v1", "vector": [1], "metadata": {"embedding_model": "x"}}`,
+			map[string]string{"metadata": `metadata key "embedding_model" is reserved, use the embedding_model field instead`}},
+		{"valid document", "/documents/validate", `{"id": "d1", "title": "Title", "content": "Content"}`, nil},
+		{"missing title", "/documents/validate", `{"id": "d1", "content": "Content"}`, map[string]string{"title": "Title is required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, http.MethodPost, server.URL+tt.path, tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, body)
+			}
+
+			data := body["data"].(map[string]interface{})
+			if valid := data["valid"].(bool); valid != (tt.errors == nil) {
+				t.Errorf("Expected valid %v, got %v", tt.errors == nil, data)
+			}
+			errs, _ := data["errors"].(map[string]interface{})
+			if len(errs) != len(tt.errors) {
+				t.Fatalf("Expected errors %v, got %v", tt.errors, errs)
+			}
+			for field, message := range tt.errors {
+				if errs[field] != message {
+					t.Errorf("Expected %s error %q, got %q", field, message, errs[field])
+				}
+			}
+		})
+	}
+
+	resp, _ := doRequest(t, http.MethodPost, server.URL+"/vectors/validate", `{"id": "v1", "vector": [1,`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for malformed JSON, got %d", resp.StatusCode)
+	}
+
+	// IDs failing the store's pattern are reported under id
+	strict := httptest.NewServer(api.NewHandler(newTestStore(t, store.Config{DBPath: "test_api_strict_ids.db", ValidateIDs: true}), config.Load()).Routes())
+	t.Cleanup(strict.Close)
+	_, body := doRequest(t, http.MethodPost, strict.URL+"/vectors/validate", `{"id": "a b", "vector": [1]}`)
+	if errs, _ := body["data"].(map[string]interface{})["errors"].(map[string]interface{}); errs["id"] != `vector ID "a b" must match ^[A-Za-z0-9._-]+$` {
+		t.Errorf("Expected an id error, got %v", body["data"])
+	}
+
+	if _, err := testStore.GetVector(context.Background(), "v1"); err == nil {
+		t.Error("Expected validated vector not to be stored")
+	}
+	if _, err := testStore.GetDocument(context.Background(), "d1"); err == nil {
+		t.Error("Expected validated document not to be stored")
+	}
+}
+
+func TestHandler_MaxConns(t *testing.T) {
+	t.Setenv("MAX_CONNS", "1")
+	server, _ := newTestServer(t, config.Load())
+
+	// Hold a request in flight by never finishing its body.
+	body, writer := io.Pipe()
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/vectors", body)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	writer.Write([]byte(`{"id": "v1", `))
+
+	status := 0
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp, _ := doRequest(t, http.MethodGet, server.URL+"/health", "")
+		if status = resp.StatusCode; status == http.StatusServiceUnavailable {
+			break
+		}
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while a request is in flight, got %d", status)
+	}
+
+	writer.Write([]byte(`"vector": [1, 0]}`))
+	writer.Close()
+	<-held
+
+	resp, _ := doRequest(t, http.MethodGet, server.URL+"/health", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 once the request finished, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_EscapedVectorIDs(t *testing.T) {
+	server, _ := newTestServer(t, config.Load())
+
+	for _, id := range []string{"v1", "a/b", "a b", "100%"} {
+		body := `{"id": "` + id + `", "vector": [1, 0]}`
+		if resp, _ := doRequest(t, http.MethodPost, server.URL+"/vectors", body); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201 creating %q, got %d", id, resp.StatusCode)
+		}
+
+		resp, result := doRequest(t, http.MethodGet, server.URL+"/vectors/"+url.PathEscape(id), "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200 fetching %q, got %d", id, resp.StatusCode)
+		}
+		if got := result["data"].(map[string]interface{})["id"]; got != id {
+			t.Errorf("Expected vector %q, got %v", id, got)
+		}
+
+		if resp, _ := doRequest(t, http.MethodDelete, server.URL+"/vectors/"+url.PathEscape(id), ""); resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected status 204 deleting %q, got %d", id, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandler_ValidationErrorFields(t *testing.T) {
+	server, _ := newTestServer(t, config.Load())
+
+	resp, result := doRequest(t, http.MethodPost, server.URL+"/vectors", `{"text": "no id or vector"}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+	}
+
+	errInfo := result["error"].(map[string]interface{})
+	if errInfo["message"] != "validation failed" {
+		t.Errorf("Expected summary message to be kept, got %v", errInfo["message"])
+	}
+	fields, _ := errInfo["validation_errors"].(map[string]interface{})
+	want := map[string]string{"id": "ID is required", "vector": "Vector is required"}
+	if len(fields) != len(want) {
+		t.Fatalf("Expected field errors %v, got %v", want, fields)
+	}
+	for field, message := range want {
+		if fields[field] != message {
+			t.Errorf("Expected %s error %q, got %v", field, message, fields[field])
+		}
+	}
+
+	// Fields are named as in the JSON body
+	resp, result = doRequest(t, http.MethodPost, server.URL+"/search", `{"query": [1, 0], "top_k": 5000}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", resp.StatusCode)
+	}
+	fields, _ = result["error"].(map[string]interface{})["validation_errors"].(map[string]interface{})
+	if fields["top_k"] != "TopK must be at most 1000" {
+		t.Errorf("Expected a top_k error, got %v", fields)
+	}
+}
+
+func TestHandler_SearchResponseSizeLimit(t *testing.T) {
+	t.Setenv("SEARCH_MAX_RESPONSE_BYTES", "4096")
+	server, testStore := newTestServer(t, config.Load())
+
+	ctx := context.Background()
+	padding := strings.Repeat("x", 1000)
+	for i := 0; i < 10; i++ {
+		vector := &models.Vector{
+			ID:       "v" + strconv.Itoa(i),
+			Vector:   []float64{1, float64(i)},
+			Text:     "fox",
+			Metadata: map[string]string{"padding": padding},
+		}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	for _, tt := range []struct{ path, body string }{
+		{"/search", `{"query": [1, 0], "top_k": 10, "limit": 10}`},
+		{"/search/hybrid", `{"query": "fox", "query_vector": [1, 0], "limit": 10, "include_vector": true}`},
+	} {
+		resp, result := doRequest(t, http.MethodPost, server.URL+tt.path, tt.body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200 from %s, got %d", tt.path, resp.StatusCode)
+		}
+
+		data := result["data"].([]interface{})
+		meta := result["meta"].(map[string]interface{})
+		if meta["truncated"] != true || meta["truncated_from"] != float64(10) {
+			t.Errorf("Expected %s to be truncated from 10 results, got meta %v", tt.path, meta)
+		}
+		if len(data) == 0 || len(data) >= 10 || meta["returned"] != float64(len(data)) {
+			t.Errorf("Expected %s to return some but not all results, got %d with meta %v", tt.path, len(data), meta)
+		}
+		if encoded, _ := json.Marshal(data); len(encoded) > 4096 {
+			t.Errorf("Expected %s results to fit in 4096 bytes, got %d", tt.path, len(encoded))
+		}
+		if meta["has_next"] != true || meta["next_offset"] != float64(len(data)) {
+			t.Errorf("Expected %s to offer the rest from offset %d, got meta %v", tt.path, len(data), meta)
+		}
+	}
+
+	// Following next_offset returns every result once
+	seen := map[string]bool{}
+	for offset, requests := 0, 0; ; requests++ {
+		if requests == 10 {
+			t.Fatalf("Expected to page through 10 results, got %d after %d requests", len(seen), requests)
+		}
+		body := fmt.Sprintf(`{"query": [1, 0], "top_k": 10, "limit": 10, "offset": %d}`, offset)
+		resp, result := doRequest(t, http.MethodPost, server.URL+"/search", body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		for _, item := range result["data"].([]interface{}) {
+			id := item.(map[string]interface{})["vector"].(map[string]interface{})["id"].(string)
+			if seen[id] {
+				t.Errorf("Expected %s to be returned once", id)
+			}
+			seen[id] = true
+		}
+		meta := result["meta"].(map[string]interface{})
+		if meta["has_next"] != true {
+			break
+		}
+		offset = int(meta["next_offset"].(float64))
+	}
+	if len(seen) != 10 {
+		t.Errorf("Expected all 10 results across the pages, got %d", len(seen))
+	}
+
+	resp, result := doRequest(t, http.MethodPost, server.URL+"/search", `{"query": [1, 0], "top_k": 2}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if meta := result["meta"].(map[string]interface{}); meta["truncated"] != nil || len(result["data"].([]interface{})) != 2 {
+		t.Errorf("Expected results under the limit to be returned whole, got meta %v", meta)
+	}
+}
+
+func TestHandler_GroupedAndAdhocResponseSizeLimit(t *testing.T) {
+	t.Setenv("SEARCH_MAX_RESPONSE_BYTES", "4096")
+	server, testStore := newTestServer(t, config.Load())
+
+	ctx := context.Background()
+	padding := strings.Repeat("x", 1000)
+	adhoc := make([]string, 10)
+	for i := 0; i < 10; i++ {
+		vector := &models.Vector{
+			ID:       "v" + strconv.Itoa(i),
+			Vector:   []float64{1, float64(i)},
+			Metadata: map[string]string{"padding": padding, "group": strconv.Itoa(i % 2)},
+		}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		adhoc[i] = fmt.Sprintf(`{"id": "a%d", "vector": [1, %d], "metadata": {"padding": %q}}`, i, i, padding)
+	}
+
+	resp, result := doRequest(t, http.MethodPost, server.URL+"/search", `{"query": [1, 0], "top_k": 10, "group_by": "group", "group_size": 5}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	groups := result["data"].(map[string]interface{})
+	meta := result["meta"].(map[string]interface{})
+	returned := 0
+	for _, group := range groups {
+		returned += len(group.([]interface{}))
+	}
+	if encoded, _ := json.Marshal(groups); len(encoded) > 4096 {
+		t.Errorf("Expected the groups to fit in 4096 bytes, got %d", len(encoded))
+	}
+	if meta["truncated"] != true || meta["truncated_from"] != float64(10) || meta["returned"] != float64(returned) || returned == 0 {
+		t.Errorf("Expected the groups to be truncated from 10 results to %d, got meta %v", returned, meta)
+	}
+
+	body := `{"query": [1, 0], "top_k": 10, "vectors": [` + strings.Join(adhoc, ",") + `]}`
+	resp, result = doRequest(t, http.MethodPost, server.URL+"/search/adhoc", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, result)
+	}
+	data := result["data"].([]interface{})
+	meta = result["meta"].(map[string]interface{})
+	if encoded, _ := json.Marshal(data); len(encoded) > 4096 {
+		t.Errorf("Expected the ad-hoc results to fit in 4096 bytes, got %d", len(encoded))
+	}
+	if meta["truncated"] != true || len(data) == 0 || meta["returned"] != float64(len(data)) {
+		t.Errorf("Expected the ad-hoc results to be truncated, got %d with meta %v", len(data), meta)
+	}
+	// There's no offset to resume an ad-hoc search from
+	if meta["has_next"] != false || meta["next_offset"] != nil {
+		t.Errorf("Expected no next offset for an ad-hoc search, got meta %v", meta)
+	}
+}
+
+func TestHandler_RejectsOversizedVectors(t *testing.T) {
+	t.Setenv("MAX_VECTOR_DIMENSION", "4")
+	server, testStore := newTestServer(t, config.Load())
+
+	huge := "[" + strings.Repeat("0.5,", 1000000) + "0.5]"
+	tests := []struct{ method, path, body string }{
+		{http.MethodPost, "/vectors", `{"id": "v1", "vector": ` + huge + `}`},
+		{http.MethodPost, "/vectors", `{"id": "v1", "vector": [1, 2, 3, 4, 5]}`},
+		{http.MethodPut, "/vectors/v1", `{"vector": [1, 2, 3, 4, 5]}`},
+		{http.MethodPost, "/search", `{"query": ` + huge + `}`},
+		{http.MethodPost, "/search/hybrid", `{"query": "fox", "query_vector": [1, 2, 3, 4, 5]}`},
+		{http.MethodPost, "/compare", `{"a": [1, 2, 3, 4, 5], "b": [1, 2, 3, 4, 5]}`},
+		{http.MethodPost, "/compare", `{"a": "v1", "b": [1, 2, 3, 4, 5]}`},
+		{http.MethodPatch, "/vectors/v1", `{"vector": [1, 2, 3, 4, 5]}`},
+		{http.MethodPost, "/vectors/batch", `{"vectors": [{"id": "v1", "vector": [1, 2, 3, 4, 5]}]}`},
+		{http.MethodPost, "/vectors/batch/update", `{"vectors": [{"id": "v1", "vector": [1, 2, 3, 4, 5]}]}`},
+		{http.MethodPost, "/search", `{"query": [1, 2], "negative_vectors": [[1, 2, 3, 4, 5]]}`},
+		{http.MethodPost, "/search/unified", `{"query": "fox", "query_vector": [1, 2, 3, 4, 5]}`},
+		{http.MethodPost, "/search/blended", `{"query_vector": [1, 2, 3, 4, 5]}`},
+		{http.MethodPost, "/search/adhoc", `{"query": [1, 2], "vectors": [{"id": "a", "vector": [1, 2, 3, 4, 5]}]}`},
+		{http.MethodGet, "/search?vector=1,2,3,4,5", ""},
+	}
+	for _, tt := range tests {
+		resp, result := doRequest(t, tt.method, server.URL+tt.path, tt.body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 from %s %s, got %d", tt.method, tt.path, resp.StatusCode)
+		}
+		if message := result["error"].(map[string]interface{})["message"]; message != "invalid vector dimension" {
+			t.Errorf("Expected dimension error from %s %s, got %v", tt.method, tt.path, message)
+		}
+	}
+
+	resp, _ := doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v1", "vector": [1, 2, 3, 4]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected a vector at the limit to be accepted, got %d", resp.StatusCode)
+	}
+	if _, err := testStore.GetVector(context.Background(), "v1"); err != nil {
+		t.Errorf("Expected vector to be stored: %v", err)
+	}
+}
+
+func TestHandler_RejectsOversizedNamedVectors(t *testing.T) {
+	t.Setenv("MAX_VECTOR_DIMENSION", "4")
+	server, testStore := newTestServer(t, config.Load())
+
+	tests := []struct{ method, path, body string }{
+		{http.MethodPost, "/vectors", `{"id": "v1", "vector": [1, 2], "named_vectors": {"title": [1, 2, 3, 4, 5]}}`},
+		{http.MethodPut, "/vectors/v1", `{"vector": [1, 2], "named_vectors": {"title": [1, 2, 3, 4, 5]}}`},
+	}
+	for _, tt := range tests {
+		resp, result := doRequest(t, tt.method, server.URL+tt.path, tt.body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 from %s %s, got %d", tt.method, tt.path, resp.StatusCode)
+		}
+		if message := result["error"].(map[string]interface{})["message"]; message != "invalid vector dimension" {
+			t.Errorf("Expected dimension error from %s %s, got %v", tt.method, tt.path, message)
+		}
+	}
+	if _, err := testStore.GetVector(context.Background(), "v1"); err == nil {
+		t.Error("Expected the vector with an oversized named vector not to be stored")
+	}
+
+	resp, _ := doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v1", "vector": [1, 2], "named_vectors": {"title": [1, 2, 3, 4]}}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected a named vector at the limit to be accepted, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_RejectsOversizedBodies(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "1024")
+	server, _ := newTestServer(t, config.Load())
+
+	resp, result := doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v1", "vector": [1], "text": "`+strings.Repeat("x", 2000)+`"}`)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d: %v", resp.StatusCode, result)
+	}
+	if resp, _ := doRequest(t, http.MethodPost, server.URL+"/vectors", `{"id": "v1", "vector": [1], "text": "short"}`); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected a body under the limit to be accepted, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_BatchCreateMultiStatus(t *testing.T) {
+	server, testStore := newTestServer(t, config.Load())
+
+	if err := testStore.InsertVector(context.Background(), &models.Vector{ID: "taken", Vector: []float64{1, 0}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	resp, result := doRequest(t, http.MethodPost, server.URL+"/vectors/batch", `{"vectors": [
+		{"id": "a", "vector": [1, 2]},
+		{"id": "taken", "vector": [3, 4]},
+		{"id": "b"},
+		{"id": "c", "vector": [5, 6]}
+	]}`)
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d", resp.StatusCode)
+	}
+
+	data := result["data"].(map[string]interface{})
+	if data["succeeded"] != float64(2) || data["failed"] != float64(2) {
+		t.Errorf("Expected 2 succeeded and 2 failed, got %v and %v", data["succeeded"], data["failed"])
+	}
+	items := data["items"].([]interface{})
+	want := []struct {
+		id     string
+		status int
+	}{
+		{"a", http.StatusCreated},
+		{"taken", http.StatusConflict},
+		{"b", http.StatusBadRequest},
+		{"c", http.StatusCreated},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("Expected %d items, got %d", len(want), len(items))
+	}
+	for i, w := range want {
+		item := items[i].(map[string]interface{})
+		if item["id"] != w.id || item["status"] != float64(w.status) {
+			t.Errorf("Expected item %d to be %s with status %d, got %v", i, w.id, w.status, item)
+		}
+		if failed := w.status != http.StatusCreated; failed != (item["error"] != nil) {
+			t.Errorf("Expected item %s to report an error only on failure, got %v", w.id, item["error"])
+		}
+	}
+	if fields, _ := items[2].(map[string]interface{})["validation_errors"].(map[string]interface{}); fields["vector"] == nil {
+		t.Errorf("Expected the invalid item to report its vector field, got %v", fields)
+	}
+
+	for _, id := range []string{"a", "c"} {
+		if _, err := testStore.GetVector(context.Background(), id); err != nil {
+			t.Errorf("Expected %s to be stored: %v", id, err)
+		}
+	}
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/vectors/batch", `{"vectors": [{"id": "d", "vector": [1, 1]}]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status 201 when every item succeeds, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_HeadExistenceChecks(t *testing.T) {
+	cfg := config.Load()
+	_, testStore := newTestServer(t, cfg)
+	routes := api.NewHandler(testStore, cfg).Routes()
+
+	ctx := context.Background()
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "vec", Vector: []float64{1, 2}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := testStore.InsertDocument(ctx, &models.Document{ID: "doc", Title: "Title", Content: "Content"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/vectors/vec", http.StatusOK},
+		{"/vectors/missing", http.StatusNotFound},
+		{"/documents/doc", http.StatusOK},
+		{"/documents/missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("Expected HEAD %s to return %d, got %d", tt.path, tt.status, rec.Code)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("Expected HEAD %s to return no body, got %q", tt.path, rec.Body.String())
+		}
+	}
+}
+
+func TestHandler_SearchProfileSampling(t *testing.T) {
+	t.Setenv("SEARCH_PROFILE_RATE", "0.3")
+	t.Setenv("SEARCH_PROFILE_SEED", "1")
+	var logs strings.Builder
+	logger.Init(logger.Config{Level: "info", Format: "json"})
+	logger.Default.SetOutput(&logs)
+	t.Cleanup(func() { logger.Init(logger.Config{Level: "info", Format: "json"}) })
+
+	server, testStore := newTestServer(t, config.Load())
+	for i := 0; i < 10; i++ {
+		v := &models.Vector{ID: strconv.Itoa(i), Vector: []float64{1, float64(i)}, Metadata: map[string]string{"even": strconv.FormatBool(i%2 == 0)}}
+		if err := testStore.InsertVector(context.Background(), v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	const searches = 400
+	for i := 0; i < searches; i++ {
+		resp, _ := doRequest(t, http.MethodPost, server.URL+"/search", `{"query": [1, 2], "filter": {"even": "true"}}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+	}
+
+	var profiled int
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if !strings.Contains(line, "Search profile") {
+			continue
+		}
+		profiled++
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", line, err)
+		}
+		if entry["candidates"] != float64(5) || entry["selectivity"] != 0.5 || entry["metric"] != "cosine" {
+			t.Fatalf("Expected 5 candidates at selectivity 0.5, got %v", entry)
+		}
+		for _, field := range []string{"filter_ms", "score_ms", "rank_ms"} {
+			if _, ok := entry[field]; !ok {
+				t.Fatalf("Expected %s in the profile, got %v", field, entry)
+			}
+		}
+	}
+
+	// The seed fixes the sample; 0.3 of 400 is 120, with a standard deviation
+	// of about 9
+	if profiled < 85 || profiled > 155 {
+		t.Errorf("Expected about 120 profiled searches, got %d", profiled)
+	}
+}
+
+func TestHandler_BatchUpdateAtomic(t *testing.T) {
+	server, testStore := newTestServer(t, config.Load())
+	if err := testStore.InsertVector(context.Background(), &models.Vector{ID: "a", Vector: []float64{1, 0}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	resp, result := doRequest(t, http.MethodPost, server.URL+"/vectors/batch/update", `{"atomic": true, "vectors": [
+		{"id": "a", "vector": [0, 1]},
+		{"id": "a2"}
+	]}`)
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d", resp.StatusCode)
+	}
+	items := result["data"].(map[string]interface{})["items"].([]interface{})
+	if status := items[0].(map[string]interface{})["status"]; status != float64(http.StatusFailedDependency) {
+		t.Errorf("Expected the valid update to be aborted with 424, got %v", status)
+	}
+	if status := items[1].(map[string]interface{})["status"]; status != float64(http.StatusBadRequest) {
+		t.Errorf("Expected the invalid update to fail with 400, got %v", status)
+	}
+	if a, _ := testStore.GetVector(context.Background(), "a"); a.Vector[0] != 1 {
+		t.Errorf("Expected a to be left unchanged, got %v", a.Vector)
+	}
+
+	resp, _ = doRequest(t, http.MethodPost, server.URL+"/vectors/batch/update", `{"vectors": [{"id": "a", "vector": [0, 1]}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 when every update applies, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_UpdateMissingVector(t *testing.T) {
+	for _, upsert := range []bool{false, true} {
+		t.Run(fmt.Sprintf("upsert=%v", upsert), func(t *testing.T) {
+			cfg := config.Load()
+			cfg.Server.UpsertOnPut = upsert
+			server, testStore := newTestServer(t, cfg)
+
+			resp, _ := doRequest(t, http.MethodPut, server.URL+"/vectors/new", `{"vector": [1, 0], "text": "created"}`)
+			vector, err := testStore.GetVector(context.Background(), "new")
+			if !upsert {
+				if resp.StatusCode != http.StatusNotFound || err != errors.ErrVectorNotFound {
+					t.Errorf("Expected 404 and no vector, got %d and %v", resp.StatusCode, err)
+				}
+				return
+			}
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+			}
+			if err != nil || vector.Text != "created" || vector.CreatedAt.IsZero() || !vector.UpdatedAt.Equal(vector.CreatedAt) {
+				t.Fatalf("Expected the vector to be created with timestamps, got %+v, %v", vector, err)
+			}
+
+			// Once it exists PUT updates it
+			resp, _ = doRequest(t, http.MethodPut, server.URL+"/vectors/new", `{"vector": [0, 1], "text": "updated"}`)
+			updated, _ := testStore.GetVector(context.Background(), "new")
+			if resp.StatusCode != http.StatusOK || updated.Text != "updated" || !updated.CreatedAt.Equal(vector.CreatedAt) {
+				t.Errorf("Expected 200 and an update keeping created_at, got %d and %+v", resp.StatusCode, updated)
+			}
+		})
+	}
+}
+
+// flushCounter counts the flushes of the responses it serves.
+type flushCounter struct {
+	http.ResponseWriter
+	flushes *atomic.Int64
+}
+
+func (f flushCounter) Flush() {
+	f.flushes.Add(1)
+	f.ResponseWriter.(http.Flusher).Flush()
+}
+
+func TestHandler_SearchStreamsOverHTTP2(t *testing.T) {
+	cfg := config.Load()
+	cfg.Search.Stream = true
+	cfg.Search.StreamFlushResults = 10
+	_, testStore := newTestServer(t, cfg)
+	for i := 0; i < 50; i++ {
+		v := &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: []float64{1, float64(i)}}
+		if err := testStore.InsertVector(context.Background(), v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	var flushes atomic.Int64
+	routes := api.NewHandler(testStore, cfg).Routes()
+	counted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes.ServeHTTP(flushCounter{ResponseWriter: w, flushes: &flushes}, r)
+	})
+	http1 := httptest.NewServer(counted)
+	t.Cleanup(http1.Close)
+	http2 := httptest.NewUnstartedServer(counted)
+	http2.EnableHTTP2 = true
+	http2.StartTLS()
+	t.Cleanup(http2.Close)
+
+	search := func(server *httptest.Server) (*http.Response, map[string]interface{}) {
+		flushes.Store(0)
+		resp, err := server.Client().Post(server.URL+"/search", "application/json",
+			strings.NewReader(`{"query": [1, 0], "top_k": 50, "limit": 50}`))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp, result
+	}
+
+	resp, streamed := search(http2)
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("Expected an HTTP/2 response, got %s", resp.Proto)
+	}
+	if n := flushes.Load(); n < 5 {
+		t.Errorf("Expected results to be flushed every 10, got %d flushes", n)
+	}
+
+	resp, buffered := search(http1)
+	if resp.ProtoMajor != 1 || flushes.Load() != 0 {
+		t.Errorf("Expected a buffered HTTP/1 response, got %s with %d flushes", resp.Proto, flushes.Load())
+	}
+
+	if !reflect.DeepEqual(streamed["data"], buffered["data"]) || !reflect.DeepEqual(streamed["meta"], buffered["meta"]) {
+		t.Errorf("Expected the streamed response to match the buffered one, got %v", streamed)
+	}
+	if len(streamed["data"].([]interface{})) != 50 || streamed["success"] != true {
+		t.Errorf("Expected 50 streamed results, got %v", streamed)
+	}
+}
+
+func TestLoggingMiddleware_RouteLevels(t *testing.T) {
+	var logs strings.Builder
+	logger.Init(logger.Config{Level: "info", Format: "json"})
+	logger.Default.SetOutput(&logs)
+	t.Cleanup(func() { logger.Init(logger.Config{Level: "info", Format: "json"}) })
+
+	routes, err := middleware.ParseRouteLogLevels([]string{"POST /vectors=info", "/search=debug", "/health=warn:x"})
+	if err == nil || len(routes) != 2 {
+		t.Fatalf("Expected the invalid sample rate to be reported and skipped, got %v and %v", routes, err)
+	}
+
+	cfg := config.Load()
+	_, testStore := newTestServer(t, cfg)
+	handler := middleware.LoggingMiddleware(routes)(api.NewHandler(testStore, cfg).Routes())
+	request := func(method, path, body string) string {
+		logs.Reset()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return logs.String()
+	}
+
+	if line := request(http.MethodPost, "/vectors", `{"id": "a", "vector": [1, 0]}`); !strings.Contains(line, `"level":"info"`) {
+		t.Errorf("Expected vector creation to be logged at info, got %q", line)
+	}
+	if line := request(http.MethodPost, "/search", `{"query": [1, 0]}`); strings.Contains(line, "HTTP request") {
+		t.Errorf("Expected search not to be logged at info, got %q", line)
+	}
+	logger.SetLevel("debug")
+	if line := request(http.MethodPost, "/search", `{"query": [1, 0]}`); !strings.Contains(line, `"level":"debug"`) {
+		t.Errorf("Expected search to be logged at debug, got %q", line)
+	}
+}
+
+func TestHandler_ExportIndex(t *testing.T) {
+	cfg := config.Load()
+	cfg.Server.IndexExportLimit = 3
+	server, testStore := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	for i := 0; i < 12; i++ {
+		metadata := models.Metadata{"shard": strconv.Itoa(i % 4), "parity": strconv.Itoa(i % 2)}
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("v%02d", i), Vector: []float64{1, 0}, Metadata: metadata}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	// Page through the export, larger limits being capped
+	var entries []models.IndexEntry
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("Expected the export to end")
+		}
+		resp, err := http.Get(server.URL + "/admin/index/export?ids=true&limit=100&cursor=" + url.QueryEscape(cursor))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("Expected an NDJSON export, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		decoder := json.NewDecoder(resp.Body)
+		page := 0
+		for decoder.More() {
+			var entry models.IndexEntry
+			if err := decoder.Decode(&entry); err != nil {
+				t.Fatalf("Failed to decode entry: %v", err)
+			}
+			entries = append(entries, entry)
+			page++
+		}
+		resp.Body.Close()
+		if page > 3 {
+			t.Errorf("Expected pages capped at 3 entries, got %d", page)
+		}
+		if cursor = resp.Header.Get("X-Next-Cursor"); cursor == "" {
+			break
+		}
+	}
+
+	// 4 shards and 2 parities, in key and value order, each matching the
+	// in-memory postings
+	want := []models.Posting{{Key: "parity", Value: "0"}, {Key: "parity", Value: "1"},
+		{Key: "shard", Value: "0"}, {Key: "shard", Value: "1"}, {Key: "shard", Value: "2"}, {Key: "shard", Value: "3"}}
+	if len(entries) != len(want) {
+		t.Fatalf("Expected %d entries, got %+v", len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry.Key != want[i].Key || entry.Value != want[i].Value {
+			t.Errorf("Expected entry %d to be %v, got %s=%s", i, want[i], entry.Key, entry.Value)
+		}
+		ids, _ := testStore.IndexPostings(ctx, entry.Key, entry.Value)
+		if entry.Count != len(ids) || !reflect.DeepEqual(entry.IDs, ids) {
+			t.Errorf("Expected %s=%s to export %v, got %d %v", entry.Key, entry.Value, ids, entry.Count, entry.IDs)
+		}
+	}
+
+	resp, body := doRequest(t, http.MethodGet, server.URL+"/admin/index/export?cursor=bogus!", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid cursor, got %d: %v", resp.StatusCode, body)
+	}
+}
+
+func TestHandler_DeterministicResponses(t *testing.T) {
+	cfg := config.Load()
+	cfg.Server.ResponseTimestamps = false
+	server, testStore := newTestServer(t, cfg)
+	ctx := context.Background()
+
+	// Every vector ties, so only the tie-break orders them
+	for i := 0; i < 30; i++ {
+		metadata := models.Metadata{"zone": "z", "author": "a", "mode": strconv.Itoa(i)}
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("v%02d", i), Vector: []float64{1, 0}, Metadata: metadata}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	search := func() string {
+		resp, err := http.Post(server.URL+"/search", "application/json", strings.NewReader(`{"query": [1, 0], "top_k": 5}`))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return string(body)
+	}
+
+	first := search()
+	for i := 0; i < 5; i++ {
+		if body := search(); body != first {
+			t.Fatalf("Expected identical bodies, got\n%s\nand\n%s", first, body)
+		}
+	}
+	if strings.Contains(first, `"timestamp"`) {
+		t.Errorf("Expected no timestamp, got %s", first)
+	}
+	// The setting is the handler's own
+	timed := httptest.NewServer(api.NewHandler(testStore, config.Load()).Routes())
+	t.Cleanup(timed.Close)
+	if _, body := doRequest(t, http.MethodGet, timed.URL+"/health", ""); body["timestamp"] == nil {
+		t.Errorf("Expected another handler to keep stamping responses, got %v", body)
+	}
+	if body := search(); body != first {
+		t.Errorf("Expected responses to stay unstamped, got %s", body)
+	}
+	if !strings.Contains(first, `"metadata":{"author":"a","mode":"0","zone":"z"}`) {
+		t.Errorf("Expected metadata keys sorted, got %s", first)
+	}
+	if i, j := strings.Index(first, `"v00"`), strings.Index(first, `"v04"`); i < 0 || j < i || strings.Contains(first, `"v05"`) {
+		t.Errorf("Expected ties ranked by ID, got %s", first)
+	}
+}
+
+func TestHandler_NullAndEmptyVectors(t *testing.T) {
+	server, testStore := newTestServer(t, config.Load())
+	ctx := context.Background()
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "v1", Vector: []float64{1, 2}, Metadata: models.Metadata{"state": "new"}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		// vectorError is the validation error expected on the vector field
+		vectorError string
+	}{
+		{"insert null", http.MethodPost, "/vectors", `{"id": "v2", "vector": null}`, http.StatusBadRequest, "Vector is required"},
+		{"insert missing", http.MethodPost, "/vectors", `{"id": "v2"}`, http.StatusBadRequest, "Vector is required"},
+		{"insert empty", http.MethodPost, "/vectors", `{"id": "v2", "vector": []}`, http.StatusBadRequest, "Vector must be at least 1"},
+		{"put null", http.MethodPut, "/vectors/v1", `{"vector": null}`, http.StatusBadRequest, "Vector is required"},
+		{"put empty", http.MethodPut, "/vectors/v1", `{"vector": []}`, http.StatusBadRequest, "Vector must be at least 1"},
+		{"patch empty", http.MethodPatch, "/vectors/v1", `{"vector": []}`, http.StatusBadRequest, "Vector must be at least 1"},
+		{"patch null", http.MethodPatch, "/vectors/v1", `{"vector": null, "metadata": {"state": "patched"}}`, http.StatusOK, ""},
+		{"patch missing", http.MethodPatch, "/vectors/v1", `{"metadata": {"state": "patched again"}}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, result := doRequest(t, tt.method, server.URL+tt.path, tt.body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Expected status %d, got %d: %v", tt.status, resp.StatusCode, result)
+			}
+			if tt.vectorError == "" {
+				return
+			}
+			fields, _ := result["error"].(map[string]interface{})["validation_errors"].(map[string]interface{})
+			if fields["vector"] != tt.vectorError {
+				t.Errorf("Expected vector error %q, got %v", tt.vectorError, fields)
+			}
+		})
+	}
+
+	// Patches without a vector keep the embedding, others replace it
+	vector, err := testStore.GetVector(ctx, "v1")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if !reflect.DeepEqual(vector.Vector, []float64{1, 2}) || vector.Metadata["state"] != "patched again" {
+		t.Errorf("Expected the embedding kept and the metadata patched, got %v %v", vector.Vector, vector.Metadata)
+	}
+	if resp, _ := doRequest(t, http.MethodPatch, server.URL+"/vectors/v1", `{"vector": [3, 4]}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if vector, _ = testStore.GetVector(ctx, "v1"); !reflect.DeepEqual(vector.Vector, []float64{3, 4}) || vector.Metadata["state"] != "patched again" {
+		t.Errorf("Expected the embedding replaced and the metadata kept, got %v %v", vector.Vector, vector.Metadata)
+	}
+	if resp, _ := doRequest(t, http.MethodPatch, server.URL+"/vectors/missing", `{"text": "x"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 patching a missing vector, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_VectorFormat(t *testing.T) {
+	server, testStore := newTestServer(t, config.Load())
+	ctx := context.Background()
+	values := []float64{0.123456789, -2.5, 1e-3, 0.987654321}
+	vector := &models.Vector{ID: "v1", Vector: values, NamedVectors: map[string][]float64{"title": {0.333333333, 0.25}}}
+	if err := testStore.InsertVector(ctx, vector); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	// decode reads an embedding written in any format back to floats
+	decode := func(t *testing.T, raw interface{}) []float64 {
+		t.Helper()
+		if packed, ok := raw.(string); ok {
+			data, err := base64.StdEncoding.DecodeString(packed)
+			if err != nil {
+				t.Fatalf("Failed to decode base64 vector: %v", err)
+			}
+			decoded := make([]float64, len(data)/4)
+			for i := range decoded {
+				decoded[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+			}
+			return decoded
+		}
+		elements, ok := raw.([]interface{})
+		if !ok {
+			t.Fatalf("Expected a vector, got %v", raw)
+		}
+		decoded := make([]float64, len(elements))
+		for i, element := range elements {
+			decoded[i] = element.(float64)
+		}
+		return decoded
+	}
+	assertClose := func(t *testing.T, got, want []float64, tolerance float64) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("Expected %d values, got %v", len(want), got)
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > tolerance {
+				t.Errorf("Value %d is %v, want %v within %v", i, got[i], want[i], tolerance)
+			}
+		}
+	}
+
+	tests := []struct {
+		query     string
+		tolerance float64
+	}{
+		{"", 0},
+		{"vector_format=float64", 0},
+		{"vector_format=float32", 1e-7},
+		{"vector_format=base64", 1e-7},
+		{"vector_format=rounded", 5e-5},
+		{"vector_format=rounded&vector_decimals=2", 5e-3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, result := doRequest(t, http.MethodGet, server.URL+"/vectors/v1?"+tt.query, "")
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, result)
+			}
+			data := result["data"].(map[string]interface{})
+			if data["id"] != "v1" {
+				t.Errorf("Expected the vector's other fields to be kept, got %v", data)
+			}
+			assertClose(t, decode(t, data["vector"]), values, tt.tolerance)
+			named := data["named_vectors"].(map[string]interface{})
+			assertClose(t, decode(t, named["title"]), vector.NamedVectors["title"], tt.tolerance)
+
+			body := `{"query": [0.1, -2.5, 0, 1], "top_k": 1}`
+			resp, result = doRequest(t, http.MethodPost, server.URL+"/search?"+tt.query, body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %v", resp.StatusCode, result)
+			}
+			hits := result["data"].([]interface{})
+			if len(hits) != 1 {
+				t.Fatalf("Expected 1 result, got %v", hits)
+			}
+			hit := hits[0].(map[string]interface{})
+			if _, ok := hit["score"].(float64); !ok {
+				t.Errorf("Expected the result's score to be kept, got %v", hit)
+			}
+			assertClose(t, decode(t, hit["vector"].(map[string]interface{})["vector"]), values, tt.tolerance)
+		})
+	}
+
+	for _, query := range []string{"vector_format=float16", "vector_format=rounded&vector_decimals=-1"} {
+		if resp, result := doRequest(t, http.MethodGet, server.URL+"/vectors/v1?"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d: %v", query, resp.StatusCode, result)
+		}
+	}
+}
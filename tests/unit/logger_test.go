@@ -0,0 +1,70 @@
+package store
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"vectraDB/internal/logger"
+)
+
+func TestNewFormatter(t *testing.T) {
+	tests := []struct {
+		format    string
+		json      bool
+		timestamp string
+		wantErr   bool
+	}{
+		{"json", true, "", false},
+		{"", true, "", false},
+		{"text", false, "2006-01-02T15:04:05Z07:00", false},
+		{"console", false, "15:04:05.000", false},
+		{"pretty", true, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			formatter, err := logger.NewFormatter(tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+
+			switch f := formatter.(type) {
+			case *logrus.JSONFormatter:
+				if !tt.json {
+					t.Errorf("Expected a text formatter, got json")
+				}
+			case *logrus.TextFormatter:
+				if tt.json {
+					t.Errorf("Expected a json formatter, got text")
+				}
+				if f.TimestampFormat != tt.timestamp || f.ForceColors {
+					t.Errorf("Expected timestamp format %q without forced colors, got %q (forced %v)", tt.timestamp, f.TimestampFormat, f.ForceColors)
+				}
+			default:
+				t.Errorf("Unexpected formatter %T", formatter)
+			}
+		})
+	}
+}
+
+func TestNewFormatter_ConsoleWithoutTerminal(t *testing.T) {
+	formatter, err := logger.NewFormatter("console")
+	if err != nil {
+		t.Fatalf("Failed to create formatter: %v", err)
+	}
+
+	var out bytes.Buffer
+	log := logrus.New()
+	log.SetOutput(&out)
+	log.SetFormatter(formatter)
+	log.WithField("key", "value").Info("hello")
+
+	if strings.Contains(out.String(), "\x1b[") {
+		t.Errorf("Expected no color codes when not writing to a terminal, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "hello") || !strings.Contains(out.String(), "key=value") {
+		t.Errorf("Expected message and fields in output, got %q", out.String())
+	}
+}
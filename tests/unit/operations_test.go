@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"vectraDB/internal/operations"
+)
+
+func TestRegistry_CancelRunningOperation(t *testing.T) {
+	registry := operations.NewRegistry()
+	started := make(chan struct{})
+
+	op := registry.Start("reindex", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		close(started)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Millisecond):
+				progress(float64(i%100) / 100)
+			}
+		}
+	})
+	if op.Status != operations.StatusRunning {
+		t.Fatalf("Expected operation to be running, got %s", op.Status)
+	}
+
+	<-started
+	if err := registry.Cancel(op.ID); err != nil {
+		t.Fatalf("Failed to cancel operation: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	finished, err := registry.Wait(ctx, op.ID)
+	if err != nil {
+		t.Fatalf("Operation did not stop after cancellation: %v", err)
+	}
+	if finished.Status != operations.StatusCancelled {
+		t.Errorf("Expected status cancelled, got %s", finished.Status)
+	}
+	if finished.FinishedAt == nil {
+		t.Error("Expected finished_at to be set")
+	}
+
+	if _, err := registry.Get("missing"); err != operations.ErrOperationNotFound {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestRegistry_OperationResult(t *testing.T) {
+	registry := operations.NewRegistry()
+
+	op := registry.Start("compact", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		return 42, nil
+	})
+
+	finished, err := registry.Wait(context.Background(), op.ID)
+	if err != nil {
+		t.Fatalf("Failed to wait for operation: %v", err)
+	}
+	if finished.Status != operations.StatusSucceeded || finished.Result != 42 || finished.Progress != 1 {
+		t.Errorf("Expected succeeded with result 42, got %+v", finished)
+	}
+}
+
+func TestRegistry_CancelAfterCommitSucceeds(t *testing.T) {
+	registry := operations.NewRegistry()
+	committed := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	op := registry.Start("compact", func(ctx context.Context, progress func(float64)) (interface{}, error) {
+		close(committed)
+		<-cancelled
+		return 3, nil
+	})
+
+	<-committed
+	if err := registry.Cancel(op.ID); err != nil {
+		t.Fatalf("Failed to cancel operation: %v", err)
+	}
+	close(cancelled)
+
+	finished, err := registry.Wait(context.Background(), op.ID)
+	if err != nil {
+		t.Fatalf("Failed to wait for operation: %v", err)
+	}
+	if finished.Status != operations.StatusSucceeded || finished.Result != 3 {
+		t.Errorf("Expected an operation finished before cancellation to succeed, got %+v", finished)
+	}
+}
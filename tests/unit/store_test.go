@@ -3,14 +3,29 @@
 package store
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"go.etcd.io/bbolt"
+	"vectraDB/internal/logger"
 	"vectraDB/internal/models"
 	"vectraDB/internal/store"
+	"vectraDB/pkg/errors"
 )
 
 func cleanupTestDB(t *testing.T, dbPath string) {
@@ -30,7 +45,7 @@ func cleanupAllTestDBs(t *testing.T) {
 			t.Logf("Failed to find test database files: %v", err)
 			return
 		}
-		
+
 		for _, match := range matches {
 			if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
 				t.Logf("Failed to cleanup test database %s: %v", match, err)
@@ -39,11 +54,32 @@ func cleanupAllTestDBs(t *testing.T) {
 	})
 }
 
+// newTestStore opens a store on a per-test database file. DBPath and Timeout
+// are filled in when left empty.
+func newTestStore(t *testing.T, config store.Config) store.Store {
+	cleanupAllTestDBs(t)
+	if config.DBPath == "" {
+		config.DBPath = "test_" + strings.ReplaceAll(t.Name(), "/", "_") + ".db"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 1 * time.Second
+	}
+	cleanupTestDB(t, config.DBPath)
+
+	testStore, err := store.NewBoltStore(config)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { testStore.Close() })
+
+	return testStore
+}
+
 func TestBoltStore_InsertVector(t *testing.T) {
 	cleanupAllTestDBs(t)
 	dbPath := "test_insert_" + t.Name() + ".db"
 	cleanupTestDB(t, dbPath)
-	
+
 	// Create a temporary store for testing
 	testStore, err := store.NewBoltStore(store.Config{
 		DBPath:   dbPath,
@@ -112,7 +148,7 @@ func TestBoltStore_UpdateVector(t *testing.T) {
 	cleanupAllTestDBs(t)
 	dbPath := "test_update_" + t.Name() + ".db"
 	cleanupTestDB(t, dbPath)
-	
+
 	// Create a temporary store for testing
 	testStore, err := store.NewBoltStore(store.Config{
 		DBPath:   dbPath,
@@ -175,7 +211,7 @@ func TestBoltStore_DeleteVector(t *testing.T) {
 	cleanupAllTestDBs(t)
 	dbPath := "test_delete_" + t.Name() + ".db"
 	cleanupTestDB(t, dbPath)
-	
+
 	// Create a temporary store for testing
 	testStore, err := store.NewBoltStore(store.Config{
 		DBPath:   dbPath,
@@ -212,11 +248,51 @@ func TestBoltStore_DeleteVector(t *testing.T) {
 	}
 }
 
+func TestBoltStore_ListVectors(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SoftDelete: true, Precision: store.PrecisionFloat32})
+	ctx := context.Background()
+
+	for _, id := range []string{"d", "a", "e", "c", "b"} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	// Tombstones aren't listed
+	if err := testStore.DeleteVector(ctx, "c"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+
+	for _, tt := range []struct {
+		limit, offset int
+		want          []string
+	}{
+		{2, 0, []string{"a", "b"}},
+		{2, 2, []string{"d", "e"}},
+		{10, 3, []string{"e"}},
+		{10, 4, []string{}},
+	} {
+		vectors, err := testStore.ListVectors(ctx, tt.limit, tt.offset)
+		if err != nil {
+			t.Fatalf("Failed to list vectors: %v", err)
+		}
+		ids := make([]string, len(vectors))
+		for i, v := range vectors {
+			ids[i] = v.ID
+			if len(v.Vector) != 2 {
+				t.Errorf("Expected %s to be listed with its embedding, got %v", v.ID, v.Vector)
+			}
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("Expected %v with limit %d and offset %d, got %v", tt.want, tt.limit, tt.offset, ids)
+		}
+	}
+}
+
 func TestBoltStore_Health(t *testing.T) {
 	cleanupAllTestDBs(t)
 	dbPath := "test_health_" + t.Name() + ".db"
 	cleanupTestDB(t, dbPath)
-	
+
 	// Create a temporary store for testing
 	testStore, err := store.NewBoltStore(store.Config{
 		DBPath:   dbPath,
@@ -234,3 +310,5198 @@ func TestBoltStore_Health(t *testing.T) {
 		t.Fatalf("Health check failed: %v", err)
 	}
 }
+
+func TestBoltStore_AutoCompaction(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		SoftDelete:          true,
+		CompactionThreshold: 0.2,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		vector := &models.Vector{
+			ID:     fmt.Sprintf("vec-%d", i),
+			Vector: []float64{float64(i), 1},
+		}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	// Two deletes sit exactly at the threshold and must not trigger compaction
+	for i := 0; i < 2; i++ {
+		if err := testStore.DeleteVector(ctx, fmt.Sprintf("vec-%d", i)); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+	stats, _ := testStore.Stats(ctx)
+	if stats.Tombstones != 2 || stats.Compactions != 0 {
+		t.Fatalf("Expected 2 tombstones and no compaction, got %+v", stats)
+	}
+
+	// The third delete crosses the threshold
+	if err := testStore.DeleteVector(ctx, "vec-2"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats, _ = testStore.Stats(ctx)
+		if stats.Compactions > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats.Compactions != 1 {
+		t.Fatalf("Expected compaction to run once, got %d", stats.Compactions)
+	}
+	if stats.Tombstones != 0 {
+		t.Errorf("Expected tombstones to be reclaimed, got %d", stats.Tombstones)
+	}
+	if stats.Vectors != 7 {
+		t.Errorf("Expected 7 live vectors, got %d", stats.Vectors)
+	}
+
+	if _, err := testStore.GetVector(ctx, "vec-0"); err == nil {
+		t.Error("Expected error when retrieving deleted vector")
+	}
+}
+
+func TestBoltStore_CloseWaitsForAutoCompaction(t *testing.T) {
+	dbPath := "test_close_auto_compaction.db"
+	testStore := newTestStore(t, store.Config{
+		DBPath:              dbPath,
+		SoftDelete:          true,
+		CompactionThreshold: 0.2,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		vector := &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: []float64{float64(i), 1}}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := testStore.DeleteVector(ctx, fmt.Sprintf("vec-%d", i)); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+
+	// Closing right after the delete that triggers compaction waits for it
+	if err := testStore.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+	testStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, SoftDelete: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer testStore.Close()
+
+	stats, _ := testStore.Stats(ctx)
+	if stats.Tombstones != 0 || stats.Vectors != 7 {
+		t.Errorf("Expected compaction to finish before close, got %+v", stats)
+	}
+}
+
+func TestBoltStore_ManualCompaction(t *testing.T) {
+	dbPath := "test_manual_compaction.db"
+	testStore := newTestStore(t, store.Config{
+		DBPath:     dbPath,
+		SoftDelete: true,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		vector := &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: []float64{1, 2}}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := testStore.DeleteVector(ctx, fmt.Sprintf("vec-%d", i)); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+
+	// Tombstones survive a restart when auto-compaction is disabled
+	testStore.Close()
+	testStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, SoftDelete: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer testStore.Close()
+
+	stats, _ := testStore.Stats(ctx)
+	if stats.Tombstones != 3 || stats.Compactions != 0 {
+		t.Fatalf("Expected 3 tombstones and no compaction, got %+v", stats)
+	}
+
+	reclaimed, err := testStore.Compact(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if reclaimed != 3 {
+		t.Errorf("Expected 3 reclaimed records, got %d", reclaimed)
+	}
+}
+
+func TestBoltStore_CancelCompaction(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		SoftDelete:          true,
+		CompactionBatchSize: 2,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 7; i++ {
+		vector := &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: []float64{1, 2}}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		if err := testStore.DeleteVector(ctx, vector.ID); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+
+	// Cancel once the first batch is reported
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var reports []float64
+	reclaimed, err := testStore.Compact(cancelCtx, func(progress float64) {
+		reports = append(reports, progress)
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected the compaction to be cancelled, got %v", err)
+	}
+	if reclaimed != 2 || len(reports) != 1 || reports[0] != 2.0/7 {
+		t.Errorf("Expected a single batch of 2 reclaimed, got %d with progress %v", reclaimed, reports)
+	}
+	stats, _ := testStore.Stats(ctx)
+	if stats.Tombstones != 5 || stats.Compactions != 0 {
+		t.Errorf("Expected 5 tombstones left and no finished compaction, got %+v", stats)
+	}
+
+	// Running it again finishes the rest, reporting each batch
+	reports = nil
+	reclaimed, err = testStore.Compact(ctx, func(progress float64) {
+		reports = append(reports, progress)
+	})
+	if err != nil || reclaimed != 5 {
+		t.Fatalf("Expected the other 5 to be reclaimed, got %d (%v)", reclaimed, err)
+	}
+	if len(reports) != 3 || reports[2] != 1 {
+		t.Errorf("Expected progress after each of 3 batches ending at 1, got %v", reports)
+	}
+	stats, _ = testStore.Stats(ctx)
+	if stats.Tombstones != 0 || stats.Compactions != 1 {
+		t.Errorf("Expected no tombstones left after one compaction, got %+v", stats)
+	}
+}
+
+// bigramTokenizer emits overlapping character bigrams, which is a simple
+// way to index text without word delimiters such as Chinese or Japanese.
+type bigramTokenizer struct{}
+
+func (bigramTokenizer) Tokenize(text string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(text) {
+		runes := []rune(field)
+		if len(runes) == 1 {
+			tokens = append(tokens, field)
+		}
+		for i := 0; i+1 < len(runes); i++ {
+			tokens = append(tokens, string(runes[i:i+2]))
+		}
+	}
+	return tokens
+}
+
+func TestBoltStore_HybridSearchCustomTokenizer(t *testing.T) {
+	testStore := newTestStore(t, store.Config{Tokenizer: bigramTokenizer{}})
+	ctx := context.Background()
+
+	texts := map[string]string{
+		"ml":      "機械学習は人工知能の一分野です",
+		"weather": "今日の天気は晴れです",
+		"cooking": "料理のレシピを紹介します",
+	}
+	for id, text := range texts {
+		vector := &models.Vector{ID: id, Vector: []float64{1, 1}, Text: text}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{
+		Query:         "機械学習",
+		QueryVector:   []float64{1, 1},
+		KeywordWeight: 1,
+	})
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+
+	if result.Results[0].ID != "ml" {
+		t.Errorf("Expected ml to rank first, got %s", result.Results[0].ID)
+	}
+	if result.Results[0].KeywordScore <= 0 {
+		t.Errorf("Expected a positive keyword score, got %f", result.Results[0].KeywordScore)
+	}
+	for _, r := range result.Results[1:] {
+		if r.KeywordScore != 0 {
+			t.Errorf("Expected no keyword match for %s, got %f", r.ID, r.KeywordScore)
+		}
+	}
+}
+
+func TestBoltStore_MetadataLimits(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		MaxMetadataEntries:     3,
+		MaxMetadataKeyLength:   5,
+		MaxMetadataValueLength: 8,
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		wantErr  bool
+	}{
+		{"entries at limit", map[string]string{"a": "1", "b": "2", "c": "3"}, false},
+		{"entries over limit", map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"}, true},
+		{"key at limit", map[string]string{"abcde": "1"}, false},
+		{"key over limit", map[string]string{"abcdef": "1"}, true},
+		{"value at limit", map[string]string{"k": "12345678"}, false},
+		{"value over limit", map[string]string{"k": "123456789"}, true},
+		{"multibyte value at limit", map[string]string{"k": "ééééééé©"}, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vector := &models.Vector{
+				ID:       fmt.Sprintf("vec-%d", i),
+				Vector:   []float64{1, 2},
+				Metadata: tt.metadata,
+			}
+
+			err := testStore.InsertVector(ctx, vector)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Expected insert to succeed, got %v", err)
+				}
+				return
+			}
+
+			appErr, ok := err.(*errors.AppError)
+			if !ok || appErr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected 422 error, got %v", err)
+			}
+			if appErr.Details == "" {
+				t.Error("Expected a descriptive error detail")
+			}
+		})
+	}
+
+	// Limits also apply on update
+	err := testStore.UpdateVector(ctx, "vec-0", &models.Vector{
+		Vector:   []float64{1, 2},
+		Metadata: map[string]string{"abcdef": "1"},
+	})
+	if err == nil {
+		t.Error("Expected update with an oversized key to fail")
+	}
+}
+
+func TestBoltStore_ListChanges(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SoftDelete: true})
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 2}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	// Changes after the sync point: update a, insert c, delete b
+	if err := testStore.UpdateVector(ctx, "a", &models.Vector{Vector: []float64{2, 1}}); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "c", Vector: []float64{1, 1}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := testStore.DeleteVector(ctx, "b"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+
+	page, err := testStore.ListChanges(ctx, since, "", 2)
+	if err != nil {
+		t.Fatalf("Failed to list changes: %v", err)
+	}
+	if len(page.Changes) != 2 || page.Changes[0].ID != "a" || page.Changes[1].ID != "c" {
+		t.Fatalf("Expected changes [a c], got %v", page.Changes)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("Expected a cursor for the next page")
+	}
+
+	page, err = testStore.ListChanges(ctx, since, page.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("Failed to list changes: %v", err)
+	}
+	if len(page.Changes) != 1 || page.Changes[0].ID != "b" {
+		t.Fatalf("Expected changes [b], got %v", page.Changes)
+	}
+	if page.Changes[0].DeletedAt == nil {
+		t.Error("Expected b to be reported as deleted")
+	}
+	if page.NextCursor != "" {
+		t.Errorf("Expected no further pages, got cursor %q", page.NextCursor)
+	}
+
+	if _, err := testStore.ListChanges(ctx, since, "not-a-cursor!", 2); err == nil {
+		t.Error("Expected an invalid cursor to be rejected")
+	}
+}
+
+func TestBoltStore_ListChangesDeletions(t *testing.T) {
+	dbPath := "test_list_changes_deletions.db"
+	testStore := newTestStore(t, store.Config{DBPath: dbPath, SoftDelete: true})
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 2}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	since := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	// a is soft deleted and compacted, b deleted and written again
+	for _, id := range []string{"a", "b"} {
+		if err := testStore.DeleteVector(ctx, id); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+	if _, err := testStore.Compact(ctx, nil); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "b", Vector: []float64{2, 1}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	// c is deleted outright, after a restart without soft deletes
+	testStore.Close()
+	testStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer testStore.Close()
+	if err := testStore.DeleteVector(ctx, "c"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+
+	page, err := testStore.ListChanges(ctx, since, "", 10)
+	if err != nil {
+		t.Fatalf("Failed to list changes: %v", err)
+	}
+	var ids []string
+	for _, change := range page.Changes {
+		ids = append(ids, change.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("Expected changes [a b c], got %v", ids)
+	}
+	for _, change := range []*models.Vector{page.Changes[0], page.Changes[2]} {
+		if change.DeletedAt == nil || !change.DeletedAt.Equal(change.UpdatedAt) || !change.DeletedAt.After(since) {
+			t.Errorf("Expected %s to be reported deleted after the sync point, got %+v", change.ID, change)
+		}
+	}
+	if page.Changes[1].DeletedAt != nil || page.Changes[1].Vector[0] != 2 {
+		t.Errorf("Expected b to be reported as written again, got %+v", page.Changes[1])
+	}
+
+	// Deletions before the sync point are left out
+	page, err = testStore.ListChanges(ctx, time.Now(), "", 10)
+	if err != nil || len(page.Changes) != 0 {
+		t.Errorf("Expected no changes after now, got %v (%v)", page, err)
+	}
+}
+
+func TestBoltStore_ListChangesPages(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	var want []string
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("vec-%02d", i)
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 2}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		want = append(want, id)
+	}
+
+	// Every change comes back exactly once and in feed order across pages
+	var got []string
+	var last *models.Vector
+	cursor := ""
+	for {
+		page, err := testStore.ListChanges(ctx, time.Time{}, cursor, 3)
+		if err != nil {
+			t.Fatalf("Failed to list changes: %v", err)
+		}
+		if len(page.Changes) > 3 {
+			t.Fatalf("Expected at most 3 changes per page, got %d", len(page.Changes))
+		}
+		for _, change := range page.Changes {
+			if last != nil && (change.UpdatedAt.Before(last.UpdatedAt) ||
+				(change.UpdatedAt.Equal(last.UpdatedAt) && change.ID <= last.ID)) {
+				t.Fatalf("Change %s listed out of order after %s", change.ID, last.ID)
+			}
+			last = change
+			got = append(got, change.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	slices.Sort(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected changes %v, got %v", want, got)
+	}
+}
+
+func TestBoltStore_QuarantineCorruptedRecords(t *testing.T) {
+	dbPath := "test_quarantine.db"
+	testStore := newTestStore(t, store.Config{DBPath: dbPath})
+	ctx := context.Background()
+
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "good", Vector: []float64{1, 2}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	testStore.Close()
+
+	// Inject a corrupted record behind the store's back
+	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("vectors")).Put([]byte("bad"), []byte(`{"id": "bad", "vector": [1,`))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to write corrupted record: %v", err)
+	}
+
+	// Strict loading refuses to start
+	if s, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, StrictLoad: true}); err == nil {
+		s.Close()
+		t.Fatal("Expected strict load to fail on a corrupted record")
+	}
+
+	testStore, err = store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Expected startup to succeed, got %v", err)
+	}
+	defer testStore.Close()
+
+	if _, err := testStore.GetVector(ctx, "good"); err != nil {
+		t.Errorf("Expected healthy vector to load, got %v", err)
+	}
+
+	records, err := testStore.Quarantine(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get quarantine: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != "bad" || records[0].Error == "" {
+		t.Errorf("Expected bad record to be quarantined, got %+v", records)
+	}
+}
+
+func randomVectors(rng *rand.Rand, n, dim int) []*models.Vector {
+	vectors := make([]*models.Vector, n)
+	for i := range vectors {
+		values := make([]float64, dim)
+		for j := range values {
+			values[j] = rng.Float64()*2 - 1
+		}
+		vectors[i] = &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: values}
+	}
+	return vectors
+}
+
+func TestBoltStore_Float32PrecisionParity(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	vectors := randomVectors(rng, 200, 32)
+	query := randomVectors(rng, 1, 32)[0].Vector
+	ctx := context.Background()
+
+	results := make(map[string]*models.SearchResponse)
+	for _, precision := range []string{store.PrecisionFloat64, store.PrecisionFloat32} {
+		testStore := newTestStore(t, store.Config{
+			DBPath:    "test_precision_" + precision + ".db",
+			Precision: precision,
+		})
+		for _, v := range vectors {
+			copied := *v
+			if err := testStore.InsertVector(ctx, &copied); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+
+		// Embeddings are returned in full precision
+		retrieved, err := testStore.GetVector(ctx, "vec-0")
+		if err != nil {
+			t.Fatalf("Failed to get vector: %v", err)
+		}
+		for i, val := range retrieved.Vector {
+			if math.Abs(val-vectors[0].Vector[i]) > 1e-6 {
+				t.Fatalf("%s: expected vector[%d] %f, got %f", precision, i, vectors[0].Vector[i], val)
+			}
+		}
+
+		results[precision], err = testStore.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 20, Limit: 20})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+	}
+
+	full, reduced := results[store.PrecisionFloat64].Results, results[store.PrecisionFloat32].Results
+	if len(full) != len(reduced) {
+		t.Fatalf("Expected %d results, got %d", len(full), len(reduced))
+	}
+	for i := range full {
+		if math.Abs(full[i].Score-reduced[i].Score) > 1e-5 {
+			t.Errorf("Result %d: expected score %f, got %f", i, full[i].Score, reduced[i].Score)
+		}
+		// Ranks may only differ between near-ties
+		if full[i].Vector.ID != reduced[i].Vector.ID && math.Abs(full[i].Score-reduced[i].Score) > 1e-5 {
+			t.Errorf("Result %d: expected %s, got %s", i, full[i].Vector.ID, reduced[i].Vector.ID)
+		}
+		if len(reduced[i].Vector.Vector) != 32 {
+			t.Errorf("Result %d: expected embedding to be returned", i)
+		}
+	}
+}
+
+func BenchmarkBoltStore_SearchPrecision(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := randomVectors(rng, 5000, 256)
+	query := randomVectors(rng, 1, 256)[0].Vector
+	ctx := context.Background()
+
+	for _, precision := range []string{store.PrecisionFloat64, store.PrecisionFloat32} {
+		b.Run(precision, func(b *testing.B) {
+			dbPath := "test_bench_precision_" + precision + ".db"
+			defer os.Remove(dbPath)
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			benchStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, Precision: precision})
+			if err != nil {
+				b.Fatalf("Failed to create store: %v", err)
+			}
+			defer benchStore.Close()
+			for _, v := range vectors {
+				copied := *v
+				copied.Vector = append([]float64(nil), v.Vector...)
+				if err := benchStore.InsertVector(ctx, &copied); err != nil {
+					b.Fatalf("Failed to insert vector: %v", err)
+				}
+			}
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			heapPerVector := float64(after.HeapAlloc-before.HeapAlloc) / float64(len(vectors))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := benchStore.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 10, Limit: 10}); err != nil {
+					b.Fatalf("Search failed: %v", err)
+				}
+			}
+			b.ReportMetric(heapPerVector, "heap-bytes/vector")
+		})
+	}
+}
+
+func TestBoltStore_Postings(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	insert := func(id, topic string) {
+		vector := &models.Vector{ID: id, Vector: []float64{1, 2}, Metadata: map[string]string{"topic": topic, "lang": "en"}}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	insert("a", "ai")
+	insert("b", "ai")
+	insert("c", "math")
+
+	ids, _ := testStore.IndexPostings(ctx, "topic", "ai")
+	if fmt.Sprint(ids) != "[a b]" {
+		t.Errorf("Expected topic=ai postings [a b], got %v", ids)
+	}
+
+	// Moving b to another topic updates both sides of the index
+	err := testStore.UpdateVector(ctx, "b", &models.Vector{Vector: []float64{1, 2}, Metadata: map[string]string{"topic": "math"}})
+	if err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	ids, _ = testStore.IndexPostings(ctx, "topic", "ai")
+	if fmt.Sprint(ids) != "[a]" {
+		t.Errorf("Expected topic=ai postings [a], got %v", ids)
+	}
+	postings, _ := testStore.VectorPostings(ctx, "b")
+	if len(postings) != 1 || postings[0] != (models.Posting{Key: "topic", Value: "math"}) {
+		t.Errorf("Expected b postings [topic=math], got %v", postings)
+	}
+
+	// Deleting a vector removes all of its postings
+	if err := testStore.DeleteVector(ctx, "c"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	postings, _ = testStore.VectorPostings(ctx, "c")
+	if len(postings) != 0 {
+		t.Errorf("Expected no postings for deleted vector, got %v", postings)
+	}
+	ids, _ = testStore.IndexPostings(ctx, "topic", "math")
+	if fmt.Sprint(ids) != "[b]" {
+		t.Errorf("Expected topic=math postings [b], got %v", ids)
+	}
+}
+
+func TestBoltStore_SearchRecencyBoost(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "old", Vector: []float64{1, 0}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "new", Vector: []float64{2, 0}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{
+		Query:         []float64{1, 0},
+		RecencyWeight: 0.5,
+		HalfLife:      "10ms",
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Results[0].Vector.ID != "new" {
+		t.Errorf("Expected newer vector to rank first, got %s", result.Results[0].Vector.ID)
+	}
+	if result.Results[0].Score <= result.Results[1].Score {
+		t.Errorf("Expected newer vector to score higher, got %f <= %f", result.Results[0].Score, result.Results[1].Score)
+	}
+
+	// Without a recency weight both vectors score their plain similarity
+	result, err = testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for _, r := range result.Results {
+		if math.Abs(r.Score-1) > 1e-9 {
+			t.Errorf("Expected score 1 for %s, got %f", r.Vector.ID, r.Score)
+		}
+	}
+
+	if _, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, RecencyWeight: 0.5, HalfLife: "soon"}); err == nil {
+		t.Error("Expected an invalid half-life to be rejected")
+	}
+}
+
+func TestBoltStore_FilterByEmbeddingModel(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "a", Vector: []float64{1, 0}, EmbeddingModel: "text-embed-1", EmbeddingVersion: "1"},
+		{ID: "b", Vector: []float64{1, 0}, EmbeddingModel: "text-embed-2", EmbeddingVersion: "1"},
+		{ID: "c", Vector: []float64{1, 0}, EmbeddingModel: "text-embed-1", EmbeddingVersion: "2"},
+		{ID: "d", Vector: []float64{1, 0}},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{
+		Query:  []float64{1, 0},
+		Filter: map[string]string{store.EmbeddingModelKey: "text-embed-1"},
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 2 {
+		t.Fatalf("Expected 2 results, got %d", result.Total)
+	}
+	for _, r := range result.Results {
+		if r.Vector.EmbeddingModel != "text-embed-1" {
+			t.Errorf("Expected embedding model text-embed-1, got %q for %s", r.Vector.EmbeddingModel, r.Vector.ID)
+		}
+	}
+
+	result, _ = testStore.SearchVectors(ctx, &models.SearchRequest{
+		Query:  []float64{1, 0},
+		Filter: map[string]string{store.EmbeddingModelKey: "text-embed-1", store.EmbeddingVersionKey: "2"},
+	})
+	if result.Total != 1 || result.Results[0].Vector.ID != "c" {
+		t.Errorf("Expected only c to match model and version, got %v", result.Results)
+	}
+
+	// The reserved keys can't be smuggled in through metadata
+	err = testStore.InsertVector(ctx, &models.Vector{
+		ID:       "e",
+		Vector:   []float64{1, 0},
+		Metadata: map[string]string{store.EmbeddingModelKey: "text-embed-1"},
+	})
+	if err == nil {
+		t.Error("Expected reserved metadata key to be rejected")
+	}
+}
+
+func TestBoltStore_HybridSearchKeywordOnly(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	texts := map[string]string{
+		"a": "the quick brown fox",
+		"b": "a lazy dog sleeps",
+		"c": "brown bears and a brown fox",
+	}
+	for id, text := range texts {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}, Text: text}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	// Without opting in an empty query vector is still rejected
+	if _, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "brown fox"}); err != errors.ErrEmptyQuery {
+		t.Fatalf("Expected ErrEmptyQuery, got %v", err)
+	}
+
+	result, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{
+		Query:            "brown fox",
+		AllowKeywordOnly: true,
+	})
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+
+	if result.Results[0].ID != "c" || result.Results[1].ID != "a" {
+		t.Errorf("Expected keyword ranking [c a ...], got %v", result.Results)
+	}
+	for _, r := range result.Results {
+		if r.VectorScore != 0 {
+			t.Errorf("Expected no vector score for %s, got %f", r.ID, r.VectorScore)
+		}
+		if r.HybridScore != r.KeywordScore {
+			t.Errorf("Expected hybrid score to equal keyword score for %s", r.ID)
+		}
+	}
+}
+
+func TestBoltStore_SearchEmptyReasons(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+	minScore := 0.99
+
+	result, _ := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}})
+	if result.Reason != models.ReasonEmptyStore {
+		t.Errorf("Expected reason %s, got %q", models.ReasonEmptyStore, result.Reason)
+	}
+	hybrid, _ := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}})
+	if hybrid.Reason != models.ReasonEmptyStore {
+		t.Errorf("Expected hybrid reason %s, got %q", models.ReasonEmptyStore, hybrid.Reason)
+	}
+
+	vector := &models.Vector{ID: "a", Vector: []float64{0, 1}, Text: "fox", Metadata: map[string]string{"topic": "ai"}}
+	if err := testStore.InsertVector(ctx, vector); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		req    *models.SearchRequest
+		reason string
+	}{
+		{"filter matches nothing", &models.SearchRequest{Query: []float64{1, 0}, Filter: map[string]string{"topic": "math"}}, models.ReasonNoFilterMatch},
+		{"below min score", &models.SearchRequest{Query: []float64{1, 0}, MinScore: &minScore}, models.ReasonBelowThreshold},
+		{"dimension mismatch", &models.SearchRequest{Query: []float64{1, 0, 0}}, models.ReasonDimensionMismatch},
+		{"results found", &models.SearchRequest{Query: []float64{0, 1}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := testStore.SearchVectors(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if result.Reason != tt.reason {
+				t.Errorf("Expected reason %q, got %q", tt.reason, result.Reason)
+			}
+		})
+	}
+
+	hybrid, _ = testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}, MinScore: &minScore})
+	if hybrid.Reason != models.ReasonBelowThreshold || len(hybrid.Results) != 0 {
+		t.Errorf("Expected hybrid reason %s, got %q", models.ReasonBelowThreshold, hybrid.Reason)
+	}
+}
+
+// waitQuantized waits for the quantizer trained in the background to
+// encode n vectors.
+func waitQuantized(tb testing.TB, s store.Store, n int) {
+	tb.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		stats, err := s.Stats(context.Background())
+		if err != nil {
+			tb.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Quantized == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("Expected %d quantized vectors, got %d", n, stats.Quantized)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBoltStore_ProductQuantization(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	vectors := randomVectors(rng, 300, 32)
+	query := randomVectors(rng, 1, 32)[0].Vector
+	ctx := context.Background()
+
+	flatStore := newTestStore(t, store.Config{DBPath: "test_pq_flat.db"})
+	pqStore := newTestStore(t, store.Config{
+		DBPath:       "test_pq.db",
+		Quantization: store.QuantizationPQ,
+		PQSubspaces:  8,
+		PQCentroids:  16,
+		PQTrainSize:  200,
+		PQRescore:    60,
+	})
+	for _, s := range []store.Store{flatStore, pqStore} {
+		for _, v := range vectors {
+			copied := *v
+			if err := s.InsertVector(ctx, &copied); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+	}
+	waitQuantized(t, pqStore, len(vectors))
+
+	// Embeddings are returned in full precision after encoding
+	retrieved, err := pqStore.GetVector(ctx, "vec-250")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	for i, val := range retrieved.Vector {
+		if val != vectors[250].Vector[i] {
+			t.Fatalf("Expected vector[%d] %f, got %f", i, vectors[250].Vector[i], val)
+		}
+	}
+
+	req := models.SearchRequest{Query: query, TopK: 10, Limit: 10}
+	flatReq, pqReq := req, req
+	flat, err := flatStore.SearchVectors(ctx, &flatReq)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	approx, err := pqStore.SearchVectors(ctx, &pqReq)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	exact := make(map[string]float64)
+	for _, result := range flat.Results {
+		exact[result.Vector.ID] = result.Score
+	}
+	hits := 0
+	for _, result := range approx.Results {
+		if len(result.Vector.Vector) != 32 {
+			t.Errorf("Expected embedding of %s to be returned", result.Vector.ID)
+		}
+		if score, ok := exact[result.Vector.ID]; ok {
+			hits++
+			// Returned scores are rescored exactly
+			if math.Abs(score-result.Score) > 1e-9 {
+				t.Errorf("Expected score %f for %s, got %f", score, result.Vector.ID, result.Score)
+			}
+		}
+	}
+	if hits < 8 {
+		t.Errorf("Expected recall@10 of at least 0.8, got %.1f", float64(hits)/10)
+	}
+
+	// Percentiles rank among all 300 candidates, not only the 60 rescored
+	pqReq = req
+	pqReq.ReturnPercentile = true
+	ranked, err := pqStore.SearchVectors(ctx, &pqReq)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if last := ranked.Results[len(ranked.Results)-1].Percentile; last == nil || *last < 0.9 {
+		t.Errorf("Expected the 10th result to rank above 90%% of the candidates, got %v", last)
+	}
+}
+
+func BenchmarkBoltStore_SearchQuantization(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := randomVectors(rng, 5000, 128)
+	queries := randomVectors(rng, 20, 128)
+	ctx := context.Background()
+
+	search := func(s store.Store, query []float64) map[string]bool {
+		resp, err := s.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 10, Limit: 10})
+		if err != nil {
+			b.Fatalf("Search failed: %v", err)
+		}
+		ids := make(map[string]bool)
+		for _, result := range resp.Results {
+			ids[result.Vector.ID] = true
+		}
+		return ids
+	}
+
+	configs := []struct {
+		name   string
+		config store.Config
+	}{
+		{"flat", store.Config{}},
+		{"pq8", store.Config{Quantization: store.QuantizationPQ, PQSubspaces: 8}},
+		{"pq32", store.Config{Quantization: store.QuantizationPQ, PQSubspaces: 32}},
+	}
+
+	var truth []map[string]bool
+	for _, c := range configs {
+		b.Run(c.name, func(b *testing.B) {
+			dbPath := "test_bench_quantization_" + c.name + ".db"
+			defer os.Remove(dbPath)
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			c.config.DBPath = dbPath
+			c.config.Timeout = time.Second
+			benchStore, err := store.NewBoltStore(c.config)
+			if err != nil {
+				b.Fatalf("Failed to create store: %v", err)
+			}
+			defer benchStore.Close()
+			for _, v := range vectors {
+				copied := *v
+				copied.Vector = append([]float64(nil), v.Vector...)
+				if err := benchStore.InsertVector(ctx, &copied); err != nil {
+					b.Fatalf("Failed to insert vector: %v", err)
+				}
+			}
+			if c.config.Quantization == store.QuantizationPQ {
+				waitQuantized(b, benchStore, len(vectors))
+			}
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			heapPerVector := float64(after.HeapAlloc-before.HeapAlloc) / float64(len(vectors))
+
+			// The flat store runs first and provides the exact neighbours
+			results := make([]map[string]bool, len(queries))
+			for i, q := range queries {
+				results[i] = search(benchStore, q.Vector)
+			}
+			if truth == nil {
+				truth = results
+			}
+			hits := 0
+			for i := range results {
+				for id := range results[i] {
+					if truth[i][id] {
+						hits++
+					}
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				search(benchStore, queries[i%len(queries)].Vector)
+			}
+			b.ReportMetric(heapPerVector, "heap-bytes/vector")
+			b.ReportMetric(float64(hits)/float64(10*len(queries)), "recall@10")
+		})
+	}
+}
+
+func TestBoltStore_SearchZeroMagnitudeVectors(t *testing.T) {
+	ctx := context.Background()
+
+	for _, skip := range []bool{false, true} {
+		testStore := newTestStore(t, store.Config{
+			DBPath:          fmt.Sprintf("test_zero_vectors_%t.db", skip),
+			SkipZeroVectors: skip,
+		})
+		for _, v := range []*models.Vector{
+			{ID: "unit", Vector: []float64{1, 0}},
+			{ID: "zero", Vector: []float64{0, 0}},
+		} {
+			if err := testStore.InsertVector(ctx, v); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+
+		resp, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, ScoreNormalization: models.NormalizationRaw})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+
+		if skip {
+			if resp.Total != 1 || resp.Results[0].Vector.ID != "unit" {
+				t.Errorf("Expected zero vector to be skipped, got %+v", resp.Results)
+			}
+			continue
+		}
+		if resp.Total != 2 {
+			t.Fatalf("Expected 2 results, got %d", resp.Total)
+		}
+		if resp.Results[1].Vector.ID != "zero" || resp.Results[1].Score != 0 {
+			t.Errorf("Expected zero vector with score 0, got %+v", resp.Results[1])
+		}
+	}
+}
+
+func TestBoltStore_DocumentsOnVectorsOnlyDatabase(t *testing.T) {
+	cleanupAllTestDBs(t)
+	dbPath := "test_vectors_only.db"
+	cleanupTestDB(t, dbPath)
+
+	// Create a database as written before documents were supported
+	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("vectors"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("v1"), []byte(`{"id": "v1", "vector": [1, 0]}`))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to write vectors-only database: %v", err)
+	}
+
+	testStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to open vectors-only database: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := testStore.GetVector(ctx, "v1"); err != nil {
+		t.Errorf("Expected existing vector to load, got %v", err)
+	}
+	documents, err := testStore.ListDocuments(ctx, 10, 0)
+	if err != nil || len(documents) != 0 {
+		t.Errorf("Expected no documents, got %v %v", documents, err)
+	}
+	if _, err := testStore.GetDocument(ctx, "d1"); err != errors.ErrDocumentNotFound {
+		t.Errorf("Expected document not found, got %v", err)
+	}
+	testStore.Close()
+
+	// Reads went through the missing bucket rather than creating it
+	db, err = bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte("documents")) != nil {
+			t.Error("Expected the documents bucket to still be missing")
+		}
+		return nil
+	})
+	db.Close()
+
+	testStore, err = store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to reopen vectors-only database: %v", err)
+	}
+	defer testStore.Close()
+
+	doc := &models.Document{ID: "d1", Title: "Title", Content: "Content", Tags: []string{"a"}}
+	if err := testStore.InsertDocument(ctx, doc); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	documents, err = testStore.ListDocumentsByTag(ctx, "a", 10, 0)
+	if err != nil || len(documents) != 1 || documents[0].ID != "d1" {
+		t.Errorf("Expected inserted document to be listed, got %v %v", documents, err)
+	}
+}
+
+func TestBoltStore_SearchCollapseBy(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "a1", Vector: []float64{1, 0}, Metadata: map[string]string{"doc_id": "a"}},
+		{ID: "a2", Vector: []float64{0.9, 0.1}, Metadata: map[string]string{"doc_id": "a"}},
+		{ID: "b1", Vector: []float64{0.5, 0.5}, Metadata: map[string]string{"doc_id": "b"}},
+		{ID: "b2", Vector: []float64{0.8, 0.2}, Metadata: map[string]string{"doc_id": "b"}},
+		{ID: "b3", Vector: []float64{0, 1}, Metadata: map[string]string{"doc_id": "b"}},
+		{ID: "loose", Vector: []float64{0.1, 0.9}},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, CollapseBy: "doc_id"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	ids := make([]string, len(result.Results))
+	for i, r := range result.Results {
+		ids[i] = r.Vector.ID
+	}
+	if strings.Join(ids, ",") != "a1,b2,loose" {
+		t.Errorf("Expected best chunk per doc [a1 b2 loose], got %v", ids)
+	}
+	if result.Collapsed != 3 || result.Total != 3 {
+		t.Errorf("Expected 3 collapsed and 3 total, got %d and %d", result.Collapsed, result.Total)
+	}
+}
+
+func TestBoltStore_SearchMaxCandidates(t *testing.T) {
+	testStore := newTestStore(t, store.Config{MaxCandidates: 100})
+	ctx := context.Background()
+
+	rng := rand.New(rand.NewSource(3))
+	for i, v := range randomVectors(rng, 1000, 8) {
+		if i < 10 {
+			v.Metadata = map[string]string{"group": "small"}
+		}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	query := randomVectors(rng, 1, 8)[0].Vector
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 1000})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 100 || !result.Approximate {
+		t.Errorf("Expected 100 sampled results flagged approximate, got %d approximate=%v", result.Total, result.Approximate)
+	}
+
+	// The sample doesn't depend on the order candidates are collected in
+	for i := 0; i < 5; i++ {
+		again, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 1000})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		for j := range again.Results {
+			if again.Results[j].Vector.ID != result.Results[j].Vector.ID {
+				t.Fatalf("Expected the same sample on every search, result %d was %s then %s", j, result.Results[j].Vector.ID, again.Results[j].Vector.ID)
+			}
+		}
+	}
+
+	result, err = testStore.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 1000, Filter: map[string]string{"group": "small"}})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 10 || result.Approximate {
+		t.Errorf("Expected 10 exact results, got %d approximate=%v", result.Total, result.Approximate)
+	}
+}
+
+func TestBoltStore_HybridSearchIncludeVector(t *testing.T) {
+	testStore := newTestStore(t, store.Config{Precision: store.PrecisionFloat32})
+	ctx := context.Background()
+
+	vector := &models.Vector{ID: "a", Vector: []float64{1, 0}, Text: "quick fox", Metadata: map[string]string{"source": "wiki"}}
+	if err := testStore.InsertVector(ctx, vector); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	req := &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}}
+	result, err := testStore.HybridSearch(ctx, req)
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Vector != nil {
+		t.Fatalf("Expected lean result by default, got %+v", result.Results)
+	}
+
+	req.IncludeVector = true
+	result, err = testStore.HybridSearch(ctx, req)
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+	full := result.Results[0].Vector
+	if full == nil || full.Metadata["source"] != "wiki" || full.CreatedAt.IsZero() || full.Vector != nil {
+		t.Fatalf("Expected metadata without embedding, got %+v", full)
+	}
+
+	req.IncludeEmbedding = true
+	result, err = testStore.HybridSearch(ctx, req)
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+	if full := result.Results[0].Vector; len(full.Vector) != 2 || full.Vector[0] != 1 {
+		t.Errorf("Expected embedding to be included, got %+v", full)
+	}
+}
+
+// sparseVectors returns n vectors of dimension dim with only nonZero
+// non-zero dimensions each.
+func sparseVectors(rng *rand.Rand, n, dim, nonZero int) []*models.Vector {
+	vectors := make([]*models.Vector, n)
+	for i := range vectors {
+		values := make([]float64, dim)
+		for _, j := range rng.Perm(dim)[:nonZero] {
+			values[j] = rng.Float64()*2 - 1
+		}
+		vectors[i] = &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: values}
+	}
+	return vectors
+}
+
+func TestBoltStore_SparseVectorScores(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	vectors := append(sparseVectors(rng, 50, 200, 5), randomVectors(rng, 10, 200)...)
+	for i, v := range vectors[50:] {
+		v.ID = fmt.Sprintf("dense-%d", i)
+	}
+	ctx := context.Background()
+
+	denseStore := newTestStore(t, store.Config{DBPath: "test_sparse_dense.db"})
+	sparseStore := newTestStore(t, store.Config{DBPath: "test_sparse.db", SparseThreshold: 0.9})
+	for _, s := range []store.Store{denseStore, sparseStore} {
+		for _, v := range vectors {
+			copied := *v
+			if err := s.InsertVector(ctx, &copied); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+	}
+
+	for _, query := range [][]float64{sparseVectors(rng, 1, 200, 5)[0].Vector, randomVectors(rng, 1, 200)[0].Vector} {
+		req := func() *models.SearchRequest { return &models.SearchRequest{Query: query, TopK: 100, Limit: 100} }
+		want, err := denseStore.SearchVectors(ctx, req())
+		if err != nil {
+			t.Fatalf("Dense search failed: %v", err)
+		}
+		got, err := sparseStore.SearchVectors(ctx, req())
+		if err != nil {
+			t.Fatalf("Sparse search failed: %v", err)
+		}
+
+		if len(got.Results) != len(want.Results) {
+			t.Fatalf("Expected %d results, got %d", len(want.Results), len(got.Results))
+		}
+		// Compare by ID, vectors sharing no dimension with the query tie at 0
+		scores := make(map[string]float64, len(want.Results))
+		for _, r := range want.Results {
+			scores[r.Vector.ID] = r.Score
+		}
+		for _, r := range got.Results {
+			if r.Score != scores[r.Vector.ID] {
+				t.Errorf("Expected %s to score %v, got %v", r.Vector.ID, scores[r.Vector.ID], r.Score)
+			}
+		}
+	}
+
+	// Sparse vectors are returned in full
+	retrieved, err := sparseStore.GetVector(ctx, "vec-0")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	for i, v := range vectors[0].Vector {
+		if retrieved.Vector[i] != v {
+			t.Fatalf("Expected vector[%d] %v, got %v", i, v, retrieved.Vector[i])
+		}
+	}
+}
+
+func BenchmarkBoltStore_SearchSparse(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	vectors := sparseVectors(rng, 2000, 1024, 16)
+	query := sparseVectors(rng, 1, 1024, 16)[0].Vector
+	ctx := context.Background()
+
+	for name, threshold := range map[string]float64{"dense": 0, "sparse": 0.9} {
+		b.Run(name, func(b *testing.B) {
+			dbPath := "test_bench_sparse_" + name + ".db"
+			defer os.Remove(dbPath)
+
+			benchStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, SparseThreshold: threshold})
+			if err != nil {
+				b.Fatalf("Failed to create store: %v", err)
+			}
+			defer benchStore.Close()
+			for _, v := range vectors {
+				copied := *v
+				if err := benchStore.InsertVector(ctx, &copied); err != nil {
+					b.Fatalf("Failed to insert vector: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := benchStore.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 10, Limit: 10}); err != nil {
+					b.Fatalf("Search failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestBoltStore_SearchExpandRelated(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "match", Vector: []float64{1, 0}, Metadata: map[string]string{models.RelatedIDsKey: "far, other, missing"}},
+		{ID: "other", Vector: []float64{0.9, 0.1}},
+		{ID: "far", Vector: []float64{0, 1}},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 2, ExpandRelated: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Results) != 3 {
+		t.Fatalf("Expected 2 matches and 1 expansion, got %+v", result.Results)
+	}
+	for i, expected := range []struct{ id, from string }{{"match", ""}, {"other", ""}, {"far", "match"}} {
+		if got := result.Results[i]; got.Vector.ID != expected.id || got.ExpandedFrom != expected.from {
+			t.Errorf("Expected result %d to be %s expanded from %q, got %s from %q", i, expected.id, expected.from, got.Vector.ID, got.ExpandedFrom)
+		}
+	}
+
+	result, err = testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 1, ExpandRelated: true, ExpandLimit: 1})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Results) != 2 || result.Results[1].Vector.ID != "far" {
+		t.Errorf("Expected expansion to be bounded to 1, got %+v", result.Results)
+	}
+	if result.Total != 1 || result.Expanded != 1 {
+		t.Errorf("Expected expansions to be counted apart from the total, got total %d and %d expanded", result.Total, result.Expanded)
+	}
+}
+
+func TestBoltStore_SearchExpandRelatedScoping(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "match", Vector: []float64{1, 0}, Metadata: map[string]string{"tenant": "a", models.RelatedIDsKey: "secret,near,far"}},
+		{ID: "secret", Vector: []float64{1, 0.1}, Metadata: map[string]string{"tenant": "b"}},
+		{ID: "near", Vector: []float64{1, 0.2}, Metadata: map[string]string{"tenant": "a"}},
+		{ID: "far", Vector: []float64{-1, 0}, Metadata: map[string]string{"tenant": "a"}},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	minScore := 0.5
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{
+		Query:         []float64{1, 0},
+		TopK:          1,
+		Filter:        map[string]string{"tenant": "a"},
+		MinScore:      &minScore,
+		ExpandRelated: true,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	// secret is another tenant's and far scores below the threshold
+	if len(result.Results) != 2 || result.Results[0].Vector.ID != "match" || result.Results[1].Vector.ID != "near" {
+		t.Errorf("Expected only near to be expanded, got %+v", result.Results)
+	}
+
+	result, err = testStore.SearchVectors(ctx, &models.SearchRequest{
+		Query:             []float64{1, 0},
+		TopK:              1,
+		DocumentTagFilter: []string{"public"},
+		ExpandRelated:     true,
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Results) != 0 {
+		t.Errorf("Expected no vector outside the tagged documents, got %+v", result.Results)
+	}
+}
+
+func TestBoltStore_SearchPageBounds(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		v := &models.Vector{ID: fmt.Sprintf("v%d", i), Vector: []float64{1, float64(i)}, Text: "fox"}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	tests := []struct {
+		page    int
+		results int
+		hasNext bool
+		reason  string
+	}{
+		{2, 2, true, ""},
+		{3, 1, false, ""},
+		{4, 0, false, models.ReasonPageOutOfRange},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("page %d", tt.page), func(t *testing.T) {
+			result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, Page: tt.page, Limit: 2})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if len(result.Results) != tt.results || result.HasNext != tt.hasNext || result.Reason != tt.reason || result.TotalPages != 3 {
+				t.Errorf("Expected %d results, has_next %v, reason %q and 3 pages, got %d, %v, %q and %d",
+					tt.results, tt.hasNext, tt.reason, len(result.Results), result.HasNext, result.Reason, result.TotalPages)
+			}
+
+			hybrid, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}, Page: tt.page, Limit: 2})
+			if err != nil {
+				t.Fatalf("Hybrid search failed: %v", err)
+			}
+			if len(hybrid.Results) != tt.results || hybrid.HasNext != tt.hasNext || hybrid.Reason != tt.reason || hybrid.TotalPages != 3 {
+				t.Errorf("Expected hybrid %d results, has_next %v, reason %q and 3 pages, got %d, %v, %q and %d",
+					tt.results, tt.hasNext, tt.reason, len(hybrid.Results), hybrid.HasNext, hybrid.Reason, hybrid.TotalPages)
+			}
+		})
+	}
+}
+
+func TestBoltStore_SearchBoost(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "similar", Vector: []float64{1, 0}},
+		{ID: "promoted", Vector: []float64{0.8, 0.6}, Boost: 1.5},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, ScoreNormalization: models.NormalizationRaw})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Results[0].Vector.ID != "promoted" || math.Abs(result.Results[0].Score-1.2) > 1e-9 {
+		t.Errorf("Expected promoted to rank first with score 1.2, got %s %f", result.Results[0].Vector.ID, result.Results[0].Score)
+	}
+	if result.Results[1].Vector.ID != "similar" || result.Results[1].Score != 1 {
+		t.Errorf("Expected unboosted score to be unchanged, got %s %f", result.Results[1].Vector.ID, result.Results[1].Score)
+	}
+}
+
+func TestBoltStore_BulkTagDocuments(t *testing.T) {
+	dbPath := "test_bulk_tags.db"
+	testStore := newTestStore(t, store.Config{DBPath: dbPath})
+	ctx := context.Background()
+
+	docs := []*models.Document{
+		{ID: "d1", Title: "One", Content: "one", Tags: []string{"draft", "go"}},
+		{ID: "d2", Title: "Two", Content: "two", Tags: []string{"draft"}},
+		{ID: "d3", Title: "Three", Content: "three", Tags: []string{"go"}},
+	}
+	for _, doc := range docs {
+		if err := testStore.InsertDocument(ctx, doc); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+
+	listTag := func(s store.Store, tag string) string {
+		t.Helper()
+		documents, err := s.ListDocumentsByTag(ctx, tag, 10, 0)
+		if err != nil {
+			t.Fatalf("Failed to list documents by tag: %v", err)
+		}
+		ids := make([]string, len(documents))
+		for i, doc := range documents {
+			ids[i] = doc.ID
+		}
+		return strings.Join(ids, ",")
+	}
+
+	changed, err := testStore.BulkTagDocuments(ctx, &models.BulkTagRequest{
+		Filter:  models.DocumentFilter{Tags: []string{"draft"}},
+		AddTags: []string{"review", "draft"},
+	})
+	if err != nil || changed != 2 {
+		t.Fatalf("Expected 2 documents tagged, got %d %v", changed, err)
+	}
+	if got := listTag(testStore, "review"); got != "d1,d2" {
+		t.Errorf("Expected review documents d1,d2, got %s", got)
+	}
+
+	changed, err = testStore.BulkTagDocuments(ctx, &models.BulkTagRequest{
+		Filter:     models.DocumentFilter{IDs: []string{"d1", "d3"}},
+		RemoveTags: []string{"draft", "go"},
+	})
+	if err != nil || changed != 2 {
+		t.Fatalf("Expected 2 documents untagged, got %d %v", changed, err)
+	}
+	if got := listTag(testStore, "draft"); got != "d2" {
+		t.Errorf("Expected draft documents d2, got %s", got)
+	}
+	if got := listTag(testStore, "go"); got != "" {
+		t.Errorf("Expected no go documents, got %s", got)
+	}
+	doc, err := testStore.GetDocument(ctx, "d1")
+	if err != nil || strings.Join(doc.Tags, ",") != "review" {
+		t.Errorf("Expected d1 tags [review], got %v %v", doc, err)
+	}
+
+	if _, err := testStore.BulkTagDocuments(ctx, &models.BulkTagRequest{AddTags: []string{"all"}}); err == nil {
+		t.Error("Expected an empty filter to be rejected")
+	}
+
+	// The tag index is rebuilt on startup
+	testStore.Close()
+	reopened, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if got := listTag(reopened, "review"); got != "d1,d2" {
+		t.Errorf("Expected review documents d1,d2 after reopening, got %s", got)
+	}
+}
+
+func TestBoltStore_StatsCountersMatchScan(t *testing.T) {
+	dbPath := "test_stats_counters.db"
+	testStore := newTestStore(t, store.Config{DBPath: dbPath, SoftDelete: true})
+	ctx := context.Background()
+
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("id-%d", i)
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, float64(i)}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		if err := testStore.InsertDocument(ctx, &models.Document{ID: id, Title: "T", Content: "C"}); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+	testStore.InsertDocument(ctx, &models.Document{ID: "id-0", Title: "T", Content: "C"}) // Duplicate, rejected
+	testStore.UpdateVector(ctx, "id-1", &models.Vector{Vector: []float64{0, 1}})
+	testStore.UpdateDocument(ctx, "id-1", &models.UpdateDocumentRequest{Title: "U", Content: "C"})
+	testStore.DeleteVector(ctx, "id-2")
+	testStore.DeleteVector(ctx, "missing")
+	testStore.DeleteDocument(ctx, "id-2")
+	testStore.DeleteDocument(ctx, "id-3")
+	testStore.DeleteDocument(ctx, "missing")
+
+	check := func(s store.Store) {
+		t.Helper()
+		stats, err := s.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		vectors, _ := s.ListVectors(ctx, 1000, 0)
+		documents, _ := s.ListDocuments(ctx, 1000, 0)
+		if stats.Vectors != len(vectors) || stats.Documents != len(documents) {
+			t.Errorf("Expected counters %d vectors and %d documents, got %d and %d",
+				len(vectors), len(documents), stats.Vectors, stats.Documents)
+		}
+	}
+	check(testStore)
+
+	// Counters are rebuilt on startup
+	testStore.Close()
+	reopened, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, SoftDelete: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	check(reopened)
+}
+
+func TestBoltStore_UnifiedSearch(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "v1", Vector: []float64{1, 0}, Text: "quick brown fox"},
+		{ID: "v2", Vector: []float64{0.6, 0.8}, Text: "lazy dog"},
+		{ID: "v3", Vector: []float64{0, 1}, Text: "fox"},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	docs := []*models.Document{
+		{ID: "d1", Title: "Foxes", Content: "the fox and the fox den"},
+		{ID: "d2", Title: "Dogs", Content: "all about dogs"},
+		{ID: "d3", Title: "Fox", Content: "a fox in a long article about many other animals and places"},
+	}
+	for _, doc := range docs {
+		if err := testStore.InsertDocument(ctx, doc); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+
+	result, err := testStore.UnifiedSearch(ctx, &models.UnifiedSearchRequest{
+		Query:           "fox",
+		QueryVector:     []float64{1, 0},
+		VectorsWeight:   0.6,
+		DocumentsWeight: 0.4,
+	})
+	if err != nil {
+		t.Fatalf("Unified search failed: %v", err)
+	}
+
+	best := map[string]float64{}
+	seen := map[string]bool{}
+	for i, r := range result.Results {
+		if i > 0 && r.Score > result.Results[i-1].Score {
+			t.Errorf("Expected results sorted by score, got %+v", result.Results)
+		}
+		best[r.Type] = math.Max(best[r.Type], r.Score)
+		seen[r.ID] = true
+	}
+	if math.Abs(best[models.ResultTypeVector]-0.6) > 1e-9 || math.Abs(best[models.ResultTypeDocument]-0.4) > 1e-9 {
+		t.Errorf("Expected best vector 0.6 and best document 0.4, got %v", best)
+	}
+	for _, id := range []string{"v1", "v2", "v3", "d1", "d3"} {
+		if !seen[id] {
+			t.Errorf("Expected %s in results, got %+v", id, result.Results)
+		}
+	}
+	if seen["d2"] {
+		t.Errorf("Expected unmatched document d2 to be dropped, got %+v", result.Results)
+	}
+	if result.Results[0].ID != "v1" || result.Results[1].Type != models.ResultTypeDocument {
+		t.Errorf("Expected v1 then a document first, got %+v", result.Results[:2])
+	}
+}
+
+func TestBoltStore_ValidateIDs(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		config  store.Config
+		id      string
+		wantErr bool
+	}{
+		{"validation off allows slash", store.Config{}, "a/b", false},
+		{"default pattern", store.Config{ValidateIDs: true}, "doc-1_v2.chunk", false},
+		{"default pattern rejects slash", store.Config{ValidateIDs: true}, "a/b", true},
+		{"default pattern rejects space", store.Config{ValidateIDs: true}, "a b", true},
+		{"custom pattern", store.Config{ValidateIDs: true, IDPattern: `^[a-z]+:[0-9]+$`}, "doc:12", false},
+		{"custom pattern rejects", store.Config{ValidateIDs: true, IDPattern: `^[a-z]+:[0-9]+$`}, "doc-12", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testStore := newTestStore(t, tt.config)
+
+			err := testStore.InsertVector(ctx, &models.Vector{ID: tt.id, Vector: []float64{1, 0}})
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Expected insert to succeed, got %v", err)
+				}
+				return
+			}
+			appErr, ok := err.(*errors.AppError)
+			if !ok || appErr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected 422 error, got %v", err)
+			}
+			if !strings.Contains(appErr.Details, tt.id) {
+				t.Errorf("Expected details to name the ID, got %q", appErr.Details)
+			}
+		})
+	}
+
+	if _, err := store.NewBoltStore(store.Config{DBPath: "test_bad_pattern.db", ValidateIDs: true, IDPattern: "("}); err == nil {
+		t.Error("Expected an invalid ID pattern to fail")
+	}
+}
+
+func TestBoltStore_SearchTotalAndReturned(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		v := &models.Vector{ID: fmt.Sprintf("v%d", i), Vector: []float64{1, float64(i)}, Text: "fox"}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	minScore := 0.5
+
+	tests := []struct {
+		name     string
+		req      models.SearchRequest
+		total    int
+		returned int
+	}{
+		{"top_k above candidates", models.SearchRequest{TopK: 50, Limit: 10}, 5, 5},
+		{"top_k below candidates", models.SearchRequest{TopK: 3, Limit: 10}, 3, 3},
+		{"limit below top_k", models.SearchRequest{TopK: 4, Limit: 3, Page: 2}, 4, 1},
+		{"threshold", models.SearchRequest{TopK: 50, Limit: 10, MinScore: &minScore, ScoreNormalization: models.NormalizationRaw}, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Query = []float64{1, 0}
+			result, err := testStore.SearchVectors(ctx, &req)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if result.Total != tt.total || result.Returned != tt.returned || len(result.Results) != tt.returned {
+				t.Errorf("Expected total %d and %d returned, got %d and %d (%d results)",
+					tt.total, tt.returned, result.Total, result.Returned, len(result.Results))
+			}
+		})
+	}
+
+	hybrid, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}, Limit: 50})
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+	if hybrid.Total != 5 || hybrid.Returned != 5 {
+		t.Errorf("Expected hybrid total 5 and 5 returned, got %d and %d", hybrid.Total, hybrid.Returned)
+	}
+	hybrid, err = testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}, Limit: 2})
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+	if hybrid.Total != 5 || hybrid.Returned != 2 {
+		t.Errorf("Expected hybrid total 5 and 2 returned, got %d and %d", hybrid.Total, hybrid.Returned)
+	}
+}
+
+func TestBoltStore_SearchRadius(t *testing.T) {
+	testStore := newTestStore(t, store.Config{MaxRadiusResults: 2})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "exact", Vector: []float64{1, 0}},
+		{ID: "near", Vector: []float64{1, 0.1}},
+		{ID: "diagonal", Vector: []float64{1, 1}, Boost: 0.1},
+		{ID: "orthogonal", Vector: []float64{0, 1}, Boost: 10},
+		{ID: "opposite", Vector: []float64{-1, 0}},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	tests := []struct {
+		radius float64
+		ids    []string
+		capped bool
+	}{
+		{0.01, []string{"exact", "near"}, false},
+		{0.3, []string{"exact", "near"}, true},
+		{0, []string{"exact"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("radius %g", tt.radius), func(t *testing.T) {
+			radius := tt.radius
+			result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 1, Radius: &radius})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			ids := make([]string, len(result.Results))
+			for i, r := range result.Results {
+				ids[i] = r.Vector.ID
+			}
+			if !reflect.DeepEqual(ids, tt.ids) || result.Total != len(tt.ids) || result.Capped != tt.capped {
+				t.Errorf("Expected %v (capped %v), got %v with total %d (capped %v)", tt.ids, tt.capped, ids, result.Total, result.Capped)
+			}
+		})
+	}
+
+	uncapped := newTestStore(t, store.Config{DBPath: "test_radius_uncapped.db"})
+	for _, v := range vectors {
+		if err := uncapped.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	radius := 1.0
+	result, err := uncapped.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 1, Radius: &radius})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 4 || result.Capped {
+		t.Errorf("Expected every vector but the opposite one within radius 1, got %d (capped %v)", result.Total, result.Capped)
+	}
+}
+
+func TestBoltStore_SearchDocumentTagFilter(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	documents := []*models.Document{
+		{ID: "d-public", Title: "Public", Content: "a", Tags: []string{"public"}},
+		{ID: "d-shared", Title: "Shared", Content: "b", Tags: []string{"public", "partner"}},
+		{ID: "d-private", Title: "Private", Content: "c", Tags: []string{"private"}},
+	}
+	for _, doc := range documents {
+		if err := testStore.InsertDocument(ctx, doc); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+	vectors := []*models.Vector{
+		{ID: "v-public", Vector: []float64{1, 0}, Metadata: models.Metadata{models.DocumentIDKey: "d-public"}},
+		{ID: "v-shared", Vector: []float64{1, 1}, Metadata: models.Metadata{models.DocumentIDKey: "d-shared"}},
+		{ID: "v-private", Vector: []float64{1, 0.5}, Metadata: models.Metadata{models.DocumentIDKey: "d-private"}},
+		{ID: "v-missing", Vector: []float64{1, 0.2}, Metadata: models.Metadata{models.DocumentIDKey: "d-deleted"}},
+		{ID: "v-unlinked", Vector: []float64{1, 0.1}},
+	}
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	tests := []struct {
+		tags []string
+		ids  []string
+	}{
+		{[]string{"public"}, []string{"v-public", "v-shared"}},
+		{[]string{"partner", "private"}, []string{"v-private", "v-shared"}},
+		{[]string{"unknown"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.tags, ","), func(t *testing.T) {
+			result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, DocumentTagFilter: tt.tags})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+
+			ids := make([]string, len(result.Results))
+			for i, r := range result.Results {
+				ids[i] = r.Vector.ID
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("Expected %v, got %v", tt.ids, ids)
+			}
+			if len(tt.ids) == 0 && result.Reason != models.ReasonNoFilterMatch {
+				t.Errorf("Expected reason %q, got %q", models.ReasonNoFilterMatch, result.Reason)
+			}
+		})
+	}
+}
+
+func TestBoltStore_ProjectVectors(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	// Points on the plane through (0.5, -0.5, 2) spanned by (1, 1, 0)/√2 and
+	// (0, 0, 1), so a 2D projection must preserve their distances
+	rng := rand.New(rand.NewSource(7))
+	points := make(map[string][]float64)
+	for i := 0; i < 20; i++ {
+		a, b := rng.NormFloat64()*3, rng.NormFloat64()
+		point := []float64{0.5 + a/math.Sqrt2, -0.5 + a/math.Sqrt2, 2 + b}
+		id := fmt.Sprintf("v%02d", i)
+		points[id] = point
+		v := &models.Vector{ID: id, Vector: point, Metadata: models.Metadata{"set": "plane"}}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "other", Vector: []float64{9, 9, 9}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	req := &models.ProjectRequest{Filter: models.Metadata{"set": "plane"}}
+	result, err := testStore.ProjectVectors(ctx, req)
+	if err != nil {
+		t.Fatalf("Projection failed: %v", err)
+	}
+	if len(result.Points) != 20 || result.Cached {
+		t.Fatalf("Expected 20 freshly projected points, got %d (cached %v)", len(result.Points), result.Cached)
+	}
+	if explained := result.ExplainedVariance[0] + result.ExplainedVariance[1]; math.Abs(explained-1) > 1e-9 {
+		t.Errorf("Expected the plane to explain all variance, got %v", result.ExplainedVariance)
+	}
+
+	distance := func(a, b []float64) float64 {
+		sum := 0.0
+		for i := range a {
+			sum += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		return math.Sqrt(sum)
+	}
+	for _, p := range result.Points {
+		for _, q := range result.Points {
+			original := distance(points[p.ID], points[q.ID])
+			if projected := distance(p.Coordinates, q.Coordinates); math.Abs(projected-original) > 1e-6 {
+				t.Fatalf("Expected distance %f between %s and %s, got %f", original, p.ID, q.ID, projected)
+			}
+		}
+	}
+
+	if result, err = testStore.ProjectVectors(ctx, req); err != nil || !result.Cached {
+		t.Errorf("Expected the second projection to reuse the fit, got cached %v (%v)", result != nil && result.Cached, err)
+	}
+	for i := 0; i < 3; i++ {
+		v := &models.Vector{ID: fmt.Sprintf("new%d", i), Vector: []float64{1, 1, 1}, Metadata: models.Metadata{"set": "plane"}}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	if result, err = testStore.ProjectVectors(ctx, req); err != nil || result.Cached || len(result.Points) != 23 {
+		t.Errorf("Expected a refit over 23 points after significant inserts, got cached %v (%v)", result != nil && result.Cached, err)
+	}
+}
+
+func TestBoltStore_AutoIndex(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		IndexType:      store.IndexAuto,
+		IndexThreshold: 200,
+		IndexAlgorithm: store.IndexIVF,
+		IndexProbes:    3,
+	})
+	ctx := context.Background()
+
+	// Vectors scattered around 8 well-separated centers
+	rng := rand.New(rand.NewSource(3))
+	centers := make([][]float64, 8)
+	for c := range centers {
+		centers[c] = make([]float64, 16)
+		for d := range centers[c] {
+			centers[c][d] = rng.NormFloat64()
+		}
+	}
+	insert := func(id string, c int) {
+		values := make([]float64, 16)
+		for d := range values {
+			values[d] = centers[c][d] + rng.NormFloat64()*0.05
+		}
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: values}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	for i := 0; i < 199; i++ {
+		insert(fmt.Sprintf("vec-%03d", i), i%8)
+	}
+
+	search := func() *models.SearchResponse {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: centers[0], TopK: 10, Limit: 10})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result
+	}
+	index := func() string {
+		stats, err := testStore.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		return stats.Index
+	}
+
+	if got := index(); got != store.IndexFlat {
+		t.Fatalf("Expected index %q below the threshold, got %q", store.IndexFlat, got)
+	}
+	flat := search()
+	if flat.Approximate {
+		t.Error("Expected flat search to be exact")
+	}
+
+	// The index is built in the background past the threshold
+	insert("vec-199", 5)
+	for deadline := time.Now().Add(5 * time.Second); index() != store.IndexIVF && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := index(); got != store.IndexIVF {
+		t.Fatalf("Expected index %q past the threshold, got %q", store.IndexIVF, got)
+	}
+	indexed := search()
+	if !indexed.Approximate {
+		t.Error("Expected indexed search to be flagged approximate")
+	}
+
+	if len(indexed.Results) != len(flat.Results) {
+		t.Fatalf("Expected %d results, got %d", len(flat.Results), len(indexed.Results))
+	}
+	for i := range flat.Results {
+		if flat.Results[i].Vector.ID != indexed.Results[i].Vector.ID {
+			t.Errorf("Expected result %d to be %s, got %s", i, flat.Results[i].Vector.ID, indexed.Results[i].Vector.ID)
+		}
+	}
+
+	// Vectors written after the switch are indexed too
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "center", Vector: centers[0]}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if result := search(); len(result.Results) == 0 || result.Results[0].Vector.ID != "center" {
+		t.Error("Expected a vector inserted after the switch to be found first")
+	}
+
+	// The index can be retrained on demand, but not on a flat store
+	built, err := testStore.BuildIndex(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+	if built.Vectors != 201 || built.Dimension != 16 || built.Lists != 14 {
+		t.Errorf("Expected 201 vectors of dimension 16 in 14 lists, got %+v", built)
+	}
+	if result := search(); len(result.Results) == 0 || result.Results[0].Vector.ID != "center" {
+		t.Error("Expected the retrained index to find the same vector first")
+	}
+	if _, err := newTestStore(t, store.Config{DBPath: "test_auto_index_flat.db"}).BuildIndex(ctx); err != store.ErrFlatIndex {
+		t.Errorf("Expected a flat store not to build an index, got %v", err)
+	}
+}
+
+func TestBoltStore_HNSWIndex(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		IndexType:      store.IndexAuto,
+		IndexThreshold: 500,
+		IndexEfSearch:  32,
+	})
+	flatStore := newTestStore(t, store.Config{DBPath: "test_hnsw_index_flat.db"})
+	ctx := context.Background()
+
+	rng := rand.New(rand.NewSource(7))
+	random := func() []float64 {
+		values := make([]float64, 32)
+		for d := range values {
+			values[d] = rng.NormFloat64()
+		}
+		return values
+	}
+	for i := 0; i < 500; i++ {
+		values := random()
+		for _, s := range []store.Store{testStore, flatStore} {
+			vector := &models.Vector{ID: fmt.Sprintf("vec-%03d", i), Vector: slices.Clone(values)}
+			if err := s.InsertVector(ctx, vector); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+	}
+
+	// Build over every vector rather than waiting for the background build
+	built, err := testStore.BuildIndex(ctx)
+	if err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+	if built.Index != store.IndexHNSW || built.Vectors != 500 || built.Dimension != 32 || built.Layers < 2 || built.Lists != 0 {
+		t.Errorf("Expected 500 vectors of dimension 32 in an HNSW graph of several layers, got %+v", built)
+	}
+	if stats, err := testStore.Stats(ctx); err != nil || stats.Index != store.IndexHNSW {
+		t.Fatalf("Expected index %q, got %+v (%v)", store.IndexHNSW, stats, err)
+	}
+
+	search := func(s store.Store, query []float64) *models.SearchResponse {
+		result, err := s.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 10, Limit: 10})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result
+	}
+	// recall returns the share of the exact ten nearest the graph finds
+	recall := func() float64 {
+		found := 0
+		for q := 0; q < 20; q++ {
+			query := random()
+			indexed := search(testStore, query)
+			if !indexed.Approximate {
+				t.Fatal("Expected indexed search to be flagged approximate")
+			}
+			ids := make(map[string]bool)
+			for _, result := range indexed.Results {
+				ids[result.Vector.ID] = true
+			}
+			for _, result := range search(flatStore, query).Results {
+				if ids[result.Vector.ID] {
+					found++
+				}
+			}
+		}
+		return float64(found) / 200
+	}
+	if got := recall(); got < 0.9 {
+		t.Errorf("Expected a recall of at least 0.9, got %.2f", got)
+	}
+
+	// Removed vectors are unlinked without disconnecting the graph
+	for i := 0; i < 500; i += 3 {
+		for _, s := range []store.Store{testStore, flatStore} {
+			if err := s.DeleteVector(ctx, fmt.Sprintf("vec-%03d", i)); err != nil {
+				t.Fatalf("Failed to delete vector: %v", err)
+			}
+		}
+	}
+	if got := recall(); got < 0.9 {
+		t.Errorf("Expected a recall of at least 0.9 after deletes, got %.2f", got)
+	}
+
+	// Vectors written after the build are linked into the graph
+	query := random()
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "query", Vector: slices.Clone(query)}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if result := search(testStore, query); len(result.Results) == 0 || result.Results[0].Vector.ID != "query" {
+		t.Error("Expected a vector inserted after the build to be found first")
+	}
+}
+
+func TestBoltStore_InsertHooks(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		BuiltinHooks: []string{store.HookContentHash, store.HookTokenCount},
+		InsertHooks: []store.InsertHook{
+			func(ctx context.Context, vector *models.Vector) error {
+				vector.Metadata["inserted_by"] = "importer"
+				return nil
+			},
+		},
+	})
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		v := &models.Vector{ID: id, Vector: []float64{1, 2}, Text: "the quick fox"}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "c", Vector: []float64{1, 2}, Text: "a slow fox"}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	a, err := testStore.GetVector(ctx, "a")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if a.Metadata["inserted_by"] != "importer" {
+		t.Errorf("Expected the hook's metadata to be stored, got %v", a.Metadata)
+	}
+	if a.Metadata[store.TokenCountKey] != "3" {
+		t.Errorf("Expected token count 3, got %q", a.Metadata[store.TokenCountKey])
+	}
+
+	ids, err := testStore.IndexPostings(ctx, "inserted_by", "importer")
+	if err != nil || len(ids) != 3 {
+		t.Errorf("Expected the hook's metadata to be indexed for 3 vectors, got %v (%v)", ids, err)
+	}
+	duplicates, err := testStore.IndexPostings(ctx, store.ContentHashKey, a.Metadata[store.ContentHashKey])
+	if err != nil || !reflect.DeepEqual(duplicates, []string{"a", "b"}) {
+		t.Errorf("Expected identical content to share a hash, got %v (%v)", duplicates, err)
+	}
+
+	_, err = store.NewBoltStore(store.Config{DBPath: "test_insert_hooks_invalid.db", BuiltinHooks: []string{"unknown"}})
+	if err == nil {
+		t.Error("Expected an unknown built-in hook to be rejected")
+	}
+}
+
+func TestBoltStore_ValidateVectorRunsHooks(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		MaxMetadataEntries: 2,
+		NormalizeMetadata:  true,
+		InsertHooks: []store.InsertHook{
+			func(ctx context.Context, vector *models.Vector) error {
+				if vector.Text == "spam" {
+					return errors.New(http.StatusUnprocessableEntity, "spam")
+				}
+				vector.Metadata["inserted_by"] = "importer"
+				return nil
+			},
+		},
+	})
+	ctx := context.Background()
+
+	vector := &models.Vector{ID: "a", Vector: []float64{1, 2}, Metadata: map[string]string{"topic": "ai"}}
+	if err := testStore.ValidateVector(ctx, vector); err != nil {
+		t.Fatalf("Expected vector to validate, got %v", err)
+	}
+	if len(vector.Metadata) != 1 {
+		t.Errorf("Expected validation to leave the vector as given, got %v", vector.Metadata)
+	}
+
+	// Each of these is rejected by InsertVector, so validation must reject it
+	for name, vector := range map[string]*models.Vector{
+		"hook error":          {ID: "b", Vector: []float64{1, 2}, Text: "spam", Metadata: map[string]string{}},
+		"hook metadata":       {ID: "c", Vector: []float64{1, 2}, Metadata: map[string]string{"topic": "ai", "lang": "en"}},
+		"normalized reserved": {ID: "d", Vector: []float64{1, 2}, Metadata: map[string]string{" Embedding_Model ": "x"}},
+	} {
+		validateErr := testStore.ValidateVector(ctx, vector)
+		insertErr := testStore.InsertVector(ctx, vector)
+		if validateErr == nil || insertErr == nil {
+			t.Errorf("%s: expected validation and insert to fail, got %v and %v", name, validateErr, insertErr)
+		}
+	}
+}
+
+func TestBoltStore_InsertHooksOnUpdate(t *testing.T) {
+	testStore := newTestStore(t, store.Config{BuiltinHooks: []string{store.HookTokenCount}})
+	ctx := context.Background()
+
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "a", Vector: []float64{1, 2}, Text: "the quick fox"}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	tokenCount := func(want string) {
+		t.Helper()
+		a, err := testStore.GetVector(ctx, "a")
+		if err != nil {
+			t.Fatalf("Failed to get vector: %v", err)
+		}
+		if a.Metadata[store.TokenCountKey] != want {
+			t.Errorf("Expected token count %s, got %q", want, a.Metadata[store.TokenCountKey])
+		}
+		ids, err := testStore.IndexPostings(ctx, store.TokenCountKey, want)
+		if err != nil || len(ids) != 1 {
+			t.Errorf("Expected token count %s to be indexed, got %v (%v)", want, ids, err)
+		}
+	}
+
+	if err := testStore.UpdateVector(ctx, "a", &models.Vector{Vector: []float64{1, 2}, Text: "fox"}); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	tokenCount("1")
+
+	text := "the quick brown fox"
+	if _, err := testStore.PatchVector(ctx, "a", &models.PatchVectorRequest{Text: &text}); err != nil {
+		t.Fatalf("Failed to patch vector: %v", err)
+	}
+	tokenCount("4")
+
+	errs, err := testStore.UpdateVectors(ctx, []*models.Vector{{ID: "a", Vector: []float64{1, 2}, Text: "a fox"}}, true)
+	if err != nil || errs[0] != nil {
+		t.Fatalf("Failed to update batch: %v %v", err, errs)
+	}
+	tokenCount("2")
+}
+
+func TestBoltStore_SearchCacheKeyedByMetric(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SearchCacheSize: 10})
+	ctx := context.Background()
+
+	// a points the same way as the query, b is closer to it
+	for id, values := range map[string][]float64{"a": {1, 0}, "b": {10, 1}} {
+		v := &models.Vector{ID: id, Vector: values, Metadata: models.Metadata{"set": "x"}}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	search := func(metric string) *models.SearchResponse {
+		req := &models.SearchRequest{Query: []float64{10, 0}, Filter: models.Metadata{"set": "x"}, TopK: 2, Metric: metric}
+		result, err := testStore.SearchVectors(ctx, req)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result
+	}
+
+	for _, round := range []string{"first", "cached"} {
+		cosine, euclidean := search(models.MetricCosine), search(models.MetricEuclidean)
+		if cached := round == "cached"; cosine.Cached != cached || euclidean.Cached != cached {
+			t.Errorf("Expected %s search to have cached %v, got %v and %v", round, cached, cosine.Cached, euclidean.Cached)
+		}
+		if cosine.Metric != models.MetricCosine || cosine.Results[0].Vector.ID != "a" {
+			t.Errorf("Expected %s cosine search to rank a first, got %s (%s)", round, cosine.Results[0].Vector.ID, cosine.Metric)
+		}
+		if euclidean.Metric != models.MetricEuclidean || euclidean.Results[0].Vector.ID != "b" {
+			t.Errorf("Expected %s euclidean search to rank b first, got %s (%s)", round, euclidean.Results[0].Vector.ID, euclidean.Metric)
+		}
+		if score := euclidean.Results[0].Score; math.Abs(score-0.5) > 1e-9 {
+			t.Errorf("Expected euclidean score 0.5 for b, got %f", score)
+		}
+	}
+
+	// Writes invalidate cached responses
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "c", Vector: []float64{10, 0}, Metadata: models.Metadata{"set": "x"}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if result := search(models.MetricEuclidean); result.Cached || result.Results[0].Vector.ID != "c" {
+		t.Errorf("Expected a fresh search ranking c first after a write, got %s (cached %v)", result.Results[0].Vector.ID, result.Cached)
+	}
+}
+
+func TestBoltStore_FlushSearchCache(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SearchCacheSize: 10})
+	ctx := context.Background()
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "a", Vector: []float64{1, 0}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	search := func() *models.SearchResponse {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 1})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result
+	}
+	search()
+	if !search().Cached {
+		t.Fatal("Expected the repeated search to be served from the cache")
+	}
+
+	evicted, err := testStore.FlushSearchCache(ctx)
+	if err != nil || evicted != 1 {
+		t.Fatalf("Expected 1 response evicted, got %d (%v)", evicted, err)
+	}
+	if search().Cached {
+		t.Error("Expected the search after a flush to miss the cache")
+	}
+	if evicted, _ := testStore.FlushSearchCache(ctx); evicted != 1 {
+		t.Errorf("Expected the search after the flush to be cached again, evicted %d", evicted)
+	}
+}
+
+func TestBoltStore_SearchCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SearchCacheSize: 2})
+	ctx := context.Background()
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "a", Vector: []float64{1, 0}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	search := func(topK int) bool {
+		t.Helper()
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: topK})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result.Cached
+	}
+	search(1)
+	search(2)
+	// Using the first search makes the second the least recently used
+	if !search(1) {
+		t.Fatal("Expected the first search to be cached")
+	}
+	search(3)
+
+	if !search(1) {
+		t.Error("Expected the recently used search to survive the eviction")
+	}
+	if !search(3) {
+		t.Error("Expected the newest search to be cached")
+	}
+	if search(2) {
+		t.Error("Expected the least recently used search to be evicted")
+	}
+	if evicted, _ := testStore.FlushSearchCache(ctx); evicted != 2 {
+		t.Errorf("Expected the cache to hold 2 responses, evicted %d", evicted)
+	}
+}
+
+func TestBoltStore_SearchCacheWarm(t *testing.T) {
+	dbPath := "test_search_cache_warm.db"
+	config := store.Config{DBPath: dbPath, SearchCacheSize: 10, SearchCacheWarm: 1}
+	testStore := newTestStore(t, config)
+	ctx := context.Background()
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "a", Vector: []float64{1, 0}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	search := func(s store.Store, query []float64) *models.SearchResponse {
+		result, err := s.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 1})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result
+	}
+	// The first query is the most frequent and the only one persisted
+	for i := 0; i < 3; i++ {
+		search(testStore, []float64{1, 0})
+	}
+	search(testStore, []float64{0, 1})
+	testStore.Close()
+
+	config.Timeout = time.Second
+	reopened, err := store.NewBoltStore(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+
+	warmed := func() int64 {
+		stats, err := reopened.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		return stats.WarmedSearches
+	}
+	for deadline := time.Now().Add(5 * time.Second); warmed() == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := warmed(); got != 1 {
+		t.Fatalf("Expected 1 search warmed, got %d", got)
+	}
+	if !search(reopened, []float64{1, 0}).Cached {
+		t.Error("Expected the most frequent search to be served from the warmed cache")
+	}
+	if search(reopened, []float64{0, 1}).Cached {
+		t.Error("Expected the less frequent search to miss the cache")
+	}
+}
+
+func TestBoltStore_SearchCacheCopies(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SearchCacheSize: 10})
+	ctx := context.Background()
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "a", Vector: []float64{1, 0}, Metadata: models.Metadata{"team": "x"}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	search := func() *models.SearchResponse {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 1, GroupBy: "team"})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result
+	}
+	// Mutating a response, whether computed or served from the cache,
+	// leaves later cache hits intact
+	for round := 0; round < 3; round++ {
+		result := search()
+		if round > 0 && !result.Cached {
+			t.Fatalf("Expected round %d to be served from the cache", round)
+		}
+		hit, group := result.Results[0], result.Groups["x"][0]
+		if hit.Vector.Vector[0] != 1 || hit.Vector.Metadata["team"] != "x" || group.Vector.Metadata["team"] != "x" {
+			t.Fatalf("Expected round %d to be unchanged, got %+v and group %+v", round, hit.Vector, group.Vector)
+		}
+		hit.Vector.Vector[0] = 42
+		hit.Vector.Metadata["team"] = "mutated"
+		group.Vector.Metadata["team"] = "mutated"
+		result.Groups["y"] = nil
+	}
+}
+
+func TestBoltStore_SearchCacheSkipsApproximate(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SearchCacheSize: 10, MaxCandidates: 2})
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("v%d", i), Vector: []float64{1, float64(i)}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	for round := 0; round < 2; round++ {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 2})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if !result.Approximate || result.Cached {
+			t.Errorf("Expected a sampled search to be approximate and never cached, got approximate %v and cached %v", result.Approximate, result.Cached)
+		}
+	}
+}
+
+func TestBoltStore_SnapshotsReleasedDuringChurn(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for i := 0; i < 200; i++ {
+		v := &models.Vector{ID: fmt.Sprintf("base-%d", i), Vector: []float64{float64(i), 1}}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var peak atomic.Int64
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, float64(i)}, TopK: 5}); err != nil {
+					t.Errorf("Search failed: %v", err)
+					return
+				}
+				if stats, err := testStore.Stats(ctx); err == nil && int64(stats.Snapshots) > peak.Load() {
+					peak.Store(int64(stats.Snapshots))
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("churn-%d", i)
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, float64(i)}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		if err := testStore.DeleteVector(ctx, id); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+	wg.Wait()
+
+	stats, err := testStore.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Snapshots != 0 || stats.SnapshotVectors != 0 {
+		t.Errorf("Expected every snapshot to be released, got %d holding %d vectors", stats.Snapshots, stats.SnapshotVectors)
+	}
+	if peak.Load() > 4 {
+		t.Errorf("Expected at most one live snapshot per searcher, got %d", peak.Load())
+	}
+}
+
+func TestBoltStore_HybridAndBlendedSearchDuringChurn(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for i := 0; i < 200; i++ {
+		v := &models.Vector{ID: fmt.Sprintf("base-%d", i), Vector: []float64{float64(i), 1}, Text: "quick fox"}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, float64(i)}, IncludeVector: true, IncludeEmbedding: true}); err != nil {
+					t.Errorf("Hybrid search failed: %v", err)
+					return
+				}
+				if _, err := testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{Query: "fox", QueryVector: []float64{1, float64(i)}, VectorWeight: 1, KeywordWeight: 1, FuzzyWeight: 1}); err != nil {
+					t.Errorf("Blended search failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("churn-%d", i)
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, float64(i)}, Text: "fox"}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		if err := testStore.DeleteVector(ctx, id); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+	wg.Wait()
+
+	stats, err := testStore.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Snapshots != 0 || stats.SnapshotVectors != 0 {
+		t.Errorf("Expected every snapshot to be released, got %d holding %d vectors", stats.Snapshots, stats.SnapshotVectors)
+	}
+
+	// Deleted vectors aren't returned once the churn is over
+	hybrid, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}, Limit: 100})
+	if err != nil {
+		t.Fatalf("Hybrid search failed: %v", err)
+	}
+	if hybrid.Total != 200 {
+		t.Errorf("Expected only the 200 remaining vectors, got %d", hybrid.Total)
+	}
+}
+
+func TestBoltStore_SnapshotMaxAge(t *testing.T) {
+	testStore := newTestStore(t, store.Config{SnapshotMaxAge: time.Nanosecond})
+	ctx := context.Background()
+
+	for i := 0; i < 3000; i++ {
+		v := &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: []float64{float64(i), 1}}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 5})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if !result.Approximate || len(result.Results) != 5 {
+		t.Errorf("Expected 5 approximate results from an expired snapshot, got %d (approximate %v)", len(result.Results), result.Approximate)
+	}
+	if stats, _ := testStore.Stats(ctx); stats.Snapshots != 0 {
+		t.Errorf("Expected the expired snapshot to be released, got %d live", stats.Snapshots)
+	}
+}
+
+func TestBoltStore_SearchNegativeExamples(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for id, values := range map[string][]float64{
+		"near-negative": {1, 0.3},
+		"other":         {1, -0.35},
+		"disliked":      {0.5, 1},
+	} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: values}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	rank := func(req *models.SearchRequest) []string {
+		result, err := testStore.SearchVectors(ctx, req)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		ids := make([]string, len(result.Results))
+		for i, r := range result.Results {
+			ids[i] = r.Vector.ID
+		}
+		return ids
+	}
+
+	if ids := rank(&models.SearchRequest{Query: []float64{1, 0}, TopK: 2}); ids[0] != "near-negative" {
+		t.Fatalf("Expected near-negative to rank first without negatives, got %v", ids)
+	}
+	if ids := rank(&models.SearchRequest{Query: []float64{1, 0}, TopK: 2, NegativeVectors: []models.Embedding{{0.5, 1}}}); ids[0] != "other" {
+		t.Errorf("Expected a negative vector to push near-negative down, got %v", ids)
+	}
+	if ids := rank(&models.SearchRequest{Query: []float64{1, 0}, TopK: 2, NegativeIDs: []string{"disliked"}}); ids[0] != "other" {
+		t.Errorf("Expected a negative ID to push near-negative down, got %v", ids)
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, NegativeIDs: []string{"disliked"}})
+	if err != nil || result.Weights["negative"] != 0.5 {
+		t.Errorf("Expected the default negative weight to be echoed, got %v (%v)", result.Weights, err)
+	}
+	_, err = testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, NegativeIDs: []string{"missing"}})
+	if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown negative ID, got %v", err)
+	}
+}
+
+func TestBoltStore_SearchScoreNormalization(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for _, v := range []*models.Vector{
+		{ID: "same", Vector: []float64{1, 0}},
+		{ID: "close", Vector: []float64{0.6, 0.8}},
+		{ID: "orthogonal", Vector: []float64{0, 1}},
+		{ID: "opposite", Vector: []float64{-1, 0}},
+	} {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	order := []string{"same", "close", "orthogonal", "opposite"}
+	for normalization, want := range map[string][]float64{
+		"":                       {1, 0.8, 0.5, 0},
+		models.NormalizationRaw:  {1, 0.6, 0, -1},
+		models.NormalizationUnit: {1, 0.8, 0.5, 0},
+		models.NormalizationRank: {1, 2.0 / 3, 1.0 / 3, 0},
+	} {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, ScoreNormalization: normalization})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if normalization == "" && result.ScoreNormalization != models.NormalizationUnit {
+			t.Errorf("Expected cosine scores to default to unit, got %q", result.ScoreNormalization)
+		}
+		if len(result.Results) != len(order) {
+			t.Fatalf("Expected %d results with %q, got %d", len(order), normalization, len(result.Results))
+		}
+		for i, r := range result.Results {
+			if r.Vector.ID != order[i] || math.Abs(r.Score-want[i]) > 1e-9 {
+				t.Errorf("Expected %s with score %v at %d with %q, got %s %v", order[i], want[i], i, normalization, r.Vector.ID, r.Score)
+			}
+		}
+	}
+
+	// min_score compares against the returned scores: unit 0.5 is an
+	// orthogonal vector
+	minScore := 0.5
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, ScoreNormalization: models.NormalizationUnit, MinScore: &minScore})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Results) != 3 {
+		t.Errorf("Expected 3 results above the unit min_score, got %d", len(result.Results))
+	}
+
+	// The radius is a cosine distance whatever the normalization, 0.5
+	// keeping the vectors with a similarity of 0.5 and up
+	radius := 0.5
+	for _, normalization := range []string{"", models.NormalizationRaw, models.NormalizationUnit, models.NormalizationRank} {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, ScoreNormalization: normalization, Radius: &radius})
+		if err != nil {
+			t.Fatalf("Search failed with %q: %v", normalization, err)
+		}
+		ids := make([]string, len(result.Results))
+		for i, r := range result.Results {
+			ids[i] = r.Vector.ID
+		}
+		if !reflect.DeepEqual(ids, []string{"same", "close"}) {
+			t.Errorf("Expected [same close] within the radius with %q, got %v", normalization, ids)
+		}
+	}
+	if _, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, ScoreNormalization: models.NormalizationRank, MinScore: &minScore}); err == nil {
+		t.Error("Expected min_score to be rejected with rank normalization")
+	}
+}
+
+func TestBoltStore_DocumentRetention(t *testing.T) {
+	testStore := newTestStore(t, store.Config{
+		DocumentRetention:     time.Hour,
+		DocumentSweepInterval: 10 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	short := &models.Document{ID: "short", Title: "Log", Content: "entry", Tags: []string{"log"}, ExpiresAt: &expiresAt}
+	if err := testStore.InsertDocument(ctx, short); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	kept := &models.Document{ID: "kept", Title: "Log", Content: "entry", Tags: []string{"log"}}
+	if err := testStore.InsertDocument(ctx, kept); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if kept.ExpiresAt == nil || kept.ExpiresAt.Sub(kept.CreatedAt) != time.Hour {
+		t.Errorf("Expected the default retention to set an expiry an hour out, got %v", kept.ExpiresAt)
+	}
+
+	if _, err := testStore.GetDocument(ctx, "short"); err != nil {
+		t.Fatalf("Expected the document to be readable before expiry: %v", err)
+	}
+
+	// Clearing an expiry keeps the document
+	cleared := &models.Document{ID: "cleared", Title: "Log", Content: "entry", ExpiresAt: &expiresAt}
+	if err := testStore.InsertDocument(ctx, cleared); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if _, err := testStore.UpdateDocument(ctx, "cleared", &models.UpdateDocumentRequest{Title: "Log", Content: "kept", KeepForever: true}); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		stats, err := testStore.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Documents == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the expired document to be purged, %d documents left", stats.Documents)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := testStore.GetDocument(ctx, "short"); err != errors.ErrDocumentNotFound {
+		t.Errorf("Expected the purged document to be gone, got %v", err)
+	}
+	if doc, err := testStore.GetDocument(ctx, "cleared"); err != nil || doc.ExpiresAt != nil {
+		t.Errorf("Expected the document with a cleared expiry to be kept, got %v (%v)", doc, err)
+	}
+	tagged, err := testStore.ListDocumentsByTag(ctx, "log", 10, 0)
+	if err != nil || len(tagged) != 1 || tagged[0].ID != "kept" {
+		t.Errorf("Expected only the kept document to be tagged, got %v (%v)", tagged, err)
+	}
+}
+
+func TestBoltStore_ExpiredDocumentsLeftOutOfSearch(t *testing.T) {
+	// The janitor doesn't run during the test, so the document is expired
+	// but still stored
+	testStore := newTestStore(t, store.Config{DocumentSweepInterval: time.Hour})
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	docs := []*models.Document{
+		{ID: "expired", Title: "Fox", Content: "fox", Tags: []string{"animals"}, ExpiresAt: &expiresAt},
+		{ID: "kept", Title: "Fox", Content: "fox", Tags: []string{"animals"}},
+	}
+	for _, doc := range docs {
+		if err := testStore.InsertDocument(ctx, doc); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+	for _, id := range []string{"expired", "kept"} {
+		v := &models.Vector{ID: "v-" + id, Vector: []float64{1, 0}, Metadata: models.Metadata{models.DocumentIDKey: id}}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	time.Sleep(time.Until(expiresAt))
+
+	unified, err := testStore.UnifiedSearch(ctx, &models.UnifiedSearchRequest{Query: "fox", DocumentsWeight: 1})
+	if err != nil {
+		t.Fatalf("Unified search failed: %v", err)
+	}
+	if len(unified.Results) != 1 || unified.Results[0].ID != "kept" {
+		t.Errorf("Expected only the unexpired document, got %+v", unified.Results)
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, DocumentTagFilter: []string{"animals"}})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Vector.ID != "v-kept" {
+		t.Errorf("Expected only the vector of the unexpired document, got %d results", len(result.Results))
+	}
+}
+
+func TestBoltStore_UpdateVectorsBatch(t *testing.T) {
+	ctx := context.Background()
+
+	for _, atomic := range []bool{true, false} {
+		t.Run(fmt.Sprintf("atomic=%v", atomic), func(t *testing.T) {
+			testStore := newTestStore(t, store.Config{BuiltinHooks: []string{store.HookTokenCount}})
+			for _, id := range []string{"a", "b"} {
+				v := &models.Vector{ID: id, Vector: []float64{1, 0}, Metadata: models.Metadata{"state": "old"}}
+				if err := testStore.InsertVector(ctx, v); err != nil {
+					t.Fatalf("Failed to insert vector: %v", err)
+				}
+			}
+
+			updates := []*models.Vector{
+				{ID: "a", Vector: []float64{0, 1}, Metadata: models.Metadata{"state": "new"}},
+				{ID: "missing", Vector: []float64{0, 1}, Metadata: models.Metadata{"state": "new"}},
+				{ID: "b", Vector: []float64{0, 1}, Metadata: models.Metadata{"state": "new"}},
+			}
+			errs, err := testStore.UpdateVectors(ctx, updates, atomic)
+			if err != nil {
+				t.Fatalf("Batch update failed: %v", err)
+			}
+			if errs[1] != errors.ErrVectorNotFound {
+				t.Errorf("Expected the missing vector to fail with not found, got %v", errs[1])
+			}
+
+			updated, _ := testStore.IndexPostings(ctx, "state", "new")
+			kept, _ := testStore.IndexPostings(ctx, "state", "old")
+			a, _ := testStore.GetVector(ctx, "a")
+			if atomic {
+				if errs[0] != errors.ErrBatchAborted || errs[2] != errors.ErrBatchAborted {
+					t.Errorf("Expected the valid updates to be aborted, got %v", errs)
+				}
+				if len(updated) != 0 || len(kept) != 2 || a.Vector[0] != 1 {
+					t.Errorf("Expected nothing to be applied, got new %v and old %v, a %v", updated, kept, a.Vector)
+				}
+				if len(updates[0].Metadata) != 1 || !updates[0].UpdatedAt.IsZero() {
+					t.Errorf("Expected an aborted batch to leave its vectors as given, got %+v", updates[0])
+				}
+			} else {
+				if errs[0] != nil || errs[2] != nil {
+					t.Errorf("Expected the valid updates to apply, got %v", errs)
+				}
+				if len(updated) != 2 || len(kept) != 0 || a.Vector[0] != 0 {
+					t.Errorf("Expected the valid updates to be applied, got new %v and old %v, a %v", updated, kept, a.Vector)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBoltStore_InsertDuringSearch measures inserts while long
+// searches run continuously. Searches score without holding the store lock,
+// so inserts shouldn't wait for them.
+func BenchmarkBoltStore_InsertDuringSearch(b *testing.B) {
+	dbPath := "test_bench_insert_during_search.db"
+	defer os.Remove(dbPath)
+
+	benchStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		b.Fatalf("Failed to create store: %v", err)
+	}
+	defer benchStore.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	ctx := context.Background()
+	for _, v := range randomVectors(rng, 5000, 512) {
+		if err := benchStore.InsertVector(ctx, v); err != nil {
+			b.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	query := randomVectors(rng, 1, 512)[0].Vector
+
+	stop := make(chan struct{})
+	var searches sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		searches.Add(1)
+		go func() {
+			defer searches.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				benchStore.SearchVectors(ctx, &models.SearchRequest{Query: query, TopK: 10, Limit: 10})
+			}
+		}()
+	}
+
+	var slowest time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vector := &models.Vector{ID: fmt.Sprintf("new-%d", i), Vector: query}
+		start := time.Now()
+		if err := benchStore.InsertVector(ctx, vector); err != nil {
+			b.Fatalf("Failed to insert vector: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > slowest {
+			slowest = elapsed
+		}
+	}
+	b.StopTimer()
+	close(stop)
+	searches.Wait()
+
+	b.ReportMetric(float64(slowest.Microseconds()), "max-insert-µs")
+}
+
+func TestBoltStore_LogsCarryRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	logger.Init(logger.Config{Level: "info", Format: "json"})
+	logger.Default.SetOutput(&logs)
+	t.Cleanup(func() { logger.Init(logger.Config{Level: "info", Format: "json"}) })
+
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			logs.Reset()
+			testStore := newTestStore(t, store.Config{IndexType: store.IndexAuto, IndexThreshold: 2, LogRequestIDs: enabled})
+			ctx := logger.ContextWithRequestID(context.Background(), "req-42")
+			for _, id := range []string{"a", "b"} {
+				if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}}); err != nil {
+					t.Fatalf("Failed to insert vector: %v", err)
+				}
+			}
+			// The index built in the background logs under the request
+			// that started it, closing waits for it
+			testStore.Close()
+
+			if !strings.Contains(logs.String(), "Switched vector search from flat to HNSW index") {
+				t.Fatalf("Expected the insert to log the index switch, got %q", logs.String())
+			}
+			if got := strings.Contains(logs.String(), `"request_id":"req-42"`); got != enabled {
+				t.Errorf("Expected request ID logged to be %v, got logs %q", enabled, logs.String())
+			}
+		})
+	}
+}
+
+// randomTexts returns n texts of the given number of words drawn from a
+// vocabulary of vocab words.
+func randomTexts(rng *rand.Rand, n, words, vocab int) []string {
+	texts := make([]string, n)
+	for i := range texts {
+		parts := make([]string, words)
+		for j := range parts {
+			parts[j] = fmt.Sprintf("word%d", rng.Intn(vocab))
+		}
+		texts[i] = strings.Join(parts, " ")
+	}
+	return texts
+}
+
+func TestBoltStore_KeywordStatsMatchRecompute(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	texts := randomTexts(rng, 200, 12, 50)
+	ctx := context.Background()
+
+	// A bound of one posting drops the postings on the first insert, so
+	// that store tokenizes the vectors it scores on every query
+	scores := make(map[int]map[string]float64)
+	filtered := make(map[int]map[string]float64)
+	for _, maxPostings := range []int{0, 1} {
+		testStore := newTestStore(t, store.Config{
+			DBPath:             fmt.Sprintf("test_keyword_stats_%d.db", maxPostings),
+			KeywordMaxPostings: maxPostings,
+		})
+		for i, text := range texts {
+			v := &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: []float64{1, 0}, Text: text, Metadata: models.Metadata{"half": fmt.Sprint(i % 2)}}
+			if err := testStore.InsertVector(ctx, v); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+		for i := 0; i < 20; i++ {
+			v := &models.Vector{Vector: []float64{1, 0}, Text: texts[len(texts)-1-i]}
+			if err := testStore.UpdateVector(ctx, fmt.Sprintf("vec-%d", i), v); err != nil {
+				t.Fatalf("Failed to update vector: %v", err)
+			}
+			if err := testStore.DeleteVector(ctx, fmt.Sprintf("vec-%d", 100+i)); err != nil {
+				t.Fatalf("Failed to delete vector: %v", err)
+			}
+		}
+
+		result, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{
+			Query:            "word1 word2 word3 word2",
+			AllowKeywordOnly: true,
+			Limit:            100,
+		})
+		if err != nil {
+			t.Fatalf("Hybrid search failed: %v", err)
+		}
+		scores[maxPostings] = make(map[string]float64)
+		for _, r := range result.Results {
+			scores[maxPostings][r.ID] = r.KeywordScore
+		}
+
+		// Vectors scored out of a filtered subset score against the
+		// statistics of the whole corpus too
+		blended, err := testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{
+			Query:         "word1 word2 word3 word2",
+			Filter:        models.Metadata{"half": "1"},
+			KeywordWeight: 1,
+			Limit:         100,
+		})
+		if err != nil {
+			t.Fatalf("Blended search failed: %v", err)
+		}
+		filtered[maxPostings] = make(map[string]float64)
+		for _, r := range blended.Results {
+			filtered[maxPostings][r.ID] = r.Components["keyword"]
+		}
+	}
+
+	for _, scores := range []map[int]map[string]float64{scores, filtered} {
+		if len(scores[0]) == 0 || len(scores[0]) != len(scores[1]) {
+			t.Fatalf("Expected the same matches, got %d and %d", len(scores[0]), len(scores[1]))
+		}
+		for id, score := range scores[1] {
+			if math.Abs(scores[0][id]-score) > 1e-9 {
+				t.Errorf("Expected %s to score %f as when recomputed, got %f", id, score, scores[0][id])
+			}
+		}
+	}
+}
+
+func TestBoltStore_HybridSearchQueryTermDecay(t *testing.T) {
+	ctx := context.Background()
+	texts := map[string]string{
+		"only-pasta": "pasta pasta pasta",
+		"recipe":     "how to cook fresh pasta at home",
+		"weather":    "the weather today is sunny",
+		"class":      "cooking class schedule for the week",
+	}
+
+	// A verbose query repeating one of its terms, ranked from the kept
+	// statistics and recomputed
+	for _, maxPostings := range []int{0, 1} {
+		testStore := newTestStore(t, store.Config{
+			DBPath:             fmt.Sprintf("test_query_term_decay_%d.db", maxPostings),
+			KeywordMaxPostings: maxPostings,
+		})
+		for id, text := range texts {
+			if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}, Text: text}); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+
+		search := func(decay *float64) []models.HybridSearchResult {
+			t.Helper()
+			result, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{
+				Query:            "how to cook pasta pasta pasta pasta pasta",
+				AllowKeywordOnly: true,
+				QueryTermDecay:   decay,
+			})
+			if err != nil {
+				t.Fatalf("Hybrid search failed: %v", err)
+			}
+			return result.Results
+		}
+		decay := func(d float64) *float64 { return &d }
+
+		if results := search(nil); results[0].ID != "only-pasta" {
+			t.Errorf("Expected repetitions to count fully by default, got %s first", results[0].ID)
+		}
+		if results := search(decay(0)); results[0].ID != "recipe" {
+			t.Errorf("Expected the recipe first when terms count once, got %s first", results[0].ID)
+		}
+		if results := search(decay(0.5)); results[0].ID != "recipe" {
+			t.Errorf("Expected the recipe first with decaying repetitions, got %s first", results[0].ID)
+		}
+
+		// Without repetitions the decay changes nothing
+		plain, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "cook pasta", AllowKeywordOnly: true})
+		if err != nil {
+			t.Fatalf("Hybrid search failed: %v", err)
+		}
+		decayed, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "cook pasta", AllowKeywordOnly: true, QueryTermDecay: decay(0)})
+		if err != nil {
+			t.Fatalf("Hybrid search failed: %v", err)
+		}
+		if !reflect.DeepEqual(plain.Results, decayed.Results) {
+			t.Errorf("Expected queries without repetitions to score the same, got %+v and %+v", plain.Results, decayed.Results)
+		}
+	}
+}
+
+func TestBoltStore_HybridSearchEmptyText(t *testing.T) {
+	ctx := context.Background()
+	texts := []string{"red apples and green pears", "apples", "a basket of ripe red cherries"}
+
+	// The keyword score of the first text, with and without vectors without
+	// text, both from the kept statistics and recomputed
+	keywordScore := func(name string, empties int, config store.Config) float64 {
+		config.DBPath = "test_empty_text_" + name + ".db"
+		testStore := newTestStore(t, config)
+		for i, text := range texts {
+			v := &models.Vector{ID: fmt.Sprintf("text-%d", i), Vector: []float64{1, 0}, Text: text}
+			if err := testStore.InsertVector(ctx, v); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+		for i := 0; i < empties; i++ {
+			v := &models.Vector{ID: fmt.Sprintf("empty-%d", i), Vector: []float64{0, 1}}
+			if i%2 == 1 {
+				v.Text = " . "
+			}
+			if err := testStore.InsertVector(ctx, v); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+
+		result, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{
+			Query:       "red apples",
+			QueryVector: []float64{0, 1},
+			Limit:       100,
+		})
+		if err != nil {
+			t.Fatalf("Hybrid search failed: %v", err)
+		}
+		if result.Total != len(texts)+empties {
+			t.Fatalf("Expected every vector to be scored, got %d", result.Total)
+		}
+		var score float64
+		for _, r := range result.Results {
+			if strings.HasPrefix(r.ID, "empty-") && (r.KeywordScore != 0 || r.VectorScore != 1) {
+				t.Errorf("Expected %s to score through its vector only, got %+v", r.ID, r)
+			}
+			if r.ID == "text-0" {
+				score = r.KeywordScore
+			}
+		}
+		return score
+	}
+
+	want := keywordScore("none", 0, store.Config{})
+	if want <= 0 {
+		t.Fatalf("Expected a keyword score, got %f", want)
+	}
+	if got := keywordScore("indexed", 20, store.Config{}); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected vectors without text to leave the score at %f, got %f", want, got)
+	}
+	if got := keywordScore("recomputed", 20, store.Config{KeywordMaxPostings: 1}); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected recomputed statistics to leave the score at %f, got %f", want, got)
+	}
+
+	// Counted as documents of length 0 they change the corpus statistics
+	if got := keywordScore("counted", 20, store.Config{KeywordCountEmpty: true}); math.Abs(got-want) < 1e-9 {
+		t.Errorf("Expected counting vectors without text to change the score, got %f", got)
+	}
+}
+
+func BenchmarkBoltStore_HybridSearchKeywordStats(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	texts := randomTexts(rng, 10000, 50, 5000)
+	ctx := context.Background()
+
+	// A bound of one posting falls back to recomputing the statistics
+	for name, maxPostings := range map[string]int{"incremental": 0, "recompute": 1} {
+		b.Run(name, func(b *testing.B) {
+			dbPath := "test_bench_keyword_" + name + ".db"
+			defer os.Remove(dbPath)
+
+			benchStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, KeywordMaxPostings: maxPostings})
+			if err != nil {
+				b.Fatalf("Failed to create store: %v", err)
+			}
+			defer benchStore.Close()
+			for i, text := range texts {
+				if err := benchStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: []float64{1, 0}, Text: text}); err != nil {
+					b.Fatalf("Failed to insert vector: %v", err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := benchStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "word1 word2", AllowKeywordOnly: true}); err != nil {
+					b.Fatalf("Hybrid search failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestBoltStore_NormalizeMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	for _, normalize := range []bool{false, true} {
+		t.Run(fmt.Sprintf("normalize=%v", normalize), func(t *testing.T) {
+			testStore := newTestStore(t, store.Config{NormalizeMetadata: normalize, PreserveOriginalMetadata: true})
+			v := &models.Vector{ID: "a", Vector: []float64{1, 0}, Metadata: models.Metadata{"Topic": "AI "}}
+			if err := testStore.InsertVector(ctx, v); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+
+			result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, Filter: models.Metadata{"topic": "ai"}})
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if matched := result.Total == 1; matched != normalize {
+				t.Errorf("Expected \"AI \" to match \"ai\" only when normalizing, got %d results", result.Total)
+			}
+
+			stored, _ := testStore.GetVector(ctx, "a")
+			if !normalize {
+				if stored.Metadata["Topic"] != "AI " || stored.OriginalMetadata != nil {
+					t.Errorf("Expected metadata to be stored as written, got %v and %v", stored.Metadata, stored.OriginalMetadata)
+				}
+				return
+			}
+			if stored.Metadata["topic"] != "ai" || stored.OriginalMetadata["Topic"] != "AI " {
+				t.Errorf("Expected normalized metadata with the original preserved, got %v and %v", stored.Metadata, stored.OriginalMetadata)
+			}
+		})
+	}
+}
+
+func TestBoltStore_NormalizeMetadataOnLoad(t *testing.T) {
+	ctx := context.Background()
+	testStore := newTestStore(t, store.Config{})
+	for id, topic := range map[string]string{"a": "AI ", "b": "ai"} {
+		v := &models.Vector{ID: id, Vector: []float64{1, 0}, Metadata: models.Metadata{"Topic": topic}}
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	dbPath := "test_" + t.Name() + ".db"
+	testStore.Close()
+
+	// Vectors written before normalization was enabled are normalized as
+	// they are loaded
+	reopened, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, NormalizeMetadata: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+
+	result, err := reopened.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, Filter: models.Metadata{"TOPIC": "Ai"}, GroupBy: "Topic", GroupSize: 2})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if result.Total != 2 {
+		t.Errorf("Expected both vectors to match the filter, got %d", result.Total)
+	}
+	if len(result.Groups) != 1 || len(result.Groups["ai"]) != 2 {
+		t.Errorf("Expected both vectors grouped under ai, got %v", result.Groups)
+	}
+
+	ids, err := reopened.IndexPostings(ctx, "Topic", " AI")
+	if err != nil || !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Errorf("Expected index lookups to be normalized, got %v (%v)", ids, err)
+	}
+}
+
+func TestBoltStore_SearchNamedVectors(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for _, v := range []*models.Vector{
+		{ID: "doc", Vector: []float64{1, 0}, NamedVectors: map[string][]float64{"title": {0, 1}, "summary": {0.6, 0.8}}},
+		{ID: "other", Vector: []float64{0.6, 0.8}},
+	} {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	tests := []struct {
+		target  string
+		pooling string
+		want    []string
+		scores  []float64
+	}{
+		{"", "", []string{"other", "doc"}, []float64{0.8, 0}},
+		{"title", "", []string{"doc"}, []float64{1}},
+		{"", models.PoolingMax, []string{"doc", "other"}, []float64{1, 0.8}},
+		{"", models.PoolingMean, []string{"other", "doc"}, []float64{0.8, 0.6}},
+	}
+	for _, tt := range tests {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{
+			Query:   []float64{0, 1},
+			Target:  tt.target,
+			Pooling: tt.pooling,
+
+			ScoreNormalization: models.NormalizationRaw,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(result.Results) != len(tt.want) {
+			t.Fatalf("Expected %v with target %q and pooling %q, got %v", tt.want, tt.target, tt.pooling, result.Results)
+		}
+		for i, r := range result.Results {
+			if math.Abs(r.Score-tt.scores[i]) > 1e-9 || r.Vector.ID != tt.want[i] {
+				t.Errorf("Expected %s scoring %v at %d with target %q and pooling %q, got %s %v",
+					tt.want[i], tt.scores[i], i, tt.target, tt.pooling, r.Vector.ID, r.Score)
+			}
+		}
+	}
+
+	if _, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{0, 1}, Target: "title", Pooling: models.PoolingMax}); err == nil {
+		t.Error("Expected combining a target with pooling to fail")
+	}
+}
+
+func TestBoltStore_SearchNormalizeQuery(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for _, v := range []*models.Vector{
+		{ID: "a", Vector: []float64{1, 0}},
+		{ID: "b", Vector: []float64{0.6, 0.8}},
+		{ID: "c", Vector: []float64{-0.8, 0.6}},
+	} {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	search := func(metric string, normalize bool) []models.SearchResult {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{
+			Query:          []float64{3, 4},
+			Metric:         metric,
+			NormalizeQuery: normalize,
+
+			ScoreNormalization: models.NormalizationRaw,
+		})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		return result.Results
+	}
+
+	cosine := search(models.MetricCosine, false)
+	if raw := search(models.MetricDot, false); math.Abs(raw[0].Score-5) > 1e-9 {
+		t.Errorf("Expected the raw query's dot product to scale with its length, got %v", raw[0].Score)
+	}
+	dot := search(models.MetricDot, true)
+	for i := range cosine {
+		if dot[i].Vector.ID != cosine[i].Vector.ID || math.Abs(dot[i].Score-cosine[i].Score) > 1e-9 {
+			t.Errorf("Expected %s scoring %v at %d like cosine, got %s %v", cosine[i].Vector.ID, cosine[i].Score, i, dot[i].Vector.ID, dot[i].Score)
+		}
+	}
+}
+
+func TestBoltStore_MigrateOldRecords(t *testing.T) {
+	cleanupAllTestDBs(t)
+	dbPath := "test_migrate.db"
+	cleanupTestDB(t, dbPath)
+
+	// Create a database as written before schema versioning, with numeric
+	// metadata and no update timestamps
+	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("vectors"))
+		if err != nil {
+			return err
+		}
+		// Enough records for the migration to take several batches
+		for i := 0; i < 2500; i++ {
+			id := fmt.Sprintf("filler-%04d", i)
+			if err := bucket.Put([]byte(id), []byte(`{"id": "`+id+`", "vector": [0, 1]}`)); err != nil {
+				return err
+			}
+		}
+		return bucket.Put([]byte("old"), []byte(`{"id": "old", "vector": [1, 0], "metadata": {"year": 2020, "draft": false}, "created_at": "2020-01-01T00:00:00Z"}`))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to write old database: %v", err)
+	}
+
+	// Without automatic migration the database can't be opened
+	if s, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, ManualMigration: true}); err == nil {
+		s.Close()
+		t.Fatal("Expected opening an old database without migration to fail")
+	}
+
+	testStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to migrate old database: %v", err)
+	}
+	vector, err := testStore.GetVector(context.Background(), "old")
+	if err != nil {
+		t.Fatalf("Expected migrated vector to load, got %v", err)
+	}
+	createdAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !vector.CreatedAt.Equal(createdAt) || !vector.UpdatedAt.Equal(createdAt) {
+		t.Errorf("Expected updated_at backfilled from created_at, got %v and %v", vector.CreatedAt, vector.UpdatedAt)
+	}
+	filler, err := testStore.GetVector(context.Background(), "filler-2499")
+	if err != nil || filler.CreatedAt.IsZero() {
+		t.Errorf("Expected every batch migrated, got %+v (%v)", filler, err)
+	}
+	testStore.Close()
+
+	readRecord := func() (record, version []byte) {
+		db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: time.Second, ReadOnly: true})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		db.View(func(tx *bbolt.Tx) error {
+			record = append(record, tx.Bucket([]byte("vectors")).Get([]byte("old"))...)
+			if meta := tx.Bucket([]byte("meta")); meta != nil {
+				version = append(version, meta.Get([]byte("schema_version"))...)
+			}
+			return nil
+		})
+		return record, version
+	}
+
+	record, version := readRecord()
+	if !bytes.Contains(record, []byte(`"year":2020`)) || !bytes.Contains(record, []byte(`"draft":false`)) {
+		t.Errorf("Expected metadata stored with its JSON types, got %s", record)
+	}
+	if !bytes.Contains(record, []byte(`"updated_at":"2020-01-01T00:00:00Z"`)) {
+		t.Errorf("Expected updated_at stored, got %s", record)
+	}
+	if string(version) != "1" {
+		t.Errorf("Expected schema version 1 stored, got %q", version)
+	}
+
+	// Migration is idempotent: reopening leaves the record untouched, even
+	// without automatic migration
+	testStore, err = store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second, ManualMigration: true})
+	if err != nil {
+		t.Fatalf("Failed to reopen migrated database: %v", err)
+	}
+	testStore.Close()
+	if again, _ := readRecord(); !bytes.Equal(again, record) {
+		t.Errorf("Expected record unchanged on reopen, got %s", again)
+	}
+}
+
+func TestBoltStore_FailedOpenLeavesCallerDB(t *testing.T) {
+	dbPath := "test_failed_open_caller_db.db"
+	cleanupTestDB(t, dbPath)
+	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// A record from before schema versioning needs a migration
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("vectors"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("old"), []byte(`{"id": "old", "vector": [1, 0]}`))
+	})
+	if err != nil {
+		t.Fatalf("Failed to write old record: %v", err)
+	}
+
+	if s, err := store.NewBoltStore(store.Config{DB: db, ManualMigration: true}); err == nil {
+		s.Close()
+		t.Fatal("Expected opening the store without migration to fail")
+	}
+
+	// The caller's database is still open and usable
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("vectors")).Put([]byte("new"), []byte(`{"id": "new", "vector": [0, 1]}`))
+	})
+	if err != nil {
+		t.Errorf("Expected the caller's database to stay open, got %v", err)
+	}
+}
+
+func TestBoltStore_ReadThrough(t *testing.T) {
+	ctx := context.Background()
+
+	// The store shares its database, so records can be written behind it
+	open := func(readThrough bool) (store.Store, *bbolt.DB) {
+		dbPath := fmt.Sprintf("test_read_through_%v.db", readThrough)
+		cleanupTestDB(t, dbPath)
+		db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		testStore := newTestStore(t, store.Config{DBPath: dbPath, DB: db, ReadThrough: readThrough})
+		return testStore, db
+	}
+	writeBehind := func(db *bbolt.DB, vector *models.Vector) {
+		data, _ := json.Marshal(vector)
+		err := db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket([]byte("vectors")).Put([]byte(vector.ID), data)
+		})
+		if err != nil {
+			t.Fatalf("Failed to write behind the store: %v", err)
+		}
+	}
+
+	testStore, db := open(true)
+	writeBehind(db, &models.Vector{ID: "missed", Vector: []float64{1, 0}, Metadata: models.Metadata{"source": "disk"}})
+	deletedAt := time.Now()
+	writeBehind(db, &models.Vector{ID: "tombstone", Vector: []float64{1, 0}, DeletedAt: &deletedAt})
+
+	vector, err := testStore.GetVector(ctx, "missed")
+	if err != nil {
+		t.Fatalf("Expected the vector to be read through, got %v", err)
+	}
+	if !reflect.DeepEqual(vector.Vector, []float64{1, 0}) || vector.Metadata["source"] != "disk" {
+		t.Errorf("Expected the vector as stored, got %+v", vector)
+	}
+
+	// Once read through it is cached and indexed
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, Filter: models.Metadata{"source": "disk"}})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if result.Total != 1 || result.Results[0].Vector.ID != "missed" {
+		t.Errorf("Expected the reconciled vector to be searchable, got %+v", result.Results)
+	}
+
+	if _, err := testStore.GetVector(ctx, "tombstone"); err != errors.ErrVectorNotFound {
+		t.Errorf("Expected deleted vectors to stay not found, got %v", err)
+	}
+	if _, err := testStore.GetVector(ctx, "absent"); err != errors.ErrVectorNotFound {
+		t.Errorf("Expected vectors on neither to be not found, got %v", err)
+	}
+
+	// The shared database stays the caller's to close
+	if _, err := testStore.Defragment(ctx); err != store.ErrSharedDB {
+		t.Errorf("Expected a shared database not to be defragmented, got %v", err)
+	}
+	testStore.Close()
+	if err := db.View(func(tx *bbolt.Tx) error { return nil }); err != nil {
+		t.Errorf("Expected the shared database to stay open, got %v", err)
+	}
+
+	// Without read-through the cache is authoritative
+	testStore, db = open(false)
+	writeBehind(db, &models.Vector{ID: "missed", Vector: []float64{1, 0}})
+	if _, err := testStore.GetVector(ctx, "missed"); err != errors.ErrVectorNotFound {
+		t.Errorf("Expected vectors missing from memory to be not found, got %v", err)
+	}
+}
+
+func TestBoltStore_FailedWriteLeavesCacheUnchanged(t *testing.T) {
+	// Keep the database file so writes can be made to fail, as they do when
+	// the disk is full. Reads go through the mmap and keep working.
+	var file *os.File
+	testStore := newTestStore(t, store.Config{
+		OpenFile: func(name string, flag int, perm os.FileMode) (*os.File, error) {
+			f, err := os.OpenFile(name, flag, perm)
+			file = f
+			return f, err
+		},
+	})
+	ctx := context.Background()
+
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "v1", Vector: []float64{1, 0}, Metadata: models.Metadata{"color": "red"}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	file.Close()
+
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "v2", Vector: []float64{0, 1}}); err == nil {
+		t.Fatal("Expected insert to fail")
+	}
+	if _, err := testStore.GetVector(ctx, "v2"); err != errors.ErrVectorNotFound {
+		t.Errorf("Expected failed insert to leave no vector, got %v", err)
+	}
+
+	if err := testStore.UpdateVector(ctx, "v1", &models.Vector{Vector: []float64{0, 1}, Metadata: models.Metadata{"color": "blue"}}); err == nil {
+		t.Fatal("Expected update to fail")
+	}
+	vector, err := testStore.GetVector(ctx, "v1")
+	if err != nil || vector.Vector[0] != 1 || vector.Metadata["color"] != "red" {
+		t.Errorf("Expected failed update to leave the vector unchanged, got %+v (%v)", vector, err)
+	}
+
+	// The metadata index still holds the vector as persisted
+	for color, want := range map[string]int{"red": 1, "blue": 0} {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 10, Filter: map[string]string{"color": color}})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(result.Results) != want {
+			t.Errorf("Expected %d results for color %s, got %d", want, color, len(result.Results))
+		}
+	}
+}
+
+func TestBoltStore_DocumentRoundTrip(t *testing.T) {
+	dbPath := "test_document_round_trip.db"
+	testStore := newTestStore(t, store.Config{DBPath: dbPath})
+	ctx := context.Background()
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	doc := &models.Document{ID: "d1", Title: "Title", Content: "Content", Tags: []string{"a", "b"}, ExpiresAt: &expiresAt}
+	if err := testStore.InsertDocument(ctx, doc); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if doc.CreatedAt.IsZero() || !doc.UpdatedAt.Equal(doc.CreatedAt) {
+		t.Fatalf("Expected matching timestamps on insert, got %v and %v", doc.CreatedAt, doc.UpdatedAt)
+	}
+
+	// Every field survives a restart
+	testStore.Close()
+	testStore, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer testStore.Close()
+
+	got, err := testStore.GetDocument(ctx, "d1")
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if got.ID != doc.ID || got.Title != doc.Title || got.Content != doc.Content || !reflect.DeepEqual(got.Tags, doc.Tags) ||
+		!got.CreatedAt.Equal(doc.CreatedAt) || !got.UpdatedAt.Equal(doc.UpdatedAt) || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Expected %+v after a restart, got %+v", doc, got)
+	}
+
+	// Updates keep created_at and advance updated_at
+	if _, err := testStore.UpdateDocument(ctx, "d1", &models.UpdateDocumentRequest{Title: "New", Content: "Content"}); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+	got, err = testStore.GetDocument(ctx, "d1")
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if !got.CreatedAt.Equal(doc.CreatedAt) || !got.UpdatedAt.After(doc.UpdatedAt) {
+		t.Errorf("Expected created_at %v kept and updated_at past %v, got %v and %v", doc.CreatedAt, doc.UpdatedAt, got.CreatedAt, got.UpdatedAt)
+	}
+}
+
+func TestBoltStore_ConcurrentDocumentInserts(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("doc%d", i)
+		var inserted, conflicts atomic.Int32
+		var wg sync.WaitGroup
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				switch err := testStore.InsertDocument(ctx, &models.Document{ID: id, Content: "racing"}); err {
+				case nil:
+					inserted.Add(1)
+				case errors.ErrDocumentExists:
+					conflicts.Add(1)
+				default:
+					t.Errorf("Unexpected insert error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if inserted.Load() != 1 || conflicts.Load() != 1 {
+			t.Errorf("Expected exactly one of two racing inserts of %s to succeed, got %d inserted and %d conflicts", id, inserted.Load(), conflicts.Load())
+		}
+	}
+
+	stats, err := testStore.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Documents != 20 {
+		t.Errorf("Expected 20 documents counted, got %d", stats.Documents)
+	}
+}
+
+func TestBoltStore_SearchGroupBy(t *testing.T) {
+	testStore := newTestStore(t, store.Config{MaxSearchGroups: 2})
+	ctx := context.Background()
+
+	vectors := []*models.Vector{
+		{ID: "shoe1", Vector: []float64{1, 0.1}, Metadata: models.Metadata{"category": "shoes"}},
+		{ID: "shoe2", Vector: []float64{1, 0.3}, Metadata: models.Metadata{"category": "shoes"}},
+		{ID: "shoe3", Vector: []float64{1, 0.5}, Metadata: models.Metadata{"category": "shoes"}},
+		{ID: "hat1", Vector: []float64{1, 0.2}, Metadata: models.Metadata{"category": "hats"}},
+		{ID: "hat2", Vector: []float64{1, 0.9}, Metadata: models.Metadata{"category": "hats"}},
+		{ID: "bag1", Vector: []float64{0, 1}, Metadata: models.Metadata{"category": "bags"}},
+		{ID: "plain", Vector: []float64{1, 0}},
+	}
+	for _, vector := range vectors {
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	ids := func(results []models.SearchResult) []string {
+		var ids []string
+		for _, result := range results {
+			ids = append(ids, result.Vector.ID)
+		}
+		return ids
+	}
+
+	// Groups aren't cut to top_k, and the worst-ranked group is past the limit
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 1, GroupBy: "category", GroupSize: 2})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	want := map[string][]string{"shoes": {"shoe1", "shoe2"}, "hats": {"hat1", "hat2"}}
+	if len(result.Groups) != len(want) {
+		t.Fatalf("Expected groups %v, got %v", want, result.Groups)
+	}
+	for group, wantIDs := range want {
+		if got := ids(result.Groups[group]); !reflect.DeepEqual(got, wantIDs) {
+			t.Errorf("Expected group %s to hold %v, got %v", group, wantIDs, got)
+		}
+	}
+	if !result.GroupsCapped {
+		t.Error("Expected groups past the limit to be reported")
+	}
+	if got := ids(result.Results); !reflect.DeepEqual(got, []string{"plain"}) {
+		t.Errorf("Expected results to keep the top_k cut, got %v", got)
+	}
+
+	// The top result per group by default
+	result, err = testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 10, GroupBy: "category", Filter: models.Metadata{"category": "shoes"}})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if got := ids(result.Groups["shoes"]); len(result.Groups) != 1 || !reflect.DeepEqual(got, []string{"shoe1"}) {
+		t.Errorf("Expected the best shoe only, got %v", result.Groups)
+	}
+}
+
+func TestBoltStore_SearchGapCutoff(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	// Three close matches, then a cliff
+	vectors := map[string][]float64{
+		"a": {1, 0},
+		"b": {1, 0.05},
+		"c": {1, 0.1},
+		"d": {0.2, 1},
+		"e": {0.1, 1},
+		"f": {0.05, 1},
+	}
+	for id, values := range vectors {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: values}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	search := func(req *models.SearchRequest) *models.SearchResponse {
+		t.Helper()
+		req.Query = []float64{1, 0}
+		result, err := testStore.SearchVectors(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		return result
+	}
+	gap := func(g float64) *float64 { return &g }
+
+	result := search(&models.SearchRequest{TopK: 10, GapCutoff: gap(0.1)})
+	if result.Total != 3 || !result.GapCut {
+		t.Errorf("Expected the cut at the cliff after 3 results, got %d (gap cut %v)", result.Total, result.GapCut)
+	}
+
+	// min_k keeps results past the cliff, the widest gap after it wins
+	result = search(&models.SearchRequest{TopK: 10, GapCutoff: gap(0), MinK: 4})
+	if result.Total != 4 || !result.GapCut {
+		t.Errorf("Expected 4 results with min_k 4, got %d", result.Total)
+	}
+
+	// max_k bounds the results when the cliff is past it
+	result = search(&models.SearchRequest{TopK: 10, GapCutoff: gap(0.1), MaxK: 2})
+	if result.Total != 2 || result.GapCut {
+		t.Errorf("Expected max_k to keep 2 results without a gap cut, got %d (gap cut %v)", result.Total, result.GapCut)
+	}
+
+	// No gap is wide enough
+	result = search(&models.SearchRequest{TopK: 5, GapCutoff: gap(0.9)})
+	if result.Total != 5 || result.GapCut {
+		t.Errorf("Expected top_k results when no gap is wide enough, got %d", result.Total)
+	}
+
+	if _, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, GapCutoff: gap(0.1), MinK: 5, MaxK: 2}); err == nil {
+		t.Error("Expected min_k above max_k to be rejected")
+	}
+}
+
+func TestBoltStore_PQCacheReadsMissesFromDisk(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	vectors := randomVectors(rng, 40, 8)
+	ctx := context.Background()
+
+	testStore := newTestStore(t, store.Config{
+		Quantization: store.QuantizationPQ,
+		PQSubspaces:  4,
+		PQCentroids:  4,
+		PQTrainSize:  20,
+		PQCacheSize:  2,
+	})
+	for _, v := range vectors {
+		copied := *v
+		if err := testStore.InsertVector(ctx, &copied); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	waitQuantized(t, testStore, len(vectors))
+
+	diskReads := func() int64 {
+		stats, err := testStore.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		return stats.DiskReads
+	}
+	get := func(v *models.Vector) {
+		t.Helper()
+		got, err := testStore.GetVector(ctx, v.ID)
+		if err != nil {
+			t.Fatalf("Failed to get vector %s: %v", v.ID, err)
+		}
+		if !reflect.DeepEqual(got.Vector, v.Vector) {
+			t.Errorf("Expected %s to have its full-precision values, got %v", v.ID, got.Vector)
+		}
+	}
+
+	// A miss reads the vector from disk, a hit doesn't
+	before := diskReads()
+	get(vectors[0])
+	get(vectors[0])
+	if reads := diskReads() - before; reads != 1 {
+		t.Errorf("Expected 1 disk read for a miss then a hit, got %d", reads)
+	}
+
+	// Reading two more vectors evicts the least recently used
+	get(vectors[1])
+	get(vectors[2])
+	before = diskReads()
+	get(vectors[0])
+	if reads := diskReads() - before; reads != 1 {
+		t.Errorf("Expected the evicted vector to be read from disk, got %d reads", reads)
+	}
+
+	// Writes drop cached values
+	values := append([]float64(nil), vectors[1].Vector...)
+	values[0] += 1
+	if err := testStore.UpdateVector(ctx, vectors[1].ID, &models.Vector{Vector: values}); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	get(&models.Vector{ID: vectors[1].ID, Vector: values})
+
+	if err := testStore.DeleteVector(ctx, vectors[0].ID); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if _, err := testStore.GetVector(ctx, vectors[0].ID); err != errors.ErrVectorNotFound {
+		t.Errorf("Expected deleted vector not found despite being cached, got %v", err)
+	}
+}
+
+func TestBoltStore_SearchReturnCluster(t *testing.T) {
+	testStore := newTestStore(t, store.Config{ClusterCount: 2, ClusterLabelKey: "topic"})
+	ctx := context.Background()
+
+	// Two tight groups, one of them with a mislabelled vector
+	rng := rand.New(rand.NewSource(5))
+	for i := 0; i < 20; i++ {
+		center, topic := []float64{1, 0, 0}, "sports"
+		if i%2 == 1 {
+			center, topic = []float64{0, 1, 0}, "cooking"
+		}
+		if i == 19 {
+			topic = "sports"
+		}
+		values := make([]float64, len(center))
+		for d := range center {
+			values[d] = center[d] + rng.Float64()*0.1
+		}
+		vector := &models.Vector{ID: fmt.Sprintf("vec-%d", i), Vector: values, Metadata: models.Metadata{"topic": topic}}
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	search := func(query []float64) *models.QueryCluster {
+		t.Helper()
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: query, ReturnCluster: true})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		return result.Cluster
+	}
+
+	// The first search asking for a cluster starts fitting them in the
+	// background and gets none
+	if got := search([]float64{0.9, 0.05, 0}); got != nil {
+		t.Errorf("Expected no cluster before they are fitted, got %+v", got)
+	}
+	sports := search([]float64{0.9, 0.05, 0})
+	for deadline := time.Now().Add(5 * time.Second); sports == nil && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+		sports = search([]float64{0.9, 0.05, 0})
+	}
+	cooking := search([]float64{0.05, 0.9, 0.02})
+	if sports == nil || cooking == nil {
+		t.Fatalf("Expected clusters, got %v and %v", sports, cooking)
+	}
+	if sports.Label != "sports" || cooking.Label != "cooking" || sports.ID == cooking.ID {
+		t.Errorf("Expected distinct sports and cooking clusters, got %+v and %+v", sports, cooking)
+	}
+	if sports.Size != 10 || cooking.Size != 10 || sports.Similarity < 0.9 {
+		t.Errorf("Expected clusters of 10 close to their queries, got %+v and %+v", sports, cooking)
+	}
+
+	// A query near a stored vector falls in the same cluster as it
+	if got := search([]float64{1.05, 0.02, 0.03}); got == nil || got.ID != sports.ID {
+		t.Errorf("Expected cluster %d, got %+v", sports.ID, got)
+	}
+
+	// Not asked for, or of another dimension
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0, 0}})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if result.Cluster != nil {
+		t.Errorf("Expected no cluster unless asked for, got %+v", result.Cluster)
+	}
+	if got := search([]float64{1, 0}); got != nil {
+		t.Errorf("Expected no cluster for another dimension, got %+v", got)
+	}
+
+	// Fitting on demand gives the same clusters
+	fit, err := testStore.FitClusters(ctx)
+	if err != nil {
+		t.Fatalf("Failed to fit clusters: %v", err)
+	}
+	if fit.Clusters != 2 || fit.Vectors != 20 || fit.Dimension != 3 {
+		t.Errorf("Expected 2 clusters of 20 vectors of dimension 3, got %+v", fit)
+	}
+	if got := search([]float64{0.9, 0.05, 0}); got == nil || *got != *sports {
+		t.Errorf("Expected %+v after refitting, got %+v", sports, got)
+	}
+}
+
+func TestBoltStore_SearchCalibration(t *testing.T) {
+	testStore := newTestStore(t, store.Config{Calibration: store.CalibrationSigmoid, CalibrationSlope: 8, CalibrationMidpoint: 0.6})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		angle := float64(i) * math.Pi / 10
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("v%d", i), Vector: []float64{math.Cos(angle), math.Sin(angle)}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 10, ScoreNormalization: models.NormalizationRaw})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(result.Results) != 10 {
+		t.Fatalf("Expected 10 results, got %d", len(result.Results))
+	}
+	for i, r := range result.Results {
+		if r.Confidence == nil {
+			t.Fatalf("Expected a confidence on %s", r.Vector.ID)
+		}
+		want := 1 / (1 + math.Exp(-8*(r.Score-0.6)))
+		if math.Abs(*r.Confidence-want) > 1e-9 {
+			t.Errorf("Expected %s confidence %f for raw score %f, got %f", r.Vector.ID, want, r.Score, *r.Confidence)
+		}
+		// Results are ranked by raw score, so confidences must fall with them
+		if i > 0 && *r.Confidence >= *result.Results[i-1].Confidence {
+			t.Errorf("Expected confidence to fall with the raw score, got %f after %f", *r.Confidence, *result.Results[i-1].Confidence)
+		}
+	}
+
+	// Calibration is independent of the normalization of the returned scores
+	unit, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 10, ScoreNormalization: models.NormalizationUnit})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	for i := range unit.Results {
+		if *unit.Results[i].Confidence != *result.Results[i].Confidence {
+			t.Errorf("Expected the same confidence whatever the normalization, got %f and %f", *unit.Results[i].Confidence, *result.Results[i].Confidence)
+		}
+	}
+
+	if _, err := store.NewBoltStore(store.Config{DBPath: "test_calibration_invalid.db", Calibration: "isotonic"}); err == nil {
+		t.Error("Expected an unknown calibration to be rejected")
+	}
+}
+
+func TestBoltStore_BlendedSearch(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	// Each vector wins on one component
+	vectors := []*models.Vector{
+		{ID: "vector", Vector: []float64{1, 0}, Text: "unrelated words"},
+		{ID: "keyword", Vector: []float64{-1, 0}, Text: "apple apple apple"},
+		{ID: "fuzzy", Vector: []float64{-1, 0}, Text: "aple orang"},
+		{ID: "metadata", Vector: []float64{-1, 0}, Text: "nothing here", Metadata: models.Metadata{"color": "red"}},
+	}
+	for _, vector := range vectors {
+		if err := testStore.InsertVector(ctx, vector); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	for _, dominant := range []string{"vector", "keyword", "fuzzy", "metadata"} {
+		t.Run(dominant, func(t *testing.T) {
+			weights := map[string]float64{"vector": 1, "keyword": 1, "fuzzy": 1, "metadata": 1}
+			weights[dominant] = 7
+			result, err := testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{
+				Query:          "apple orange",
+				QueryVector:    []float64{1, 0},
+				MetadataMatch:  models.Metadata{"color": "red"},
+				VectorWeight:   weights["vector"],
+				KeywordWeight:  weights["keyword"],
+				FuzzyWeight:    weights["fuzzy"],
+				MetadataWeight: weights["metadata"],
+			})
+			if err != nil {
+				t.Fatalf("Failed to search: %v", err)
+			}
+			if len(result.Results) != len(vectors) || result.Results[0].ID != dominant {
+				t.Fatalf("Expected %s to rank first, got %+v", dominant, result.Results)
+			}
+			if math.Abs(result.Weights[dominant]-0.7) > 1e-9 {
+				t.Errorf("Expected normalized weight 0.7, got %v", result.Weights)
+			}
+
+			// The blended score is the weighted sum of the components
+			for _, r := range result.Results {
+				blended := 0.0
+				for component, value := range r.Components {
+					if value < 0 || value > 1 {
+						t.Errorf("Expected %s %s component within 0..1, got %f", r.ID, component, value)
+					}
+					blended += result.Weights[component] * value
+				}
+				if math.Abs(blended-r.Score) > 1e-9 {
+					t.Errorf("Expected %s to score %f, got %f", r.ID, blended, r.Score)
+				}
+			}
+		})
+	}
+
+	if _, err := testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{Query: "apple", MetadataWeight: 1}); err == nil {
+		t.Error("Expected a weighted component without its query to be rejected")
+	}
+}
+
+func TestBoltStore_BlendedSearchFuzzyBounds(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	// One edit in a short term, a transposition (two edits) in a long one
+	for id, text := range map[string]string{"short": "cot", "long": "internatoinal"} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}, Text: text}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	fuzzy := func(query, id string, req models.BlendedSearchRequest) float64 {
+		t.Helper()
+		req.Query = query
+		req.FuzzyWeight = 1
+		result, err := testStore.BlendedSearch(ctx, &req)
+		if err != nil {
+			t.Fatalf("Blended search failed: %v", err)
+		}
+		for _, r := range result.Results {
+			if r.ID == id {
+				return r.Components["fuzzy"]
+			}
+		}
+		t.Fatalf("Expected %s in the results", id)
+		return 0
+	}
+
+	tests := []struct {
+		name      string
+		req       models.BlendedSearchRequest
+		wantShort bool
+		wantLong  bool
+	}{
+		// A ratio rejects the one edit in "cat" but accepts two in "international"
+		{"ratio", models.BlendedSearchRequest{FuzzyMinSimilarity: 0.7}, false, true},
+		{"one edit", models.BlendedSearchRequest{FuzzyMaxEdits: 1}, true, false},
+		{"two edits", models.BlendedSearchRequest{FuzzyMaxEdits: 2}, true, true},
+		{"unbounded", models.BlendedSearchRequest{}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fuzzy("cat", "short", tt.req); (got > 0) != tt.wantShort {
+				t.Errorf("Expected cat to match cot: %v, got score %f", tt.wantShort, got)
+			}
+			if got := fuzzy("international", "long", tt.req); (got > 0) != tt.wantLong {
+				t.Errorf("Expected international to match internatoinal: %v, got score %f", tt.wantLong, got)
+			}
+		})
+	}
+
+	// A matching token still scores by its similarity
+	if got := fuzzy("cat", "short", models.BlendedSearchRequest{FuzzyMaxEdits: 1}); math.Abs(got-2.0/3) > 1e-9 {
+		t.Errorf("Expected cot to score 2/3, got %f", got)
+	}
+
+	_, err := testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{Query: "cat", FuzzyWeight: 1, FuzzyMinSimilarity: 0.5, FuzzyMaxEdits: 1})
+	if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected both bounds to be rejected with 400, got %v", err)
+	}
+}
+
+func TestBoltStore_BlendedSearchFuzzyLimits(t *testing.T) {
+	ctx := context.Background()
+
+	fuzzy := func(s store.Store, req *models.BlendedSearchRequest, id string) float64 {
+		t.Helper()
+		req.FuzzyWeight = 1
+		result, err := s.BlendedSearch(ctx, req)
+		if err != nil {
+			t.Fatalf("Blended search failed: %v", err)
+		}
+		for _, r := range result.Results {
+			if r.ID == id {
+				return r.Components["fuzzy"]
+			}
+		}
+		t.Fatalf("Expected %s in the results", id)
+		return 0
+	}
+
+	// cabin is 3 edits from cat, a similarity of 0.4
+	testStore := newTestStore(t, store.Config{FuzzyMinSimilarity: 0.5})
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "a", Vector: []float64{1, 0}, Text: "cabin"}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if got := fuzzy(testStore, &models.BlendedSearchRequest{Query: "cat"}, "a"); got != 0 {
+		t.Errorf("Expected the configured bound to apply by default, got score %f", got)
+	}
+	if got := fuzzy(testStore, &models.BlendedSearchRequest{Query: "cat", FuzzyMinSimilarity: 0.01}, "a"); got != 0 {
+		t.Errorf("Expected a too low bound to be raised to the configured one, got score %f", got)
+	}
+	if got := fuzzy(testStore, &models.BlendedSearchRequest{Query: "cabins", FuzzyMinSimilarity: 0.8}, "a"); got == 0 {
+		t.Error("Expected a higher bound of the request to apply")
+	}
+
+	// A large document compares the query to no more than the cap
+	testStore = newTestStore(t, store.Config{DBPath: "test_fuzzy_cap.db", FuzzyMaxComparisons: 100})
+	tokens := make([]string, 0, 50001)
+	for i := 0; i < 50000; i++ {
+		tokens = append(tokens, fmt.Sprintf("tok%d", i))
+	}
+	tokens = append(tokens, "needle")
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "large", Vector: []float64{1, 0}, Text: strings.Join(tokens, " ")}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if got := fuzzy(testStore, &models.BlendedSearchRequest{Query: "needle"}, "large"); got == 1 {
+		t.Error("Expected tokens past the comparison cap to match nothing")
+	}
+
+	if _, err := store.NewBoltStore(store.Config{DBPath: "test_fuzzy_invalid.db", Timeout: time.Second, FuzzyMinSimilarity: 2}); err == nil {
+		t.Error("Expected a similarity bound past 1 to be rejected")
+	}
+}
+
+func TestBoltStore_SignedCursors(t *testing.T) {
+	testStore := newTestStore(t, store.Config{CursorSecret: "secret"})
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}, Metadata: models.Metadata{"id": id}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	page, err := testStore.ListChanges(ctx, time.Time{}, "", 1)
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("Expected a first page with a cursor, got %+v (%v)", page, err)
+	}
+
+	// A valid cursor resumes after the first page
+	next, err := testStore.ListChanges(ctx, time.Time{}, page.NextCursor, 10)
+	if err != nil {
+		t.Fatalf("Failed to resume from cursor: %v", err)
+	}
+	if len(next.Changes) != 2 || next.Changes[0].ID == page.Changes[0].ID {
+		t.Errorf("Expected the 2 remaining changes, got %v", next.Changes)
+	}
+
+	// Flipping any byte of the cursor invalidates it
+	for i := range page.NextCursor {
+		tampered := []byte(page.NextCursor)
+		tampered[i] ^= 1
+		if _, err := testStore.ListChanges(ctx, time.Time{}, string(tampered), 10); err != store.ErrInvalidCursor {
+			t.Fatalf("Expected cursor modified at %d to be rejected as invalid, got %v", i, err)
+		}
+	}
+
+	// Cursors are bound to their listing and their store's secret
+	export, err := testStore.ExportIndex(ctx, "", 1, false)
+	if err != nil || export.NextCursor == "" {
+		t.Fatalf("Expected an index page with a cursor, got %+v (%v)", export, err)
+	}
+	if _, err := testStore.ListChanges(ctx, time.Time{}, export.NextCursor, 10); err != store.ErrInvalidCursor {
+		t.Errorf("Expected an index cursor to be rejected by changes, got %v", err)
+	}
+	t.Run("other secret", func(t *testing.T) {
+		other := newTestStore(t, store.Config{CursorSecret: "other"})
+		if _, err := other.ListChanges(ctx, time.Time{}, page.NextCursor, 10); err != store.ErrInvalidCursor {
+			t.Errorf("Expected a cursor signed with another secret to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expiring := newTestStore(t, store.Config{CursorSecret: "secret", CursorTTL: time.Nanosecond})
+		for _, id := range []string{"a", "b"} {
+			if err := expiring.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}}); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+		page, err := expiring.ListChanges(ctx, time.Time{}, "", 1)
+		if err != nil || page.NextCursor == "" {
+			t.Fatalf("Expected a first page with a cursor, got %+v (%v)", page, err)
+		}
+		time.Sleep(time.Millisecond)
+		if _, err := expiring.ListChanges(ctx, time.Time{}, page.NextCursor, 10); err != store.ErrExpiredCursor {
+			t.Errorf("Expected an expired cursor to be rejected, got %v", err)
+		}
+	})
+}
+
+func TestBoltStore_AdhocSearch(t *testing.T) {
+	testStore := newTestStore(t, store.Config{MaxAdhocVectors: 4})
+	ctx := context.Background()
+
+	req := &models.AdhocSearchRequest{
+		Query: []float64{1, 0},
+		Vectors: []models.AdhocVector{
+			{ID: "far", Vector: []float64{0, 1}},
+			{ID: "near", Vector: []float64{1, 0.1}, Metadata: models.Metadata{"kind": "a"}},
+			{ID: "mid", Vector: []float64{1, 1}, Metadata: models.Metadata{"kind": "a"}},
+			{ID: "other-dimension", Vector: []float64{1, 0, 0}},
+		},
+		TopK:               3,
+		ScoreNormalization: models.NormalizationRaw,
+	}
+	result, err := testStore.AdhocSearch(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	var ids []string
+	for _, r := range result.Results {
+		ids = append(ids, r.Vector.ID)
+	}
+	if fmt.Sprint(ids) != "[near mid far]" {
+		t.Errorf("Expected results ranked [near mid far], got %v", ids)
+	}
+	if result.Results[2].Score != 0 {
+		t.Errorf("Expected an orthogonal vector to score 0, got %f", result.Results[2].Score)
+	}
+
+	// Filters apply to the given metadata, and nothing is stored
+	req.Filter = models.Metadata{"kind": "a"}
+	if result, err = testStore.AdhocSearch(ctx, req); err != nil || result.Total != 2 {
+		t.Errorf("Expected 2 filtered results, got %+v (%v)", result, err)
+	}
+	if _, err := testStore.GetVector(ctx, "near"); err == nil {
+		t.Error("Expected ad-hoc vectors not to be stored")
+	}
+
+	req.Vectors = append(req.Vectors, models.AdhocVector{ID: "fifth", Vector: []float64{1, 0}})
+	_, err = testStore.AdhocSearch(ctx, req)
+	if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a corpus over the limit to be rejected, got %v", err)
+	}
+}
+
+func TestBoltStore_IndexFallback(t *testing.T) {
+	ctx := context.Background()
+	// One vector in a sparse region and a dense group elsewhere; the IVF
+	// index probes only the sparse cluster
+	newIndexedStore := func(t *testing.T, config store.Config) store.Store {
+		config.IndexType = store.IndexAuto
+		config.IndexThreshold = 4
+		config.IndexAlgorithm = store.IndexIVF
+		config.IndexProbes = 1
+		testStore := newTestStore(t, config)
+		vectors := map[string][]float64{
+			"sparse": {1, 0.05},
+			"dense1": {0.05, 1}, "dense2": {0.1, 1}, "dense3": {0.15, 1},
+			"dense4": {0.2, 1}, "dense5": {0.25, 1},
+		}
+		for _, id := range []string{"sparse", "dense1", "dense2", "dense3", "dense4", "dense5"} {
+			if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: vectors[id]}); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+		// Build the index over every vector rather than those stored when
+		// the background build started
+		if _, err := testStore.BuildIndex(ctx); err != nil {
+			t.Fatalf("Failed to build index: %v", err)
+		}
+		return testStore
+	}
+	search := func(t *testing.T, testStore store.Store, topK int) *models.SearchResponse {
+		t.Helper()
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: topK})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		return result
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		result := search(t, newIndexedStore(t, store.Config{}), 3)
+		if len(result.Results) != 1 || result.Fallback {
+			t.Errorf("Expected only the probed cluster without fallback, got %d results (fallback %v)", len(result.Results), result.Fallback)
+		}
+	})
+
+	t.Run("too few results", func(t *testing.T) {
+		testStore := newIndexedStore(t, store.Config{IndexFallback: true})
+		result := search(t, testStore, 3)
+		if len(result.Results) != 3 || !result.Fallback {
+			t.Fatalf("Expected the fallback to fill 3 results, got %d (fallback %v)", len(result.Results), result.Fallback)
+		}
+		for i, id := range []string{"sparse", "dense5", "dense4"} {
+			if result.Results[i].Vector.ID != id {
+				t.Errorf("Expected result %d to be %s, got %s", i, id, result.Results[i].Vector.ID)
+			}
+		}
+
+		// Searches the index recalls enough for don't fall back
+		if result := search(t, testStore, 1); result.Fallback {
+			t.Error("Expected a search recalling top_k results not to fall back")
+		}
+		// Nor do those whose results a threshold drops
+		minScore := 0.999
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 1, MinScore: &minScore, ScoreNormalization: models.NormalizationRaw})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(result.Results) != 0 || result.Fallback {
+			t.Errorf("Expected a search thresholded to nothing not to fall back, got %d results (fallback %v)", len(result.Results), result.Fallback)
+		}
+	})
+
+	t.Run("low score", func(t *testing.T) {
+		result := search(t, newIndexedStore(t, store.Config{IndexFallback: true, IndexFallbackMinScore: 0.9999}), 1)
+		if len(result.Results) != 1 || !result.Fallback {
+			t.Errorf("Expected a result scoring below the minimum to fall back, got %d results (fallback %v)", len(result.Results), result.Fallback)
+		}
+	})
+}
+
+func TestBoltStore_SearchDimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	testStore := newTestStore(t, store.Config{})
+	for id, values := range map[string][]float64{"x": {1, 0, 0}, "y": {0, 1, 0}, "xz": {1, 0, 1}} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: values}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	search := func(query []float64, policy string) *models.SearchResponse {
+		t.Helper()
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: query, OnDimensionMismatch: policy})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		query  []float64
+		policy string
+		first  string
+	}{
+		{"pad shorter query", []float64{0, 1}, models.DimensionMismatchPadZero, "y"},
+		{"truncate longer query", []float64{1, 0, 1, 0.5}, models.DimensionMismatchTruncate, "xz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := search(tt.query, tt.policy)
+			if len(result.Results) != 3 || result.Results[0].Vector.ID != tt.first {
+				t.Errorf("Expected 3 results led by %s, got %+v", tt.first, result.Results)
+			}
+		})
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		for _, policy := range []string{"", models.DimensionMismatchReject} {
+			result := search([]float64{0, 1}, policy)
+			if len(result.Results) != 0 || result.Reason != models.ReasonDimensionMismatch {
+				t.Errorf("Expected policy %q to score nothing, got %d results (reason %q)", policy, len(result.Results), result.Reason)
+			}
+		}
+	})
+
+	t.Run("policy doesn't apply", func(t *testing.T) {
+		// Padding doesn't shorten a longer query, truncating doesn't
+		// lengthen a shorter one
+		if result := search([]float64{1, 0, 1, 0.5}, models.DimensionMismatchPadZero); result.Reason != models.ReasonDimensionMismatch {
+			t.Errorf("Expected a longer query not to be padded, got reason %q", result.Reason)
+		}
+		if result := search([]float64{0, 1}, models.DimensionMismatchTruncate); result.Reason != models.ReasonDimensionMismatch {
+			t.Errorf("Expected a shorter query not to be truncated, got reason %q", result.Reason)
+		}
+	})
+
+	t.Run("store default", func(t *testing.T) {
+		padding := newTestStore(t, store.Config{OnDimensionMismatch: models.DimensionMismatchPadZero})
+		if err := padding.InsertVector(ctx, &models.Vector{ID: "x", Vector: []float64{1, 0, 0}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+		result, err := padding.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1}})
+		if err != nil || len(result.Results) != 1 {
+			t.Errorf("Expected the store's policy to pad the query, got %+v (%v)", result, err)
+		}
+	})
+
+	t.Run("follows writes", func(t *testing.T) {
+		// Once most vectors are two-dimensional queries are fitted to them
+		for _, id := range []string{"a", "b", "c", "d"} {
+			if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 1}}); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+		if result := search([]float64{1}, models.DimensionMismatchPadZero); len(result.Results) != 4 {
+			t.Errorf("Expected the query to be padded to the new common dimension, got %d results", len(result.Results))
+		}
+	})
+}
+
+func TestBoltStore_AccessStats(t *testing.T) {
+	ctx := context.Background()
+	config := store.Config{AccessStats: true}
+	testStore := newTestStore(t, config)
+	for id, values := range map[string][]float64{"a": {1, 0}, "b": {0.9, 0.1}, "c": {0, 1}} {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: values}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	// c is fetched 3 times, b returned by 2 searches and fetched once, a
+	// returned by 2 searches
+	for i := 0; i < 3; i++ {
+		if _, err := testStore.GetVector(ctx, "c"); err != nil {
+			t.Fatalf("Failed to get vector: %v", err)
+		}
+	}
+	if _, err := testStore.GetVector(ctx, "b"); err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 2}); err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+	}
+
+	popular := func(s store.Store) string {
+		t.Helper()
+		vectors, err := s.PopularVectors(ctx, 10)
+		if err != nil {
+			t.Fatalf("Failed to list popular vectors: %v", err)
+		}
+		var ranked []string
+		for _, vector := range vectors {
+			ranked = append(ranked, fmt.Sprintf("%s:%d", vector.ID, vector.Count))
+		}
+		return strings.Join(ranked, ",")
+	}
+	if got := popular(testStore); got != "b:3,c:3,a:2" {
+		t.Errorf("Expected popular vectors b:3,c:3,a:2, got %s", got)
+	}
+
+	// The boost lifts c above a, which ties with it unboosted
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{0.5, 0.5}, TopK: 3, PopularityBoost: 1})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if result.Weights["popularity"] != 1 || result.Results[0].Vector.ID != "b" || result.Results[1].Vector.ID != "c" {
+		t.Errorf("Expected boosted results b, c, a, got %+v", result.Results)
+	}
+
+	// Counts are flushed when the store is closed
+	testStore.Close()
+	config.DBPath = "test_" + t.Name() + ".db"
+	reopened, err := store.NewBoltStore(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if got := popular(reopened); got != "b:4,c:4,a:3" {
+		t.Errorf("Expected counts to survive reopening, got %s", got)
+	}
+
+	// Deleted vectors lose their counts, on disk too
+	if err := reopened.DeleteVector(ctx, "b"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if got := popular(reopened); got != "c:4,a:3" {
+		t.Errorf("Expected b's count to be dropped, got %s", got)
+	}
+	if err := reopened.InsertVector(ctx, &models.Vector{ID: "b", Vector: []float64{0.9, 0.1}}); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	reopened.Close()
+	reopened, err = store.NewBoltStore(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if got := popular(reopened); got != "c:4,a:3" {
+		t.Errorf("Expected a recreated vector to start uncounted, got %s", got)
+	}
+
+	// The boost is rejected rather than ignored without access stats
+	plain := newTestStore(t, store.Config{DBPath: "test_popularity_without_stats.db"})
+	if _, err := plain.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 3, PopularityBoost: 1}); err == nil {
+		t.Error("Expected popularity_boost to be rejected without access stats")
+	}
+}
+
+func TestBoltStore_SearchReturnPercentile(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	// 101 vectors at increasing angles from the query
+	for i := 0; i <= 100; i++ {
+		angle := float64(i) / 100 * math.Pi / 2
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("vec-%03d", i), Vector: []float64{math.Cos(angle), math.Sin(angle)}}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 10, Limit: 5, Page: 2, ReturnPercentile: true})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(result.Results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(result.Results))
+	}
+	// Percentiles rank among all 101 candidates, not the returned page
+	for i, r := range result.Results {
+		want := float64(100-5-i) / 100
+		if r.Percentile == nil || math.Abs(*r.Percentile-want) > 1e-9 {
+			t.Errorf("Expected result %d to have percentile %v, got %v", i, want, r.Percentile)
+		}
+	}
+
+	first, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 3, ReturnPercentile: true})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if p := first.Results[0].Percentile; p == nil || *p != 1 {
+		t.Errorf("Expected the top result to have percentile 1, got %v", p)
+	}
+	for i := 1; i < len(first.Results); i++ {
+		if *first.Results[i].Percentile >= *first.Results[i-1].Percentile {
+			t.Errorf("Expected percentiles to decrease with rank, got %v after %v", *first.Results[i].Percentile, *first.Results[i-1].Percentile)
+		}
+	}
+
+	// Off by default
+	plain, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 3})
+	if err != nil || plain.Results[0].Percentile != nil {
+		t.Errorf("Expected no percentile unless asked for, got %+v (%v)", plain.Results[0], err)
+	}
+}
+
+func TestBoltStore_CollectionAliasSwap(t *testing.T) {
+	testStore := newTestStore(t, store.Config{})
+	ctx := context.Background()
+
+	insert := func(collection string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			vector := &models.Vector{
+				ID:       fmt.Sprintf("%s-%d", collection, i),
+				Vector:   []float64{1, float64(i) / 10},
+				Metadata: models.Metadata{"collection": collection},
+			}
+			if err := testStore.InsertVector(ctx, vector); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+	}
+	// search returns the collections of the results of a search of the
+	// alias, and the collection the response reports
+	search := func() (map[string]bool, string) {
+		result, err := testStore.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, TopK: 100, Limit: 100, Collection: "products"})
+		if err != nil {
+			t.Errorf("Failed to search: %v", err)
+			return nil, ""
+		}
+		seen := make(map[string]bool)
+		for _, r := range result.Results {
+			seen[r.Vector.Metadata["collection"]] = true
+		}
+		return seen, result.Collection
+	}
+
+	insert("blue", 5)
+	if _, err := testStore.SetAlias(ctx, "products", "blue"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	if seen, collection := search(); len(seen) != 1 || !seen["blue"] || collection != "blue" {
+		t.Fatalf("Expected only blue results, got %v from %q", seen, collection)
+	}
+
+	// Searches run throughout building the shadow collection and swapping
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	var mixed atomic.Int64
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if seen, collection := search(); len(seen) != 1 || !seen[collection] {
+					mixed.Add(1)
+				}
+			}
+		}()
+	}
+
+	insert("green", 8)
+	alias, err := testStore.SetAlias(ctx, "products", "green")
+	if err != nil {
+		t.Fatalf("Failed to swap alias: %v", err)
+	}
+	close(stop)
+	wg.Wait()
+
+	if alias.Previous != "blue" || alias.Collection != "green" {
+		t.Errorf("Expected the alias to move from blue to green, got %+v", alias)
+	}
+	if n := mixed.Load(); n > 0 {
+		t.Errorf("Expected every search to see a single collection, %d didn't", n)
+	}
+	if seen, collection := search(); len(seen) != 1 || !seen["green"] || collection != "green" {
+		t.Errorf("Expected only green results after the swap, got %v from %q", seen, collection)
+	}
+
+	// Aliases can't chain, in either direction
+	if _, err := testStore.SetAlias(ctx, "shop", "products"); err == nil {
+		t.Error("Expected an alias pointing at an alias to be rejected")
+	}
+	if _, err := testStore.SetAlias(ctx, "green", "blue"); err == nil {
+		t.Error("Expected aliasing a collection an alias points at to be rejected")
+	}
+	if _, err := testStore.SetAlias(ctx, "shop", "shop"); err == nil {
+		t.Error("Expected an alias pointing at itself to be rejected")
+	}
+	aliases, err := testStore.ListAliases(ctx)
+	if err != nil || len(aliases) != 1 || aliases[0].Collection != "green" {
+		t.Errorf("Expected the products alias to point to green, got %+v (%v)", aliases, err)
+	}
+
+	deleted, err := testStore.DeleteAlias(ctx, "products")
+	if err != nil || deleted.Collection != "green" {
+		t.Fatalf("Expected the products alias to be deleted, got %+v (%v)", deleted, err)
+	}
+	if _, err := testStore.DeleteAlias(ctx, "products"); err == nil {
+		t.Error("Expected deleting a missing alias to fail")
+	}
+	if aliases, _ := testStore.ListAliases(ctx); len(aliases) != 0 {
+		t.Errorf("Expected no aliases left, got %+v", aliases)
+	}
+	// With the alias gone its collection can become an alias
+	if _, err := testStore.SetAlias(ctx, "green", "blue"); err != nil {
+		t.Errorf("Expected green to be aliased once nothing points at it, got %v", err)
+	}
+}
+
+func TestBoltStore_CollectionConfig(t *testing.T) {
+	ctx := context.Background()
+	dbPath := "test_collection_config.db"
+	testStore := newTestStore(t, store.Config{DBPath: dbPath})
+
+	// [3, 3] is the better match by dot product, [1, 0] by cosine
+	for _, collection := range []string{"cosine-docs", "dot-docs"} {
+		for id, vector := range map[string][]float64{"near": {1, 0}, "long": {3, 3}} {
+			err := testStore.InsertVector(ctx, &models.Vector{
+				ID:       collection + "-" + id,
+				Vector:   vector,
+				Metadata: models.Metadata{"collection": collection},
+			})
+			if err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+	}
+	if _, err := testStore.SetCollectionConfig(ctx, &models.CollectionConfig{Collection: "dot-docs", Metric: models.MetricDot, Dimension: 2}); err != nil {
+		t.Fatalf("Failed to configure collection: %v", err)
+	}
+	if _, err := testStore.SetAlias(ctx, "docs", "dot-docs"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+
+	search := func(req *models.SearchRequest) (string, string) {
+		t.Helper()
+		req.Query = []float64{1, 0}
+		result, err := testStore.SearchVectors(ctx, req)
+		if err != nil || len(result.Results) == 0 {
+			t.Fatalf("Failed to search %q: %v", req.Collection, err)
+		}
+		return result.Results[0].Vector.ID, result.Metric
+	}
+	if top, metric := search(&models.SearchRequest{Collection: "dot-docs"}); top != "dot-docs-long" || metric != models.MetricDot {
+		t.Errorf("Expected the dot-docs collection to rank by dot product, got %s by %s", top, metric)
+	}
+	if top, metric := search(&models.SearchRequest{Collection: "docs"}); top != "dot-docs-long" || metric != models.MetricDot {
+		t.Errorf("Expected the alias to use the metric of its collection, got %s by %s", top, metric)
+	}
+	if top, metric := search(&models.SearchRequest{Collection: "cosine-docs"}); top != "cosine-docs-near" || metric != models.MetricCosine {
+		t.Errorf("Expected an unconfigured collection to use the default metric, got %s by %s", top, metric)
+	}
+	// A metric given by the search wins
+	if top, _ := search(&models.SearchRequest{Collection: "dot-docs", Metric: models.MetricCosine}); top != "dot-docs-near" {
+		t.Errorf("Expected the search's own metric to override the collection's, got %s", top)
+	}
+
+	// Only vectors written to the configured collection must have its
+	// dimension
+	wrong := &models.Vector{ID: "wrong", Vector: []float64{1, 0, 0}, Metadata: models.Metadata{"collection": "dot-docs"}}
+	if err := testStore.ValidateVector(ctx, wrong); err == nil {
+		t.Error("Expected validating a vector of another dimension than its collection to fail")
+	}
+	if err := testStore.InsertVector(ctx, wrong); err == nil {
+		t.Error("Expected inserting a vector of another dimension than its collection to fail")
+	}
+	if err := testStore.UpdateVector(ctx, "dot-docs-near", &models.Vector{Vector: []float64{1}, Metadata: models.Metadata{"collection": "dot-docs"}}); err == nil {
+		t.Error("Expected updating a vector to another dimension than its collection to fail")
+	}
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "other", Vector: []float64{1, 0, 0}, Metadata: models.Metadata{"collection": "cosine-docs"}}); err != nil {
+		t.Errorf("Expected an unconfigured collection to take any dimension, got %v", err)
+	}
+
+	// Configs name collections, not aliases
+	if _, err := testStore.SetCollectionConfig(ctx, &models.CollectionConfig{Collection: "docs", Metric: models.MetricEuclidean}); err == nil {
+		t.Error("Expected configuring an alias to be rejected")
+	}
+	if _, err := testStore.SetAlias(ctx, "dot-docs", "cosine-docs"); err == nil {
+		t.Error("Expected aliasing a configured collection to be rejected")
+	}
+
+	// Configs are kept across restarts
+	testStore.Close()
+	reopened, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	configs, err := reopened.ListCollectionConfigs(ctx)
+	if err != nil || len(configs) != 1 || configs[0].Collection != "dot-docs" || configs[0].Metric != models.MetricDot || configs[0].Dimension != 2 {
+		t.Fatalf("Expected the dot-docs config to be reloaded, got %+v (%v)", configs, err)
+	}
+
+	deleted, err := reopened.DeleteCollectionConfig(ctx, "dot-docs")
+	if err != nil || deleted.Metric != models.MetricDot {
+		t.Fatalf("Expected the dot-docs config to be deleted, got %+v (%v)", deleted, err)
+	}
+	if _, err := reopened.DeleteCollectionConfig(ctx, "dot-docs"); err == nil {
+		t.Error("Expected deleting a missing config to fail")
+	}
+	result, err := reopened.SearchVectors(ctx, &models.SearchRequest{Query: []float64{1, 0}, Collection: "dot-docs"})
+	if err != nil || result.Metric != models.MetricCosine {
+		t.Errorf("Expected the collection to go back to the default metric, got %+v (%v)", result, err)
+	}
+}
+
+func TestBoltStore_ListVectorsDuringDefragment(t *testing.T) {
+	ctx := context.Background()
+	testStore := newTestStore(t, store.Config{
+		DBPath:       "test_list_defragment.db",
+		Quantization: store.QuantizationPQ,
+		PQSubspaces:  8,
+		PQCentroids:  16,
+		PQTrainSize:  200,
+	})
+	vectors := randomVectors(rand.New(rand.NewSource(11)), 300, 32)
+	for _, v := range vectors {
+		if err := testStore.InsertVector(ctx, v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	waitQuantized(t, testStore, len(vectors))
+
+	// Listing reads quantized embeddings back from disk, which must not
+	// deadlock with a defragmentation waiting to swap the database
+	done := make(chan error, 2)
+	go func() {
+		for i := 0; i < 50; i++ {
+			page, err := testStore.ListVectors(ctx, 100, 0)
+			if err != nil {
+				done <- err
+				return
+			}
+			if len(page) != 100 || len(page[0].Vector) != 32 {
+				done <- fmt.Errorf("expected 100 full vectors, got %d", len(page))
+				return
+			}
+		}
+		done <- nil
+	}()
+	go func() {
+		for i := 0; i < 5; i++ {
+			if _, err := testStore.Defragment(ctx); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Concurrent list and defragment failed: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Listing and defragmenting concurrently deadlocked")
+		}
+	}
+}
+
+func TestBoltStore_Defragment(t *testing.T) {
+	ctx := context.Background()
+	config := store.Config{DBPath: "test_defragment.db"}
+	testStore := newTestStore(t, config)
+
+	values := make([]float64, 512)
+	for i := range values {
+		values[i] = float64(i)
+	}
+	for i := 0; i < 400; i++ {
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("v%d", i), Vector: values}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	for i := 10; i < 400; i++ {
+		if err := testStore.DeleteVector(ctx, fmt.Sprintf("v%d", i)); err != nil {
+			t.Fatalf("Failed to delete vector: %v", err)
+		}
+	}
+
+	// Writes landing during the copy are kept
+	written := make(chan error, 1)
+	go func() {
+		written <- testStore.InsertVector(ctx, &models.Vector{ID: "late", Vector: values})
+	}()
+
+	result, err := testStore.Defragment(ctx)
+	if err != nil {
+		t.Fatalf("Failed to defragment: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if result.SizeAfter >= result.SizeBefore || result.Reclaimed != result.SizeBefore-result.SizeAfter {
+		t.Fatalf("Expected the file to shrink, got %+v", result)
+	}
+	info, err := os.Stat(config.DBPath)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+	if info.Size() != result.SizeAfter {
+		t.Errorf("Expected a %d byte file, got %d", result.SizeAfter, info.Size())
+	}
+
+	for _, id := range []string{"v0", "v9", "late"} {
+		if _, err := testStore.GetVector(ctx, id); err != nil {
+			t.Errorf("Failed to get vector %s after defragmenting: %v", id, err)
+		}
+	}
+	if err := testStore.InsertVector(ctx, &models.Vector{ID: "after", Vector: values}); err != nil {
+		t.Fatalf("Failed to insert vector after defragmenting: %v", err)
+	}
+	stats, err := testStore.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Defragmentations != 1 || stats.DefragReclaimedBytes != result.Reclaimed {
+		t.Errorf("Expected 1 defragmentation reclaiming %d bytes, got %+v", result.Reclaimed, stats)
+	}
+
+	// The data survives reopening the defragmented file
+	testStore.Close()
+	reopened, err := store.NewBoltStore(store.Config{DBPath: config.DBPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.GetVector(ctx, "after"); err != nil {
+		t.Errorf("Failed to get vector after reopening: %v", err)
+	}
+
+	if _, err := store.NewBoltStore(store.Config{DBPath: "test_defrag_window.db", DefragWindow: "2am-5am"}); err == nil {
+		t.Error("Expected an invalid defragmentation window to be rejected")
+	}
+}
+
+func TestBoltStore_ScheduledDefragment(t *testing.T) {
+	ctx := context.Background()
+	values := make([]float64, 512)
+	for i := range values {
+		values[i] = float64(i)
+	}
+
+	for _, minFree := range []float64{0, 0.99} {
+		t.Run(fmt.Sprintf("min_free=%v", minFree), func(t *testing.T) {
+			testStore := newTestStore(t, store.Config{DefragInterval: 10 * time.Millisecond, DefragMinFreeRatio: minFree})
+			for i := 0; i < 400; i++ {
+				if err := testStore.InsertVector(ctx, &models.Vector{ID: fmt.Sprintf("v%d", i), Vector: values}); err != nil {
+					t.Fatalf("Failed to insert vector: %v", err)
+				}
+			}
+			for i := 200; i < 400; i++ {
+				if err := testStore.DeleteVector(ctx, fmt.Sprintf("v%d", i)); err != nil {
+					t.Fatalf("Failed to delete vector: %v", err)
+				}
+			}
+
+			defrags := func() int64 {
+				stats, err := testStore.Stats(ctx)
+				if err != nil {
+					t.Fatalf("Failed to get stats: %v", err)
+				}
+				return stats.Defragmentations
+			}
+			if minFree > 0 {
+				time.Sleep(100 * time.Millisecond)
+				if n := defrags(); n != 0 {
+					t.Errorf("Expected a file with fewer free pages than required not to be defragmented, got %d", n)
+				}
+				return
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for defrags() == 0 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			// The few pages later writes free don't trigger another run
+			for i := 0; i < 3; i++ {
+				if err := testStore.UpdateVector(ctx, "v0", &models.Vector{Vector: values}); err != nil {
+					t.Fatalf("Failed to update vector: %v", err)
+				}
+			}
+			time.Sleep(100 * time.Millisecond)
+			if n := defrags(); n != 1 {
+				t.Errorf("Expected one scheduled defragmentation, got %d", n)
+			}
+		})
+	}
+}
+
+func TestBoltStore_SearchRequireWeights(t *testing.T) {
+	ctx := context.Background()
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			testStore := newTestStore(t, store.Config{RequireWeights: strict})
+			if err := testStore.InsertVector(ctx, &models.Vector{ID: "v1", Vector: []float64{1, 0}, Text: "quick brown fox"}); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+
+			searches := map[string]func(weighted bool) error{
+				"hybrid": func(weighted bool) error {
+					req := &models.HybridSearchRequest{Query: "fox", QueryVector: []float64{1, 0}}
+					if weighted {
+						req.VectorWeight = 0.7
+					}
+					result, err := testStore.HybridSearch(ctx, req)
+					if err == nil && !weighted && (result.Weights["vector"] != 0.5 || result.Weights["keyword"] != 0.5) {
+						t.Errorf("Expected equal default weights, got %v", result.Weights)
+					}
+					return err
+				},
+				"blended": func(weighted bool) error {
+					req := &models.BlendedSearchRequest{Query: "fox", QueryVector: []float64{1, 0}}
+					if weighted {
+						req.KeywordWeight = 0.3
+					}
+					_, err := testStore.BlendedSearch(ctx, req)
+					return err
+				},
+				"unified": func(weighted bool) error {
+					req := &models.UnifiedSearchRequest{Query: "fox", QueryVector: []float64{1, 0}}
+					if weighted {
+						req.DocumentsWeight = 0.2
+					}
+					_, err := testStore.UnifiedSearch(ctx, req)
+					return err
+				},
+			}
+			for name, search := range searches {
+				err := search(false)
+				if !strict && err != nil {
+					t.Errorf("%s: expected unweighted query to default to equal weights, got %v", name, err)
+				}
+				if strict {
+					appErr, ok := err.(*errors.AppError)
+					if !ok || appErr.Code != http.StatusBadRequest || !strings.Contains(appErr.Details, "weight") {
+						t.Errorf("%s: expected 400 naming the weights to set, got %v", name, err)
+					}
+				}
+				if err := search(true); err != nil {
+					t.Errorf("%s: expected weighted query to pass, got %v", name, err)
+				}
+			}
+
+			// Text alone has a single modality and needs no weights
+			if _, err := testStore.UnifiedSearch(ctx, &models.UnifiedSearchRequest{Query: "fox"}); err != nil {
+				t.Errorf("Expected text-only unified search to pass, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBoltStore_HybridSearchLongQuery(t *testing.T) {
+	ctx := context.Background()
+	// A huge query: a rare term, a term every vector has and thousands of
+	// terms no vector has
+	terms := []string{"the", "fox"}
+	for i := 0; i < 5000; i++ {
+		terms = append(terms, fmt.Sprintf("junk%d", i))
+	}
+	query := strings.Join(terms, " ")
+
+	t.Run("truncate", func(t *testing.T) {
+		testStore := newTestStore(t, store.Config{MaxQueryTerms: 1})
+		for id, text := range map[string]string{"v1": "the quick brown fox", "v2": "the lazy dog", "v3": "the sleepy cat"} {
+			if err := testStore.InsertVector(ctx, &models.Vector{ID: id, Vector: []float64{1, 0}, Text: text}); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+		}
+
+		result, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: query, QueryVector: []float64{1, 0}})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		// Only the rarest term, fox, is kept
+		if len(result.Results) != 3 || result.Results[0].ID != "v1" || result.Results[0].KeywordScore == 0 || result.Results[1].KeywordScore != 0 {
+			t.Errorf("Expected v1 to rank first on fox alone, got %+v", result.Results)
+		}
+
+		// The fuzzy component keeps the first term, the
+		blended, err := testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{Query: query, FuzzyWeight: 1})
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		for _, r := range blended.Results {
+			if r.Components["fuzzy"] != 1 {
+				t.Errorf("Expected %s to match the on the fuzzy component, got %f", r.ID, r.Components["fuzzy"])
+			}
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		testStore := newTestStore(t, store.Config{MaxQueryTerms: 100, OnLongQuery: store.LongQueryReject})
+		if err := testStore.InsertVector(ctx, &models.Vector{ID: "v1", Vector: []float64{1, 0}, Text: "the quick brown fox"}); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+
+		_, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: query, QueryVector: []float64{1, 0}})
+		if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected a 400 for a query past the term limit, got %v", err)
+		}
+		if _, err := testStore.HybridSearch(ctx, &models.HybridSearchRequest{Query: "quick fox", QueryVector: []float64{1, 0}}); err != nil {
+			t.Errorf("Expected a short query to pass, got %v", err)
+		}
+
+		// The fuzzy component follows the same policy
+		_, err = testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{Query: query, FuzzyWeight: 1})
+		if appErr, ok := err.(*errors.AppError); !ok || appErr.Code != http.StatusBadRequest {
+			t.Errorf("Expected a 400 for a fuzzy query past the term limit, got %v", err)
+		}
+		if _, err := testStore.BlendedSearch(ctx, &models.BlendedSearchRequest{Query: "quikc fox", FuzzyWeight: 1}); err != nil {
+			t.Errorf("Expected a short fuzzy query to pass, got %v", err)
+		}
+	})
+}
+
+func TestBoltStore_SearchEventsBufferedAndPruned(t *testing.T) {
+	dbPath := "test_search_events.db"
+	testStore := newTestStore(t, store.Config{DBPath: dbPath, EventFlushInterval: time.Hour, EventRetention: time.Hour})
+	ctx := context.Background()
+
+	now := time.Now()
+	for _, event := range []*models.SearchEvent{
+		{Kind: "search", Time: now.Add(-2 * time.Hour)},
+		{Kind: "search", Time: now.Add(-time.Minute)},
+		{Kind: "hybrid_search", Time: now},
+	} {
+		if err := testStore.RecordSearch(ctx, event); err != nil {
+			t.Fatalf("Failed to record search: %v", err)
+		}
+	}
+
+	// Listing writes the buffered events first, pruning the expired one
+	events, err := testStore.ListSearchEvents(ctx, time.Time{}, time.Time{}, 10)
+	if err != nil || len(events) != 2 || events[1].Kind != "hybrid_search" {
+		t.Fatalf("Expected the 2 unexpired searches, got %v %v", events, err)
+	}
+
+	// Closing flushes events buffered since
+	if err := testStore.RecordSearch(ctx, &models.SearchEvent{Kind: "blended_search", Time: now.Add(time.Second)}); err != nil {
+		t.Fatalf("Failed to record search: %v", err)
+	}
+	testStore.Close()
+	reopened, err := store.NewBoltStore(store.Config{DBPath: dbPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer reopened.Close()
+	events, err = reopened.ListSearchEvents(ctx, time.Time{}, time.Time{}, 10)
+	if err != nil || len(events) != 3 || events[2].Kind != "blended_search" {
+		t.Errorf("Expected the search recorded before closing to be kept, got %v %v", events, err)
+	}
+}